@@ -2,14 +2,21 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/cache"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/config"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/health"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/server"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/stock"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/tracing"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/weather"
 )
 
@@ -19,14 +26,64 @@ func main() {
 	log.Println("Starting Weather & Stock API service...")
 
 	// Parse command line flags
+	defaults := config.Default()
 	var (
-		host         = flag.String("host", getEnv("HOST", "localhost"), "Server host")
-		port         = flag.Int("port", getEnvInt("PORT", 3000), "Server port")
-		readTimeout  = flag.Duration("read-timeout", getEnvDuration("READ_TIMEOUT", "10s"), "HTTP read timeout")
-		writeTimeout = flag.Duration("write-timeout", getEnvDuration("WRITE_TIMEOUT", "10s"), "HTTP write timeout")
-		idleTimeout  = flag.Duration("idle-timeout", getEnvDuration("IDLE_TIMEOUT", "60s"), "HTTP idle timeout")
-		showHelp     = flag.Bool("help", false, "Show help message")
+		configPath     = flag.String("config", getEnv("CONFIG_FILE", ""), "Configuration file (JSON, or YAML for .yaml and .yml files)")
+		host           = flag.String("host", defaults.Server.Host, "Server host")
+		bindAll        = flag.Bool("bind-all", false, "Listen on all interfaces (0.0.0.0); overrides --host and HOST")
+		port           = flag.Int("port", defaults.Server.Port, "Server port")
+		adminPort      = flag.Int("admin-port", defaults.Server.AdminPort, "Port for health checks and pprof, separate from the API (0 keeps them on the main port)")
+		readTimeout    = flag.Duration("read-timeout", defaults.Server.ReadTimeout, "HTTP read timeout")
+		writeTimeout   = flag.Duration("write-timeout", defaults.Server.WriteTimeout, "HTTP write timeout")
+		idleTimeout    = flag.Duration("idle-timeout", defaults.Server.IdleTimeout, "HTTP idle timeout")
+		readyMaxAge    = flag.Duration("readiness-max-age", defaults.Server.ReadinessMaxAge, "How recent an upstream success must be for readiness, and how long failing upstreams may go without one")
+		requestTimeout = flag.Duration("request-timeout", defaults.Server.RequestTimeout, "Maximum time a request may take before a 503 is returned (0 uses the write timeout)")
+		debugEndpoints = flag.Bool("debug-endpoints", false, "Expose diagnostic endpoints such as /weather/raw")
+		prettyJSON     = flag.Bool("pretty", false, "Indent response bodies by default, for development (requests can still pass pretty=false)")
+		maxURLBytes    = flag.Int("max-url-bytes", defaults.Server.MaxURLBytes, "Longest request URL accepted before a 414 (0 disables the limit)")
+		tlsCert        = flag.String("tls-cert", "", "TLS certificate file (enables HTTPS with --tls-key)")
+		tlsKey         = flag.String("tls-key", "", "TLS private key file (enables HTTPS with --tls-cert)")
+		trustProxy     = flag.Bool("trust-proxy-headers", false, "Take the client address from X-Forwarded-For/X-Real-IP (only behind a trusted reverse proxy)")
+		maintenance    = flag.Bool("maintenance", false, "Serve only cached and demo data without calling the upstream APIs")
+		corsOrigins    = flag.String("cors-origins", "", "Comma-separated allowed CORS origins (default: any origin)")
+		stockRateLimit = flag.Duration("stock-rate-limit", defaults.Stock.RateLimit, "Minimum delay between stock upstream requests")
+		maxUpstream    = flag.Int("max-upstream-concurrency", defaults.MaxUpstreamConcurrency, "Maximum concurrent requests to each upstream API (0 removes the limit)")
+		maxRespBytes   = flag.Int("max-response-bytes", defaults.MaxResponseBytes, "Largest upstream response body read before the request fails")
+		userAgent      = flag.String("user-agent", "", "User-Agent sent to the upstream APIs (default: a per-upstream built-in value)")
+		stockURL       = flag.String("stock-base-url", defaults.Stock.BaseURL, "Yahoo Finance quote endpoint")
+		stockCacheTTL  = flag.Duration("stock-cache-ttl", defaults.Stock.CacheTTL, "How long stock quotes are served from cache (0 disables the cache)")
+		fallbackCodes  = flag.String("stock-fallback-codes", defaults.Stock.FallbackCodes, "Upstream status codes answered with demo stock data, e.g. 404,429,5xx (none disables)")
+		refreshSymbols = flag.String("stock-refresh-symbols", "", "Comma-separated stock symbols refreshed in the background to keep their quotes cached")
+		refreshEvery   = flag.Duration("stock-refresh-interval", defaults.Stock.RefreshInterval, "How often background-refreshed stock symbols are fetched")
+		stockBudget    = flag.Duration("stock-response-budget", defaults.Stock.ResponseBudget, "Serve demo data when a live stock quote is expected to take longer (0 disables)")
+		stockDecimals  = flag.Int("stock-decimals", defaults.Stock.Decimals, "Decimal places stock prices and changes are rounded to (negative keeps the upstream precision)")
+		repairSign     = flag.Bool("stock-repair-change-sign", false, "Recompute a stock's change percent when its sign disagrees with the change")
+		stockFallback  = flag.String("stock-fallback-base-url", defaults.Stock.FallbackBaseURL, "Yahoo Finance quote endpoint tried when the primary fails (empty disables failover)")
+		stockCrumb     = flag.Bool("stock-crumb-handshake", false, "Fetch a Yahoo Finance session cookie and crumb and send the crumb with quote requests")
+		companyNames   = flag.String("company-names", "", "JSON file mapping stock symbols to the company names shown in summaries")
+		allowedSymbols = flag.String("allowed-symbols", "", "Comma-separated stock symbols that can be quoted; others get a 403 (empty allows all)")
+		deniedSymbols  = flag.String("denied-symbols", "", "Comma-separated stock symbols that can never be quoted")
+		alertsFile     = flag.String("alerts-file", "", "JSON file of stock alert rules posting quotes to a webhook when their change crosses a threshold")
+		weatherURL     = flag.String("weather-base-url", defaults.Weather.BaseURL, "Open-Meteo forecast endpoint")
+		geocodeURL     = flag.String("geocode-base-url", defaults.Weather.GeocodeBaseURL, "Open-Meteo geocoding endpoint")
+		staleThreshold = flag.Duration("weather-stale-threshold", defaults.Weather.StaleThreshold, "Observation age past which weather is flagged as stale (0 disables)")
+		transliterate  = flag.Bool("transliterate-city-names", false, "Strip accents from city names sent to the geocoding API (e.g. Sao Paulo for São Paulo)")
+		cacheBackend   = flag.String("cache", defaults.Cache.Backend, "Cache backend for weather, geocoding, and stock results (memory, redis)")
+		redisAddr      = flag.String("redis-addr", "", "Redis address (host:port) for --cache=redis")
+		redisPassword  = flag.String("redis-password", "", "Redis password")
+		redisDB        = flag.Int("redis-db", 0, "Redis database number")
+		redisPrefix    = flag.String("redis-prefix", defaults.Cache.RedisKeyPrefix, "Prefix for keys written to Redis")
+		logLevel       = flag.String("log-level", defaults.LogLevel, "Minimum log level (debug, info, warn, error)")
+		tracerName     = flag.String("tracer", getEnv("TRACER", "none"), "Tracer for requests and upstream calls (none, log)")
+		enablePprof    = flag.Bool("enable-pprof", false, "Serve the Go profiler under /debug/pprof/ (unauthenticated; keep behind an authenticating proxy)")
+		showVersion    = flag.Bool("version", false, "Print version information and exit")
+		showHelp       = flag.Bool("help", false, "Show help message")
 	)
+	var trustedHeaders []string
+	flag.Func("trusted-proxy-header", "Forwarded header to take the client address from, e.g. X-Forwarded-For or CF-Connecting-IP (repeatable or comma-separated; list values use the right-most entry; only behind a trusted reverse proxy)", func(value string) error {
+		trustedHeaders = append(trustedHeaders, splitList(value)...)
+		return nil
+	})
 	flag.Parse()
 
 	if *showHelp {
@@ -34,35 +91,243 @@ func main() {
 		return
 	}
 
+	if *showVersion {
+		fmt.Println(versionString())
+		return
+	}
+
+	// Load configuration: file values are overridden by flags, and flags by env vars
+	appConfig := defaults
+	if *configPath != "" {
+		loaded, err := config.Load(*configPath)
+		if err != nil {
+			log.Fatalf("Failed to load configuration: %v", err)
+		}
+		appConfig = loaded
+		log.Printf("Loaded configuration from %s", *configPath)
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "host":
+			appConfig.Server.Host = *host
+		case "port":
+			appConfig.Server.Port = *port
+		case "admin-port":
+			appConfig.Server.AdminPort = *adminPort
+		case "read-timeout":
+			appConfig.Server.ReadTimeout = *readTimeout
+		case "write-timeout":
+			appConfig.Server.WriteTimeout = *writeTimeout
+		case "idle-timeout":
+			appConfig.Server.IdleTimeout = *idleTimeout
+		case "readiness-max-age":
+			appConfig.Server.ReadinessMaxAge = *readyMaxAge
+		case "request-timeout":
+			appConfig.Server.RequestTimeout = *requestTimeout
+		case "debug-endpoints":
+			appConfig.Server.DebugEndpoints = *debugEndpoints
+		case "pretty":
+			appConfig.Server.PrettyJSON = *prettyJSON
+		case "max-url-bytes":
+			appConfig.Server.MaxURLBytes = *maxURLBytes
+		case "tls-cert":
+			appConfig.Server.CertFile = *tlsCert
+		case "tls-key":
+			appConfig.Server.KeyFile = *tlsKey
+		case "trust-proxy-headers":
+			appConfig.Server.TrustProxyHeaders = *trustProxy
+		case "trusted-proxy-header":
+			appConfig.Server.TrustedProxyHeaders = trustedHeaders
+		case "maintenance":
+			appConfig.Server.Maintenance = *maintenance
+		case "cors-origins":
+			appConfig.Server.CORSOrigins = splitList(*corsOrigins)
+		case "stock-rate-limit":
+			appConfig.Stock.RateLimit = *stockRateLimit
+		case "max-upstream-concurrency":
+			appConfig.MaxUpstreamConcurrency = *maxUpstream
+		case "max-response-bytes":
+			appConfig.MaxResponseBytes = *maxRespBytes
+		case "user-agent":
+			appConfig.UserAgent = *userAgent
+		case "stock-base-url":
+			appConfig.Stock.BaseURL = *stockURL
+		case "stock-fallback-base-url":
+			appConfig.Stock.FallbackBaseURL = *stockFallback
+		case "stock-crumb-handshake":
+			appConfig.Stock.CrumbHandshake = *stockCrumb
+		case "stock-cache-ttl":
+			appConfig.Stock.CacheTTL = *stockCacheTTL
+		case "stock-fallback-codes":
+			appConfig.Stock.FallbackCodes = *fallbackCodes
+		case "stock-decimals":
+			appConfig.Stock.Decimals = *stockDecimals
+		case "stock-repair-change-sign":
+			appConfig.Stock.RepairChangePercentSign = *repairSign
+		case "stock-response-budget":
+			appConfig.Stock.ResponseBudget = *stockBudget
+		case "stock-refresh-symbols":
+			appConfig.Stock.RefreshSymbols = splitList(*refreshSymbols)
+		case "stock-refresh-interval":
+			appConfig.Stock.RefreshInterval = *refreshEvery
+		case "company-names":
+			appConfig.Stock.CompanyNamesFile = *companyNames
+		case "allowed-symbols":
+			appConfig.Stock.AllowedSymbols = splitList(*allowedSymbols)
+		case "denied-symbols":
+			appConfig.Stock.DeniedSymbols = splitList(*deniedSymbols)
+		case "alerts-file":
+			appConfig.Stock.AlertsFile = *alertsFile
+		case "weather-base-url":
+			appConfig.Weather.BaseURL = *weatherURL
+		case "geocode-base-url":
+			appConfig.Weather.GeocodeBaseURL = *geocodeURL
+		case "weather-stale-threshold":
+			appConfig.Weather.StaleThreshold = *staleThreshold
+		case "transliterate-city-names":
+			appConfig.Weather.TransliterateCityNames = *transliterate
+		case "cache":
+			appConfig.Cache.Backend = *cacheBackend
+		case "redis-addr":
+			appConfig.Cache.RedisAddr = *redisAddr
+		case "redis-password":
+			appConfig.Cache.RedisPassword = *redisPassword
+		case "redis-db":
+			appConfig.Cache.RedisDB = *redisDB
+		case "redis-prefix":
+			appConfig.Cache.RedisKeyPrefix = *redisPrefix
+		case "log-level":
+			appConfig.LogLevel = *logLevel
+		}
+	})
+
+	applyEnvOverrides(appConfig)
+	if *bindAll {
+		appConfig.Server.Host = server.BindAllHost
+	}
+	if err := appConfig.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Validate has already rejected unknown level names
+	level, _ := logging.ParseLevel(appConfig.LogLevel)
+	logging.SetLevel(level)
+
+	tracer, err := tracing.New(*tracerName)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
 	// Create server configuration
-	config := &server.Config{
-		Host:         *host,
-		Port:         *port,
-		ReadTimeout:  *readTimeout,
-		WriteTimeout: *writeTimeout,
-		IdleTimeout:  *idleTimeout,
+	serverConfig := &appConfig.Server
+	serverConfig.HealthTracker = health.NewTracker()
+	serverConfig.BuildInfo = server.BuildInfo{
+		Version:   Version,
+		BuildTime: BuildTime,
+		GitCommit: GitCommit,
 	}
+	serverConfig.Tracer = tracer
+	// The profiler is only ever enabled by an explicit flag, never by the
+	// config file or environment
+	serverConfig.EnablePprof = *enablePprof
 
 	// Initialize services
 	log.Println("Initializing services...")
 
-	// Create HTTP client (nil will use default)
-	var httpClient interface {
-		Get(url string) (*http.Response, error)
+	// Create the upstream HTTP clients, overriding the User-Agent if configured
+	stockHeaders := stock.DefaultHeaders()
+	if appConfig.UserAgent != "" {
+		stockHeaders.Set("User-Agent", appConfig.UserAgent)
 	}
-	// httpClient = nil // Use default HTTP client
 
 	// Initialize weather service
-	weatherService := weather.NewService(httpClient)
+	weatherService := weather.NewService(weather.NewDefaultHTTPClientWithUserAgent(appConfig.UserAgent),
+		weather.WithHealthTracker(serverConfig.HealthTracker),
+		weather.WithCache(newCache(appConfig.Cache, "weather:"), weather.DefaultCacheTTL),
+		weather.WithGeocodeCache(newCache(appConfig.Cache, "geocode:")),
+		weather.WithTracer(tracer),
+		weather.WithStaleThreshold(appConfig.Weather.StaleThreshold),
+		weather.WithMaxConcurrency(appConfig.MaxUpstreamConcurrency),
+		weather.WithMaintenance(serverConfig.Maintenance),
+		weather.WithClientOptions(
+			weather.WeatherBaseURL(appConfig.Weather.BaseURL),
+			weather.GeocodeBaseURL(appConfig.Weather.GeocodeBaseURL),
+			weather.MaxResponseBytes(appConfig.MaxResponseBytes),
+			weather.TransliterateCityNames(appConfig.Weather.TransliterateCityNames),
+		),
+	)
 	log.Println("Weather service initialized")
 
-	// Initialize stock service
-	stockService := stock.NewService(httpClient)
+	// Initialize stock service; Validate has already rejected bad fallback codes
+	stockFallbackCodes, _ := stock.ParseFallbackCodes(appConfig.Stock.FallbackCodes)
+	var companyNameOverrides map[string]string
+	if appConfig.Stock.CompanyNamesFile != "" {
+		companyNameOverrides, err = stock.LoadCompanyNames(appConfig.Stock.CompanyNamesFile)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		log.Printf("Loaded %d company name overrides from %s", len(companyNameOverrides), appConfig.Stock.CompanyNamesFile)
+	}
+	var alertRules []stock.AlertRule
+	if appConfig.Stock.AlertsFile != "" {
+		alertRules, err = stock.LoadAlertRules(appConfig.Stock.AlertsFile)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
+		}
+		log.Printf("Loaded %d stock alert rules from %s", len(alertRules), appConfig.Stock.AlertsFile)
+	}
+	stockService := stock.NewService(stock.NewDefaultHTTPClientWithHeaders(stockHeaders),
+		stock.WithHealthTracker(serverConfig.HealthTracker),
+		stock.WithRateLimit(appConfig.Stock.RateLimit),
+		stock.WithCache(newCache(appConfig.Cache, "stock:"), appConfig.Stock.CacheTTL),
+		stock.WithResponseBudget(appConfig.Stock.ResponseBudget),
+		stock.WithFallback(stockFallbackCodes),
+		stock.WithMaxConcurrency(appConfig.MaxUpstreamConcurrency),
+		stock.WithMaintenance(serverConfig.Maintenance),
+		stock.WithTracer(tracer),
+		stock.WithCompanyNames(companyNameOverrides),
+		stock.WithAllowedSymbols(appConfig.Stock.AllowedSymbols...),
+		stock.WithDeniedSymbols(appConfig.Stock.DeniedSymbols...),
+		stock.WithAlertRules(alertRules...),
+		stock.WithClientOptions(
+			stock.BaseURL(appConfig.Stock.BaseURL),
+			stock.FallbackBaseURL(appConfig.Stock.FallbackBaseURL),
+			stock.MaxResponseBytes(appConfig.MaxResponseBytes),
+			stock.CrumbHandshake(appConfig.Stock.CrumbHandshake),
+			stock.RepairChangePercentSign(appConfig.Stock.RepairChangePercentSign),
+			stock.Decimals(appConfig.Stock.Decimals),
+		),
+	)
 	log.Println("Stock service initialized")
 
+	// Run a one-shot query instead of the server when a subcommand is given
+	if flag.NArg() > 0 {
+		os.Exit(runQuery(flag.Args(), weatherService, stockService))
+	}
+
+	// Fail fast on a host that cannot be listened on
+	if err := serverConfig.CheckHost(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if serverConfig.IsPublic() {
+		log.Printf("WARNING: listening on all interfaces (host %q); the server is reachable from other machines", serverConfig.Host)
+	}
+	if serverConfig.Maintenance {
+		log.Println("WARNING: maintenance mode is on; serving cached and demo data only")
+	}
+	if serverConfig.EnablePprof {
+		log.Printf("WARNING: pprof is enabled at %s without authentication; put it behind an authenticating proxy", server.PprofPrefix)
+	}
+
 	// Create and configure server
-	srv := server.NewServer(config, weatherService, stockService)
-	log.Printf("Server created and configured to run on %s:%d", config.Host, config.Port)
+	srv := server.NewServer(serverConfig, weatherService, stockService)
+	log.Printf("Server created and configured to run on %s", srv.GetAddr())
+
+	// Keep the configured symbols cached until the server shuts down
+	stopRefresh := make(chan struct{})
+	srv.RegisterOnShutdown(sync.OnceFunc(func() { close(stopRefresh) }))
+	stockService.StartBackgroundRefresh(appConfig.Stock.RefreshSymbols, appConfig.Stock.RefreshInterval, stopRefresh)
 
 	// Start server with graceful shutdown
 	log.Println("Starting server...")
@@ -81,28 +346,181 @@ func showUsage() {
 	log.Println("  - Current weather information for cities")
 	log.Println("  - Real-time stock prices (including Datadog)")
 	log.Println("")
+	log.Println("Configuration precedence: config file < command line flags < environment variables")
+	log.Println("")
 	log.Println("Environment Variables:")
-	log.Println("  HOST         - Server host (default: localhost)")
+	log.Println("  CONFIG_FILE  - Configuration file (JSON, or YAML for .yaml and .yml files)")
+	log.Println("  HOST         - Server host (default: localhost; 0.0.0.0 or :: listens on all interfaces)")
 	log.Println("  PORT         - Server port (default: 3000)")
+	log.Println("  ADMIN_PORT   - Port for health checks and pprof (default: 0, served on PORT)")
 	log.Println("  READ_TIMEOUT - HTTP read timeout (default: 10s)")
 	log.Println("  WRITE_TIMEOUT- HTTP write timeout (default: 10s)")
 	log.Println("  IDLE_TIMEOUT - HTTP idle timeout (default: 60s)")
+	log.Println("  READINESS_MAX_AGE - Max age of last upstream success for readiness (default: 5m)")
+	log.Println("  REQUEST_TIMEOUT - Maximum handler time before a 503 (default: write timeout)")
+	log.Println("  DEBUG_ENDPOINTS - Expose diagnostic endpoints such as /weather/raw (default: false)")
+	log.Println("  PRETTY_JSON  - Indent response bodies unless a request passes pretty=false (default: false)")
+	log.Println("  MAX_URL_BYTES - Longest request URL accepted before a 414 (default: 8192)")
+	log.Println("  TLS_CERT     - TLS certificate file (requires TLS_KEY)")
+	log.Println("  TLS_KEY      - TLS private key file (requires TLS_CERT)")
+	log.Println("  TRUST_PROXY_HEADERS - Take the client address from X-Forwarded-For/X-Real-IP (default: false)")
+	log.Println("  TRUSTED_PROXY_HEADERS - Comma-separated forwarded headers to take the client address from (default: none)")
+	log.Println("  MAINTENANCE_MODE - Serve only cached and demo data without calling the upstream APIs (default: false)")
+	log.Println("  CORS_ORIGINS - Comma-separated allowed CORS origins (default: any origin)")
+	log.Println("  STOCK_RATE_LIMIT - Minimum delay between stock upstream requests (default: 2s)")
+	log.Println("  MAX_UPSTREAM_CONCURRENCY - Maximum concurrent requests to each upstream API (default: 8, 0 removes the limit)")
+	log.Println("  MAX_RESPONSE_BYTES - Largest upstream response body read before the request fails (default: 4194304)")
+	log.Println("  USER_AGENT   - User-Agent sent to the upstream APIs (default: a per-upstream built-in value)")
+	log.Println("  STOCK_BASE_URL - Yahoo Finance quote endpoint (default: https://query1.finance.yahoo.com/v7/finance/quote)")
+	log.Println("  STOCK_FALLBACK_BASE_URL - Quote endpoint tried when the primary fails (default: https://query2.finance.yahoo.com/v7/finance/quote)")
+	log.Println("  STOCK_CRUMB_HANDSHAKE - Send a Yahoo Finance session crumb with quote requests (default: false)")
+	log.Println("  STOCK_CACHE_TTL - How long stock quotes are served from cache (default: 15s, 0 disables)")
+	log.Println("  STOCK_FALLBACK_CODES - Upstream status codes answered with demo stock data (default: 401,403,429,5xx; none disables)")
+	log.Println("  STOCK_RESPONSE_BUDGET - Serve demo data when a live quote is expected to take longer (default: 0, disabled)")
+	log.Println("  STOCK_DECIMALS - Decimal places stock prices and changes are rounded to (default: 2)")
+	log.Println("  STOCK_REPAIR_CHANGE_SIGN - Recompute a stock's change percent when its sign disagrees with the change (default: false)")
+	log.Println("  STOCK_REFRESH_SYMBOLS - Comma-separated stock symbols refreshed in the background (default: none)")
+	log.Println("  STOCK_REFRESH_INTERVAL - How often background-refreshed symbols are fetched (default: 10s)")
+	log.Println("  STOCK_COMPANY_NAMES - JSON file mapping symbols to the company names shown in summaries (default: none)")
+	log.Println("  STOCK_ALLOWED_SYMBOLS - Comma-separated symbols that can be quoted (default: all)")
+	log.Println("  STOCK_DENIED_SYMBOLS - Comma-separated symbols that can never be quoted (default: none)")
+	log.Println("  STOCK_ALERTS_FILE - JSON file of alert rules posting quotes to webhooks, checked on background refresh (default: none)")
+	log.Println("  WEATHER_BASE_URL - Open-Meteo forecast endpoint (default: https://api.open-meteo.com/v1/forecast)")
+	log.Println("  GEOCODE_BASE_URL - Open-Meteo geocoding endpoint (default: https://geocoding-api.open-meteo.com/v1/search)")
+	log.Println("  WEATHER_STALE_THRESHOLD - Observation age past which weather is flagged as stale (default: 1h)")
+	log.Println("  TRANSLITERATE_CITY_NAMES - Strip accents from city names sent to the geocoding API (default: false)")
+	log.Println("  CACHE_BACKEND - Cache backend for weather, geocoding, and stock: memory, redis (default: memory)")
+	log.Println("  REDIS_ADDR   - Redis address (host:port) for the redis cache backend")
+	log.Println("  REDIS_PASSWORD - Redis password")
+	log.Println("  REDIS_DB     - Redis database number (default: 0)")
+	log.Println("  REDIS_KEY_PREFIX - Prefix for keys written to Redis (default: weather-stock-api:)")
+	log.Println("  LOG_LEVEL    - Minimum log level: debug, info, warn, error (default: info)")
+	log.Println("  TRACER       - Tracer for requests and upstream calls: none, log (default: none)")
 	log.Println("")
 	log.Println("Command Line Flags:")
 	flag.PrintDefaults()
 	log.Println("")
 	log.Println("API Endpoints:")
-	log.Println("  GET /health                     - Health check")
-	log.Println("  GET /weather?city=<name>        - Get weather for city")
+	log.Println("  GET /health                     - Health check (liveness)")
+	log.Println("  GET /health/live                - Liveness probe")
+	log.Println("  GET /health/ready               - Readiness probe")
+	log.Println("  GET /weather?city=<name>&timezone=<zone> - Get weather for city (timezone defaults to auto)")
 	log.Println("  GET /weather/summary?city=<name>- Get weather summary")
-	log.Println("  GET /stock?symbol=<symbol>      - Get stock price")
+	log.Println("  GET /weather/detail?city=<name> - Get multi-line weather detail")
+	log.Println("  GET /weather/cities             - List cities that resolve instantly")
+	log.Println("  GET /weather/summary/batch?cities=<a,b> - Get weather summaries for several cities")
+	log.Println("  GET /weather/batch?cities=<a,b>&limit=<n>&offset=<n> - Get paged weather for several cities")
+	log.Println("  GET /stock?symbol=<symbol>&fresh=<bool> - Get stock price (fresh=true bypasses the cache)")
+	log.Println("  POST /weather {\"city\": ...}    - Get weather from a JSON body")
+	log.Println("  POST /stock {\"symbol\": ...}    - Get stock price from a JSON body")
 	log.Println("  GET /stock/datadog              - Get Datadog stock price")
+	log.Println("  GET /stock/search?q=<name>      - Look up symbols by company name")
 	log.Println("  GET /stock/summary?symbol=<sym> - Get stock summary")
+	log.Println("  GET /stock/movers               - Get top gainers and losers")
+	log.Println("  GET /stock/batch.csv?symbols=<a,b> - Export quotes as CSV")
+	log.Println("  GET /debug/pprof/               - Go profiler (only with --enable-pprof; keep behind auth)")
+	log.Println("  With --admin-port, /health?deep=true and /debug/pprof/ are served only on the admin port")
+	log.Println("")
+	log.Println("One-shot Queries (no server):")
+	log.Println("  weather [--json] <city>         - Print weather summary (or full JSON) and exit")
+	log.Println("  stock [--json] <symbol>         - Print stock summary (or full JSON) and exit")
 	log.Println("")
 	log.Println("Examples:")
 	log.Println("  curl http://localhost:3000/weather?city=Stuttgart")
 	log.Println("  curl http://localhost:3000/stock/datadog")
 	log.Println("  curl http://localhost:3000/health")
+	log.Println("  ./weather-stock-api weather Stuttgart")
+	log.Println("  ./weather-stock-api stock DDOG --json")
+}
+
+// applyEnvOverrides applies environment variables on top of the file and flag values
+func applyEnvOverrides(appConfig *config.AppConfig) {
+	appConfig.Server.Host = getEnv("HOST", appConfig.Server.Host)
+	appConfig.Server.Port = getEnvInt("PORT", appConfig.Server.Port)
+	appConfig.Server.AdminPort = getEnvInt("ADMIN_PORT", appConfig.Server.AdminPort)
+	appConfig.Server.ReadTimeout = getEnvDuration("READ_TIMEOUT", appConfig.Server.ReadTimeout)
+	appConfig.Server.WriteTimeout = getEnvDuration("WRITE_TIMEOUT", appConfig.Server.WriteTimeout)
+	appConfig.Server.IdleTimeout = getEnvDuration("IDLE_TIMEOUT", appConfig.Server.IdleTimeout)
+	appConfig.Server.ReadinessMaxAge = getEnvDuration("READINESS_MAX_AGE", appConfig.Server.ReadinessMaxAge)
+	appConfig.Server.RequestTimeout = getEnvDuration("REQUEST_TIMEOUT", appConfig.Server.RequestTimeout)
+	appConfig.Server.DebugEndpoints = getEnvBool("DEBUG_ENDPOINTS", appConfig.Server.DebugEndpoints)
+	appConfig.Server.PrettyJSON = getEnvBool("PRETTY_JSON", appConfig.Server.PrettyJSON)
+	appConfig.Server.TrustProxyHeaders = getEnvBool("TRUST_PROXY_HEADERS", appConfig.Server.TrustProxyHeaders)
+	if headers := os.Getenv("TRUSTED_PROXY_HEADERS"); headers != "" {
+		appConfig.Server.TrustedProxyHeaders = splitList(headers)
+	}
+	appConfig.Server.Maintenance = getEnvBool("MAINTENANCE_MODE", appConfig.Server.Maintenance)
+	appConfig.Server.MaxURLBytes = getEnvInt("MAX_URL_BYTES", appConfig.Server.MaxURLBytes)
+	appConfig.Server.CertFile = getEnv("TLS_CERT", appConfig.Server.CertFile)
+	appConfig.Server.KeyFile = getEnv("TLS_KEY", appConfig.Server.KeyFile)
+	if origins := os.Getenv("CORS_ORIGINS"); origins != "" {
+		appConfig.Server.CORSOrigins = splitList(origins)
+	}
+	appConfig.Stock.RateLimit = getEnvDuration("STOCK_RATE_LIMIT", appConfig.Stock.RateLimit)
+	appConfig.MaxUpstreamConcurrency = getEnvInt("MAX_UPSTREAM_CONCURRENCY", appConfig.MaxUpstreamConcurrency)
+	appConfig.MaxResponseBytes = getEnvInt("MAX_RESPONSE_BYTES", appConfig.MaxResponseBytes)
+	appConfig.UserAgent = getEnv("USER_AGENT", appConfig.UserAgent)
+	appConfig.Stock.BaseURL = getEnv("STOCK_BASE_URL", appConfig.Stock.BaseURL)
+	appConfig.Stock.FallbackBaseURL = getEnv("STOCK_FALLBACK_BASE_URL", appConfig.Stock.FallbackBaseURL)
+	appConfig.Stock.CrumbHandshake = getEnvBool("STOCK_CRUMB_HANDSHAKE", appConfig.Stock.CrumbHandshake)
+	appConfig.Stock.CacheTTL = getEnvDuration("STOCK_CACHE_TTL", appConfig.Stock.CacheTTL)
+	appConfig.Stock.FallbackCodes = getEnv("STOCK_FALLBACK_CODES", appConfig.Stock.FallbackCodes)
+	appConfig.Stock.ResponseBudget = getEnvDuration("STOCK_RESPONSE_BUDGET", appConfig.Stock.ResponseBudget)
+	appConfig.Stock.Decimals = getEnvInt("STOCK_DECIMALS", appConfig.Stock.Decimals)
+	appConfig.Stock.RepairChangePercentSign = getEnvBool("STOCK_REPAIR_CHANGE_SIGN", appConfig.Stock.RepairChangePercentSign)
+	if symbols := os.Getenv("STOCK_REFRESH_SYMBOLS"); symbols != "" {
+		appConfig.Stock.RefreshSymbols = splitList(symbols)
+	}
+	appConfig.Stock.RefreshInterval = getEnvDuration("STOCK_REFRESH_INTERVAL", appConfig.Stock.RefreshInterval)
+	appConfig.Stock.CompanyNamesFile = getEnv("STOCK_COMPANY_NAMES", appConfig.Stock.CompanyNamesFile)
+	if symbols := os.Getenv("STOCK_ALLOWED_SYMBOLS"); symbols != "" {
+		appConfig.Stock.AllowedSymbols = splitList(symbols)
+	}
+	if symbols := os.Getenv("STOCK_DENIED_SYMBOLS"); symbols != "" {
+		appConfig.Stock.DeniedSymbols = splitList(symbols)
+	}
+	appConfig.Stock.AlertsFile = getEnv("STOCK_ALERTS_FILE", appConfig.Stock.AlertsFile)
+	appConfig.Weather.BaseURL = getEnv("WEATHER_BASE_URL", appConfig.Weather.BaseURL)
+	appConfig.Weather.GeocodeBaseURL = getEnv("GEOCODE_BASE_URL", appConfig.Weather.GeocodeBaseURL)
+	appConfig.Weather.StaleThreshold = getEnvDuration("WEATHER_STALE_THRESHOLD", appConfig.Weather.StaleThreshold)
+	appConfig.Weather.TransliterateCityNames = getEnvBool("TRANSLITERATE_CITY_NAMES", appConfig.Weather.TransliterateCityNames)
+	appConfig.Cache.Backend = getEnv("CACHE_BACKEND", appConfig.Cache.Backend)
+	appConfig.Cache.RedisAddr = getEnv("REDIS_ADDR", appConfig.Cache.RedisAddr)
+	appConfig.Cache.RedisPassword = getEnv("REDIS_PASSWORD", appConfig.Cache.RedisPassword)
+	appConfig.Cache.RedisDB = getEnvInt("REDIS_DB", appConfig.Cache.RedisDB)
+	appConfig.Cache.RedisKeyPrefix = getEnv("REDIS_KEY_PREFIX", appConfig.Cache.RedisKeyPrefix)
+	appConfig.LogLevel = getEnv("LOG_LEVEL", appConfig.LogLevel)
+}
+
+// newCache creates the configured cache for one kind of data. Keys are
+// namespaced so several caches can share a Redis database. If Redis cannot
+// be reached at startup the service falls back to an in-memory cache.
+func newCache(cacheConfig config.CacheConfig, namespace string) cache.Cache {
+	if cacheConfig.Backend == config.CacheBackendRedis {
+		redisCache, err := cache.NewRedisCache(cache.RedisOptions{
+			Addr:      cacheConfig.RedisAddr,
+			Password:  cacheConfig.RedisPassword,
+			DB:        cacheConfig.RedisDB,
+			KeyPrefix: cacheConfig.RedisKeyPrefix + namespace,
+		})
+		if err == nil {
+			log.Printf("Using Redis cache at %s for %s", cacheConfig.RedisAddr, strings.TrimSuffix(namespace, ":"))
+			return redisCache
+		}
+		logging.Warnf("Redis at %s unreachable (%v), falling back to in-memory cache", cacheConfig.RedisAddr, err)
+	}
+	return cache.NewMemoryCache(cache.DefaultCleanupInterval)
+}
+
+// splitList splits a comma-separated value into trimmed, non-empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 // getEnv returns environment variable value or default
@@ -124,17 +542,26 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
-// getEnvDuration returns environment variable as duration or default
-func getEnvDuration(key, defaultValue string) time.Duration {
-	value := getEnv(key, defaultValue)
-	if duration, err := time.ParseDuration(value); err == nil {
-		return duration
+// getEnvBool returns environment variable as bool or default
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+		log.Printf("Warning: Invalid boolean value for %s: %s, using default %t", key, value, defaultValue)
 	}
-	log.Printf("Warning: Invalid duration value for %s: %s, using default %s", key, value, defaultValue)
-	if duration, err := time.ParseDuration(defaultValue); err == nil {
-		return duration
+	return defaultValue
+}
+
+// getEnvDuration returns environment variable as duration or default
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+		log.Printf("Warning: Invalid duration value for %s: %s, using default %s", key, value, defaultValue)
 	}
-	return 10 * time.Second // fallback
+	return defaultValue
 }
 
 // Version information (could be set during build)
@@ -144,6 +571,11 @@ var (
 	GitCommit = "unknown"
 )
 
+// versionString formats the build metadata for display
+func versionString() string {
+	return fmt.Sprintf("Weather & Stock API v%s (built: %s, commit: %s)", Version, BuildTime, GitCommit)
+}
+
 func init() {
-	log.Printf("Weather & Stock API v%s (built: %s, commit: %s)", Version, BuildTime, GitCommit)
+	log.Print(versionString())
 }
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/stock"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/weather"
+)
+
+// runQuery executes a one-shot subcommand such as "weather Stuttgart" or
+// "stock DDOG", prints the result to stdout, and returns the process exit code
+func runQuery(args []string, weatherService *weather.Service, stockService *stock.Service) int {
+	command := args[0]
+
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	jsonOutput := fs.Bool("json", false, "Print the full JSON response instead of the summary")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s %s [--json] <%s>\n", os.Args[0], command, queryArgName(command))
+		fs.PrintDefaults()
+	}
+
+	// Accept flags both before and after the positional argument
+	var positional []string
+	rest := args[1:]
+	for {
+		if err := fs.Parse(rest); err != nil {
+			return 2
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		rest = fs.Args()[1:]
+	}
+
+	target := strings.Join(positional, " ")
+	if target == "" {
+		fs.Usage()
+		return 2
+	}
+
+	var (
+		result  interface{}
+		summary string
+		err     error
+	)
+
+	switch command {
+	case "weather":
+		if *jsonOutput {
+			result, err = weatherService.GetWeatherWithValidation(target)
+		} else {
+			summary, err = weatherService.GetWeatherSummary(target)
+		}
+	case "stock":
+		if *jsonOutput {
+			result, err = stockService.GetCurrentPrice(target)
+		} else {
+			summary, err = stockService.GetStockSummary(target)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q (expected \"weather\" or \"stock\")\n", command)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Println(summary)
+	return 0
+}
+
+// queryArgName returns the placeholder shown in subcommand usage
+func queryArgName(command string) string {
+	if command == "stock" {
+		return "symbol"
+	}
+	return "city"
+}
@@ -1,5 +1,7 @@
 package testutils
 
+import "fmt"
+
 // Weather API Response Fixtures
 
 // OpenMeteoWeatherResponse is a sample response from Open-Meteo API
@@ -8,13 +10,31 @@ const OpenMeteoWeatherResponse = `{
     "time": "2024-01-15T14:00",
     "temperature_2m": 22.5,
     "weather_code": 3,
-    "is_day": 1
+    "is_day": 1,
+    "uv_index": 4.2
   },
   "current_units": {
     "temperature_2m": "°C"
   }
 }`
 
+// OpenMeteoWeatherFeelsColder is a weather response whose apparent
+// temperature is well below the measured one
+const OpenMeteoWeatherFeelsColder = `{
+  "current": {
+    "time": "2024-01-15T14:00",
+    "temperature_2m": 22.5,
+    "apparent_temperature": 18.3,
+    "weather_code": 3,
+    "is_day": 1,
+    "uv_index": 4.2
+  },
+  "current_units": {
+    "temperature_2m": "°C",
+    "apparent_temperature": "°C"
+  }
+}`
+
 // OpenMeteoGeocodeResponse is a sample response from Open-Meteo Geocoding API
 const OpenMeteoGeocodeResponse = `{
   "results": [
@@ -59,6 +79,30 @@ const YahooFinanceStockResponse = `{
   }
 }`
 
+// YahooFinanceMillisecondTimestamp is YahooFinanceStockResponse with the
+// market time in epoch milliseconds, as some Yahoo Finance responses carry it
+const YahooFinanceMillisecondTimestamp = `{
+  "quoteResponse": {
+    "result": [
+      {
+        "symbol": "DDOG",
+        "shortName": "Datadog Inc",
+        "longName": "Datadog, Inc.",
+        "regularMarketPrice": 125.67,
+        "regularMarketChange": 2.34,
+        "regularMarketChangePercent": 1.89,
+        "regularMarketPreviousClose": 123.33,
+        "regularMarketVolume": 1234567,
+        "marketCap": 40000000000,
+        "currency": "USD",
+        "marketState": "REGULAR",
+        "regularMarketTime": 1705327200000
+      }
+    ],
+    "error": null
+  }
+}`
+
 // YahooFinanceStockNotFound is a response when stock symbol is not found
 const YahooFinanceStockNotFound = `{
   "quoteResponse": {
@@ -67,6 +111,17 @@ const YahooFinanceStockNotFound = `{
   }
 }`
 
+// YahooFinanceErrorResponse is a response carrying an error object and no results
+const YahooFinanceErrorResponse = `{
+  "quoteResponse": {
+    "result": [],
+    "error": {
+      "code": "Bad Request",
+      "description": "Missing value for the \"symbols\" argument"
+    }
+  }
+}`
+
 // YahooFinanceMarketClosed is a response when market is closed
 const YahooFinanceMarketClosed = `{
   "quoteResponse": {
@@ -90,8 +145,155 @@ const YahooFinanceMarketClosed = `{
   }
 }`
 
+// YahooFinanceInconsistentSign is a response where change and change percent disagree in sign
+const YahooFinanceInconsistentSign = `{
+  "quoteResponse": {
+    "result": [
+      {
+        "symbol": "DDOG",
+        "shortName": "Datadog Inc",
+        "longName": "Datadog, Inc.",
+        "regularMarketPrice": 125.67,
+        "regularMarketChange": 2.34,
+        "regularMarketChangePercent": -1.89,
+        "regularMarketPreviousClose": 123.33,
+        "regularMarketVolume": 1234567,
+        "marketCap": 40000000000,
+        "currency": "USD",
+        "marketState": "REGULAR",
+        "regularMarketTime": 1705327200
+      }
+    ],
+    "error": null
+  }
+}`
+
+// YahooFinanceZeroPrice is a partially populated quote, as returned for delisted symbols
+const YahooFinanceZeroPrice = `{
+  "quoteResponse": {
+    "result": [
+      {
+        "symbol": "DLST",
+        "shortName": "Delisted Co",
+        "regularMarketPrice": 0,
+        "regularMarketChange": 0,
+        "regularMarketChangePercent": 0,
+        "regularMarketPreviousClose": 0,
+        "regularMarketVolume": 0,
+        "currency": "USD",
+        "marketState": "CLOSED",
+        "regularMarketTime": 0
+      }
+    ],
+    "error": null
+  }
+}`
+
+// YahooFinanceMissingSymbol is a quote without a symbol
+const YahooFinanceMissingSymbol = `{
+  "quoteResponse": {
+    "result": [
+      {
+        "regularMarketPrice": 125.67,
+        "currency": "USD",
+        "marketState": "REGULAR",
+        "regularMarketTime": 1705327200
+      }
+    ],
+    "error": null
+  }
+}`
+
+// YahooFinanceSearchResponse is a sample response from the Yahoo Finance search endpoint
+const YahooFinanceSearchResponse = `{
+  "count": 3,
+  "quotes": [
+    {
+      "exchange": "NMS",
+      "shortname": "Apple Inc.",
+      "longname": "Apple Inc.",
+      "quoteType": "EQUITY",
+      "symbol": "AAPL",
+      "exchDisp": "NASDAQ"
+    },
+    {
+      "exchange": "NEO",
+      "shortname": "APPLE CDR (CAD HEDGED)",
+      "quoteType": "EQUITY",
+      "symbol": "AAPL.NE",
+      "exchDisp": "NEO"
+    },
+    {
+      "shortname": "News result without a symbol"
+    }
+  ],
+  "news": []
+}`
+
+// YahooFinanceChartResponse is a sample response from the Yahoo Finance
+// chart endpoint for DDOG over 5 days at a 1 day interval; the third bar has
+// no trades
+const YahooFinanceChartResponse = `{
+  "chart": {
+    "result": [
+      {
+        "meta": {
+          "currency": "USD",
+          "symbol": "DDOG",
+          "exchangeName": "NMS",
+          "regularMarketPrice": 125.456
+        },
+        "timestamp": [1703462400, 1703548800, 1703635200, 1703721600],
+        "indicators": {
+          "quote": [
+            {
+              "open": [121.1, 122.345, null, 124.0],
+              "high": [123.0, 124.5, null, 126.2],
+              "low": [120.5, 121.9, null, 123.75],
+              "close": [122.5, 123.456, null, 125.456],
+              "volume": [2100000, 1950000, null, 2234567]
+            }
+          ]
+        }
+      }
+    ],
+    "error": null
+  }
+}`
+
+// YahooFinanceSearchNoMatches is a search response without any quotes
+const YahooFinanceSearchNoMatches = `{
+  "count": 0,
+  "quotes": [],
+  "news": []
+}`
+
 // Error Response Fixtures
 
+// YahooFinanceQuote builds a single-quote Yahoo Finance response for the given values
+func YahooFinanceQuote(symbol string, price, changePercent float64) string {
+	previousClose := price / (1 + changePercent/100)
+	return fmt.Sprintf(`{
+  "quoteResponse": {
+    "result": [
+      {
+        "symbol": %q,
+        "longName": "%s Corp",
+        "regularMarketPrice": %g,
+        "regularMarketChange": %g,
+        "regularMarketChangePercent": %g,
+        "regularMarketPreviousClose": %g,
+        "regularMarketVolume": 1000000,
+        "currency": "USD",
+        "marketState": "REGULAR",
+        "regularMarketTime": 1705327200
+      }
+    ],
+    "error": null
+  }
+}`, symbol, symbol, price, price-previousClose, changePercent, previousClose)
+}
+
 // APIErrorResponse is a generic API error response
 const APIErrorResponse = `{
   "error": {
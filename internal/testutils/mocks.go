@@ -2,15 +2,40 @@ package testutils
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
+	"sync"
+	"time"
 )
 
-// MockHTTPClient is a mock implementation of HTTPClient for testing
+// MockHTTPClient is a mock implementation of HTTPClient for testing. It is
+// safe for concurrent use; each call gets a fresh copy of the mocked body.
 type MockHTTPClient struct {
 	Responses map[string]*http.Response
 	Errors    map[string]error
 	CallCount map[string]int
+	Delays    map[string]time.Duration
+
+	mutex     sync.Mutex
+	calls     []string
+	posts     []MockPost
+	bodies    map[string]string
+	transient map[string][]transientResult
+}
+
+// MockPost is a POST request received by MockHTTPClient
+type MockPost struct {
+	URL         string
+	ContentType string
+	Body        string
+}
+
+// transientResult is a one-off outcome returned before the regular mock for a URL
+type transientResult struct {
+	err        error
+	statusCode int
+	body       string
 }
 
 // NewMockHTTPClient creates a new mock HTTP client
@@ -19,18 +44,43 @@ func NewMockHTTPClient() *MockHTTPClient {
 		Responses: make(map[string]*http.Response),
 		Errors:    make(map[string]error),
 		CallCount: make(map[string]int),
+		Delays:    make(map[string]time.Duration),
+		bodies:    make(map[string]string),
+		transient: make(map[string][]transientResult),
 	}
 }
 
 // Get implements the HTTPClient interface
 func (m *MockHTTPClient) Get(url string) (*http.Response, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	m.CallCount[url]++
+	m.calls = append(m.calls, url)
+
+	if queued := m.transient[url]; len(queued) > 0 {
+		m.transient[url] = queued[1:]
+		if queued[0].err != nil {
+			return nil, queued[0].err
+		}
+		return &http.Response{
+			StatusCode: queued[0].statusCode,
+			Body:       io.NopCloser(bytes.NewReader([]byte(queued[0].body))),
+			Header:     make(http.Header),
+		}, nil
+	}
 
 	if err, exists := m.Errors[url]; exists {
 		return nil, err
 	}
 
 	if resp, exists := m.Responses[url]; exists {
+		if body, known := m.bodies[url]; known {
+			copied := *resp
+			copied.Header = resp.Header.Clone()
+			copied.Body = io.NopCloser(bytes.NewReader([]byte(body)))
+			return &copied, nil
+		}
 		return resp, nil
 	}
 
@@ -41,28 +91,178 @@ func (m *MockHTTPClient) Get(url string) (*http.Response, error) {
 	}, nil
 }
 
+// GetWithContext implements the context-aware HTTP client interfaces. Any
+// delay added for the URL is cut short when ctx is done.
+func (m *MockHTTPClient) GetWithContext(ctx context.Context, url string) (*http.Response, error) {
+	m.mutex.Lock()
+	delay, hasDelay := m.Delays[url]
+	m.mutex.Unlock()
+
+	if hasDelay {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		m.mutex.Lock()
+		m.CallCount[url]++
+		m.calls = append(m.calls, url)
+		m.mutex.Unlock()
+		return nil, err
+	}
+	return m.Get(url)
+}
+
+// Post implements the POST method of HTTPClient, recording the request and
+// answering it like a GET of the same URL
+func (m *MockHTTPClient) Post(url, contentType string, body io.Reader) (*http.Response, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	m.posts = append(m.posts, MockPost{URL: url, ContentType: contentType, Body: string(data)})
+	m.mutex.Unlock()
+	return m.Get(url)
+}
+
+// PostWithContext implements the context-aware HTTP client interfaces. Any
+// delay added for the URL is cut short when ctx is done; the request is
+// recorded either way.
+func (m *MockHTTPClient) PostWithContext(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	m.mutex.Lock()
+	delay, hasDelay := m.Delays[url]
+	m.mutex.Unlock()
+
+	if hasDelay {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		data, _ := io.ReadAll(body)
+		m.mutex.Lock()
+		m.posts = append(m.posts, MockPost{URL: url, ContentType: contentType, Body: string(data)})
+		m.CallCount[url]++
+		m.calls = append(m.calls, url)
+		m.mutex.Unlock()
+		return nil, err
+	}
+	return m.Post(url, contentType, body)
+}
+
+// GetPosts returns every POST request received, in order
+func (m *MockHTTPClient) GetPosts() []MockPost {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]MockPost(nil), m.posts...)
+}
+
+// AddDelay makes context-aware requests for a given URL wait before responding
+func (m *MockHTTPClient) AddDelay(url string, delay time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.Delays[url] = delay
+}
+
 // AddResponse adds a mock response for a given URL
 func (m *MockHTTPClient) AddResponse(url string, statusCode int, body string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	m.Responses[url] = &http.Response{
 		StatusCode: statusCode,
 		Body:       io.NopCloser(bytes.NewReader([]byte(body))),
 		Header:     make(http.Header),
 	}
+	m.bodies[url] = body
 }
 
 // AddError adds a mock error for a given URL
 func (m *MockHTTPClient) AddError(url string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	m.Errors[url] = err
 }
 
+// AddTransientError makes the next call for a given URL fail with err; later
+// calls get the regular mock. Repeated calls queue up several failures.
+func (m *MockHTTPClient) AddTransientError(url string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.transient[url] = append(m.transient[url], transientResult{err: err})
+}
+
+// AddTransientResponse makes the next call for a given URL return statusCode
+// and body; later calls get the regular mock
+func (m *MockHTTPClient) AddTransientResponse(url string, statusCode int, body string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.transient[url] = append(m.transient[url], transientResult{statusCode: statusCode, body: body})
+}
+
 // GetCallCount returns the number of times a URL was called
 func (m *MockHTTPClient) GetCallCount(url string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	return m.CallCount[url]
 }
 
+// GetCalls returns every URL called, in the order the calls were answered.
+// Calls for a URL with a delay are recorded once the delay has passed.
+func (m *MockHTTPClient) GetCalls() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]string(nil), m.calls...)
+}
+
 // Reset clears all mock data
 func (m *MockHTTPClient) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	m.Responses = make(map[string]*http.Response)
 	m.Errors = make(map[string]error)
 	m.CallCount = make(map[string]int)
+	m.calls = nil
+	m.posts = nil
+	m.Delays = make(map[string]time.Duration)
+	m.bodies = make(map[string]string)
+	m.transient = make(map[string][]transientResult)
+}
+
+// MockClock is a clock whose time only changes when set or advanced. It is
+// safe for concurrent use.
+type MockClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewMockClock creates a mock clock stopped at now
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{now: now}
+}
+
+// Now returns the clock's current time
+func (c *MockClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+// Set moves the clock to now
+func (c *MockClock) Set(now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = now
+}
+
+// Advance moves the clock forward by d
+func (c *MockClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
 }
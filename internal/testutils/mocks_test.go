@@ -0,0 +1,66 @@
+package testutils
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMockHTTPClient_Post(t *testing.T) {
+	const hook = "https://hooks.example.com/a"
+	mock := NewMockHTTPClient()
+	mock.AddResponse(hook, 202, `{"ok":true}`)
+
+	resp, err := mock.Post(hook, "application/json", strings.NewReader(`{"n":1}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 202 || string(body) != `{"ok":true}` {
+		t.Errorf("Expected the mocked 202 response, got %d %s", resp.StatusCode, body)
+	}
+
+	resp, err = mock.Post("https://hooks.example.com/unmocked", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.StatusCode != 404 {
+		t.Errorf("Expected 404 for an unmocked URL, got %d", resp.StatusCode)
+	}
+
+	want := []MockPost{
+		{URL: hook, ContentType: "application/json", Body: `{"n":1}`},
+		{URL: "https://hooks.example.com/unmocked", ContentType: "text/plain", Body: "hello"},
+	}
+	posts := mock.GetPosts()
+	if len(posts) != len(want) {
+		t.Fatalf("Expected %d posts, got %d", len(want), len(posts))
+	}
+	for i := range want {
+		if posts[i] != want[i] {
+			t.Errorf("Expected post %d to be %+v, got %+v", i, want[i], posts[i])
+		}
+	}
+	if count := mock.GetCallCount(hook); count != 1 {
+		t.Errorf("Expected 1 call to %s, got %d", hook, count)
+	}
+
+	mock.Reset()
+	if posts := mock.GetPosts(); len(posts) != 0 {
+		t.Errorf("Expected no posts after Reset, got %d", len(posts))
+	}
+}
+
+func TestMockHTTPClient_Post_Error(t *testing.T) {
+	const hook = "https://hooks.example.com/a"
+	mock := NewMockHTTPClient()
+	mock.AddError(hook, errors.New("connection refused"))
+
+	if _, err := mock.Post(hook, "application/json", strings.NewReader("{}")); err == nil {
+		t.Error("Expected the mocked error")
+	}
+	if posts := mock.GetPosts(); len(posts) != 1 {
+		t.Errorf("Expected the failed post to be recorded, got %d posts", len(posts))
+	}
+}
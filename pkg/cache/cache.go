@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultCleanupInterval is how often a MemoryCache sweeps expired entries
+const DefaultCleanupInterval = time.Minute
+
+// Cache stores values by key for a limited time. Implementations must be
+// safe for concurrent use.
+type Cache interface {
+	// Get returns the value stored under key, if present and not expired
+	Get(key string) (interface{}, bool)
+	// Set stores value under key; a ttl of zero or less never expires
+	Set(key string, value interface{}, ttl time.Duration)
+}
+
+// Lister is implemented by caches that can enumerate their keys
+type Lister interface {
+	// Keys returns the keys of all entries that have not expired
+	Keys() []string
+}
+
+// entry is a cached value with its expiry time
+type entry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// expired reports whether the entry is past its expiry at the given time
+func (e entry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// MemoryCache is an in-process Cache with per-entry TTLs
+type MemoryCache struct {
+	mutex    sync.RWMutex
+	items    map[string]entry
+	stop     chan struct{}
+	once     sync.Once
+	counters counters
+}
+
+// NewMemoryCache creates an in-memory cache. When cleanupInterval is positive,
+// a background goroutine removes expired entries at that interval until Close.
+func NewMemoryCache(cleanupInterval time.Duration) *MemoryCache {
+	c := &MemoryCache{
+		items: make(map[string]entry),
+		stop:  make(chan struct{}),
+	}
+
+	if cleanupInterval > 0 {
+		go c.cleanupLoop(cleanupInterval)
+	}
+
+	return c
+}
+
+// Get returns the value stored under key, if present and not expired
+func (c *MemoryCache) Get(key string) (interface{}, bool) {
+	c.mutex.RLock()
+	item, exists := c.items[key]
+	c.mutex.RUnlock()
+
+	if !exists || item.expired(time.Now()) {
+		c.counters.record(false)
+		return nil, false
+	}
+	c.counters.record(true)
+	return item.value, true
+}
+
+// Set stores value under key; a ttl of zero or less never expires
+func (c *MemoryCache) Set(key string, value interface{}, ttl time.Duration) {
+	item := entry{value: value}
+	if ttl > 0 {
+		item.expiresAt = time.Now().Add(ttl)
+	}
+
+	c.mutex.Lock()
+	c.items[key] = item
+	c.mutex.Unlock()
+}
+
+// Delete removes key from the cache
+func (c *MemoryCache) Delete(key string) {
+	c.mutex.Lock()
+	delete(c.items, key)
+	c.mutex.Unlock()
+}
+
+// Keys returns the keys of all entries that have not expired, in no particular order
+func (c *MemoryCache) Keys() []string {
+	now := time.Now()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	keys := make([]string, 0, len(c.items))
+	for key, item := range c.items {
+		if !item.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Len returns the number of stored entries, including expired ones not yet swept
+func (c *MemoryCache) Len() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return len(c.items)
+}
+
+// Stats returns the hit and miss counts of Get; Size is Len
+func (c *MemoryCache) Stats() Stats {
+	return c.counters.stats(c.Len())
+}
+
+// DeleteExpired removes all expired entries
+func (c *MemoryCache) DeleteExpired() {
+	now := time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for key, item := range c.items {
+		if item.expired(now) {
+			delete(c.items, key)
+		}
+	}
+}
+
+// Close stops the background cleanup; the cache remains usable afterwards
+func (c *MemoryCache) Close() {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+}
+
+// cleanupLoop periodically removes expired entries until Close is called
+func (c *MemoryCache) cleanupLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.DeleteExpired()
+		case <-c.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache_GetSet(t *testing.T) {
+	c := NewMemoryCache(0)
+	defer c.Close()
+
+	if _, found := c.Get("missing"); found {
+		t.Errorf("Expected miss for unknown key")
+	}
+
+	c.Set("city", "Stuttgart", time.Minute)
+	value, found := c.Get("city")
+	if !found {
+		t.Fatalf("Expected hit for stored key")
+	}
+	if value != "Stuttgart" {
+		t.Errorf("Expected Stuttgart, got %v", value)
+	}
+
+	c.Set("city", "Berlin", time.Minute)
+	if value, _ := c.Get("city"); value != "Berlin" {
+		t.Errorf("Expected overwritten value Berlin, got %v", value)
+	}
+
+	c.Delete("city")
+	if _, found := c.Get("city"); found {
+		t.Errorf("Expected miss after Delete")
+	}
+}
+
+func TestMemoryCache_Expiry(t *testing.T) {
+	c := NewMemoryCache(0)
+	defer c.Close()
+
+	c.Set("short", 1, 10*time.Millisecond)
+	c.Set("forever", 2, 0)
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, found := c.Get("short"); found {
+		t.Errorf("Expected expired entry to be a miss")
+	}
+	if _, found := c.Get("forever"); !found {
+		t.Errorf("Expected entry without TTL to remain")
+	}
+
+	if c.Len() != 2 {
+		t.Errorf("Expected expired entry to stay until swept, got %d entries", c.Len())
+	}
+	c.DeleteExpired()
+	if c.Len() != 1 {
+		t.Errorf("Expected 1 entry after DeleteExpired, got %d", c.Len())
+	}
+}
+
+func TestMemoryCache_BackgroundCleanup(t *testing.T) {
+	c := NewMemoryCache(5 * time.Millisecond)
+	defer c.Close()
+
+	c.Set("short", 1, time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for c.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if c.Len() != 0 {
+		t.Errorf("Expected background cleanup to remove expired entry, got %d entries", c.Len())
+	}
+
+	// Close is idempotent
+	c.Close()
+	c.Close()
+}
+
+func TestMemoryCache_Concurrent(t *testing.T) {
+	c := NewMemoryCache(time.Millisecond)
+	defer c.Close()
+
+	const workers = 20
+	const iterations = 200
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				key := fmt.Sprintf("key-%d", i%10)
+				c.Set(key, worker, time.Duration(i%3)*time.Millisecond)
+				c.Get(key)
+				if i%50 == 0 {
+					c.Delete(key)
+					c.DeleteExpired()
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	c.Set("final", "value", time.Minute)
+	if value, found := c.Get("final"); !found || value != "value" {
+		t.Errorf("Expected cache to remain usable after concurrent access, got %v, %v", value, found)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	c := NewMemoryCache(0)
+	defer c.Close()
+
+	c.Set("count", 42, 0)
+
+	var count int
+	if !Load(c, "count", &count) || count != 42 {
+		t.Errorf("Expected 42, got %d", count)
+	}
+
+	var name string
+	if Load(c, "count", &name) {
+		t.Errorf("Expected type mismatch to be reported as a miss")
+	}
+
+	if Load(c, "missing", &count) {
+		t.Errorf("Expected miss for unknown key")
+	}
+}
+
+// Ensure MemoryCache satisfies the Cache interface
+var _ Cache = (*MemoryCache)(nil)
+var _ Cache = (*RedisCache)(nil)
+
+func TestMemoryCache_Keys(t *testing.T) {
+	c := NewMemoryCache(0)
+	defer c.Close()
+
+	c.Set("fresh", 1, time.Minute)
+	c.Set("forever", 2, 0)
+	c.Set("expired", 3, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	keys := c.Keys()
+	found := make(map[string]bool)
+	for _, key := range keys {
+		found[key] = true
+	}
+
+	if len(keys) != 2 || !found["fresh"] || !found["forever"] {
+		t.Errorf("Expected keys fresh and forever, got %v", keys)
+	}
+}
+
+func TestMemoryCache_Stats(t *testing.T) {
+	c := NewMemoryCache(0)
+
+	if stats := c.Stats(); stats != (Stats{}) {
+		t.Errorf("Expected empty stats, got %+v", stats)
+	}
+
+	c.Set("a", 1, 0)
+	c.Set("expired", 2, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	c.Get("a")
+	c.Get("a")
+	c.Get("missing")
+	c.Get("expired")
+
+	stats := c.Stats()
+	want := Stats{Size: 2, Hits: 2, Misses: 2, HitRatio: 0.5}
+	if stats != want {
+		t.Errorf("Expected %+v, got %+v", want, stats)
+	}
+}
@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Load reads key from c into dst, which must be a pointer. Values stored
+// in memory are assigned directly; JSON from a shared cache is decoded.
+// It returns false on a miss or when the value does not fit dst.
+func Load(c Cache, key string, dst interface{}) bool {
+	value, found := c.Get(key)
+	if !found {
+		return false
+	}
+
+	if raw, ok := value.(json.RawMessage); ok {
+		return json.Unmarshal(raw, dst) == nil
+	}
+
+	target := reflect.ValueOf(dst)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return false
+	}
+	source := reflect.ValueOf(value)
+	if !source.IsValid() || !source.Type().AssignableTo(target.Elem().Type()) {
+		return false
+	}
+	target.Elem().Set(source)
+	return true
+}
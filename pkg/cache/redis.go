@@ -0,0 +1,292 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
+)
+
+// DefaultRedisKeyPrefix namespaces keys written by this service
+const DefaultRedisKeyPrefix = "weather-stock-api:"
+
+// errNilReply is returned when Redis answers with a nil bulk string
+var errNilReply = errors.New("redis: nil reply")
+
+// RedisOptions holds the connection settings for a RedisCache
+type RedisOptions struct {
+	Addr        string
+	Password    string
+	DB          int
+	KeyPrefix   string
+	DialTimeout time.Duration
+	IOTimeout   time.Duration
+	// PoolSize is how many idle connections are kept for reuse; busy
+	// callers dial extra connections rather than wait for one
+	PoolSize int
+}
+
+// DefaultRedisPoolSize is the default RedisOptions.PoolSize
+const DefaultRedisPoolSize = 4
+
+// RedisCache is a Cache shared between instances through a Redis server.
+// Values are stored as JSON, so Get returns a json.RawMessage; use Load to
+// decode it into the original type.
+type RedisCache struct {
+	options RedisOptions
+	// idle holds connections between commands. Each command takes one for
+	// its round trip, so a slow reply only holds up its own caller.
+	idle     chan *redisConn
+	mutex    sync.Mutex
+	closed   bool
+	counters counters
+}
+
+// redisConn is one connection with its buffered reader
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedisCache connects to Redis and verifies the connection with PING
+func NewRedisCache(options RedisOptions) (*RedisCache, error) {
+	if options.Addr == "" {
+		return nil, fmt.Errorf("redis address is required")
+	}
+	if options.DialTimeout <= 0 {
+		options.DialTimeout = 2 * time.Second
+	}
+	if options.IOTimeout <= 0 {
+		options.IOTimeout = time.Second
+	}
+	if options.PoolSize <= 0 {
+		options.PoolSize = DefaultRedisPoolSize
+	}
+
+	c := &RedisCache{options: options, idle: make(chan *redisConn, options.PoolSize)}
+	if _, err := c.do("PING"); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get returns the JSON stored under key. Connection errors are logged and
+// reported as a miss so callers fall through to the upstream.
+func (c *RedisCache) Get(key string) (interface{}, bool) {
+	reply, err := c.do("GET", c.options.KeyPrefix+key)
+	if err != nil {
+		if err != errNilReply {
+			logging.Warnf("Redis GET %s failed: %v", key, err)
+		}
+		c.counters.record(false)
+		return nil, false
+	}
+	c.counters.record(true)
+	return json.RawMessage(reply), true
+}
+
+// Stats returns the hit and miss counts of Get. The size is unknown (-1),
+// since counting the keys under the prefix would scan the whole database.
+func (c *RedisCache) Stats() Stats {
+	return c.counters.stats(-1)
+}
+
+// Set stores value under key as JSON; a ttl of zero or less never expires
+func (c *RedisCache) Set(key string, value interface{}, ttl time.Duration) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		logging.Warnf("Redis SET %s: cannot encode value: %v", key, err)
+		return
+	}
+
+	args := []string{"SET", c.options.KeyPrefix + key, string(data)}
+	if ttl > 0 {
+		// Redis rejects PX 0, so sub-millisecond TTLs round up
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+
+	if _, err := c.do(args...); err != nil {
+		logging.Warnf("Redis SET %s failed: %v", key, err)
+	}
+}
+
+// Close closes the idle connections to Redis; connections still in use are
+// closed when their command finishes
+func (c *RedisCache) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closed = true
+	var firstErr error
+	for {
+		select {
+		case conn := <-c.idle:
+			if err := conn.conn.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		default:
+			return firstErr
+		}
+	}
+}
+
+// do sends a command on a pooled connection and reads its reply,
+// reconnecting once if the connection was lost
+func (c *RedisCache) do(args ...string) (string, error) {
+	conn, err := c.getConn()
+	if err != nil {
+		return "", err
+	}
+
+	reply, err := conn.roundTrip(args, c.options.IOTimeout)
+	if isConnectionError(err) {
+		// Retry once on a fresh connection
+		conn.conn.Close()
+		if conn, err = c.dial(); err != nil {
+			return "", err
+		}
+		reply, err = conn.roundTrip(args, c.options.IOTimeout)
+		if isConnectionError(err) {
+			conn.conn.Close()
+			return "", err
+		}
+	}
+
+	c.putConn(conn)
+	return reply, err
+}
+
+// getConn takes an idle connection, or dials a new one when none is idle
+func (c *RedisCache) getConn() (*redisConn, error) {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil, errors.New("redis: cache is closed")
+	}
+	select {
+	case conn := <-c.idle:
+		c.mutex.Unlock()
+		return conn, nil
+	default:
+	}
+	c.mutex.Unlock()
+
+	return c.dial()
+}
+
+// putConn returns a healthy connection to the pool, closing it when the pool
+// is full or the cache has been closed
+func (c *RedisCache) putConn(conn *redisConn) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.closed {
+		select {
+		case c.idle <- conn:
+			return
+		default:
+		}
+	}
+	conn.conn.Close()
+}
+
+// dial connects to Redis and authenticates and selects the database if configured
+func (c *RedisCache) dial() (*redisConn, error) {
+	netConn, err := net.DialTimeout("tcp", c.options.Addr, c.options.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{conn: netConn, reader: bufio.NewReader(netConn)}
+
+	if c.options.Password != "" {
+		if _, err := conn.roundTrip([]string{"AUTH", c.options.Password}, c.options.IOTimeout); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("redis AUTH: %w", err)
+		}
+	}
+	if c.options.DB != 0 {
+		if _, err := conn.roundTrip([]string{"SELECT", strconv.Itoa(c.options.DB)}, c.options.IOTimeout); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("redis SELECT: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// roundTrip writes one command and reads one reply
+func (rc *redisConn) roundTrip(args []string, timeout time.Duration) (string, error) {
+	rc.conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := io.WriteString(rc.conn, encodeCommand(args)); err != nil {
+		return "", err
+	}
+	return readReply(rc.reader)
+}
+
+// redisError is an error reply sent by the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// isConnectionError reports whether err came from the transport rather than
+// Redis itself; after one the connection must not be reused
+func isConnectionError(err error) bool {
+	if err == nil || err == errNilReply {
+		return false
+	}
+	var replyErr redisError
+	return !errors.As(err, &replyErr)
+}
+
+// encodeCommand formats args as a RESP array of bulk strings
+func encodeCommand(args []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return b.String()
+}
+
+// readReply reads a simple string, error, integer, or bulk string reply
+func readReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", redisError(line[1:])
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("redis: invalid bulk length %q", line[1:])
+		}
+		if length < 0 {
+			return "", errNilReply
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return "", err
+		}
+		return string(data[:length]), nil
+	}
+	return "", fmt.Errorf("redis: unsupported reply type %q", line[0])
+}
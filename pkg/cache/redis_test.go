@@ -0,0 +1,246 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a minimal in-process Redis speaking enough RESP for RedisCache
+type fakeRedis struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	data     map[string]string
+	commands []string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &fakeRedis{listener: listener, data: make(map[string]string)}
+	go server.serve()
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		f.mutex.Lock()
+		f.commands = append(f.commands, strings.Join(args, " "))
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "PING":
+			reply = "+PONG\r\n"
+		case "GET":
+			if value, ok := f.data[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "SET":
+			f.data[args[1]] = args[2]
+			reply = "+OK\r\n"
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		f.mutex.Unlock()
+
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) lastCommand() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.commands[len(f.commands)-1]
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		value, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, strings.TrimSuffix(value, "\r\n"))
+	}
+	return args, nil
+}
+
+type cachedCity struct {
+	Name       string
+	Population int
+}
+
+func TestRedisCache_RoundTrip(t *testing.T) {
+	server := newFakeRedis(t)
+
+	c, err := NewRedisCache(RedisOptions{Addr: server.listener.Addr().String(), KeyPrefix: "test:"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	c.Set("city", cachedCity{Name: "Stuttgart", Population: 630000}, 90*time.Second)
+	if got := server.lastCommand(); !strings.HasPrefix(got, "SET test:city ") || !strings.HasSuffix(got, " PX 90000") {
+		t.Errorf("Unexpected SET command: %s", got)
+	}
+
+	var city cachedCity
+	if !Load(c, "city", &city) {
+		t.Fatalf("Expected hit for stored key")
+	}
+	if city.Name != "Stuttgart" || city.Population != 630000 {
+		t.Errorf("Unexpected decoded value: %+v", city)
+	}
+
+	if _, found := c.Get("missing"); found {
+		t.Errorf("Expected miss for unknown key")
+	}
+}
+
+func TestRedisCache_Reconnect(t *testing.T) {
+	server := newFakeRedis(t)
+
+	c, err := NewRedisCache(RedisOptions{Addr: server.listener.Addr().String()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	// Simulate the server dropping the idle connection
+	conn := <-c.idle
+	conn.conn.Close()
+	c.idle <- conn
+
+	c.Set("key", "value", 0)
+	var value string
+	if !Load(c, "key", &value) || value != "value" {
+		t.Errorf("Expected value after reconnect, got %q", value)
+	}
+}
+
+func TestRedisCache_SubMillisecondTTL(t *testing.T) {
+	server := newFakeRedis(t)
+
+	c, err := NewRedisCache(RedisOptions{Addr: server.listener.Addr().String()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	c.Set("key", "value", 500*time.Microsecond)
+	if got := server.lastCommand(); !strings.HasSuffix(got, " PX 1") {
+		t.Errorf("Expected the TTL to round up to 1ms, got %s", got)
+	}
+}
+
+func TestRedisCache_BusyConnection(t *testing.T) {
+	server := newFakeRedis(t)
+
+	c, err := NewRedisCache(RedisOptions{Addr: server.listener.Addr().String(), PoolSize: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer c.Close()
+
+	// Hold the only pooled connection as a slow command would; other
+	// callers must not wait for it
+	busy := <-c.idle
+	defer busy.conn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		c.Set("key", "value", 0)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Set to proceed while another connection is busy")
+	}
+
+	var value string
+	if !Load(c, "key", &value) || value != "value" {
+		t.Errorf("Expected stored value, got %q", value)
+	}
+}
+
+func TestNewRedisCache_Unreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	if _, err := NewRedisCache(RedisOptions{Addr: addr, DialTimeout: 100 * time.Millisecond}); err == nil {
+		t.Errorf("Expected error for unreachable Redis")
+	}
+}
+
+// TestRedisCache_Integration runs against a real server when REDIS_TEST_ADDR is set
+func TestRedisCache_Integration(t *testing.T) {
+	addr := os.Getenv("REDIS_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_TEST_ADDR not set")
+	}
+
+	c, err := NewRedisCache(RedisOptions{Addr: addr, KeyPrefix: fmt.Sprintf("test-%d:", time.Now().UnixNano())})
+	if err != nil {
+		t.Fatalf("Failed to connect to Redis at %s: %v", addr, err)
+	}
+	defer c.Close()
+
+	c.Set("city", cachedCity{Name: "Berlin", Population: 3600000}, time.Second)
+
+	var city cachedCity
+	if !Load(c, "city", &city) || city.Name != "Berlin" {
+		t.Errorf("Expected Berlin, got %+v", city)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if _, found := c.Get("city"); found {
+		t.Errorf("Expected key to expire")
+	}
+}
@@ -0,0 +1,47 @@
+package cache
+
+import "sync/atomic"
+
+// Stats describes how effective a cache has been since it was created
+type Stats struct {
+	// Size is the number of stored entries, or -1 when the backend cannot
+	// tell cheaply
+	Size   int    `json:"size" xml:"size"`
+	Hits   uint64 `json:"hits" xml:"hits"`
+	Misses uint64 `json:"misses" xml:"misses"`
+	// HitRatio is Hits over all lookups, or 0 before the first lookup
+	HitRatio float64 `json:"hit_ratio" xml:"hit_ratio"`
+}
+
+// StatsReporter is implemented by caches that count their hits and misses
+type StatsReporter interface {
+	Stats() Stats
+}
+
+// counters tracks cache lookups; it is safe for concurrent use
+type counters struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// record counts one lookup as a hit or a miss
+func (c *counters) record(hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// stats returns the counts along with size
+func (c *counters) stats(size int) Stats {
+	stats := Stats{
+		Size:   size,
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(lookups)
+	}
+	return stats
+}
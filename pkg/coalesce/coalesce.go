@@ -0,0 +1,87 @@
+// Package coalesce lets concurrent callers asking for the same key share a
+// single call, so a burst of identical requests reaches the upstream once.
+package coalesce
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Group coalesces calls by key. The zero value is ready to use.
+type Group[T any] struct {
+	mutex sync.Mutex
+	calls map[string]*call[T]
+}
+
+// call is one in-flight function call and the callers waiting on it
+type call[T any] struct {
+	done    chan struct{}
+	value   T
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// Do calls fn once for all concurrent callers of the same key and returns
+// its result to each of them. fn runs with a context that keeps ctx's values
+// but is only canceled once every waiting caller has given up, so one
+// impatient caller does not fail the others. A caller whose ctx is done
+// stops waiting and gets ctx.Err().
+//
+// The value is shared between callers; copy it before modifying it.
+func (g *Group[T]) Do(ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call[T])
+	}
+	c, inFlight := g.calls[key]
+	if !inFlight {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &call[T]{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go g.run(callCtx, key, c, fn)
+	}
+	c.waiters++
+	g.mutex.Unlock()
+
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		g.mutex.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// Nobody is left to use the result; later callers start afresh
+			c.cancel()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		}
+		g.mutex.Unlock()
+
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// run executes fn for c, turning a panic into an error since it runs on its
+// own goroutine where no recovery middleware can catch it
+func (g *Group[T]) run(ctx context.Context, key string, c *call[T], fn func(ctx context.Context) (T, error)) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			c.err = fmt.Errorf("coalesced call for %q panicked: %v", key, recovered)
+		}
+
+		g.mutex.Lock()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		g.mutex.Unlock()
+
+		c.cancel()
+		close(c.done)
+	}()
+
+	c.value, c.err = fn(ctx)
+}
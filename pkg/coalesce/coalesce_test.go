@@ -0,0 +1,146 @@
+package coalesce
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroup_SharesConcurrentCalls(t *testing.T) {
+	var group Group[int]
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	const callers = 10
+	var started, finished sync.WaitGroup
+	results := make([]int, callers)
+	for i := 0; i < callers; i++ {
+		started.Add(1)
+		finished.Add(1)
+		go func(i int) {
+			defer finished.Done()
+			started.Done()
+			value, err := group.Do(context.Background(), "key", func(ctx context.Context) (int, error) {
+				calls.Add(1)
+				<-release
+				return 42, nil
+			})
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			results[i] = value
+		}(i)
+	}
+
+	started.Wait()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	finished.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected 1 call, got %d", got)
+	}
+	for i, value := range results {
+		if value != 42 {
+			t.Errorf("Expected caller %d to get 42, got %d", i, value)
+		}
+	}
+}
+
+func TestGroup_SequentialCallsAreNotShared(t *testing.T) {
+	var group Group[int]
+	calls := 0
+	for i := 0; i < 3; i++ {
+		group.Do(context.Background(), "key", func(ctx context.Context) (int, error) {
+			calls++
+			return calls, nil
+		})
+	}
+
+	if calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+}
+
+func TestGroup_CanceledCaller(t *testing.T) {
+	var group Group[string]
+	release := make(chan struct{})
+
+	fn := func(ctx context.Context) (string, error) {
+		select {
+		case <-release:
+			return "done", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	impatient, cancelImpatient := context.WithCancel(context.Background())
+	patient, cancelPatient := context.WithCancel(context.Background())
+	defer cancelPatient()
+
+	impatientErr := make(chan error, 1)
+	go func() {
+		_, err := group.Do(impatient, "key", fn)
+		impatientErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	patientResult := make(chan string, 1)
+	go func() {
+		value, _ := group.Do(patient, "key", fn)
+		patientResult <- value
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	t.Run("one caller giving up does not cancel the call", func(t *testing.T) {
+		cancelImpatient()
+		if err := <-impatientErr; !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+
+		close(release)
+		if value := <-patientResult; value != "done" {
+			t.Errorf("Expected the remaining caller to get the result, got %q", value)
+		}
+	})
+
+	t.Run("the call is canceled once every caller gives up", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		never := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			group.Do(ctx, "other", func(ctx context.Context) (string, error) {
+				select {
+				case <-never:
+				case <-ctx.Done():
+					close(done)
+				}
+				return "", ctx.Err()
+			})
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the call to be canceled")
+		}
+	})
+}
+
+func TestGroup_Panic(t *testing.T) {
+	var group Group[int]
+	_, err := group.Do(context.Background(), "key", func(ctx context.Context) (int, error) {
+		panic("boom")
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("Expected the panic to be returned as an error, got %v", err)
+	}
+}
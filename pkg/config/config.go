@@ -0,0 +1,432 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/cache"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/server"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/stock"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/weather"
+)
+
+// AppConfig holds the complete application configuration
+type AppConfig struct {
+	Server  server.Config
+	Stock   StockConfig
+	Weather WeatherConfig
+	Cache   CacheConfig
+
+	// LogLevel is the minimum level written to the log (debug, info, warn, error)
+	LogLevel string
+
+	// MaxUpstreamConcurrency limits concurrent requests to each upstream;
+	// zero removes the limit
+	MaxUpstreamConcurrency int
+
+	// MaxResponseBytes caps the size of upstream response bodies
+	MaxResponseBytes int
+
+	// UserAgent replaces the User-Agent sent to both upstreams; empty keeps
+	// each client's default
+	UserAgent string
+}
+
+// StockConfig holds stock service options
+type StockConfig struct {
+	// RateLimit is the minimum delay between upstream quote requests
+	RateLimit time.Duration
+	// BaseURL is the primary Yahoo Finance quote endpoint
+	BaseURL string
+	// FallbackBaseURL is tried when BaseURL fails; empty disables failover
+	FallbackBaseURL string
+	// CrumbHandshake sends a session crumb with quote requests
+	CrumbHandshake bool
+	// Decimals is how many decimal places prices and changes are rounded
+	// to; negative keeps the upstream precision
+	Decimals int
+	// RepairChangePercentSign recomputes the change percent from the change
+	// and previous close when the upstream values disagree in sign
+	RepairChangePercentSign bool
+	// CacheTTL is how long quotes are served from cache; zero disables caching
+	CacheTTL time.Duration
+	// ResponseBudget serves demo data instead of a live quote expected to
+	// take longer; zero disables the budget
+	ResponseBudget time.Duration
+	// FallbackCodes lists the upstream status codes answered with demo data,
+	// e.g. "401,403,429,5xx"; "none" disables the fallback
+	FallbackCodes string
+	// RefreshSymbols are fetched in the background every RefreshInterval to
+	// keep their cached quotes warm; empty disables the refresh
+	RefreshSymbols  []string
+	RefreshInterval time.Duration
+	// CompanyNamesFile is a JSON file mapping symbols to the company names
+	// shown in stock summaries; empty uses the upstream names
+	CompanyNamesFile string
+	// AllowedSymbols, when not empty, lists the only symbols that can be
+	// quoted; DeniedSymbols can never be quoted
+	AllowedSymbols []string
+	DeniedSymbols  []string
+	// AlertsFile is a JSON file of alert rules posting quotes to webhooks
+	// when their change crosses a threshold; empty disables alerts
+	AlertsFile string
+}
+
+// WeatherConfig holds weather service options
+type WeatherConfig struct {
+	// BaseURL is the Open-Meteo forecast endpoint
+	BaseURL string
+	// GeocodeBaseURL is the Open-Meteo geocoding endpoint
+	GeocodeBaseURL string
+	// StaleThreshold is the observation age past which responses are flagged
+	// as stale; zero disables the check
+	StaleThreshold time.Duration
+	// TransliterateCityNames strips accents from city names sent to the
+	// geocoding API
+	TransliterateCityNames bool
+}
+
+// Cache backends selectable with CacheConfig.Backend
+const (
+	CacheBackendMemory = "memory"
+	CacheBackendRedis  = "redis"
+)
+
+// CacheConfig selects where weather, geocoding, and stock results are cached
+type CacheConfig struct {
+	// Backend is either "memory" or "redis"
+	Backend        string
+	RedisAddr      string
+	RedisPassword  string
+	RedisDB        int
+	RedisKeyPrefix string
+}
+
+// Duration is a time.Duration that is written as a string such as "10s" in config files
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string like "1m30s"
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"10s\": %v", err)
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+	return nil
+}
+
+// fileConfig mirrors the on-disk layout of the configuration file
+type fileConfig struct {
+	LogLevel               string `json:"log_level"`
+	MaxUpstreamConcurrency int    `json:"max_upstream_concurrency"`
+	MaxResponseBytes       int    `json:"max_response_bytes"`
+	UserAgent              string `json:"user_agent"`
+	Server                 struct {
+		Host                string   `json:"host"`
+		Port                int      `json:"port"`
+		AdminPort           int      `json:"admin_port"`
+		ReadTimeout         Duration `json:"read_timeout"`
+		WriteTimeout        Duration `json:"write_timeout"`
+		IdleTimeout         Duration `json:"idle_timeout"`
+		ReadinessMaxAge     Duration `json:"readiness_max_age"`
+		RequestTimeout      Duration `json:"request_timeout"`
+		DebugEndpoints      bool     `json:"debug_endpoints"`
+		PrettyJSON          bool     `json:"pretty_json"`
+		MaxURLBytes         int      `json:"max_url_bytes"`
+		TLSCert             string   `json:"tls_cert"`
+		TLSKey              string   `json:"tls_key"`
+		CORSOrigins         []string `json:"cors_origins"`
+		TrustProxyHeaders   bool     `json:"trust_proxy_headers"`
+		TrustedProxyHeaders []string `json:"trusted_proxy_headers"`
+		Maintenance         bool     `json:"maintenance"`
+	} `json:"server"`
+	Stock struct {
+		RateLimit       Duration `json:"rate_limit"`
+		BaseURL         string   `json:"base_url"`
+		FallbackBaseURL string   `json:"fallback_base_url"`
+		CrumbHandshake  bool     `json:"crumb_handshake"`
+		Decimals        int      `json:"decimals"`
+		RepairSign      bool     `json:"repair_change_percent_sign"`
+		CacheTTL        Duration `json:"cache_ttl"`
+		ResponseBudget  Duration `json:"response_budget"`
+		FallbackCodes   string   `json:"fallback_codes"`
+		RefreshSymbols  []string `json:"refresh_symbols"`
+		RefreshInterval Duration `json:"refresh_interval"`
+		CompanyNames    string   `json:"company_names_file"`
+		AllowedSymbols  []string `json:"allowed_symbols"`
+		DeniedSymbols   []string `json:"denied_symbols"`
+		AlertsFile      string   `json:"alerts_file"`
+	} `json:"stock"`
+	Weather struct {
+		BaseURL        string   `json:"base_url"`
+		GeocodeBaseURL string   `json:"geocode_base_url"`
+		StaleThreshold Duration `json:"stale_threshold"`
+		Transliterate  bool     `json:"transliterate_city_names"`
+	} `json:"weather"`
+	Cache struct {
+		Backend        string `json:"backend"`
+		RedisAddr      string `json:"redis_addr"`
+		RedisPassword  string `json:"redis_password"`
+		RedisDB        int    `json:"redis_db"`
+		RedisKeyPrefix string `json:"redis_key_prefix"`
+	} `json:"cache"`
+}
+
+// Default returns the configuration used when no file, flags, or env vars are set
+func Default() *AppConfig {
+	return &AppConfig{
+		Server: *server.DefaultConfig(),
+		Stock: StockConfig{
+			RateLimit:       stock.DefaultRateLimit,
+			BaseURL:         stock.DefaultBaseURL,
+			FallbackBaseURL: stock.DefaultFallbackBaseURL,
+			CacheTTL:        stock.DefaultCacheTTL,
+			FallbackCodes:   stock.DefaultFallbackCodes,
+			RefreshInterval: stock.DefaultRefreshInterval,
+			Decimals:        models.DefaultStockDecimals,
+		},
+		Weather: WeatherConfig{
+			BaseURL:        weather.DefaultWeatherBaseURL,
+			GeocodeBaseURL: weather.DefaultGeocodeBaseURL,
+			StaleThreshold: weather.DefaultStaleThreshold,
+		},
+		Cache: CacheConfig{
+			Backend:        CacheBackendMemory,
+			RedisKeyPrefix: cache.DefaultRedisKeyPrefix,
+		},
+		LogLevel:               logging.LevelInfo.String(),
+		MaxUpstreamConcurrency: stock.DefaultMaxConcurrency,
+		MaxResponseBytes:       models.DefaultMaxResponseBytes,
+	}
+}
+
+// Load reads a configuration file on top of the defaults. Files ending in
+// .yaml or .yml are decoded as YAML, others as JSON; unknown keys are
+// reported as errors.
+func Load(path string) (*AppConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	parse := Parse
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		parse = ParseYAML
+	}
+	config, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Parse decodes configuration data on top of the defaults and validates the result
+func Parse(data []byte) (*AppConfig, error) {
+	config := Default()
+	file := config.toFile()
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return nil, err
+	}
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the configuration object")
+	}
+
+	config.fromFile(file)
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Validate checks that all values are within acceptable ranges
+func (c *AppConfig) Validate() error {
+	if c.Server.Port < 0 || c.Server.Port > 65535 {
+		return fmt.Errorf("server port %d out of range", c.Server.Port)
+	}
+	if c.Server.AdminPort < 0 || c.Server.AdminPort > 65535 {
+		return fmt.Errorf("admin port %d out of range", c.Server.AdminPort)
+	}
+	if c.Server.AdminPort != 0 && c.Server.AdminPort == c.Server.Port {
+		return fmt.Errorf("admin port %d must differ from the server port", c.Server.AdminPort)
+	}
+
+	durations := map[string]time.Duration{
+		"read_timeout":           c.Server.ReadTimeout,
+		"write_timeout":          c.Server.WriteTimeout,
+		"idle_timeout":           c.Server.IdleTimeout,
+		"readiness_max_age":      c.Server.ReadinessMaxAge,
+		"request_timeout":        c.Server.RequestTimeout,
+		"rate_limit":             c.Stock.RateLimit,
+		"stock.cache_ttl":        c.Stock.CacheTTL,
+		"stock.response_budget":  c.Stock.ResponseBudget,
+		"stock.refresh_interval": c.Stock.RefreshInterval,
+		"stale_threshold":        c.Weather.StaleThreshold,
+	}
+	for name, value := range durations {
+		if value < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+
+	if c.Server.MaxURLBytes < 0 {
+		return fmt.Errorf("max_url_bytes must not be negative")
+	}
+	if c.MaxUpstreamConcurrency < 0 {
+		return fmt.Errorf("max_upstream_concurrency must not be negative")
+	}
+	if c.MaxResponseBytes <= 0 {
+		return fmt.Errorf("max_response_bytes must be positive")
+	}
+	if _, err := stock.ParseFallbackCodes(c.Stock.FallbackCodes); err != nil {
+		return fmt.Errorf("stock.fallback_codes: %v", err)
+	}
+
+	endpoints := map[string]string{
+		"weather.base_url":         c.Weather.BaseURL,
+		"weather.geocode_base_url": c.Weather.GeocodeBaseURL,
+		"stock.base_url":           c.Stock.BaseURL,
+	}
+	if c.Stock.FallbackBaseURL != "" {
+		endpoints["stock.fallback_base_url"] = c.Stock.FallbackBaseURL
+	}
+	for name, value := range endpoints {
+		parsed, err := url.Parse(value)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("%s must be an absolute http or https URL, got %q", name, value)
+		}
+	}
+
+	switch c.Cache.Backend {
+	case CacheBackendMemory:
+	case CacheBackendRedis:
+		if c.Cache.RedisAddr == "" {
+			return fmt.Errorf("redis cache backend requires redis_addr")
+		}
+	default:
+		return fmt.Errorf("unknown cache backend %q (expected %s or %s)", c.Cache.Backend, CacheBackendMemory, CacheBackendRedis)
+	}
+
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		return err
+	}
+
+	return c.Server.Validate()
+}
+
+// toFile copies the current values into the file layout so missing keys keep them
+func (c *AppConfig) toFile() fileConfig {
+	var file fileConfig
+	file.LogLevel = c.LogLevel
+	file.MaxUpstreamConcurrency = c.MaxUpstreamConcurrency
+	file.MaxResponseBytes = c.MaxResponseBytes
+	file.UserAgent = c.UserAgent
+	file.Server.Host = c.Server.Host
+	file.Server.Port = c.Server.Port
+	file.Server.AdminPort = c.Server.AdminPort
+	file.Server.ReadTimeout = Duration(c.Server.ReadTimeout)
+	file.Server.WriteTimeout = Duration(c.Server.WriteTimeout)
+	file.Server.IdleTimeout = Duration(c.Server.IdleTimeout)
+	file.Server.ReadinessMaxAge = Duration(c.Server.ReadinessMaxAge)
+	file.Server.RequestTimeout = Duration(c.Server.RequestTimeout)
+	file.Server.DebugEndpoints = c.Server.DebugEndpoints
+	file.Server.PrettyJSON = c.Server.PrettyJSON
+	file.Server.MaxURLBytes = c.Server.MaxURLBytes
+	file.Server.TLSCert = c.Server.CertFile
+	file.Server.TLSKey = c.Server.KeyFile
+	file.Server.CORSOrigins = c.Server.CORSOrigins
+	file.Server.TrustProxyHeaders = c.Server.TrustProxyHeaders
+	file.Server.TrustedProxyHeaders = c.Server.TrustedProxyHeaders
+	file.Server.Maintenance = c.Server.Maintenance
+	file.Stock.RateLimit = Duration(c.Stock.RateLimit)
+	file.Stock.BaseURL = c.Stock.BaseURL
+	file.Stock.FallbackBaseURL = c.Stock.FallbackBaseURL
+	file.Stock.CrumbHandshake = c.Stock.CrumbHandshake
+	file.Stock.Decimals = c.Stock.Decimals
+	file.Stock.RepairSign = c.Stock.RepairChangePercentSign
+	file.Stock.CacheTTL = Duration(c.Stock.CacheTTL)
+	file.Stock.ResponseBudget = Duration(c.Stock.ResponseBudget)
+	file.Stock.FallbackCodes = c.Stock.FallbackCodes
+	file.Stock.RefreshSymbols = c.Stock.RefreshSymbols
+	file.Stock.RefreshInterval = Duration(c.Stock.RefreshInterval)
+	file.Stock.CompanyNames = c.Stock.CompanyNamesFile
+	file.Stock.AllowedSymbols = c.Stock.AllowedSymbols
+	file.Stock.DeniedSymbols = c.Stock.DeniedSymbols
+	file.Stock.AlertsFile = c.Stock.AlertsFile
+	file.Weather.BaseURL = c.Weather.BaseURL
+	file.Weather.GeocodeBaseURL = c.Weather.GeocodeBaseURL
+	file.Weather.StaleThreshold = Duration(c.Weather.StaleThreshold)
+	file.Weather.Transliterate = c.Weather.TransliterateCityNames
+	file.Cache.Backend = c.Cache.Backend
+	file.Cache.RedisAddr = c.Cache.RedisAddr
+	file.Cache.RedisPassword = c.Cache.RedisPassword
+	file.Cache.RedisDB = c.Cache.RedisDB
+	file.Cache.RedisKeyPrefix = c.Cache.RedisKeyPrefix
+	return file
+}
+
+// fromFile applies decoded file values to the configuration
+func (c *AppConfig) fromFile(file fileConfig) {
+	c.LogLevel = file.LogLevel
+	c.MaxUpstreamConcurrency = file.MaxUpstreamConcurrency
+	c.MaxResponseBytes = file.MaxResponseBytes
+	c.UserAgent = file.UserAgent
+	c.Server.Host = file.Server.Host
+	c.Server.Port = file.Server.Port
+	c.Server.AdminPort = file.Server.AdminPort
+	c.Server.ReadTimeout = time.Duration(file.Server.ReadTimeout)
+	c.Server.WriteTimeout = time.Duration(file.Server.WriteTimeout)
+	c.Server.IdleTimeout = time.Duration(file.Server.IdleTimeout)
+	c.Server.ReadinessMaxAge = time.Duration(file.Server.ReadinessMaxAge)
+	c.Server.RequestTimeout = time.Duration(file.Server.RequestTimeout)
+	c.Server.DebugEndpoints = file.Server.DebugEndpoints
+	c.Server.PrettyJSON = file.Server.PrettyJSON
+	c.Server.MaxURLBytes = file.Server.MaxURLBytes
+	c.Server.CertFile = file.Server.TLSCert
+	c.Server.KeyFile = file.Server.TLSKey
+	c.Server.CORSOrigins = file.Server.CORSOrigins
+	c.Server.TrustProxyHeaders = file.Server.TrustProxyHeaders
+	c.Server.TrustedProxyHeaders = file.Server.TrustedProxyHeaders
+	c.Server.Maintenance = file.Server.Maintenance
+	c.Stock.RateLimit = time.Duration(file.Stock.RateLimit)
+	c.Stock.BaseURL = file.Stock.BaseURL
+	c.Stock.FallbackBaseURL = file.Stock.FallbackBaseURL
+	c.Stock.CrumbHandshake = file.Stock.CrumbHandshake
+	c.Stock.Decimals = file.Stock.Decimals
+	c.Stock.RepairChangePercentSign = file.Stock.RepairSign
+	c.Stock.CacheTTL = time.Duration(file.Stock.CacheTTL)
+	c.Stock.ResponseBudget = time.Duration(file.Stock.ResponseBudget)
+	c.Stock.FallbackCodes = file.Stock.FallbackCodes
+	c.Stock.RefreshSymbols = file.Stock.RefreshSymbols
+	c.Stock.RefreshInterval = time.Duration(file.Stock.RefreshInterval)
+	c.Stock.CompanyNamesFile = file.Stock.CompanyNames
+	c.Stock.AllowedSymbols = file.Stock.AllowedSymbols
+	c.Stock.DeniedSymbols = file.Stock.DeniedSymbols
+	c.Stock.AlertsFile = file.Stock.AlertsFile
+	c.Weather.BaseURL = file.Weather.BaseURL
+	c.Weather.GeocodeBaseURL = file.Weather.GeocodeBaseURL
+	c.Weather.StaleThreshold = time.Duration(file.Weather.StaleThreshold)
+	c.Weather.TransliterateCityNames = file.Weather.Transliterate
+	c.Cache.Backend = file.Cache.Backend
+	c.Cache.RedisAddr = file.Cache.RedisAddr
+	c.Cache.RedisPassword = file.Cache.RedisPassword
+	c.Cache.RedisDB = file.Cache.RedisDB
+	c.Cache.RedisKeyPrefix = file.Cache.RedisKeyPrefix
+}
@@ -0,0 +1,294 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		wantError bool
+		errorMsg  string
+		check     func(t *testing.T, config *AppConfig)
+	}{
+		{
+			name: "full configuration",
+			data: `{
+				"server": {
+					"host": "0.0.0.0",
+					"port": 8080,
+					"read_timeout": "5s",
+					"write_timeout": "15s",
+					"idle_timeout": "2m",
+					"cors_origins": ["https://example.com"],
+					"trusted_proxy_headers": ["CF-Connecting-IP"]
+				},
+				"stock": {"rate_limit": "500ms"}
+			}`,
+			check: func(t *testing.T, config *AppConfig) {
+				if config.Server.Host != "0.0.0.0" || config.Server.Port != 8080 {
+					t.Errorf("Expected 0.0.0.0:8080, got %s:%d", config.Server.Host, config.Server.Port)
+				}
+				if config.Server.ReadTimeout != 5*time.Second || config.Server.IdleTimeout != 2*time.Minute {
+					t.Errorf("Unexpected timeouts: %+v", config.Server)
+				}
+				if len(config.Server.CORSOrigins) != 1 || config.Server.CORSOrigins[0] != "https://example.com" {
+					t.Errorf("Unexpected CORS origins: %v", config.Server.CORSOrigins)
+				}
+				if len(config.Server.TrustedProxyHeaders) != 1 || config.Server.TrustedProxyHeaders[0] != "CF-Connecting-IP" {
+					t.Errorf("Unexpected trusted proxy headers: %v", config.Server.TrustedProxyHeaders)
+				}
+				if config.Stock.RateLimit != 500*time.Millisecond {
+					t.Errorf("Expected rate limit 500ms, got %v", config.Stock.RateLimit)
+				}
+			},
+		},
+		{
+			name: "missing keys keep defaults",
+			data: `{"server": {"port": 9090}}`,
+			check: func(t *testing.T, config *AppConfig) {
+				defaults := Default()
+				if config.Server.Host != defaults.Server.Host {
+					t.Errorf("Expected default host %s, got %s", defaults.Server.Host, config.Server.Host)
+				}
+				if config.Server.WriteTimeout != defaults.Server.WriteTimeout {
+					t.Errorf("Expected default write timeout, got %v", config.Server.WriteTimeout)
+				}
+				if config.Stock.RateLimit != defaults.Stock.RateLimit {
+					t.Errorf("Expected default rate limit, got %v", config.Stock.RateLimit)
+				}
+			},
+		},
+		{
+			name:      "unknown key",
+			data:      `{"server": {"hots": "localhost"}}`,
+			wantError: true,
+			errorMsg:  `unknown field "hots"`,
+		},
+		{
+			name:      "invalid duration",
+			data:      `{"server": {"read_timeout": "soon"}}`,
+			wantError: true,
+			errorMsg:  "soon",
+		},
+		{
+			name: "log level",
+			data: `{"log_level": "warn"}`,
+			check: func(t *testing.T, config *AppConfig) {
+				if config.LogLevel != "warn" {
+					t.Errorf("Expected log level warn, got %s", config.LogLevel)
+				}
+			},
+		},
+		{
+			name:      "unknown log level",
+			data:      `{"log_level": "loud"}`,
+			wantError: true,
+			errorMsg:  "unknown log level",
+		},
+		{
+			name: "redis cache",
+			data: `{"cache": {"backend": "redis", "redis_addr": "redis:6379", "redis_db": 2}}`,
+			check: func(t *testing.T, config *AppConfig) {
+				if config.Cache.Backend != CacheBackendRedis || config.Cache.RedisAddr != "redis:6379" || config.Cache.RedisDB != 2 {
+					t.Errorf("Unexpected cache config: %+v", config.Cache)
+				}
+				if config.Cache.RedisKeyPrefix != Default().Cache.RedisKeyPrefix {
+					t.Errorf("Expected default key prefix, got %q", config.Cache.RedisKeyPrefix)
+				}
+			},
+		},
+		{
+			name:      "redis cache without address",
+			data:      `{"cache": {"backend": "redis"}}`,
+			wantError: true,
+			errorMsg:  "requires redis_addr",
+		},
+		{
+			name:      "unknown cache backend",
+			data:      `{"cache": {"backend": "memcached"}}`,
+			wantError: true,
+			errorMsg:  "unknown cache backend",
+		},
+		{
+			name: "stock change sign repair",
+			data: `{"stock": {"repair_change_percent_sign": true}}`,
+			check: func(t *testing.T, config *AppConfig) {
+				if !config.Stock.RepairChangePercentSign {
+					t.Errorf("Expected change sign repair enabled, got %v", config.Stock.RepairChangePercentSign)
+				}
+			},
+		},
+		{
+			name: "weather base URLs",
+			data: `{"weather": {"base_url": "http://localhost:8080/v1/forecast"}}`,
+			check: func(t *testing.T, config *AppConfig) {
+				if config.Weather.BaseURL != "http://localhost:8080/v1/forecast" {
+					t.Errorf("Expected custom base URL, got %s", config.Weather.BaseURL)
+				}
+				if config.Weather.GeocodeBaseURL != Default().Weather.GeocodeBaseURL {
+					t.Errorf("Expected default geocode URL, got %s", config.Weather.GeocodeBaseURL)
+				}
+			},
+		},
+		{
+			name:      "relative weather base URL",
+			data:      `{"weather": {"geocode_base_url": "/v1/search"}}`,
+			wantError: true,
+			errorMsg:  "geocode_base_url must be an absolute",
+		},
+		{
+			name: "stock failover disabled",
+			data: `{"stock": {"base_url": "https://query2.finance.yahoo.com/v8/finance/quote", "fallback_base_url": ""}}`,
+			check: func(t *testing.T, config *AppConfig) {
+				if config.Stock.BaseURL != "https://query2.finance.yahoo.com/v8/finance/quote" || config.Stock.FallbackBaseURL != "" {
+					t.Errorf("Unexpected stock endpoints: %+v", config.Stock)
+				}
+			},
+		},
+		{
+			name:      "port out of range",
+			data:      `{"server": {"port": 70000}}`,
+			wantError: true,
+			errorMsg:  "out of range",
+		},
+		{
+			name:      "invalid stock fallback codes",
+			data:      `{"stock": {"fallback_codes": "404,teapot"}}`,
+			wantError: true,
+			errorMsg:  "fallback_codes",
+		},
+		{
+			name:      "zero max response bytes",
+			data:      `{"max_response_bytes": 0}`,
+			wantError: true,
+			errorMsg:  "max_response_bytes",
+		},
+		{
+			name:      "admin port equal to server port",
+			data:      `{"server": {"port": 8080, "admin_port": 8080}}`,
+			wantError: true,
+			errorMsg:  "must differ",
+		},
+		{
+			name:      "TLS certificate without key",
+			data:      `{"server": {"tls_cert": "cert.pem"}}`,
+			wantError: true,
+			errorMsg:  "both a certificate and a key",
+		},
+		{
+			name:      "trailing data",
+			data:      `{} {}`,
+			wantError: true,
+			errorMsg:  "unexpected data",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := Parse([]byte(tt.data))
+
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+					return
+				}
+				if !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Errorf("Expected error message to contain '%s', got: %v", tt.errorMsg, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			tt.check(t, config)
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(`{"server": {"port": 4000}}`), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if config.Server.Port != 4000 {
+		t.Errorf("Expected port 4000, got %d", config.Server.Port)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("Expected error for missing file")
+	}
+}
+
+func TestLoad_YAML(t *testing.T) {
+	config, err := Load(filepath.Join("testdata", "config.yaml"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if config.LogLevel != "debug" || config.MaxUpstreamConcurrency != 4 {
+		t.Errorf("Expected log level debug and concurrency 4, got %s and %d", config.LogLevel, config.MaxUpstreamConcurrency)
+	}
+	if config.Server.Port != 9090 || config.Server.ReadTimeout != 20*time.Second || !config.Server.PrettyJSON {
+		t.Errorf("Unexpected server config: %+v", config.Server)
+	}
+	if len(config.Server.CORSOrigins) != 2 || config.Server.CORSOrigins[1] != "https://admin.example.com" {
+		t.Errorf("Expected two CORS origins, got %v", config.Server.CORSOrigins)
+	}
+	if config.Stock.RateLimit != 2*time.Second || config.Stock.FallbackCodes != "429,5xx" {
+		t.Errorf("Unexpected stock config: %+v", config.Stock)
+	}
+	if len(config.Stock.RefreshSymbols) != 2 || config.Stock.RefreshSymbols[1] != "AAPL" {
+		t.Errorf("Expected refresh symbols [DDOG AAPL], got %v", config.Stock.RefreshSymbols)
+	}
+	if len(config.Stock.DeniedSymbols) != 1 || config.Stock.DeniedSymbols[0] != "GME" {
+		t.Errorf("Expected denied symbols [GME], got %v", config.Stock.DeniedSymbols)
+	}
+	if config.Weather.StaleThreshold != 30*time.Minute || !config.Weather.TransliterateCityNames {
+		t.Errorf("Unexpected weather config: %+v", config.Weather)
+	}
+	if config.Cache.RedisKeyPrefix != "app:" {
+		t.Errorf("Expected redis key prefix app:, got %q", config.Cache.RedisKeyPrefix)
+	}
+	// Unset values keep their defaults
+	if config.Stock.BaseURL != Default().Stock.BaseURL {
+		t.Errorf("Expected the default stock base URL, got %s", config.Stock.BaseURL)
+	}
+}
+
+func TestParseYAML_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unknown key", "server:\n  prot: 8080\n"},
+		{"wrong type", "server:\n  port: eighty\n"},
+		{"bad indentation", "server:\n  port: 8080\n    host: x\n"},
+		{"tab indentation", "server:\n\tport: 8080\n"},
+		{"not a mapping", "- port\n"},
+		{"duplicate key", "log_level: info\nlog_level: debug\n"},
+		{"invalid value", "server:\n  port: 70000\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseYAML([]byte(tt.content)); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseYAML decodes YAML configuration data on top of the defaults and
+// validates the result. It understands the subset of YAML a configuration
+// file needs: nested block mappings, block and flow sequences of scalars,
+// quoted and plain scalars, and comments. JSON syntax is accepted as is.
+func ParseYAML(data []byte) (*AppConfig, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		return Parse(data)
+	}
+
+	lines, err := yamlLines(string(data))
+	if err != nil {
+		return nil, err
+	}
+	parser := yamlParser{lines: lines}
+	root, err := parser.mapping(0)
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(parser.lines) {
+		line := parser.lines[parser.pos]
+		return nil, fmt.Errorf("yaml line %d: unexpected indentation", line.number)
+	}
+
+	// Going through JSON keeps the strict decoding and validation of Parse
+	encoded, err := json.Marshal(root)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(encoded)
+}
+
+// yamlLine is a non-empty line with its indentation and comment removed
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// yamlLines splits data into meaningful lines, dropping blank lines,
+// comments, and document markers
+func yamlLines(data string) ([]yamlLine, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(data, "\n") {
+		raw = strings.TrimRight(raw, "\r")
+		content := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(content, "\t") {
+			return nil, fmt.Errorf("yaml line %d: tabs cannot be used for indentation", i+1)
+		}
+		content = strings.TrimSpace(stripYAMLComment(content))
+		if content == "" || content == "---" {
+			continue
+		}
+		lines = append(lines, yamlLine{number: i + 1, indent: len(raw) - len(strings.TrimLeft(raw, " ")), text: content})
+	}
+	return lines, nil
+}
+
+// stripYAMLComment removes a trailing comment, leaving '#' inside quotes or
+// within a word alone
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' '):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// yamlParser builds a tree of maps, slices, and scalars from lines
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// mapping parses the key: value lines at indent into a map
+func (p *yamlParser) mapping(indent int) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml line %d: unexpected indentation", line.number)
+		}
+
+		key, value, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("yaml line %d: expected \"key: value\"", line.number)
+		}
+		if _, exists := result[key]; exists {
+			return nil, fmt.Errorf("yaml line %d: duplicate key %q", line.number, key)
+		}
+		p.pos++
+
+		if value != "" {
+			parsed, err := yamlValue(value, line.number)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = parsed
+			continue
+		}
+
+		result[key] = nil
+		if p.pos == len(p.lines) {
+			continue
+		}
+		next := p.lines[p.pos]
+		switch {
+		case strings.HasPrefix(next.text, "- ") || next.text == "-":
+			// Sequences may sit at the same indentation as their key
+			if next.indent < line.indent {
+				continue
+			}
+			items, err := p.sequence(next.indent)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = items
+		case next.indent > line.indent:
+			nested, err := p.mapping(next.indent)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = nested
+		}
+	}
+	return result, nil
+}
+
+// sequence parses the "- item" lines at indent into a slice of scalars
+func (p *yamlParser) sequence(indent int) ([]interface{}, error) {
+	items := []interface{}{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || !(strings.HasPrefix(line.text, "- ") || line.text == "-") {
+			break
+		}
+		item := strings.TrimSpace(strings.TrimPrefix(line.text, "-"))
+		if _, _, nested := splitYAMLKey(item); nested || item == "" {
+			return nil, fmt.Errorf("yaml line %d: sequence items must be scalars", line.number)
+		}
+		value, err := yamlValue(item, line.number)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+		p.pos++
+	}
+	return items, nil
+}
+
+// splitYAMLKey splits "key: value" at the first colon outside quotes that is
+// followed by a space or ends the line
+func splitYAMLKey(text string) (key, value string, ok bool) {
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") || strings.HasPrefix(text, "[") {
+		return "", "", false
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			key = strings.TrimSpace(text[:i])
+			return key, strings.TrimSpace(text[i+1:]), key != ""
+		}
+	}
+	return "", "", false
+}
+
+// yamlValue parses a scalar or a flow sequence of scalars
+func yamlValue(value string, number int) (interface{}, error) {
+	switch {
+	case value == "{}":
+		return map[string]interface{}{}, nil
+	case strings.HasPrefix(value, "["):
+		if !strings.HasSuffix(value, "]") {
+			return nil, fmt.Errorf("yaml line %d: unterminated flow sequence", number)
+		}
+		items := []interface{}{}
+		inner := strings.TrimSpace(value[1 : len(value)-1])
+		if inner == "" {
+			return items, nil
+		}
+		for _, item := range splitFlowItems(inner) {
+			parsed, err := yamlScalar(strings.TrimSpace(item), number)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, parsed)
+		}
+		return items, nil
+	case strings.HasPrefix(value, "{"):
+		return nil, fmt.Errorf("yaml line %d: flow mappings are not supported; use nested keys", number)
+	}
+	return yamlScalar(value, number)
+}
+
+// splitFlowItems splits a flow sequence body at commas outside quotes
+func splitFlowItems(inner string) []string {
+	var items []string
+	var quote rune
+	start := 0
+	for i, r := range inner {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, inner[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, inner[start:])
+}
+
+// yamlScalar parses a quoted string, null, boolean, integer, or plain string
+func yamlScalar(value string, number int) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(value, "\""):
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("yaml line %d: invalid double-quoted string %s", number, value)
+		}
+		return unquoted, nil
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return nil, fmt.Errorf("yaml line %d: invalid single-quoted string %s", number, value)
+		}
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'"), nil
+	}
+
+	switch strings.ToLower(value) {
+	case "~", "null":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n, nil
+	}
+	return value, nil
+}
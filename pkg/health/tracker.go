@@ -0,0 +1,95 @@
+package health
+
+import (
+	"sync"
+	"time"
+)
+
+// Tracker records the outcome of upstream calls so readiness can be derived
+// from real traffic instead of a static flag
+type Tracker struct {
+	mutex    sync.RWMutex
+	upstream map[string]*UpstreamStatus
+}
+
+// UpstreamStatus holds the last success and failure times for one upstream;
+// a zero time means it has not happened yet and is left out of the JSON
+type UpstreamStatus struct {
+	LastSuccess time.Time `json:"last_success,omitzero" xml:"last_success,omitempty"`
+	LastFailure time.Time `json:"last_failure,omitzero" xml:"last_failure,omitempty"`
+}
+
+// NewTracker creates an empty health tracker
+func NewTracker() *Tracker {
+	return &Tracker{
+		upstream: make(map[string]*UpstreamStatus),
+	}
+}
+
+// RecordSuccess marks a successful call to the named upstream
+func (t *Tracker) RecordSuccess(name string) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.status(name).LastSuccess = time.Now()
+}
+
+// RecordFailure marks a failed call to the named upstream
+func (t *Tracker) RecordFailure(name string) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.status(name).LastFailure = time.Now()
+}
+
+// status returns the entry for an upstream, creating it if needed (caller holds the lock)
+func (t *Tracker) status(name string) *UpstreamStatus {
+	status, exists := t.upstream[name]
+	if !exists {
+		status = &UpstreamStatus{}
+		t.upstream[name] = status
+	}
+	return status
+}
+
+// Snapshot returns a copy of the current status of every tracked upstream
+func (t *Tracker) Snapshot() map[string]UpstreamStatus {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	snapshot := make(map[string]UpstreamStatus, len(t.upstream))
+	for name, status := range t.upstream {
+		snapshot[name] = *status
+	}
+	return snapshot
+}
+
+// IsReady reports whether some upstream call has succeeded within maxAge and
+// no tracked upstream is unhealthy. An upstream is unhealthy when its latest
+// call failed and it has not succeeded within maxAge. A tracker that has not
+// seen a successful call yet is not ready.
+func (t *Tracker) IsReady(maxAge time.Duration) bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	recentSuccess := false
+	for _, status := range t.upstream {
+		sinceSuccess := time.Since(status.LastSuccess)
+		failedLast := status.LastFailure.After(status.LastSuccess)
+		if failedLast && sinceSuccess > maxAge {
+			return false
+		}
+		if !status.LastSuccess.IsZero() && sinceSuccess <= maxAge {
+			recentSuccess = true
+		}
+	}
+	return recentSuccess
+}
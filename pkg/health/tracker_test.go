@@ -0,0 +1,105 @@
+package health
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTracker_IsReady(t *testing.T) {
+	t.Run("no calls yet", func(t *testing.T) {
+		tracker := NewTracker()
+		if tracker.IsReady(time.Minute) {
+			t.Errorf("Expected fresh tracker not to be ready")
+		}
+	})
+
+	t.Run("recent success", func(t *testing.T) {
+		tracker := NewTracker()
+		tracker.RecordSuccess("weather")
+		if !tracker.IsReady(time.Minute) {
+			t.Errorf("Expected tracker to be ready after a success")
+		}
+	})
+
+	t.Run("failure after recent success", func(t *testing.T) {
+		tracker := NewTracker()
+		tracker.RecordSuccess("weather")
+		tracker.RecordFailure("weather")
+		if !tracker.IsReady(time.Minute) {
+			t.Errorf("Expected tracker to stay ready while last success is recent")
+		}
+	})
+
+	t.Run("failure without recent success", func(t *testing.T) {
+		tracker := NewTracker()
+		tracker.RecordSuccess("weather")
+		tracker.RecordFailure("stock")
+		if tracker.IsReady(time.Minute) {
+			t.Errorf("Expected tracker not to be ready when an upstream only failed")
+		}
+	})
+
+	t.Run("only failures", func(t *testing.T) {
+		tracker := NewTracker()
+		tracker.RecordFailure("weather")
+		if tracker.IsReady(time.Minute) {
+			t.Errorf("Expected tracker not to be ready without any success")
+		}
+	})
+
+	t.Run("success too long ago", func(t *testing.T) {
+		tracker := NewTracker()
+		tracker.RecordSuccess("weather")
+		time.Sleep(5 * time.Millisecond)
+		if tracker.IsReady(time.Millisecond) {
+			t.Errorf("Expected tracker not to be ready once the last success is stale")
+		}
+	})
+
+	t.Run("recovered after failure", func(t *testing.T) {
+		tracker := NewTracker()
+		tracker.RecordFailure("stock")
+		tracker.RecordSuccess("stock")
+		if !tracker.IsReady(time.Minute) {
+			t.Errorf("Expected tracker to be ready after recovering")
+		}
+	})
+}
+
+func TestTracker_Snapshot(t *testing.T) {
+	tracker := NewTracker()
+	tracker.RecordSuccess("weather")
+
+	snapshot := tracker.Snapshot()
+	status, exists := snapshot["weather"]
+	if !exists {
+		t.Fatalf("Expected weather in snapshot")
+	}
+	if status.LastSuccess.IsZero() {
+		t.Errorf("Expected last success to be set")
+	}
+	if !status.LastFailure.IsZero() {
+		t.Errorf("Expected no failure to be recorded")
+	}
+}
+
+func TestTracker_NilSafe(t *testing.T) {
+	var tracker *Tracker
+	tracker.RecordSuccess("weather")
+	tracker.RecordFailure("weather")
+}
+
+func TestUpstreamStatus_JSONOmitsZeroTimes(t *testing.T) {
+	tracker := NewTracker()
+	tracker.RecordSuccess("weather")
+
+	encoded, err := json.Marshal(tracker.Snapshot()["weather"])
+	if err != nil {
+		t.Fatalf("Failed to encode status: %v", err)
+	}
+	if !strings.Contains(string(encoded), `"last_success"`) || strings.Contains(string(encoded), `"last_failure"`) {
+		t.Errorf("Expected only last_success in %s", encoded)
+	}
+}
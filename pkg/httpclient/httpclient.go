@@ -0,0 +1,157 @@
+// Package httpclient provides the HTTP client interface the upstream API
+// clients depend on, and a configurable implementation of it
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"time"
+)
+
+// HTTPClient interface for dependency injection and testing
+type HTTPClient interface {
+	Get(url string) (*http.Response, error)
+	Post(url, contentType string, body io.Reader) (*http.Response, error)
+}
+
+// ContextHTTPClient is an HTTPClient whose requests can be canceled through a context
+type ContextHTTPClient interface {
+	HTTPClient
+	GetWithContext(ctx context.Context, url string) (*http.Response, error)
+	PostWithContext(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error)
+}
+
+// Client is the default HTTPClient, sending a fixed set of headers with
+// every request. The zero value sends no extra headers, keeps no cookies,
+// and has no timeout.
+type Client struct {
+	headers http.Header
+	client  *http.Client
+}
+
+// Option configures optional client behavior
+type Option func(*Client)
+
+// Headers sends headers with every request
+func Headers(headers http.Header) Option {
+	return func(c *Client) {
+		c.headers = headers.Clone()
+	}
+}
+
+// Cookies keeps cookies set by responses and sends them with later
+// requests, as session handshakes require
+func Cookies(enabled bool) Option {
+	return func(c *Client) {
+		c.client.Jar = nil
+		if enabled {
+			// cookiejar.New only fails for invalid options
+			c.client.Jar, _ = cookiejar.New(nil)
+		}
+	}
+}
+
+// Timeout bounds each request, including reading the response body; zero
+// means no limit
+func Timeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.client.Timeout = timeout
+	}
+}
+
+// New creates a client
+func New(opts ...Option) *Client {
+	c := &Client{client: &http.Client{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Get performs a GET request
+func (c *Client) Get(url string) (*http.Response, error) {
+	return c.GetWithContext(context.Background(), url)
+}
+
+// GetWithContext performs a GET request that is canceled when ctx is done
+func (c *Client) GetWithContext(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+// Post sends body as a POST request of the given content type
+func (c *Client) Post(url, contentType string, body io.Reader) (*http.Response, error) {
+	return c.PostWithContext(context.Background(), url, contentType, body)
+}
+
+// PostWithContext is Post with a request that is canceled when ctx is done
+func (c *Client) PostWithContext(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.do(req)
+}
+
+// do sends req with the client's headers
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	for name, values := range c.headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+
+	client := c.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+// GetCtx issues a GET request with client, passing ctx along when the
+// client supports it and otherwise checking it before the request
+func GetCtx(ctx context.Context, client HTTPClient, url string) (*http.Response, error) {
+	if ctxClient, ok := client.(ContextHTTPClient); ok {
+		return ctxClient.GetWithContext(ctx, url)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return client.Get(url)
+}
+
+// PostCtx issues a POST request with client, passing ctx along when the
+// client supports it and otherwise checking it before the request
+func PostCtx(ctx context.Context, client HTTPClient, url, contentType string, body io.Reader) (*http.Response, error) {
+	if ctxClient, ok := client.(ContextHTTPClient); ok {
+		return ctxClient.PostWithContext(ctx, url, contentType, body)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return client.Post(url, contentType, body)
+}
+
+// BuildURL adds params to baseURL, keeping any query parameters the base
+// URL already carries, such as an API key of a proxy
+func BuildURL(baseURL string, params url.Values) string {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return baseURL + "?" + params.Encode()
+	}
+
+	query := parsed.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String()
+}
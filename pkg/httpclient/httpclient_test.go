@@ -0,0 +1,172 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_Headers(t *testing.T) {
+	received := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		client        *Client
+		wantUserAgent string
+	}{
+		{"zero value", &Client{}, "Go-http-client/1.1"},
+		{"headers", New(Headers(http.Header{"User-Agent": {"ops-bot/2.0"}})), "ops-bot/2.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if got := (<-received).Get("User-Agent"); got != tt.wantUserAgent {
+				t.Errorf("Expected User-Agent %q, got %q", tt.wantUserAgent, got)
+			}
+		})
+	}
+}
+
+func TestClient_Post(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Content-Type", r.Header.Get("Content-Type"))
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	resp, err := New().Post(server.URL, "application/json", strings.NewReader(`{"a":1}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if method := resp.Header.Get("X-Method"); method != http.MethodPost {
+		t.Errorf("Expected method POST, got %s", method)
+	}
+	if ct := resp.Header.Get("X-Content-Type"); ct != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %q", ct)
+	}
+	if string(body) != `{"a":1}` {
+		t.Errorf("Expected the posted body echoed, got %q", body)
+	}
+}
+
+func TestClient_Cookies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session"); err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		enabled    bool
+		wantStatus int
+	}{
+		{"kept", true, http.StatusOK},
+		{"dropped", false, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := New(Cookies(tt.enabled))
+			for i := 0; i < 2; i++ {
+				resp, err := client.Get(server.URL)
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				resp.Body.Close()
+				if i == 1 && resp.StatusCode != tt.wantStatus {
+					t.Errorf("Expected status %d on the second request, got %d", tt.wantStatus, resp.StatusCode)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	_, err := New(Timeout(20 * time.Millisecond)).Get(server.URL)
+	if err == nil {
+		t.Fatal("Expected a timeout error")
+	}
+}
+
+// getOnly is an HTTPClient without context support
+type getOnly struct{ calls int }
+
+func (g *getOnly) Get(url string) (*http.Response, error) {
+	g.calls++
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+}
+
+func (g *getOnly) Post(url, contentType string, body io.Reader) (*http.Response, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestGetCtx_CanceledWithoutContextSupport(t *testing.T) {
+	client := &getOnly{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := GetCtx(ctx, client, "https://example.com"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if client.calls != 0 {
+		t.Errorf("Expected no request after cancellation, got %d", client.calls)
+	}
+
+	if _, err := GetCtx(context.Background(), client, "https://example.com"); err != nil || client.calls != 1 {
+		t.Errorf("Expected one request, got %d calls and error %v", client.calls, err)
+	}
+}
+
+func TestBuildURL(t *testing.T) {
+	params := url.Values{"symbols": {"DDOG"}, "lang": {"en"}}
+
+	tests := []struct {
+		name    string
+		baseURL string
+		want    string
+	}{
+		{"plain base URL", "https://example.com/quote", "https://example.com/quote?lang=en&symbols=DDOG"},
+		{"base URL with a query", "https://example.com/quote?apikey=secret", "https://example.com/quote?apikey=secret&lang=en&symbols=DDOG"},
+		{"params override the base query", "https://example.com/quote?symbols=AAPL", "https://example.com/quote?lang=en&symbols=DDOG"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BuildURL(tt.baseURL, params); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+// Package limiter bounds how many upstream requests a service has in flight
+// at once, so a burst of client requests cannot overwhelm an upstream API.
+package limiter
+
+import (
+	"context"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
+)
+
+// Limiter hands out a fixed number of slots. A nil *Limiter has no limit,
+// so services can keep one unconditionally.
+type Limiter struct {
+	slots chan struct{}
+}
+
+// New returns a limiter with n slots, or nil, which does not limit, when n
+// is zero or less
+func New(n int) *Limiter {
+	if n <= 0 {
+		return nil
+	}
+	return &Limiter{slots: make(chan struct{}, n)}
+}
+
+// Acquire waits for a free slot, giving up with ctx.Err() when ctx is done.
+// Every successful call must be paired with Release.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	logging.Debugf("Upstream concurrency limit of %d reached, waiting for a slot", cap(l.slots))
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Release frees the slot taken by Acquire
+func (l *Limiter) Release() {
+	if l != nil {
+		<-l.slots
+	}
+}
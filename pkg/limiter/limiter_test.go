@@ -0,0 +1,79 @@
+package limiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter_BoundsConcurrency(t *testing.T) {
+	const limit = 3
+	const callers = 12
+	l := New(limit)
+
+	var inFlight, peak atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.Acquire(context.Background()); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			defer l.Release()
+
+			current := inFlight.Add(1)
+			for {
+				seen := peak.Load()
+				if current <= seen || peak.CompareAndSwap(seen, current) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			inFlight.Add(-1)
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got > limit {
+		t.Errorf("Expected at most %d callers in flight, got %d", limit, got)
+	}
+	if got := peak.Load(); got == 0 {
+		t.Error("Expected callers to acquire a slot")
+	}
+}
+
+func TestLimiter_CanceledWhileWaiting(t *testing.T) {
+	l := New(1)
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatalf("Unexpected error acquiring slot: %v", err)
+	}
+	defer l.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := l.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		l := New(n)
+		if l != nil {
+			t.Errorf("Expected New(%d) to return nil, got %+v", n, l)
+		}
+		// A nil limiter never blocks, not even on a canceled context
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := l.Acquire(ctx); err != nil {
+			t.Errorf("Expected no error from an unlimited limiter, got %v", err)
+		}
+		l.Release()
+	}
+}
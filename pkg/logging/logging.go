@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is the severity of a log message
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// currentLevel holds the minimum level that is written
+var currentLevel atomic.Int32
+
+func init() {
+	SetLevel(LevelInfo)
+}
+
+// String returns the lowercase name of the level
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// ParseLevel converts a level name such as "warn" into a Level
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q (expected debug, info, warn, or error)", name)
+}
+
+// SetLevel sets the minimum level that is written
+func SetLevel(level Level) {
+	currentLevel.Store(int32(level))
+}
+
+// GetLevel returns the minimum level that is written
+func GetLevel() Level {
+	return Level(currentLevel.Load())
+}
+
+// Enabled reports whether messages at the given level are written
+func Enabled(level Level) bool {
+	return level >= GetLevel()
+}
+
+// Debugf logs a message useful only when diagnosing problems
+func Debugf(format string, args ...interface{}) {
+	output(LevelDebug, format, args...)
+}
+
+// Infof logs a routine operational message
+func Infof(format string, args ...interface{}) {
+	output(LevelInfo, format, args...)
+}
+
+// Warnf logs a degraded but handled condition
+func Warnf(format string, args ...interface{}) {
+	output(LevelWarn, format, args...)
+}
+
+// Errorf logs a failure
+func Errorf(format string, args ...interface{}) {
+	output(LevelError, format, args...)
+}
+
+// output writes the message through the standard logger, keeping the
+// caller's file and line when log.Lshortfile is enabled
+func output(level Level, format string, args ...interface{}) {
+	if !Enabled(level) {
+		return
+	}
+	prefix := "[" + strings.ToUpper(level.String()) + "] "
+	log.Output(3, prefix+fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input     string
+		want      Level
+		wantError bool
+	}{
+		{"debug", LevelDebug, false},
+		{"INFO", LevelInfo, false},
+		{"warn", LevelWarn, false},
+		{"warning", LevelWarn, false},
+		{" error ", LevelError, false},
+		{"", LevelInfo, false},
+		{"verbose", LevelInfo, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseLevel(tt.input)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLevel(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	var buf bytes.Buffer
+	previousOutput := log.Writer()
+	previousFlags := log.Flags()
+	log.SetFlags(0)
+	previousLevel := GetLevel()
+	defer func() {
+		log.SetOutput(previousOutput)
+		log.SetFlags(previousFlags)
+		SetLevel(previousLevel)
+	}()
+	log.SetOutput(&buf)
+
+	SetLevel(LevelWarn)
+	Debugf("debug message")
+	Infof("Successfully fetched %s", "DDOG")
+	Warnf("falling back to demo mode")
+	Errorf("upstream failed")
+
+	output := buf.String()
+	if strings.Contains(output, "debug message") || strings.Contains(output, "Successfully fetched") {
+		t.Errorf("Expected debug and info messages to be suppressed, got: %s", output)
+	}
+	if !strings.Contains(output, "[WARN] falling back to demo mode") {
+		t.Errorf("Expected warn message, got: %s", output)
+	}
+	if !strings.Contains(output, "[ERROR] upstream failed") {
+		t.Errorf("Expected error message, got: %s", output)
+	}
+}
@@ -1,21 +1,51 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"time"
 )
 
+// Sentinel errors matched by APIError.Is based on the status code
+var (
+	ErrNotFound            = errors.New("not found")
+	ErrRateLimited         = errors.New("rate limited")
+	ErrUpstreamUnavailable = errors.New("upstream unavailable")
+)
+
 // APIError represents a custom error type for API-related errors
 type APIError struct {
 	Service string
 	Message string
 	Code    int
+	// Wrapped is the underlying cause, if any
+	Wrapped error
 }
 
 func (e *APIError) Error() string {
 	return fmt.Sprintf("%s API error (%d): %s", e.Service, e.Code, e.Message)
 }
 
+// Unwrap returns the underlying cause so errors.As can reach it
+func (e *APIError) Unwrap() error {
+	return e.Wrapped
+}
+
+// Is lets errors.Is match an APIError against the sentinel errors by status code
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Code == 404
+	case ErrRateLimited:
+		return e.Code == 429
+	case ErrUpstreamUnavailable:
+		return e.Code >= 500 && e.Code <= 599
+	}
+	return false
+}
+
 // NewAPIError creates a new API error
 func NewAPIError(service, message string, code int) *APIError {
 	return &APIError{
@@ -25,14 +55,52 @@ func NewAPIError(service, message string, code int) *APIError {
 	}
 }
 
+// NewWrappedAPIError creates a new API error that keeps the underlying cause
+func NewWrappedAPIError(service, message string, code int, err error) *APIError {
+	return &APIError{
+		Service: service,
+		Message: message,
+		Code:    code,
+		Wrapped: err,
+	}
+}
+
+// DefaultMaxResponseBytes caps the size of upstream response bodies; real
+// responses are a few kilobytes
+const DefaultMaxResponseBytes = 4 << 20
+
+// DecodeResponse decodes the JSON body of an upstream response into dst,
+// reading at most maxBytes bytes so a misbehaving upstream cannot exhaust
+// memory. A body over the cap is reported as a 502 from service, and a
+// malformed one as a 500. maxBytes <= 0 uses DefaultMaxResponseBytes.
+func DecodeResponse(service string, body io.Reader, maxBytes int, dst interface{}) error {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxResponseBytes
+	}
+
+	// Allow one byte past the cap so an oversized body can be told apart
+	// from one that is exactly maxBytes long
+	limited := &io.LimitedReader{R: body, N: int64(maxBytes) + 1}
+	err := json.NewDecoder(limited).Decode(dst)
+	if limited.N <= 0 {
+		return NewAPIError(service, fmt.Sprintf("Response body exceeds %d bytes", maxBytes), 502)
+	}
+	if err != nil {
+		return NewWrappedAPIError(service, fmt.Sprintf("Failed to parse response: %v", err), 500, err)
+	}
+	return nil
+}
+
 // Coordinates represents latitude and longitude
 type Coordinates struct {
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
+	Latitude  float64 `json:"latitude" xml:"latitude"`
+	Longitude float64 `json:"longitude" xml:"longitude"`
 }
 
 // ResponseMetadata contains common response metadata
 type ResponseMetadata struct {
-	Timestamp time.Time `json:"timestamp"`
-	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp" xml:"timestamp"`
+	Source    string    `json:"source" xml:"source"`
+	// CachedAt is when the data was stored in a cache; nil for live data
+	CachedAt *time.Time `json:"cached_at,omitempty" xml:"cached_at,omitempty"`
 }
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAPIError_Is(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   int
+		target error
+		want   bool
+	}{
+		{"404 is not found", 404, ErrNotFound, true},
+		{"429 is rate limited", 429, ErrRateLimited, true},
+		{"500 is upstream unavailable", 500, ErrUpstreamUnavailable, true},
+		{"503 is upstream unavailable", 503, ErrUpstreamUnavailable, true},
+		{"400 is not found", 400, ErrNotFound, false},
+		{"404 is not rate limited", 404, ErrRateLimited, false},
+		{"429 is not upstream unavailable", 429, ErrUpstreamUnavailable, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewAPIError("Test", "message", tt.code)
+			if got := errors.Is(err, tt.target); got != tt.want {
+				t.Errorf("errors.Is(%d, %v) = %v, want %v", tt.code, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIError_IsThroughWrapping(t *testing.T) {
+	err := fmt.Errorf("fetching quote: %w", NewAPIError("Yahoo Finance", "Too many requests", 429))
+
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected wrapped APIError to match ErrRateLimited")
+	}
+}
+
+func TestAPIError_Unwrap(t *testing.T) {
+	cause := errors.New("connection reset")
+	err := NewWrappedAPIError("Test", fmt.Sprintf("Failed to make request: %v", cause), 500, cause)
+
+	if !errors.Is(err, cause) {
+		t.Errorf("Expected errors.Is to reach the wrapped cause")
+	}
+
+	if got, want := err.Error(), "Test API error (500): Failed to make request: connection reset"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+
+	if NewAPIError("Test", "message", 400).Unwrap() != nil {
+		t.Errorf("Expected unwrapped APIError to have no cause")
+	}
+}
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		maxBytes     int
+		expectedCode int
+	}{
+		{name: "within the cap", body: `{"value": 1}`, maxBytes: 12},
+		{name: "over the cap", body: `{"value": 10}`, maxBytes: 12, expectedCode: 502},
+		{name: "default cap", body: `{"value": 1}`, maxBytes: 0},
+		{name: "malformed", body: `{"value": }`, maxBytes: 100, expectedCode: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst struct{ Value int }
+			err := DecodeResponse("Test", strings.NewReader(tt.body), tt.maxBytes, &dst)
+
+			if tt.expectedCode == 0 {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Code != tt.expectedCode {
+				t.Errorf("Expected APIError with code %d, got %v", tt.expectedCode, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HistoryRange is how far back a price history reaches, in the syntax of
+// the Yahoo Finance chart endpoint
+type HistoryRange string
+
+const (
+	HistoryRange1Day    HistoryRange = "1d"
+	HistoryRange5Days   HistoryRange = "5d"
+	HistoryRange1Month  HistoryRange = "1mo"
+	HistoryRange3Months HistoryRange = "3mo"
+	HistoryRange6Months HistoryRange = "6mo"
+	HistoryRangeYTD     HistoryRange = "ytd"
+	HistoryRange1Year   HistoryRange = "1y"
+	HistoryRange2Years  HistoryRange = "2y"
+	HistoryRange5Years  HistoryRange = "5y"
+	HistoryRange10Years HistoryRange = "10y"
+	HistoryRangeMax     HistoryRange = "max"
+)
+
+// HistoryRanges lists the supported ranges from shortest to longest
+var HistoryRanges = []HistoryRange{
+	HistoryRange1Day, HistoryRange5Days, HistoryRange1Month, HistoryRange3Months,
+	HistoryRange6Months, HistoryRangeYTD, HistoryRange1Year, HistoryRange2Years,
+	HistoryRange5Years, HistoryRange10Years, HistoryRangeMax,
+}
+
+// historyRangeDays is the longest span each range can cover, in days. The
+// year to date is counted as a full year.
+var historyRangeDays = map[HistoryRange]int{
+	HistoryRange1Day:    1,
+	HistoryRange5Days:   5,
+	HistoryRange1Month:  31,
+	HistoryRange3Months: 92,
+	HistoryRange6Months: 184,
+	HistoryRangeYTD:     366,
+	HistoryRange1Year:   366,
+	HistoryRange2Years:  731,
+	HistoryRange5Years:  1827,
+	HistoryRange10Years: 3653,
+	HistoryRangeMax:     -1,
+}
+
+// Valid reports whether r is a supported range
+func (r HistoryRange) Valid() bool {
+	_, ok := historyRangeDays[r]
+	return ok
+}
+
+// HistoryInterval is the spacing between the points of a price history, in
+// the syntax of the Yahoo Finance chart endpoint
+type HistoryInterval string
+
+const (
+	HistoryInterval1Minute   HistoryInterval = "1m"
+	HistoryInterval2Minutes  HistoryInterval = "2m"
+	HistoryInterval5Minutes  HistoryInterval = "5m"
+	HistoryInterval15Minutes HistoryInterval = "15m"
+	HistoryInterval30Minutes HistoryInterval = "30m"
+	HistoryInterval60Minutes HistoryInterval = "60m"
+	HistoryInterval90Minutes HistoryInterval = "90m"
+	HistoryInterval1Hour     HistoryInterval = "1h"
+	HistoryInterval1Day      HistoryInterval = "1d"
+	HistoryInterval5Days     HistoryInterval = "5d"
+	HistoryInterval1Week     HistoryInterval = "1wk"
+	HistoryInterval1Month    HistoryInterval = "1mo"
+	HistoryInterval3Months   HistoryInterval = "3mo"
+)
+
+// historyIntervalMaxDays is the longest span Yahoo Finance serves at each
+// interval, in days; -1 means any range. Intraday data only reaches back a
+// limited time and longer ranges are rejected upstream.
+var historyIntervalMaxDays = map[HistoryInterval]int{
+	HistoryInterval1Minute:   7,
+	HistoryInterval2Minutes:  60,
+	HistoryInterval5Minutes:  60,
+	HistoryInterval15Minutes: 60,
+	HistoryInterval30Minutes: 60,
+	HistoryInterval60Minutes: 730,
+	HistoryInterval90Minutes: 60,
+	HistoryInterval1Hour:     730,
+	HistoryInterval1Day:      -1,
+	HistoryInterval5Days:     -1,
+	HistoryInterval1Week:     -1,
+	HistoryInterval1Month:    -1,
+	HistoryInterval3Months:   -1,
+}
+
+// Valid reports whether i is a supported interval
+func (i HistoryInterval) Valid() bool {
+	_, ok := historyIntervalMaxDays[i]
+	return ok
+}
+
+// Allows reports whether a history at interval i can cover range r. Both
+// must be valid.
+func (i HistoryInterval) Allows(r HistoryRange) bool {
+	maxDays, ok := historyIntervalMaxDays[i]
+	if !ok || !r.Valid() {
+		return false
+	}
+	if maxDays < 0 {
+		return true
+	}
+	days := historyRangeDays[r]
+	return days >= 0 && days <= maxDays
+}
+
+// ValidateHistory checks a range and interval before they are sent upstream,
+// returning a 400 APIError that names the problem, including the ranges the
+// interval does allow when the combination is not served
+func ValidateHistory(r HistoryRange, i HistoryInterval) error {
+	if !r.Valid() {
+		return NewAPIError("Stock History", fmt.Sprintf("Unsupported range %q", r), 400)
+	}
+	if !i.Valid() {
+		return NewAPIError("Stock History", fmt.Sprintf("Unsupported interval %q", i), 400)
+	}
+	if i.Allows(r) {
+		return nil
+	}
+
+	var allowed []string
+	for _, candidate := range HistoryRanges {
+		if i.Allows(candidate) {
+			allowed = append(allowed, string(candidate))
+		}
+	}
+	return NewAPIError("Stock History",
+		fmt.Sprintf("Interval %q is not available for range %q (allowed ranges: %s)", i, r, strings.Join(allowed, ", ")), 400)
+}
+
+// HistoryPoint is one bar of a price history
+type HistoryPoint struct {
+	Time   time.Time `json:"time" xml:"time"`
+	Open   float64   `json:"open" xml:"open"`
+	High   float64   `json:"high" xml:"high"`
+	Low    float64   `json:"low" xml:"low"`
+	Close  float64   `json:"close" xml:"close"`
+	Volume int64     `json:"volume" xml:"volume"`
+}
+
+// StockHistory is the price history of a symbol over a range, oldest point
+// first
+type StockHistory struct {
+	Symbol   string           `json:"symbol" xml:"symbol"`
+	Currency string           `json:"currency" xml:"currency"`
+	Range    HistoryRange     `json:"range" xml:"range"`
+	Interval HistoryInterval  `json:"interval" xml:"interval"`
+	Points   []HistoryPoint   `json:"points" xml:"points>point"`
+	Metadata ResponseMetadata `json:"metadata" xml:"metadata"`
+}
+
+// YahooFinanceChartResponse represents the raw response from the Yahoo
+// Finance chart endpoint. Prices and volumes are null for bars without
+// trades.
+type YahooFinanceChartResponse struct {
+	Chart struct {
+		Result []struct {
+			Meta struct {
+				Symbol   string `json:"symbol"`
+				Currency string `json:"currency"`
+			} `json:"meta"`
+			Timestamp  []int64 `json:"timestamp"`
+			Indicators struct {
+				Quote []struct {
+					Open   []*float64 `json:"open"`
+					High   []*float64 `json:"high"`
+					Low    []*float64 `json:"low"`
+					Close  []*float64 `json:"close"`
+					Volume []*int64   `json:"volume"`
+				} `json:"quote"`
+			} `json:"indicators"`
+		} `json:"result"`
+		Error interface{} `json:"error"`
+	} `json:"chart"`
+}
+
+// ConvertYahooFinanceChartResponse converts a chart response for range r at
+// interval i to our standard format, skipping bars without a closing price.
+// Prices are rounded to opts.Decimals like quotes. The metadata timestamp is the time of the
+// last point.
+func ConvertYahooFinanceChartResponse(response *YahooFinanceChartResponse, r HistoryRange, i HistoryInterval, opts StockConversionOptions) (*StockHistory, error) {
+	if message := yahooErrorMessage(response.Chart.Error); message != "" {
+		return nil, NewAPIError("Yahoo Finance", "Upstream reported an error: "+message, 502)
+	}
+	if len(response.Chart.Result) == 0 {
+		return nil, NewAPIError("Yahoo Finance", "No price history found", 404)
+	}
+
+	result := response.Chart.Result[0]
+	if strings.TrimSpace(result.Meta.Symbol) == "" {
+		return nil, NewAPIError("Yahoo Finance", "Price history is missing its symbol", 502)
+	}
+
+	history := &StockHistory{
+		Symbol:   result.Meta.Symbol,
+		Currency: result.Meta.Currency,
+		Range:    r,
+		Interval: i,
+		Points:   []HistoryPoint{},
+		Metadata: ResponseMetadata{Source: "Yahoo Finance"},
+	}
+	if len(result.Indicators.Quote) == 0 {
+		return history, nil
+	}
+
+	quote := result.Indicators.Quote[0]
+	for n, epoch := range result.Timestamp {
+		closePrice := priceAt(quote.Close, n)
+		if closePrice == nil {
+			continue
+		}
+		point := HistoryPoint{
+			Time:  marketTime(epoch),
+			Close: roundTo(*closePrice, opts.Decimals),
+		}
+		if open := priceAt(quote.Open, n); open != nil {
+			point.Open = roundTo(*open, opts.Decimals)
+		}
+		if high := priceAt(quote.High, n); high != nil {
+			point.High = roundTo(*high, opts.Decimals)
+		}
+		if low := priceAt(quote.Low, n); low != nil {
+			point.Low = roundTo(*low, opts.Decimals)
+		}
+		if n < len(quote.Volume) && quote.Volume[n] != nil {
+			point.Volume = *quote.Volume[n]
+		}
+		history.Points = append(history.Points, point)
+	}
+
+	if len(history.Points) > 0 {
+		history.Metadata.Timestamp = history.Points[len(history.Points)-1].Time
+	}
+	return history, nil
+}
+
+// priceAt returns the nth price, or nil when it is null or missing
+func priceAt(prices []*float64, n int) *float64 {
+	if n >= len(prices) {
+		return nil
+	}
+	return prices[n]
+}
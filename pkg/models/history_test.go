@@ -0,0 +1,143 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/internal/testutils"
+)
+
+func TestValidateHistory(t *testing.T) {
+	tests := []struct {
+		name        string
+		rng         HistoryRange
+		interval    HistoryInterval
+		wantErr     bool
+		wantMessage string
+	}{
+		{name: "1m over 1d", rng: HistoryRange1Day, interval: HistoryInterval1Minute},
+		{name: "1m over 5d", rng: HistoryRange5Days, interval: HistoryInterval1Minute},
+		{name: "5m over 1mo", rng: HistoryRange1Month, interval: HistoryInterval5Minutes},
+		{name: "1h over 1y", rng: HistoryRange1Year, interval: HistoryInterval1Hour},
+		{name: "1d over max", rng: HistoryRangeMax, interval: HistoryInterval1Day},
+		{name: "1wk over ytd", rng: HistoryRangeYTD, interval: HistoryInterval1Week},
+		{
+			name:        "1m over 1y",
+			rng:         HistoryRange1Year,
+			interval:    HistoryInterval1Minute,
+			wantErr:     true,
+			wantMessage: `Interval "1m" is not available for range "1y" (allowed ranges: 1d, 5d)`,
+		},
+		{name: "15m over 3mo", rng: HistoryRange3Months, interval: HistoryInterval15Minutes, wantErr: true},
+		{name: "60m over 5y", rng: HistoryRange5Years, interval: HistoryInterval60Minutes, wantErr: true},
+		{name: "1h over max", rng: HistoryRangeMax, interval: HistoryInterval1Hour, wantErr: true},
+		{
+			name:        "unknown range",
+			rng:         "3y",
+			interval:    HistoryInterval1Day,
+			wantErr:     true,
+			wantMessage: `Unsupported range "3y"`,
+		},
+		{
+			name:        "unknown interval",
+			rng:         HistoryRange1Year,
+			interval:    "2h",
+			wantErr:     true,
+			wantMessage: `Unsupported interval "2h"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateHistory(tt.rng, tt.interval)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil {
+				return
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Code != 400 {
+				t.Fatalf("Expected a 400 APIError, got %v", err)
+			}
+			if tt.wantMessage != "" && !strings.Contains(apiErr.Message, tt.wantMessage) {
+				t.Errorf("Expected message %q, got %q", tt.wantMessage, apiErr.Message)
+			}
+		})
+	}
+}
+
+func TestHistoryRanges_AllValid(t *testing.T) {
+	for _, r := range HistoryRanges {
+		if !r.Valid() {
+			t.Errorf("Expected %q to be valid", r)
+		}
+	}
+	if len(HistoryRanges) != len(historyRangeDays) {
+		t.Errorf("Expected %d ranges, got %d", len(historyRangeDays), len(HistoryRanges))
+	}
+}
+
+func TestConvertYahooFinanceChartResponse(t *testing.T) {
+	var response YahooFinanceChartResponse
+	if err := json.Unmarshal([]byte(testutils.YahooFinanceChartResponse), &response); err != nil {
+		t.Fatalf("Failed to parse fixture: %v", err)
+	}
+
+	history, err := ConvertYahooFinanceChartResponse(&response, HistoryRange5Days, HistoryInterval1Day, defaultConversion)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if history.Symbol != "DDOG" || history.Currency != "USD" {
+		t.Errorf("Expected DDOG in USD, got %s in %s", history.Symbol, history.Currency)
+	}
+	if history.Range != HistoryRange5Days || history.Interval != HistoryInterval1Day {
+		t.Errorf("Expected range 5d at 1d, got %s at %s", history.Range, history.Interval)
+	}
+	if len(history.Points) != 3 {
+		t.Fatalf("Expected 3 points without the bar lacking trades, got %d", len(history.Points))
+	}
+
+	last := history.Points[2]
+	if !last.Time.Equal(time.Unix(1703721600, 0)) {
+		t.Errorf("Expected last point at 1703721600, got %v", last.Time)
+	}
+	if last.Open != 124 || last.High != 126.2 || last.Low != 123.75 || last.Close != 125.46 || last.Volume != 2234567 {
+		t.Errorf("Unexpected last point: %+v", last)
+	}
+	if !history.Metadata.Timestamp.Equal(last.Time) {
+		t.Errorf("Expected metadata timestamp %v, got %v", last.Time, history.Metadata.Timestamp)
+	}
+}
+
+func TestConvertYahooFinanceChartResponse_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{"upstream error", `{"chart": {"result": null, "error": {"code": "Not Found", "description": "No data found, symbol may be delisted"}}}`, 502},
+		{"no result", `{"chart": {"result": [], "error": null}}`, 404},
+		{"missing symbol", `{"chart": {"result": [{"meta": {}, "timestamp": []}], "error": null}}`, 502},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response YahooFinanceChartResponse
+			if err := json.Unmarshal([]byte(tt.body), &response); err != nil {
+				t.Fatalf("Failed to parse body: %v", err)
+			}
+
+			_, err := ConvertYahooFinanceChartResponse(&response, HistoryRange1Month, HistoryInterval1Day, defaultConversion)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Code != tt.wantCode {
+				t.Errorf("Expected a %d APIError, got %v", tt.wantCode, err)
+			}
+		})
+	}
+}
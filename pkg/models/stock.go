@@ -1,6 +1,14 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
+)
 
 // MarketState represents the current state of the stock market
 type MarketState string
@@ -12,19 +20,36 @@ const (
 	MarketStateClosed     MarketState = "CLOSED"
 )
 
+// StockConversionOptions controls how raw upstream quotes are normalized
+type StockConversionOptions struct {
+	// RepairChangePercentSign recomputes ChangePercent from Change and
+	// PreviousClose when the two upstream values disagree in sign
+	RepairChangePercentSign bool
+	// Decimals is how many decimal places Price, Change, and ChangePercent
+	// are rounded to; a negative value keeps the upstream precision
+	Decimals int
+}
+
+// DefaultStockDecimals is the default StockConversionOptions.Decimals
+const DefaultStockDecimals = 2
+
 // StockResponse represents the standardized stock response
 type StockResponse struct {
-	Symbol        string           `json:"symbol"`
-	CompanyName   string           `json:"company_name"`
-	Price         float64          `json:"price"`
-	Change        float64          `json:"change"`
-	ChangePercent float64          `json:"change_percent"`
-	PreviousClose float64          `json:"previous_close"`
-	Volume        int64            `json:"volume"`
-	MarketCap     int64            `json:"market_cap,omitempty"`
-	MarketState   MarketState      `json:"market_state"`
-	Currency      string           `json:"currency"`
-	Metadata      ResponseMetadata `json:"metadata"`
+	Symbol        string           `json:"symbol" xml:"symbol"`
+	CompanyName   string           `json:"company_name" xml:"company_name"`
+	Price         float64          `json:"price" xml:"price"`
+	Change        float64          `json:"change" xml:"change"`
+	ChangePercent float64          `json:"change_percent" xml:"change_percent"`
+	PreviousClose float64          `json:"previous_close" xml:"previous_close"`
+	Volume        int64            `json:"volume" xml:"volume"`
+	MarketCap     int64            `json:"market_cap,omitempty" xml:"market_cap,omitempty"`
+	MarketState   MarketState      `json:"market_state" xml:"market_state"`
+	Currency      string           `json:"currency" xml:"currency"`
+	Metadata      ResponseMetadata `json:"metadata" xml:"metadata"`
+	// VolumeDisplay and MarketCapDisplay repeat Volume and MarketCap with
+	// thousands separators, e.g. "1,234,567", for clients that show them as is
+	VolumeDisplay    string `json:"volume_display" xml:"volume_display"`
+	MarketCapDisplay string `json:"market_cap_display,omitempty" xml:"market_cap_display,omitempty"`
 }
 
 // YahooFinanceResponse represents the raw response from Yahoo Finance API
@@ -48,14 +73,37 @@ type YahooFinanceResponse struct {
 	} `json:"quoteResponse"`
 }
 
-// ConvertYahooFinanceResponse converts Yahoo Finance API response to our standard format
-func ConvertYahooFinanceResponse(response *YahooFinanceResponse) (*StockResponse, error) {
+// roundTo rounds value half away from zero to the given number of decimal
+// places; negative decimals return value unchanged
+func roundTo(value float64, decimals int) float64 {
+	if decimals < 0 {
+		return value
+	}
+	scale := math.Pow10(decimals)
+	return math.Round(value*scale) / scale
+}
+
+// ConvertYahooFinanceResponse converts Yahoo Finance API response to our
+// standard format, normalizing the quote as opts asks
+func ConvertYahooFinanceResponse(response *YahooFinanceResponse, opts StockConversionOptions) (*StockResponse, error) {
+	if message := yahooErrorMessage(response.QuoteResponse.Error); message != "" {
+		return nil, NewAPIError("Yahoo Finance", "Upstream reported an error: "+message, 502)
+	}
 	if len(response.QuoteResponse.Result) == 0 {
 		return nil, NewAPIError("Yahoo Finance", "No stock data found", 404)
 	}
 
 	result := response.QuoteResponse.Result[0]
 
+	// Reject partially populated quotes rather than returning a response full of zeros
+	if strings.TrimSpace(result.Symbol) == "" {
+		return nil, NewAPIError("Yahoo Finance", "Quote is missing its symbol", 502)
+	}
+	if !(result.RegularMarketPrice > 0) {
+		return nil, NewAPIError("Yahoo Finance",
+			fmt.Sprintf("No valid price for %s (got %v); the symbol may be delisted", result.Symbol, result.RegularMarketPrice), 404)
+	}
+
 	// Convert market state
 	var marketState MarketState
 	switch result.MarketState {
@@ -76,16 +124,28 @@ func ConvertYahooFinanceResponse(response *YahooFinanceResponse) (*StockResponse
 	if companyName == "" {
 		companyName = result.ShortName
 	}
+	if companyName == "" {
+		companyName = result.Symbol
+	}
 
-	// Convert Unix timestamp to time
-	timestamp := time.Unix(result.RegularMarketTime, 0)
+	// Yahoo occasionally reports change and change percent with different signs
+	changePercent := result.RegularMarketChangePercent
+	if hasInconsistentSign(result.RegularMarketChange, changePercent) {
+		logging.Warnf("Inconsistent change sign for %s: change %.4f, change percent %.4f",
+			result.Symbol, result.RegularMarketChange, changePercent)
+		if opts.RepairChangePercentSign && result.RegularMarketPreviousClose != 0 {
+			changePercent = result.RegularMarketChange / result.RegularMarketPreviousClose * 100
+		}
+	}
+
+	timestamp := marketTime(result.RegularMarketTime)
 
-	return &StockResponse{
+	stock := &StockResponse{
 		Symbol:        result.Symbol,
 		CompanyName:   companyName,
-		Price:         result.RegularMarketPrice,
-		Change:        result.RegularMarketChange,
-		ChangePercent: result.RegularMarketChangePercent,
+		Price:         roundTo(result.RegularMarketPrice, opts.Decimals),
+		Change:        roundTo(result.RegularMarketChange, opts.Decimals),
+		ChangePercent: roundTo(changePercent, opts.Decimals),
 		PreviousClose: result.RegularMarketPreviousClose,
 		Volume:        result.RegularMarketVolume,
 		MarketCap:     result.MarketCap,
@@ -95,7 +155,204 @@ func ConvertYahooFinanceResponse(response *YahooFinanceResponse) (*StockResponse
 			Timestamp: timestamp,
 			Source:    "Yahoo Finance",
 		},
-	}, nil
+	}
+	stock.SetDisplayFields()
+
+	return stock, nil
+}
+
+// yahooErrorMessage describes the "error" field of a Yahoo Finance response,
+// usually an object such as {"code": "Bad Request", "description": "..."}.
+// It returns "" when there is no error.
+func yahooErrorMessage(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}:
+		code, _ := v["code"].(string)
+		description, _ := v["description"].(string)
+		switch {
+		case code != "" && description != "":
+			return code + ": " + description
+		case description != "":
+			return description
+		case code != "":
+			return code
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// SymbolMatch is a ticker found by searching for a company name
+type SymbolMatch struct {
+	Symbol   string `json:"symbol" xml:"symbol"`
+	Name     string `json:"name" xml:"name"`
+	Exchange string `json:"exchange,omitempty" xml:"exchange,omitempty"`
+	Type     string `json:"type,omitempty" xml:"type,omitempty"`
+}
+
+// maxEpochSeconds is the start of the year 3000 in Unix seconds. Yahoo
+// Finance timestamps are in seconds, but some responses carry milliseconds;
+// a value past this bound cannot be a plausible time in seconds.
+const maxEpochSeconds = 32503680000
+
+// marketTime converts a Yahoo Finance epoch timestamp to a time, reading it
+// as milliseconds when it is too large to be seconds
+func marketTime(epoch int64) time.Time {
+	if epoch > maxEpochSeconds {
+		return time.UnixMilli(epoch)
+	}
+	return time.Unix(epoch, 0)
+}
+
+// SymbolInfo describes a symbol the service can quote without an upstream
+// request, such as one of the demo-mode symbols
+type SymbolInfo struct {
+	Symbol   string `json:"symbol" xml:"symbol"`
+	Name     string `json:"name" xml:"name"`
+	Currency string `json:"currency,omitempty" xml:"currency,omitempty"`
+}
+
+// YahooFinanceSearchResponse represents the raw response from the Yahoo
+// Finance search endpoint
+type YahooFinanceSearchResponse struct {
+	Quotes []struct {
+		Symbol    string `json:"symbol"`
+		ShortName string `json:"shortname"`
+		LongName  string `json:"longname"`
+		Exchange  string `json:"exchDisp"`
+		QuoteType string `json:"quoteType"`
+	} `json:"quotes"`
+}
+
+// ConvertYahooFinanceSearchResponse extracts the symbol matches from a
+// search response, skipping entries without a symbol. It never returns nil,
+// so no matches encode as an empty array.
+func ConvertYahooFinanceSearchResponse(response *YahooFinanceSearchResponse) []SymbolMatch {
+	matches := make([]SymbolMatch, 0, len(response.Quotes))
+	for _, quote := range response.Quotes {
+		if quote.Symbol == "" {
+			continue
+		}
+		name := quote.LongName
+		if name == "" {
+			name = quote.ShortName
+		}
+		matches = append(matches, SymbolMatch{
+			Symbol:   quote.Symbol,
+			Name:     name,
+			Exchange: quote.Exchange,
+			Type:     quote.QuoteType,
+		})
+	}
+	return matches
+}
+
+// hasInconsistentSign reports whether change and percent point in opposite directions
+func hasInconsistentSign(change, percent float64) bool {
+	if change == 0 || percent == 0 {
+		return false
+	}
+	return math.Signbit(change) != math.Signbit(percent)
+}
+
+// marketStateDisplayText maps market states to the text shown in summaries
+var marketStateDisplayText = map[MarketState]string{
+	MarketStateRegular:    "Market Open",
+	MarketStatePremarket:  "Pre-Market",
+	MarketStatePostmarket: "After Hours",
+	MarketStateClosed:     "Market Closed",
+}
+
+// DisplayText returns a human-readable market state, or "" for unknown states
+func (m MarketState) DisplayText() string {
+	return marketStateDisplayText[m]
+}
+
+// IsOpen reports whether the regular trading session is in progress
+func (m MarketState) IsOpen() bool {
+	return m == MarketStateRegular
+}
+
+// IsTradeable reports whether orders can be placed, including pre-market and after hours
+func (m MarketState) IsTradeable() bool {
+	switch m {
+	case MarketStateRegular, MarketStatePremarket, MarketStatePostmarket:
+		return true
+	}
+	return false
+}
+
+// volumeUnits are the suffixes used by FormattedVolume, smallest first
+var volumeUnits = []string{"K", "M", "B", "T"}
+
+// FormattedVolume returns the volume abbreviated with two decimals, such as
+// "1.23M" or "987.65K". Volumes below a thousand are shown as is and a zero
+// volume is reported as "N/A".
+func (s *StockResponse) FormattedVolume() string {
+	if s.Volume <= 0 {
+		return "N/A"
+	}
+	if s.Volume < 1000 {
+		return strconv.FormatInt(s.Volume, 10)
+	}
+
+	value := float64(s.Volume)
+	unit := ""
+	for _, next := range volumeUnits {
+		value /= 1000
+		unit = next
+		// Stop unless rounding would print 1000.00 of this unit
+		if math.Round(value*100)/100 < 1000 {
+			break
+		}
+	}
+
+	return fmt.Sprintf("%.2f%s", value, unit)
+}
+
+// FormatThousands formats n with comma thousands separators, e.g. 1234567
+// as "1,234,567"
+func FormatThousands(n int64) string {
+	digits := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	return b.String()
+}
+
+// SetDisplayFields fills VolumeDisplay and MarketCapDisplay from the raw
+// numbers; a zero market cap leaves its display field empty
+func (s *StockResponse) SetDisplayFields() {
+	s.VolumeDisplay = FormatThousands(s.Volume)
+	s.MarketCapDisplay = ""
+	if s.MarketCap != 0 {
+		s.MarketCapDisplay = FormatThousands(s.MarketCap)
+	}
+}
+
+// LastModified returns the time of the quote
+func (s *StockResponse) LastModified() time.Time {
+	return s.Metadata.Timestamp
+}
+
+// WithoutCacheStamp returns a copy of the quote with Metadata.CachedAt cleared
+func (s *StockResponse) WithoutCacheStamp() interface{} {
+	copied := *s
+	copied.Metadata.CachedAt = nil
+	return &copied
 }
 
 // IsPositiveChange returns true if the stock price change is positive
@@ -112,3 +369,14 @@ func (s *StockResponse) GetChangeDirection() string {
 	}
 	return "neutral"
 }
+
+// ChangeSign returns "+", "-", or "" to prefix the absolute price change
+func (s *StockResponse) ChangeSign() string {
+	switch s.GetChangeDirection() {
+	case "up":
+		return "+"
+	case "down":
+		return "-"
+	}
+	return ""
+}
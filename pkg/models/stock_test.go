@@ -0,0 +1,303 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/internal/testutils"
+)
+
+func TestMarketState_DisplayText(t *testing.T) {
+	tests := []struct {
+		state MarketState
+		want  string
+	}{
+		{MarketStateRegular, "Market Open"},
+		{MarketStatePremarket, "Pre-Market"},
+		{MarketStatePostmarket, "After Hours"},
+		{MarketStateClosed, "Market Closed"},
+		{MarketState("UNKNOWN"), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.state), func(t *testing.T) {
+			if got := tt.state.DisplayText(); got != tt.want {
+				t.Errorf("DisplayText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarketState_IsTradeable(t *testing.T) {
+	tests := []struct {
+		state MarketState
+		want  bool
+	}{
+		{MarketStateRegular, true},
+		{MarketStatePremarket, true},
+		{MarketStatePostmarket, true},
+		{MarketStateClosed, false},
+		{MarketState(""), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.state), func(t *testing.T) {
+			if got := tt.state.IsTradeable(); got != tt.want {
+				t.Errorf("IsTradeable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStockResponse_FormattedVolume(t *testing.T) {
+	tests := []struct {
+		volume int64
+		want   string
+	}{
+		{0, "N/A"},
+		{-5, "N/A"},
+		{7, "7"},
+		{999, "999"},
+		{1000, "1.00K"},
+		{987654, "987.65K"},
+		{999994, "999.99K"},
+		{999995, "1.00M"},
+		{1234567, "1.23M"},
+		{1235000, "1.24M"},
+		{45678901, "45.68M"},
+		{2500000000, "2.50B"},
+		{999999999999, "1.00T"},
+		{3210000000000000, "3210.00T"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			stock := &StockResponse{Volume: tt.volume}
+			if got := stock.FormattedVolume(); got != tt.want {
+				t.Errorf("FormattedVolume(%d) = %q, want %q", tt.volume, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatThousands(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{1000, "1,000"},
+		{1234567, "1,234,567"},
+		{40000000000, "40,000,000,000"},
+		{-1234, "-1,234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := FormatThousands(tt.n); got != tt.want {
+				t.Errorf("FormatThousands(%d) = %q, want %q", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+// defaultConversion is the quote normalization a stock client uses by default
+var defaultConversion = StockConversionOptions{Decimals: DefaultStockDecimals}
+
+func TestConvertYahooFinanceResponse_DisplayFields(t *testing.T) {
+	var response YahooFinanceResponse
+	if err := json.Unmarshal([]byte(testutils.YahooFinanceStockResponse), &response); err != nil {
+		t.Fatalf("Failed to decode fixture: %v", err)
+	}
+	stock, err := ConvertYahooFinanceResponse(&response, defaultConversion)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	encoded, err := json.Marshal(stock)
+	if err != nil {
+		t.Fatalf("Failed to encode response: %v", err)
+	}
+	for _, field := range []string{
+		`"volume":1234567`,
+		`"volume_display":"1,234,567"`,
+		`"market_cap":40000000000`,
+		`"market_cap_display":"40,000,000,000"`,
+	} {
+		if !strings.Contains(string(encoded), field) {
+			t.Errorf("Expected %s in %s", field, encoded)
+		}
+	}
+}
+
+func TestConvertYahooFinanceResponse_InvalidQuotes(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{"zero price", testutils.YahooFinanceZeroPrice, 404},
+		{"negative price", testutils.YahooFinanceQuote("NEG", -1, 0), 404},
+		{"missing symbol", testutils.YahooFinanceMissingSymbol, 502},
+		{"no results", testutils.YahooFinanceStockNotFound, 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response YahooFinanceResponse
+			if err := json.Unmarshal([]byte(tt.body), &response); err != nil {
+				t.Fatalf("Failed to decode fixture: %v", err)
+			}
+
+			stock, err := ConvertYahooFinanceResponse(&response, defaultConversion)
+			if stock != nil {
+				t.Errorf("Expected no stock response, got %+v", stock)
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Expected an APIError, got %v", err)
+			}
+			if apiErr.Code != tt.wantCode {
+				t.Errorf("Expected code %d, got %d (%v)", tt.wantCode, apiErr.Code, err)
+			}
+		})
+	}
+
+	t.Run("error message is propagated", func(t *testing.T) {
+		var response YahooFinanceResponse
+		if err := json.Unmarshal([]byte(testutils.YahooFinanceErrorResponse), &response); err != nil {
+			t.Fatalf("Failed to decode fixture: %v", err)
+		}
+
+		_, err := ConvertYahooFinanceResponse(&response, defaultConversion)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("Expected an APIError, got %v", err)
+		}
+		if apiErr.Code != 502 {
+			t.Errorf("Expected code 502, got %d", apiErr.Code)
+		}
+		want := `Bad Request: Missing value for the "symbols" argument`
+		if !strings.Contains(apiErr.Message, want) {
+			t.Errorf("Expected message to contain %q, got %q", want, apiErr.Message)
+		}
+	})
+
+	t.Run("valid quote converts", func(t *testing.T) {
+		var response YahooFinanceResponse
+		if err := json.Unmarshal([]byte(testutils.YahooFinanceStockResponse), &response); err != nil {
+			t.Fatalf("Failed to decode fixture: %v", err)
+		}
+		if _, err := ConvertYahooFinanceResponse(&response, defaultConversion); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
+
+func TestYahooErrorMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"no error", nil, ""},
+		{"string", "Service unavailable", "Service unavailable"},
+		{"code and description", map[string]interface{}{"code": "Not Found", "description": "No data"}, "Not Found: No data"},
+		{"description only", map[string]interface{}{"description": "No data"}, "No data"},
+		{"code only", map[string]interface{}{"code": "Not Found"}, "Not Found"},
+		{"unknown shape", 42.0, "42"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := yahooErrorMessage(tt.value); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConvertYahooFinanceResponse_TimestampUnits(t *testing.T) {
+	want := time.Date(2024, time.January, 15, 14, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		fixture string
+	}{
+		{"seconds", testutils.YahooFinanceStockResponse},
+		{"milliseconds", testutils.YahooFinanceMillisecondTimestamp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response YahooFinanceResponse
+			if err := json.Unmarshal([]byte(tt.fixture), &response); err != nil {
+				t.Fatalf("Failed to decode fixture: %v", err)
+			}
+			stock, err := ConvertYahooFinanceResponse(&response, defaultConversion)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !stock.Metadata.Timestamp.Equal(want) {
+				t.Errorf("Expected timestamp %v, got %v", want, stock.Metadata.Timestamp.UTC())
+			}
+		})
+	}
+}
+
+func TestConvertYahooFinanceResponse_Rounding(t *testing.T) {
+	body := `{"quoteResponse": {"result": [{"symbol": "DDOG", "regularMarketPrice": 125.456789, "regularMarketChange": 2.3449999,
+		"regularMarketChangePercent": 1.8900000001, "regularMarketPreviousClose": 123.11, "marketState": "REGULAR"}], "error": null}}`
+
+	tests := []struct {
+		name              string
+		decimals          int
+		wantPrice         float64
+		wantChange        float64
+		wantChangePercent float64
+	}{
+		{"default two decimals", DefaultStockDecimals, 125.46, 2.34, 1.89},
+		{"four decimals", 4, 125.4568, 2.345, 1.89},
+		{"whole numbers", 0, 125, 2, 2},
+		{"negative keeps full precision", -1, 125.456789, 2.3449999, 1.8900000001},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response YahooFinanceResponse
+			if err := json.Unmarshal([]byte(body), &response); err != nil {
+				t.Fatalf("Failed to decode fixture: %v", err)
+			}
+			stock, err := ConvertYahooFinanceResponse(&response, StockConversionOptions{Decimals: tt.decimals})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if stock.Price != tt.wantPrice || stock.Change != tt.wantChange || stock.ChangePercent != tt.wantChangePercent {
+				t.Errorf("Expected %v / %v / %v, got %v / %v / %v",
+					tt.wantPrice, tt.wantChange, tt.wantChangePercent, stock.Price, stock.Change, stock.ChangePercent)
+			}
+		})
+	}
+
+	t.Run("JSON carries the rounded value", func(t *testing.T) {
+		var response YahooFinanceResponse
+		if err := json.Unmarshal([]byte(body), &response); err != nil {
+			t.Fatalf("Failed to decode fixture: %v", err)
+		}
+		stock, err := ConvertYahooFinanceResponse(&response, defaultConversion)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		encoded, _ := json.Marshal(stock)
+		if !strings.Contains(string(encoded), `"change_percent":1.89,`) {
+			t.Errorf("Expected a rounded change_percent in %s", encoded)
+		}
+	})
+}
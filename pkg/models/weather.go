@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"math"
+	"sort"
+	"time"
+)
 
 // WeatherCondition represents different weather states
 type WeatherCondition string
@@ -13,34 +17,138 @@ const (
 	Fog          WeatherCondition = "fog"
 	Drizzle      WeatherCondition = "drizzle"
 	Rain         WeatherCondition = "rain"
+	FreezingRain WeatherCondition = "freezing_rain"
+	Showers      WeatherCondition = "showers"
 	Snow         WeatherCondition = "snow"
 	Thunderstorm WeatherCondition = "thunderstorm"
 	Unknown      WeatherCondition = "unknown"
 )
 
+// conditionSeverity ranks conditions from Clear to Thunderstorm
+var conditionSeverity = map[WeatherCondition]int{
+	Clear:        0,
+	PartlyCloudy: 1,
+	Cloudy:       2,
+	Overcast:     3,
+	Fog:          4,
+	Drizzle:      5,
+	Rain:         6,
+	Showers:      7,
+	FreezingRain: 8,
+	Snow:         9,
+	Thunderstorm: 10,
+}
+
+// Severity returns the condition's rank on a scale from 0 (Clear) to 10
+// (Thunderstorm). Unknown conditions rank below Clear at -1.
+func (c WeatherCondition) Severity() int {
+	if severity, ok := conditionSeverity[c]; ok {
+		return severity
+	}
+	return -1
+}
+
+// heavyRainCodes are the rain codes IsSevereWeatherCode counts as heavy
+// rain; slight and moderate rain or showers are not severe
+var heavyRainCodes = map[int]bool{
+	65: true, // Heavy rain
+	67: true, // Heavy freezing rain
+	82: true, // Violent rain showers
+}
+
+// IsSevereWeatherCode reports whether an Open-Meteo weather code is worth
+// alerting on: a thunderstorm, snow, or heavy rain. Conditions alone cannot
+// tell, as Rain and Showers cover light and heavy rain alike.
+func IsSevereWeatherCode(code int) bool {
+	condition, _ := GetWeatherCondition(code)
+	switch condition {
+	case Thunderstorm, Snow:
+		return true
+	}
+	return heavyRainCodes[code]
+}
+
+// conditionIcons names an icon for each condition, for frontends that render
+// conditions consistently
+var conditionIcons = map[WeatherCondition]string{
+	Clear:        "sun",
+	PartlyCloudy: "cloud-sun",
+	Cloudy:       "cloud",
+	Overcast:     "clouds",
+	Fog:          "fog",
+	Drizzle:      "cloud-drizzle",
+	Rain:         "cloud-rain",
+	Showers:      "cloud-showers",
+	FreezingRain: "cloud-sleet",
+	Snow:         "snow",
+	Thunderstorm: "cloud-lightning",
+}
+
+// Icon returns the icon name for the condition, or "unknown" for conditions
+// without one
+func (c WeatherCondition) Icon() string {
+	if icon, ok := conditionIcons[c]; ok {
+		return icon
+	}
+	return "unknown"
+}
+
 // WeatherResponse represents the standardized weather response
 type WeatherResponse struct {
-	City        string           `json:"city"`
-	Country     string           `json:"country"`
-	Temperature float64          `json:"temperature"`
-	Condition   WeatherCondition `json:"condition"`
-	Description string           `json:"description"`
-	IsDay       bool             `json:"is_day"`
-	Coordinates Coordinates      `json:"coordinates"`
-	Metadata    ResponseMetadata `json:"metadata"`
+	City    string `json:"city" xml:"city"`
+	Country string `json:"country" xml:"country"`
+	// Region is the first-level administrative area, such as a state, when known
+	Region      string  `json:"region,omitempty" xml:"region,omitempty"`
+	Temperature float64 `json:"temperature" xml:"temperature"`
+	// ApparentTemperature is the perceived ("feels like") temperature, when reported
+	ApparentTemperature *float64         `json:"apparent_temperature,omitempty" xml:"apparent_temperature,omitempty"`
+	Condition           WeatherCondition `json:"condition" xml:"condition"`
+	Severity            int              `json:"severity" xml:"severity"`
+	Severe              bool             `json:"severe" xml:"severe"`
+	Description         string           `json:"description" xml:"description"`
+	IsDay               bool             `json:"is_day" xml:"is_day"`
+	UVIndex             float64          `json:"uv_index,omitempty" xml:"uv_index,omitempty"`
+	Coordinates         Coordinates      `json:"coordinates" xml:"coordinates"`
+	Metadata            ResponseMetadata `json:"metadata" xml:"metadata"`
+	// Stale is set when the observation is older than the service's threshold
+	Stale bool `json:"stale,omitempty" xml:"stale,omitempty"`
+}
+
+// ResolvedLocation is a city name resolved by the geocoder
+type ResolvedLocation struct {
+	Name    string `json:"name" xml:"name"`
+	Country string `json:"country" xml:"country"`
+	// Region is the first-level administrative area (Open-Meteo's admin1),
+	// such as a state, which tells apart cities sharing a name
+	Region      string      `json:"region,omitempty" xml:"region,omitempty"`
+	Coordinates Coordinates `json:"coordinates" xml:"coordinates"`
+}
+
+// CityInfo describes a city that resolves without a geocoding request
+type CityInfo struct {
+	Name        string      `json:"name" xml:"name"`
+	Country     string      `json:"country" xml:"country"`
+	Coordinates Coordinates `json:"coordinates" xml:"coordinates"`
 }
 
 // OpenMeteoResponse represents the raw response from Open-Meteo API
 type OpenMeteoResponse struct {
 	Current struct {
-		Time          string  `json:"time"`
-		Temperature2m float64 `json:"temperature_2m"`
-		WeatherCode   int     `json:"weather_code"`
-		IsDay         int     `json:"is_day"`
-	} `json:"current"`
+		Time          string  `json:"time" xml:"time"`
+		Temperature2m float64 `json:"temperature_2m" xml:"temperature_2m"`
+		WeatherCode   int     `json:"weather_code" xml:"weather_code"`
+		IsDay         int     `json:"is_day" xml:"is_day"`
+		UVIndex       float64 `json:"uv_index" xml:"uv_index"`
+		// ApparentTemperature is nil when the field is missing from the response
+		ApparentTemperature *float64 `json:"apparent_temperature" xml:"apparent_temperature"`
+	} `json:"current" xml:"current"`
 	CurrentUnits struct {
-		Temperature2m string `json:"temperature_2m"`
-	} `json:"current_units"`
+		Temperature2m string `json:"temperature_2m" xml:"temperature_2m"`
+	} `json:"current_units" xml:"current_units"`
+	// UTCOffsetSeconds is the offset of the local times in Current
+	UTCOffsetSeconds int `json:"utc_offset_seconds" xml:"utc_offset_seconds"`
+	// Timezone is the IANA name of the zone the local times are in
+	Timezone string `json:"timezone" xml:"timezone"`
 }
 
 // WeatherCodeMap maps Open-Meteo weather codes to our conditions
@@ -57,17 +165,56 @@ var WeatherCodeMap = map[int]struct {
 	51: {Drizzle, "Light drizzle"},
 	53: {Drizzle, "Moderate drizzle"},
 	55: {Drizzle, "Dense drizzle"},
+	56: {FreezingRain, "Light freezing drizzle"},
+	57: {FreezingRain, "Dense freezing drizzle"},
 	61: {Rain, "Slight rain"},
 	63: {Rain, "Moderate rain"},
 	65: {Rain, "Heavy rain"},
+	66: {FreezingRain, "Light freezing rain"},
+	67: {FreezingRain, "Heavy freezing rain"},
 	71: {Snow, "Slight snow fall"},
 	73: {Snow, "Moderate snow fall"},
 	75: {Snow, "Heavy snow fall"},
+	77: {Snow, "Snow grains"},
+	80: {Showers, "Slight rain showers"},
+	81: {Showers, "Moderate rain showers"},
+	82: {Showers, "Violent rain showers"},
+	85: {Snow, "Slight snow showers"},
+	86: {Snow, "Heavy snow showers"},
 	95: {Thunderstorm, "Thunderstorm"},
 	96: {Thunderstorm, "Thunderstorm with slight hail"},
 	99: {Thunderstorm, "Thunderstorm with heavy hail"},
 }
 
+// WeatherCodeEntry describes one Open-Meteo weather code
+type WeatherCodeEntry struct {
+	Code        int              `json:"code" xml:"code"`
+	Condition   WeatherCondition `json:"condition" xml:"condition"`
+	Description string           `json:"description" xml:"description"`
+	Severity    int              `json:"severity" xml:"severity"`
+	Severe      bool             `json:"severe" xml:"severe"`
+	Icon        string           `json:"icon" xml:"icon"`
+}
+
+// WeatherCodeReference returns every entry of WeatherCodeMap sorted by code
+func WeatherCodeReference() []WeatherCodeEntry {
+	entries := make([]WeatherCodeEntry, 0, len(WeatherCodeMap))
+	for code, weather := range WeatherCodeMap {
+		entries = append(entries, WeatherCodeEntry{
+			Code:        code,
+			Condition:   weather.Condition,
+			Description: weather.Description,
+			Severity:    weather.Condition.Severity(),
+			Severe:      IsSevereWeatherCode(code),
+			Icon:        weather.Condition.Icon(),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Code < entries[j].Code
+	})
+	return entries
+}
+
 // GetWeatherCondition converts Open-Meteo weather code to our condition
 func GetWeatherCondition(code int) (WeatherCondition, string) {
 	if weather, exists := WeatherCodeMap[code]; exists {
@@ -80,20 +227,72 @@ func GetWeatherCondition(code int) (WeatherCondition, string) {
 func ConvertOpenMeteoResponse(response *OpenMeteoResponse, city, country string, coords Coordinates) *WeatherResponse {
 	condition, description := GetWeatherCondition(response.Current.WeatherCode)
 
-	// Parse time
-	timestamp, _ := time.Parse("2006-01-02T15:04", response.Current.Time)
+	// Parse time in the zone Open-Meteo reports, which is local to the
+	// coordinates with timezone=auto; the fixed offset covers unknown names
+	location, err := time.LoadLocation(response.Timezone)
+	if response.Timezone == "" || err != nil {
+		location = time.FixedZone(response.Timezone, response.UTCOffsetSeconds)
+	}
+	timestamp, _ := time.ParseInLocation("2006-01-02T15:04", response.Current.Time, location)
 
 	return &WeatherResponse{
-		City:        city,
-		Country:     country,
-		Temperature: response.Current.Temperature2m,
-		Condition:   condition,
-		Description: description,
-		IsDay:       response.Current.IsDay == 1,
-		Coordinates: coords,
+		City:                city,
+		Country:             country,
+		Temperature:         response.Current.Temperature2m,
+		ApparentTemperature: response.Current.ApparentTemperature,
+		Condition:           condition,
+		Severity:            condition.Severity(),
+		Severe:              IsSevereWeatherCode(response.Current.WeatherCode),
+		Description:         description,
+		IsDay:               response.Current.IsDay == 1,
+		UVIndex:             response.Current.UVIndex,
+		Coordinates:         coords,
 		Metadata: ResponseMetadata{
 			Timestamp: timestamp,
 			Source:    "Open-Meteo",
 		},
 	}
 }
+
+// LastModified returns when the conditions were observed
+func (w *WeatherResponse) LastModified() time.Time {
+	return w.Metadata.Timestamp
+}
+
+// WithoutCacheStamp returns a copy of the response with Metadata.CachedAt cleared
+func (w *WeatherResponse) WithoutCacheStamp() interface{} {
+	copied := *w
+	copied.Metadata.CachedAt = nil
+	return &copied
+}
+
+// FeelsNotable reports whether the apparent temperature differs from the
+// measured one by more than a degree, making it worth mentioning
+func (w *WeatherResponse) FeelsNotable() bool {
+	return w.ApparentTemperature != nil && math.Abs(*w.ApparentTemperature-w.Temperature) > 1
+}
+
+// Age returns how long ago the conditions were observed, or zero when the
+// observation time is unknown
+func (w *WeatherResponse) Age() time.Duration {
+	if w.Metadata.Timestamp.IsZero() {
+		return 0
+	}
+	return time.Since(w.Metadata.Timestamp)
+}
+
+// UVRiskLevel returns the WHO exposure category for the UV index
+func (w *WeatherResponse) UVRiskLevel() string {
+	switch {
+	case w.UVIndex < 3:
+		return "Low"
+	case w.UVIndex < 6:
+		return "Moderate"
+	case w.UVIndex < 8:
+		return "High"
+	case w.UVIndex < 11:
+		return "Very High"
+	default:
+		return "Extreme"
+	}
+}
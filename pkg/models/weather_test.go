@@ -0,0 +1,91 @@
+package models
+
+import "testing"
+
+func TestWeatherCondition_Severity(t *testing.T) {
+	ordered := []WeatherCondition{
+		Clear, PartlyCloudy, Cloudy, Overcast, Fog, Drizzle,
+		Rain, Showers, FreezingRain, Snow, Thunderstorm,
+	}
+
+	if got := Unknown.Severity(); got >= Clear.Severity() {
+		t.Errorf("Expected unknown to rank below clear, got %d", got)
+	}
+	for i := 1; i < len(ordered); i++ {
+		if ordered[i-1].Severity() >= ordered[i].Severity() {
+			t.Errorf("Expected %s (%d) to rank below %s (%d)",
+				ordered[i-1], ordered[i-1].Severity(), ordered[i], ordered[i].Severity())
+		}
+	}
+	if Clear.Severity() != 0 || Thunderstorm.Severity() != 10 {
+		t.Errorf("Expected a scale from 0 to 10, got %d to %d", Clear.Severity(), Thunderstorm.Severity())
+	}
+}
+
+func TestIsSevereWeatherCode(t *testing.T) {
+	tests := []struct {
+		name string
+		code int
+		want bool
+	}{
+		{"clear sky", 0, false},
+		{"overcast", 3, false},
+		{"fog", 45, false},
+		{"dense drizzle", 55, false},
+		{"moderate rain", 63, false},
+		{"heavy rain", 65, true},
+		{"heavy freezing rain", 67, true},
+		{"slight snow fall", 71, true},
+		{"slight rain showers", 80, false},
+		{"moderate rain showers", 81, false},
+		{"violent rain showers", 82, true},
+		{"heavy snow showers", 86, true},
+		{"thunderstorm", 95, true},
+		{"unknown code", 42, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSevereWeatherCode(tt.code); got != tt.want {
+				t.Errorf("Expected IsSevereWeatherCode(%d) = %v, got %v", tt.code, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWeatherCodeReference(t *testing.T) {
+	entries := WeatherCodeReference()
+
+	if len(entries) != len(WeatherCodeMap) {
+		t.Fatalf("Expected %d entries, got %d", len(WeatherCodeMap), len(entries))
+	}
+	for i, entry := range entries {
+		known, ok := WeatherCodeMap[entry.Code]
+		if !ok {
+			t.Errorf("Entry %d: unexpected code %d", i, entry.Code)
+			continue
+		}
+		if entry.Condition != known.Condition || entry.Description != known.Description {
+			t.Errorf("Code %d: expected %s %q, got %s %q", entry.Code, known.Condition, known.Description, entry.Condition, entry.Description)
+		}
+		if entry.Icon == "unknown" || entry.Severity < 0 {
+			t.Errorf("Code %d: expected an icon and severity for %s, got %q and %d", entry.Code, entry.Condition, entry.Icon, entry.Severity)
+		}
+		if i > 0 && entries[i-1].Code >= entry.Code {
+			t.Errorf("Expected codes in ascending order, got %d before %d", entries[i-1].Code, entry.Code)
+		}
+	}
+}
+
+func TestConvertOpenMeteoResponse_Severity(t *testing.T) {
+	var response OpenMeteoResponse
+	response.Current.WeatherCode = 95
+
+	weather := ConvertOpenMeteoResponse(&response, "Stuttgart", "Germany", Coordinates{})
+	if weather.Severity != Thunderstorm.Severity() {
+		t.Errorf("Expected severity %d, got %d", Thunderstorm.Severity(), weather.Severity)
+	}
+	if !weather.Severe {
+		t.Error("Expected a thunderstorm to be severe")
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type clientIPKey struct{}
+
+// DefaultTrustedProxyHeaders are the forwarded headers trusted when
+// Config.TrustProxyHeaders is set without an explicit TrustedProxyHeaders list.
+// Like any trusted header, X-Forwarded-For is read from its right-most entry.
+var DefaultTrustedProxyHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+// ClientIPMiddleware resolves the client address once per request so later
+// middleware and handlers can read it with clientIP. Only the forwarded
+// headers in trustedHeaders are honored, tried in order; with none the
+// address is always taken from RemoteAddr, since otherwise any client could
+// claim an arbitrary address.
+func ClientIPMiddleware(trustedHeaders []string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolveClientIP(r, trustedHeaders)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip)))
+		})
+	}
+}
+
+// clientIP returns the client address resolved by ClientIPMiddleware, or the
+// host part of r.RemoteAddr when the middleware did not run
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return resolveClientIP(r, nil)
+}
+
+// resolveClientIP picks the client address from the first trusted header
+// holding a valid address, and from RemoteAddr otherwise
+func resolveClientIP(r *http.Request, trustedHeaders []string) string {
+	for _, header := range trustedHeaders {
+		if ip := parseIP(lastHeaderEntry(r.Header, header)); ip != "" {
+			return ip
+		}
+	}
+
+	if ip := parseIP(r.RemoteAddr); ip != "" {
+		return ip
+	}
+	return r.RemoteAddr
+}
+
+// lastHeaderEntry returns the right-most entry of a possibly list-valued
+// header. Proxies append the address they received the request from, so
+// everything left of that entry was supplied by the client and can be
+// forged; only the entry added by the proxy in front of us is trustworthy.
+func lastHeaderEntry(header http.Header, name string) string {
+	values := header.Values(name)
+	if len(values) == 0 {
+		return ""
+	}
+	last := values[len(values)-1]
+	if i := strings.LastIndex(last, ","); i >= 0 {
+		last = last[i+1:]
+	}
+	return last
+}
+
+// validHeaderName reports whether name is a non-empty HTTP header field name
+// made only of token characters
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > '~' || c <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseIP extracts a normalized IP from an address that may carry a port
+// and IPv6 brackets, e.g. "[::1]:54321", "::1", or "10.0.0.1:8080". It
+// returns "" when value holds no valid IP.
+func parseIP(value string) string {
+	value = strings.TrimSpace(value)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Timestamped is implemented by response data that knows when it was
+// produced upstream, such as weather observations and stock quotes
+type Timestamped interface {
+	LastModified() time.Time
+}
+
+// setLastModified sets the Last-Modified header from data's upstream
+// timestamp, if it has a known one
+func setLastModified(w http.ResponseWriter, data interface{}) {
+	timestamped, ok := data.(Timestamped)
+	if !ok {
+		return
+	}
+	if modified := timestamped.LastModified(); !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// CacheStamped is implemented by response data that records when it was
+// stored in a cache
+type CacheStamped interface {
+	WithoutCacheStamp() interface{}
+}
+
+// computeETag derives a strong entity tag from the response data in the given
+// format. The envelope's timestamp and timing metadata are left out so that
+// data served from a cache keeps the same tag across requests, and so is the
+// cache stamp so that a live response and its cached copies share a tag.
+func computeETag(format string, data interface{}) (string, error) {
+	if stamped, ok := data.(CacheStamped); ok {
+		data = stamped.WithoutCacheStamp()
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(append([]byte(format+"\n"), encoded...))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag,
+// using the weak comparison RFC 9110 requires for If-None-Match
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified answers a matching conditional request and reports whether
+// it did so. Only GET and HEAD requests are considered.
+func writeNotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	if r == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Add("Vary", "Accept")
+
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch == "" || !etagMatches(ifNoneMatch, etag) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Response formats selectable through the Accept header
+const (
+	formatJSON   = "application/json"
+	formatXML    = "application/xml"
+	formatNDJSON = "application/x-ndjson"
+)
+
+// negotiateFormat picks the response format from the request's Accept header.
+// XML is used only when the client prefers application/xml or text/xml, and
+// JSON lines only when it prefers application/x-ndjson (which only batch
+// endpoints stream; the rest answer it with JSON); everything else,
+// including a missing header, gets JSON.
+func negotiateFormat(r *http.Request) string {
+	if r == nil {
+		return formatJSON
+	}
+
+	type candidate struct {
+		format  string
+		quality float64
+	}
+	var candidates []candidate
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(q, 64); err == nil {
+				quality = parsed
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+
+		switch mediaType {
+		case "application/xml", "text/xml":
+			candidates = append(candidates, candidate{formatXML, quality})
+		case "application/x-ndjson":
+			candidates = append(candidates, candidate{formatNDJSON, quality})
+		case "application/json", "application/*", "*/*":
+			candidates = append(candidates, candidate{formatJSON, quality})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return formatJSON
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].quality > candidates[j].quality
+	})
+	return candidates[0].format
+}
+
+// responseIndent is the indentation of pretty-printed responses
+const responseIndent = "  "
+
+// wantsPretty reports whether the response to r should be indented: the
+// pretty query parameter decides when it holds a boolean, and defaultPretty
+// otherwise
+func wantsPretty(r *http.Request, defaultPretty bool) bool {
+	if r == nil {
+		return defaultPretty
+	}
+	if pretty, err := strconv.ParseBool(r.URL.Query().Get("pretty")); err == nil {
+		return pretty
+	}
+	return defaultPretty
+}
+
+// writeEncoded writes the status and body in the given format, indented
+// when pretty is set
+func writeEncoded(w http.ResponseWriter, format string, statusCode int, body interface{}, pretty bool) error {
+	if format == formatXML {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(statusCode)
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+		encoder := xml.NewEncoder(w)
+		if pretty {
+			encoder.Indent("", responseIndent)
+		}
+		return encoder.Encode(body)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	encoder := json.NewEncoder(w)
+	if pretty {
+		encoder.SetIndent("", responseIndent)
+	}
+	return encoder.Encode(body)
+}
+
+// ndjsonStream writes a streamed response as one JSON object per line,
+// flushing after each so clients can act on results as they arrive
+type ndjsonStream struct {
+	encoder *json.Encoder
+	flusher http.Flusher
+}
+
+// newNDJSONStream sends the response headers and returns a stream for the body
+func newNDJSONStream(w http.ResponseWriter) *ndjsonStream {
+	w.Header().Set("Content-Type", formatNDJSON)
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	return &ndjsonStream{encoder: json.NewEncoder(w), flusher: flusher}
+}
+
+// Write encodes v as the next line
+func (s *ndjsonStream) Write(v interface{}) error {
+	if err := s.encoder.Encode(v); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+// xmlValue wraps response data for XML encoding. encoding/xml cannot marshal
+// maps, so map entries become child elements named after their keys. Keys
+// that are not valid XML names, such as city names with spaces, become
+// <entry key="..."> elements instead.
+type xmlValue struct {
+	value interface{}
+}
+
+// MarshalXML implements xml.Marshaler
+func (v xmlValue) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	rv := reflect.ValueOf(v.value)
+	if rv.Kind() != reflect.Map {
+		return e.EncodeElement(v.value, start)
+	}
+
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	keys := rv.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	for _, key := range keys {
+		name := fmt.Sprint(key.Interface())
+		element := xml.StartElement{Name: xml.Name{Local: name}}
+		if !isXMLName(name) {
+			element = xml.StartElement{
+				Name: xml.Name{Local: "entry"},
+				Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}},
+			}
+		}
+		if err := e.EncodeElement(xmlValue{rv.MapIndex(key).Interface()}, element); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// isXMLName reports whether name can be used as an element name as is:
+// a letter or underscore followed by letters, digits, '-', '_', or '.'.
+// encoding/xml writes any name without checking it.
+func isXMLName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r)):
+		default:
+			return false
+		}
+	}
+	return true
+}
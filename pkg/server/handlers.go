@@ -1,26 +1,47 @@
 package server
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
-	"log"
+	"math"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/health"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/stock"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/tracing"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/weather"
 )
 
 // Handler contains the services for handling HTTP requests
 type Handler struct {
+	config         *Config
 	weatherService *weather.Service
 	stockService   *stock.Service
 }
 
 // NewHandler creates a new handler with the required services
-func NewHandler(weatherService *weather.Service, stockService *stock.Service) *Handler {
+func NewHandler(config *Config, weatherService *weather.Service, stockService *stock.Service) *Handler {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.HealthTracker == nil {
+		config.HealthTracker = health.NewTracker()
+	}
+
 	return &Handler{
+		config:         config,
 		weatherService: weatherService,
 		stockService:   stockService,
 	}
@@ -28,24 +49,151 @@ func NewHandler(weatherService *weather.Service, stockService *stock.Service) *H
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error   string    `json:"error"`
-	Code    int       `json:"code"`
-	Message string    `json:"message"`
-	Time    time.Time `json:"timestamp"`
+	XMLName xml.Name  `json:"-" xml:"response"`
+	Error   string    `json:"error" xml:"error"`
+	Code    int       `json:"code" xml:"code"`
+	Message string    `json:"message" xml:"message"`
+	Time    time.Time `json:"timestamp" xml:"timestamp"`
 }
 
 // SuccessResponse represents a successful response wrapper
 type SuccessResponse struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data"`
-	Time    time.Time   `json:"timestamp"`
+	XMLName xml.Name      `json:"-" xml:"response"`
+	Success bool          `json:"success" xml:"success"`
+	Data    interface{}   `json:"data" xml:"data"`
+	Time    time.Time     `json:"timestamp" xml:"timestamp"`
+	Meta    *ResponseMeta `json:"meta,omitempty" xml:"meta,omitempty"`
+}
+
+// ResponseMeta describes how a response was produced
+type ResponseMeta struct {
+	// UpstreamSource names the data source, e.g. "Yahoo Finance" or "Demo Mode"
+	UpstreamSource string `json:"upstream_source,omitempty" xml:"upstream_source,omitempty"`
+	// DurationMs is the time spent handling the request in milliseconds
+	DurationMs int64 `json:"duration_ms" xml:"duration_ms"`
+	// Cached reports whether the data was served from a cache rather than
+	// fetched live
+	Cached bool `json:"cached" xml:"cached"`
+	// CacheAge is how many seconds the data spent in a cache; absent for live data
+	CacheAge *float64 `json:"cache_age,omitempty" xml:"cache_age,omitempty"`
+}
+
+// newResponseMeta builds response metadata measured from the handler's start time
+func newResponseMeta(start time.Time, source string) *ResponseMeta {
+	return &ResponseMeta{
+		UpstreamSource: source,
+		DurationMs:     time.Since(start).Milliseconds(),
+	}
+}
+
+// withCacheAge marks the data as cached and records its age when it was
+// stored in a cache at cachedAt; nil leaves the metadata unchanged
+func (m *ResponseMeta) withCacheAge(cachedAt *time.Time) *ResponseMeta {
+	if cachedAt != nil {
+		age := time.Since(*cachedAt).Seconds()
+		m.Cached = true
+		m.CacheAge = &age
+	}
+	return m
+}
+
+// maxRequestBodyBytes caps the size of JSON request bodies
+const maxRequestBodyBytes = 4 << 10
+
+// WeatherRequest is the JSON body accepted by POST /weather
+type WeatherRequest struct {
+	City     string `json:"city"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// WeatherBatchRequest is the JSON body accepted by POST /weather/batch
+type WeatherBatchRequest struct {
+	Cities []string `json:"cities"`
+}
+
+// StockRequest is the JSON body accepted by POST /stock
+type StockRequest struct {
+	Symbol string `json:"symbol"`
+	// Fresh bypasses the quote cache
+	Fresh bool `json:"fresh,omitempty"`
+}
+
+// DashboardResponse is the body of GET /dashboard. A section is present only
+// when its query parameter was given.
+type DashboardResponse struct {
+	Weather *DashboardWeather `json:"weather,omitempty" xml:"weather,omitempty"`
+	Stock   *DashboardStock   `json:"stock,omitempty" xml:"stock,omitempty"`
+}
+
+// DashboardWeather is the weather section of a dashboard; a failed fetch
+// carries its error message instead of the weather
+type DashboardWeather struct {
+	City    string                  `json:"city" xml:"city"`
+	Weather *models.WeatherResponse `json:"weather,omitempty" xml:"weather,omitempty"`
+	Error   string                  `json:"error,omitempty" xml:"error,omitempty"`
 }
 
-// writeErrorResponse writes an error response to the HTTP response writer
-func (h *Handler) writeErrorResponse(w http.ResponseWriter, err error, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+// DashboardStock is the stock section of a dashboard; a failed fetch
+// carries its error message instead of the quote
+type DashboardStock struct {
+	Symbol string                `json:"symbol" xml:"symbol"`
+	Stock  *models.StockResponse `json:"stock,omitempty" xml:"stock,omitempty"`
+	Error  string                `json:"error,omitempty" xml:"error,omitempty"`
+}
+
+// maxLoggedValueLength caps user-supplied values such as city names in log lines
+const maxLoggedValueLength = 64
+
+// truncateForLog shortens a user-supplied value for logging
+func truncateForLog(value string) string {
+	return truncate(value, maxLoggedValueLength)
+}
+
+// normalizeSymbol trims and uppercases a ticker symbol taken from a request,
+// so responses echo "DDOG" even when the client asked for " ddog"
+func normalizeSymbol(symbol string) string {
+	return strings.ToUpper(strings.TrimSpace(symbol))
+}
+
+// truncate cuts value to at most max bytes without splitting a UTF-8
+// sequence, marking the cut with an ellipsis
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+
+	cut := max
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	return value[:cut] + "…"
+}
 
+// decodeJSONBody decodes a size-limited JSON request body into dst and returns
+// the HTTP status code to report when decoding fails
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) (int, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return http.StatusUnsupportedMediaType, fmt.Errorf("content type must be application/json")
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return http.StatusRequestEntityTooLarge, fmt.Errorf("request body must not exceed %d bytes", maxBytesErr.Limit)
+		}
+		return http.StatusBadRequest, fmt.Errorf("invalid JSON body: %v", err)
+	}
+
+	return http.StatusOK, nil
+}
+
+// writeErrorResponse writes an error response in the format negotiated from the request
+func (h *Handler) writeErrorResponse(w http.ResponseWriter, r *http.Request, err error, statusCode int) {
 	errorResp := ErrorResponse{
 		Error:   err.Error(),
 		Code:    statusCode,
@@ -53,160 +201,727 @@ func (h *Handler) writeErrorResponse(w http.ResponseWriter, err error, statusCod
 		Time:    time.Now(),
 	}
 
-	json.NewEncoder(w).Encode(errorResp)
-	log.Printf("Error response: %v", err)
+	writeEncoded(w, negotiateFormat(r), statusCode, errorResp, wantsPretty(r, h.config.PrettyJSON))
+	logging.Warnf("Error response: %v", err)
 }
 
-// writeSuccessResponse writes a successful response to the HTTP response writer
-func (h *Handler) writeSuccessResponse(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
+// writeSuccessResponse writes a successful response in the format negotiated
+// from the request, including the optional metadata when given. The body is
+// indented with pretty=true or Config.PrettyJSON. GET responses
+// carry an ETag, and a matching If-None-Match gets a 304 without a body.
+// Timestamped data also sets Last-Modified.
+func (h *Handler) writeSuccessResponse(w http.ResponseWriter, r *http.Request, data interface{}, meta ...*ResponseMeta) {
 	successResp := SuccessResponse{
 		Success: true,
 		Data:    data,
 		Time:    time.Now(),
 	}
+	if len(meta) > 0 {
+		successResp.Meta = meta[0]
+	}
 
-	json.NewEncoder(w).Encode(successResp)
+	setLastModified(w, data)
+
+	format := negotiateFormat(r)
+	pretty := wantsPretty(r, h.config.PrettyJSON)
+
+	// Indented bodies are a different representation, so they get their own tag
+	variant := format
+	if pretty {
+		variant += "; pretty"
+	}
+	if etag, err := computeETag(variant, data); err == nil && writeNotModified(w, r, etag) {
+		return
+	}
+
+	if format == formatXML {
+		successResp.Data = xmlValue{data}
+	}
+	writeEncoded(w, format, http.StatusOK, successResp, pretty)
 }
 
-// GetWeather handles GET /weather?city=<city_name> requests
+// GetWeather handles GET /weather?city=<city_name> and POST /weather {"city": "<city_name>"} requests
 func (h *Handler) GetWeather(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET requests
-	if r.Method != http.MethodGet {
-		h.writeErrorResponse(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
-		return
+	start := time.Now()
+
+	var city, timezone string
+
+	switch r.Method {
+	case http.MethodGet:
+		// Get city and optional timezone parameters from query string
+		city = r.URL.Query().Get("city")
+		timezone = r.URL.Query().Get("timezone")
+	case http.MethodPost:
+		var req WeatherRequest
+		if statusCode, err := decodeJSONBody(w, r, &req); err != nil {
+			h.writeErrorResponse(w, r, err, statusCode)
+			return
+		}
+		city = req.City
+		timezone = req.Timezone
 	}
 
-	// Get city parameter from query string
-	city := r.URL.Query().Get("city")
 	if city == "" {
-		h.writeErrorResponse(w, fmt.Errorf("missing required parameter 'city'"), http.StatusBadRequest)
+		h.writeErrorResponse(w, r, fmt.Errorf("missing required parameter 'city'"), http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Weather request for city: %s", city)
+	logging.Debugf("Weather request for city: %s", truncateForLog(city))
+	tracing.SpanFromContext(r.Context()).SetTag(tracing.TagWeatherCity, city)
 
 	// Get weather data
-	weatherData, err := h.weatherService.GetWeatherWithValidation(city)
+	weatherData, err := h.weatherService.GetWeatherInTimezoneCtx(r.Context(), city, timezone)
 	if err != nil {
 		// Check if it's an API error to determine status code
 		if apiErr, ok := err.(*models.APIError); ok {
-			h.writeErrorResponse(w, err, apiErr.Code)
+			h.writeErrorResponse(w, r, err, apiErr.Code)
 		} else {
-			h.writeErrorResponse(w, err, http.StatusInternalServerError)
+			h.writeErrorResponse(w, r, err, http.StatusInternalServerError)
 		}
 		return
 	}
 
-	h.writeSuccessResponse(w, weatherData)
-	log.Printf("Weather request completed successfully for city: %s", city)
+	h.writeSuccessResponse(w, r, weatherData, newResponseMeta(start, weatherData.Metadata.Source).withCacheAge(weatherData.Metadata.CachedAt))
+	logging.Infof("Weather request completed successfully for city: %s", truncateForLog(city))
 }
 
-// GetDatadogStock handles GET /stock/datadog requests
-func (h *Handler) GetDatadogStock(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET requests
-	if r.Method != http.MethodGet {
-		h.writeErrorResponse(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+// GetWeatherByCoordinates handles GET /weather/coordinates?lat=<lat>&lon=<lon>
+// requests for places that are easier to give as a point than as a city name
+func (h *Handler) GetWeatherByCoordinates(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	lat, err := parseCoordinate(r, "lat")
+	if err != nil {
+		h.writeErrorResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+	lon, err := parseCoordinate(r, "lon")
+	if err != nil {
+		h.writeErrorResponse(w, r, err, http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Datadog stock price request")
+	logging.Debugf("Weather request for coordinates: %v,%v", lat, lon)
 
-	// Get Datadog stock data
-	stockData, err := h.stockService.GetDatadogPrice()
+	weatherData, err := h.weatherService.GetWeatherByCoordinatesCtx(r.Context(), lat, lon)
 	if err != nil {
-		// Check if it's an API error to determine status code
 		if apiErr, ok := err.(*models.APIError); ok {
-			h.writeErrorResponse(w, err, apiErr.Code)
+			h.writeErrorResponse(w, r, err, apiErr.Code)
 		} else {
-			h.writeErrorResponse(w, err, http.StatusInternalServerError)
+			h.writeErrorResponse(w, r, err, http.StatusInternalServerError)
 		}
 		return
 	}
 
-	h.writeSuccessResponse(w, stockData)
-	log.Printf("Datadog stock request completed successfully")
+	h.writeSuccessResponse(w, r, weatherData, newResponseMeta(start, weatherData.Metadata.Source).withCacheAge(weatherData.Metadata.CachedAt))
+	logging.Infof("Weather request completed successfully for coordinates: %v,%v", lat, lon)
 }
 
-// GetStock handles GET /stock?symbol=<symbol> requests (generic stock endpoint)
-func (h *Handler) GetStock(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET requests
-	if r.Method != http.MethodGet {
-		h.writeErrorResponse(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+// parseCoordinate reads the required decimal query parameter name
+func parseCoordinate(r *http.Request, name string) (float64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, fmt.Errorf("missing required parameter '%s'", name)
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: must be a decimal number", name, truncateForLog(value))
+	}
+	return parsed, nil
+}
+
+// GetWeatherRaw handles GET /weather/raw?city=<city_name> requests, returning
+// the upstream payload before it is mapped to our response format
+func (h *Handler) GetWeatherRaw(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	city := r.URL.Query().Get("city")
+	if city == "" {
+		h.writeErrorResponse(w, r, fmt.Errorf("missing required parameter 'city'"), http.StatusBadRequest)
 		return
 	}
 
-	// Get symbol parameter from query string
-	symbol := r.URL.Query().Get("symbol")
+	logging.Debugf("Raw weather request for city: %s", truncateForLog(city))
+	tracing.SpanFromContext(r.Context()).SetTag(tracing.TagWeatherCity, city)
+
+	raw, err := h.weatherService.GetRawWeatherCtx(r.Context(), city)
+	if err != nil {
+		if apiErr, ok := err.(*models.APIError); ok {
+			h.writeErrorResponse(w, r, err, apiErr.Code)
+		} else {
+			h.writeErrorResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.writeSuccessResponse(w, r, raw, newResponseMeta(start, "Open-Meteo"))
+	logging.Infof("Raw weather request completed successfully for city: %s", truncateForLog(city))
+}
+
+// GetStockSearch handles GET /stock/search requests, looking up ticker
+// symbols by company name. No matches is a 200 with an empty list.
+func (h *Handler) GetStockSearch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		h.writeErrorResponse(w, r, fmt.Errorf("missing required parameter 'q'"), http.StatusBadRequest)
+		return
+	}
+
+	logging.Debugf("Stock search request for query: %s", truncateForLog(query))
+
+	matches, err := h.stockService.SearchSymbolCtx(r.Context(), query)
+	if err != nil {
+		if apiErr, ok := err.(*models.APIError); ok {
+			h.writeErrorResponse(w, r, err, apiErr.Code)
+		} else {
+			h.writeErrorResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	searchData := map[string]interface{}{
+		"query":   query,
+		"count":   len(matches),
+		"matches": matches,
+	}
+
+	h.writeSuccessResponse(w, r, searchData, newResponseMeta(start, "Yahoo Finance"))
+	logging.Infof("Stock search request completed with %d matches for query: %s", len(matches), truncateForLog(query))
+}
+
+// GetStockDemoSymbols handles GET /stock/demo/symbols requests, listing the
+// symbols answered from demo data with their company names
+func (h *Handler) GetStockDemoSymbols(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	symbols := stock.ListDemoSymbols()
+	symbolsData := map[string]interface{}{
+		"count":   len(symbols),
+		"symbols": symbols,
+	}
+
+	h.writeSuccessResponse(w, r, symbolsData, newResponseMeta(start, stock.DemoSource))
+}
+
+// GetDatadogStock handles GET /stock/datadog requests. It is GET /stock with
+// symbol=DDOG, so every query parameter of the generic endpoint, such as
+// fresh, applies here too.
+func (h *Handler) GetDatadogStock(w http.ResponseWriter, r *http.Request) {
+	logging.Debugf("Datadog stock price request")
+
+	query := r.URL.Query()
+	query.Set("symbol", "DDOG")
+	generic := r.Clone(r.Context())
+	generic.URL.RawQuery = query.Encode()
+
+	h.GetStock(w, generic)
+}
+
+// GetStock handles GET /stock?symbol=<symbol>&fresh=<bool> and POST /stock
+// {"symbol": "<symbol>"} requests (generic stock endpoint). fresh=true
+// bypasses the quote cache.
+func (h *Handler) GetStock(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	var symbol string
+	fresh := false
+
+	switch r.Method {
+	case http.MethodGet:
+		// Get symbol parameter from query string
+		symbol = r.URL.Query().Get("symbol")
+		if value := r.URL.Query().Get("fresh"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				h.writeErrorResponse(w, r, fmt.Errorf("invalid fresh %q: must be a boolean", value), http.StatusBadRequest)
+				return
+			}
+			fresh = parsed
+		}
+	case http.MethodPost:
+		var req StockRequest
+		if statusCode, err := decodeJSONBody(w, r, &req); err != nil {
+			h.writeErrorResponse(w, r, err, statusCode)
+			return
+		}
+		symbol = req.Symbol
+		fresh = req.Fresh
+	}
+
+	symbol = normalizeSymbol(symbol)
 	if symbol == "" {
-		h.writeErrorResponse(w, fmt.Errorf("missing required parameter 'symbol'"), http.StatusBadRequest)
+		h.writeErrorResponse(w, r, fmt.Errorf("missing required parameter 'symbol'"), http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Stock request for symbol: %s", symbol)
+	logging.Debugf("Stock request for symbol: %s", truncateForLog(symbol))
+	tracing.SpanFromContext(r.Context()).SetTag(tracing.TagStockSymbol, symbol)
 
 	// Get stock data
-	stockData, err := h.stockService.GetCurrentPrice(symbol)
+	getPrice := h.stockService.GetCurrentPriceCtx
+	if fresh {
+		getPrice = h.stockService.GetFreshPriceCtx
+	}
+	stockData, err := getPrice(r.Context(), symbol)
+	if err != nil {
+		// Check if it's an API error to determine status code
+		if apiErr, ok := err.(*models.APIError); ok {
+			h.writeErrorResponse(w, r, err, apiErr.Code)
+		} else {
+			h.writeErrorResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.writeSuccessResponse(w, r, stockData, newResponseMeta(start, stockData.Metadata.Source).withCacheAge(stockData.Metadata.CachedAt))
+	logging.Infof("Stock request completed successfully for symbol: %s", truncateForLog(symbol))
+}
+
+// Paging bounds for /weather/batch
+const (
+	defaultWeatherBatchLimit = 10
+	maxWeatherBatchLimit     = 50
+	maxWeatherBatchCities    = 500
+)
+
+// Fetch bounds for /weather/batch; larger values are clamped so a single
+// request cannot flood the upstreams or hold a worker for too long
+const (
+	maxWeatherBatchWorkers = 10
+	maxWeatherBatchTimeout = 30 * time.Second
+)
+
+// GetWeatherBatch handles GET /weather/batch?cities=<a,b,...>&limit=<n>&offset=<n>
+// and POST /weather/batch {"cities": [...]} requests. Only the requested page
+// is fetched; results keep the input order so paging is consistent. With
+// Accept: application/x-ndjson the page is streamed one result per line
+// instead, in the order the cities finish. The optional workers and timeout
+// query parameters set how many cities are fetched at once and how long
+// each city may take.
+func (h *Handler) GetWeatherBatch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	var cities []string
+
+	switch r.Method {
+	case http.MethodGet:
+		cities = splitList(r.URL.Query().Get("cities"))
+	case http.MethodPost:
+		var req WeatherBatchRequest
+		if statusCode, err := decodeJSONBody(w, r, &req); err != nil {
+			h.writeErrorResponse(w, r, err, statusCode)
+			return
+		}
+		cities = req.Cities
+	}
+
+	if len(cities) == 0 {
+		h.writeErrorResponse(w, r, fmt.Errorf("missing required parameter 'cities'"), http.StatusBadRequest)
+		return
+	}
+	if len(cities) > maxWeatherBatchCities {
+		h.writeErrorResponse(w, r, fmt.Errorf("at most %d cities are allowed per request", maxWeatherBatchCities), http.StatusBadRequest)
+		return
+	}
+
+	limit, err := queryInt(r, "limit", defaultWeatherBatchLimit)
+	if err != nil || limit < 1 {
+		h.writeErrorResponse(w, r, fmt.Errorf("invalid limit: must be a positive integer"), http.StatusBadRequest)
+		return
+	}
+	if limit > maxWeatherBatchLimit {
+		limit = maxWeatherBatchLimit
+	}
+
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil || offset < 0 {
+		h.writeErrorResponse(w, r, fmt.Errorf("invalid offset: must be a non-negative integer"), http.StatusBadRequest)
+		return
+	}
+
+	opts, err := weatherBatchOptions(r)
+	if err != nil {
+		h.writeErrorResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	logging.Debugf("Weather batch request for %d cities (limit %d, offset %d, workers %d, timeout %v)",
+		len(cities), limit, offset, opts.Workers, opts.Timeout)
+
+	page := []string{}
+	if offset < len(cities) {
+		end := offset + limit
+		if end > len(cities) {
+			end = len(cities)
+		}
+		page = cities[offset:end]
+	}
+
+	if negotiateFormat(r) == formatNDJSON {
+		h.streamWeatherBatch(w, r, page, opts)
+		return
+	}
+
+	batchData := map[string]interface{}{
+		"total":   len(cities),
+		"limit":   limit,
+		"offset":  offset,
+		"results": h.weatherService.GetBatchWeatherCtx(r.Context(), page, opts),
+	}
+
+	h.writeSuccessResponse(w, r, batchData, newResponseMeta(start, ""))
+	logging.Infof("Weather batch request completed successfully for %d cities", len(page))
+}
+
+// streamWeatherBatch writes one batch result per line as each city is
+// fetched, in completion order
+func (h *Handler) streamWeatherBatch(w http.ResponseWriter, r *http.Request, cities []string, opts weather.BatchOptions) {
+	stream := newNDJSONStream(w)
+
+	var writeErr error
+	h.weatherService.StreamBatchWeatherCtx(r.Context(), cities, opts, func(result weather.BatchResult) {
+		if writeErr == nil {
+			writeErr = stream.Write(result)
+		}
+	})
+
+	if writeErr != nil {
+		logging.Errorf("Weather batch stream write failed: %v", writeErr)
+		return
+	}
+	logging.Infof("Weather batch stream completed successfully for %d cities", len(cities))
+}
+
+// weatherBatchOptions reads the workers and timeout query parameters of
+// /weather/batch, clamping them to maxWeatherBatchWorkers and
+// maxWeatherBatchTimeout. The timeout is a Go duration such as "2s".
+func weatherBatchOptions(r *http.Request) (weather.BatchOptions, error) {
+	workers, err := queryInt(r, "workers", weather.BatchWorkers)
+	if err != nil || workers < 1 {
+		return weather.BatchOptions{}, fmt.Errorf("invalid workers: must be a positive integer")
+	}
+
+	var timeout time.Duration
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		timeout, err = time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return weather.BatchOptions{}, fmt.Errorf("invalid timeout: must be a positive duration such as 2s")
+		}
+	}
+
+	return weather.BatchOptions{
+		Workers: min(workers, maxWeatherBatchWorkers),
+		Timeout: min(timeout, maxWeatherBatchTimeout),
+	}, nil
+}
+
+// queryInt parses an integer query parameter, returning defaultValue when it is absent
+func queryInt(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// defaultMoversLimit is how many gainers and losers /stock/movers returns by default
+const defaultMoversLimit = 3
+
+// GetStockMovers handles GET /stock/movers?symbols=<a,b,...>&limit=<n> requests.
+// Without symbols, the demo symbol set is used.
+func (h *Handler) GetStockMovers(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	limit := defaultMoversLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			h.writeErrorResponse(w, r, fmt.Errorf("invalid limit %q: must be a positive integer", value), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	symbols := stock.DemoSymbols()
+	if value := r.URL.Query().Get("symbols"); value != "" {
+		symbols = splitList(value)
+	}
+	if len(symbols) > maxBatchSymbols {
+		h.writeErrorResponse(w, r, fmt.Errorf("at most %d symbols are allowed per request", maxBatchSymbols), http.StatusBadRequest)
+		return
+	}
+
+	logging.Debugf("Stock movers request for symbols: %s", truncateForLog(strings.Join(symbols, ",")))
+
+	gainers, losers, err := h.stockService.GetMoversCtx(r.Context(), symbols, limit)
 	if err != nil {
 		// Check if it's an API error to determine status code
 		if apiErr, ok := err.(*models.APIError); ok {
-			h.writeErrorResponse(w, err, apiErr.Code)
+			h.writeErrorResponse(w, r, err, apiErr.Code)
+		} else {
+			h.writeErrorResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	moversData := map[string]interface{}{
+		"gainers": gainers,
+		"losers":  losers,
+	}
+
+	h.writeSuccessResponse(w, r, moversData, newResponseMeta(start, ""))
+	logging.Infof("Stock movers request completed successfully")
+}
+
+// maxBatchSymbols caps how many symbols a single batch request may ask for
+const maxBatchSymbols = 20
+
+// csvHeader is the header row written by GetStockBatchCSV
+var csvHeader = []string{"symbol", "company", "price", "change", "change_percent", "market_state", "currency"}
+
+// GetStockBatchCSV handles GET /stock/batch.csv?symbols=<a,b,...> requests.
+// Rows are streamed as each quote is fetched; a symbol that cannot be
+// fetched gets a row with only the symbol filled in.
+func (h *Handler) GetStockBatchCSV(w http.ResponseWriter, r *http.Request) {
+	symbols := splitList(r.URL.Query().Get("symbols"))
+	if len(symbols) == 0 {
+		h.writeErrorResponse(w, r, fmt.Errorf("missing required parameter 'symbols'"), http.StatusBadRequest)
+		return
+	}
+	if len(symbols) > maxBatchSymbols {
+		h.writeErrorResponse(w, r, fmt.Errorf("at most %d symbols are allowed per request", maxBatchSymbols), http.StatusBadRequest)
+		return
+	}
+	for i, symbol := range symbols {
+		normalized, err := h.stockService.ValidateAndNormalizeSymbol(symbol)
+		if err != nil {
+			h.writeErrorResponse(w, r, err, http.StatusBadRequest)
+			return
+		}
+		symbols[i] = normalizeSymbol(normalized)
+	}
+
+	logging.Debugf("Stock batch CSV request for symbols: %s", truncateForLog(strings.Join(symbols, ",")))
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="stocks.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	writer := csv.NewWriter(w)
+	writer.Write(csvHeader)
+
+	h.stockService.FetchPrices(r.Context(), symbols, func(symbol string, stockData *models.StockResponse, err error) {
+		if err != nil {
+			logging.Warnf("Stock batch CSV: skipping %s: %v", symbol, err)
+			writer.Write([]string{symbol, "", "", "", "", "", ""})
 		} else {
-			h.writeErrorResponse(w, err, http.StatusInternalServerError)
+			writer.Write([]string{
+				stockData.Symbol,
+				stockData.CompanyName,
+				strconv.FormatFloat(stockData.Price, 'f', 2, 64),
+				strconv.FormatFloat(stockData.Change, 'f', 2, 64),
+				strconv.FormatFloat(stockData.ChangePercent, 'f', 2, 64),
+				string(stockData.MarketState),
+				stockData.Currency,
+			})
+		}
+
+		writer.Flush()
+		if flusher != nil {
+			flusher.Flush()
 		}
+	})
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		logging.Errorf("Stock batch CSV write failed: %v", err)
 		return
 	}
+	logging.Infof("Stock batch CSV request completed successfully for %d symbols", len(symbols))
+}
 
-	h.writeSuccessResponse(w, stockData)
-	log.Printf("Stock request completed successfully for symbol: %s", symbol)
+// splitSymbols splits a comma-separated symbol list into trimmed, non-empty entries
+func splitList(value string) []string {
+	var symbols []string
+	for _, symbol := range strings.Split(value, ",") {
+		if symbol = strings.TrimSpace(symbol); symbol != "" {
+			symbols = append(symbols, symbol)
+		}
+	}
+	return symbols
 }
 
-// HealthCheck handles GET /health requests
+// HealthCheck handles GET /health requests. With ?deep=true it also pings
+// each upstream and reports it as "ok" or "degraded"; when an admin port is
+// configured, deep checks are only answered there.
 func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET requests
-	if r.Method != http.MethodGet {
-		h.writeErrorResponse(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+	h.healthCheck(w, r, h.config.AdminPort <= 0)
+}
+
+// AdminHealthCheck handles GET /health on the admin port, where deep checks
+// are always allowed
+func (h *Handler) AdminHealthCheck(w http.ResponseWriter, r *http.Request) {
+	h.healthCheck(w, r, true)
+}
+
+func (h *Handler) healthCheck(w http.ResponseWriter, r *http.Request, allowDeep bool) {
+	deep := false
+	if value := r.URL.Query().Get("deep"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			h.writeErrorResponse(w, r, fmt.Errorf("invalid deep %q: must be a boolean", value), http.StatusBadRequest)
+			return
+		}
+		deep = parsed
+	}
+	if deep && !allowDeep {
+		h.writeErrorResponse(w, r, fmt.Errorf("deep health checks are served on the admin port"), http.StatusForbidden)
 		return
 	}
 
 	healthData := map[string]interface{}{
 		"status":    "healthy",
 		"service":   "weather-stock-api",
-		"version":   "1.0.0",
+		"version":   h.config.BuildInfo.Version,
+		"build":     h.config.BuildInfo,
 		"timestamp": time.Now(),
 		"uptime":    time.Since(startTime),
 	}
+	if h.config.Maintenance {
+		healthData["maintenance"] = true
+	}
 
-	h.writeSuccessResponse(w, healthData)
+	if deep && h.config.Maintenance {
+		// The upstreams are not called in maintenance mode, so there is
+		// nothing to probe
+		healthData[healthKeyOpenMeteo] = upstreamMaintenance
+		healthData[healthKeyYahoo] = upstreamMaintenance
+	} else if deep {
+		for name, status := range h.probeUpstreams(r.Context()) {
+			if status != upstreamOK {
+				healthData["status"] = upstreamDegraded
+			}
+			healthData[name] = status
+		}
+	}
+
+	h.writeSuccessResponse(w, r, healthData)
 }
 
-// GetWeatherSummary handles GET /weather/summary?city=<city_name> requests
-func (h *Handler) GetWeatherSummary(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET requests
-	if r.Method != http.MethodGet {
-		h.writeErrorResponse(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+// CacheHealthCheck handles GET /health/cache requests, reporting the size,
+// hit and miss counts, and hit ratio of each cache
+func (h *Handler) CacheHealthCheck(w http.ResponseWriter, r *http.Request) {
+	caches := h.weatherService.CacheStats()
+	for name, stats := range h.stockService.CacheStats() {
+		caches[name] = stats
+	}
+
+	h.writeSuccessResponse(w, r, map[string]interface{}{
+		"caches":    caches,
+		"timestamp": time.Now(),
+	})
+}
+
+// Upstream states reported by the deep health check
+const (
+	upstreamOK       = "ok"
+	upstreamDegraded = "degraded"
+	// upstreamMaintenance is reported instead of probing in maintenance mode
+	upstreamMaintenance = "maintenance"
+)
+
+// Keys of the upstream states in the deep health check, which are reported
+// next to the overall status, e.g. {"open_meteo": "ok", "yahoo": "degraded"}
+const (
+	healthKeyOpenMeteo = "open_meteo"
+	healthKeyYahoo     = "yahoo"
+)
+
+// deepHealthTimeout bounds the upstream probes of GET /health?deep=true
+const deepHealthTimeout = 2 * time.Second
+
+// probeUpstreams pings each upstream concurrently and reports its state
+func (h *Handler) probeUpstreams(ctx context.Context) map[string]string {
+	ctx, cancel := context.WithTimeout(ctx, deepHealthTimeout)
+	defer cancel()
+
+	probes := map[string]func(context.Context) error{
+		healthKeyOpenMeteo: h.weatherService.Ping,
+		healthKeyYahoo:     h.stockService.Ping,
+	}
+
+	var (
+		mutex  sync.Mutex
+		wg     sync.WaitGroup
+		states = make(map[string]string, len(probes))
+	)
+	for name, probe := range probes {
+		wg.Add(1)
+		go func(name string, probe func(context.Context) error) {
+			defer wg.Done()
+
+			state := upstreamOK
+			if err := probe(ctx); err != nil {
+				logging.Warnf("Health probe for %s failed: %v", name, err)
+				state = upstreamDegraded
+			}
+
+			mutex.Lock()
+			states[name] = state
+			mutex.Unlock()
+		}(name, probe)
+	}
+	wg.Wait()
+
+	return states
+}
+
+// ReadinessCheck handles GET /health/ready requests
+func (h *Handler) ReadinessCheck(w http.ResponseWriter, r *http.Request) {
+	// Maintenance mode serves without the upstreams, so their health does
+	// not affect readiness
+	if !h.config.Maintenance && !h.config.HealthTracker.IsReady(h.config.ReadinessMaxAge) {
+		h.writeErrorResponse(w, r, fmt.Errorf("no successful upstream call within %v", h.config.ReadinessMaxAge), http.StatusServiceUnavailable)
 		return
 	}
 
+	readyData := map[string]interface{}{
+		"status":    "ready",
+		"upstreams": h.config.HealthTracker.Snapshot(),
+		"timestamp": time.Now(),
+	}
+	if h.config.Maintenance {
+		readyData["maintenance"] = true
+	}
+
+	h.writeSuccessResponse(w, r, readyData)
+}
+
+// GetWeatherSummary handles GET /weather/summary?city=<city_name> requests
+func (h *Handler) GetWeatherSummary(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
 	// Get city parameter from query string
 	city := r.URL.Query().Get("city")
 	if city == "" {
-		h.writeErrorResponse(w, fmt.Errorf("missing required parameter 'city'"), http.StatusBadRequest)
+		h.writeErrorResponse(w, r, fmt.Errorf("missing required parameter 'city'"), http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Weather summary request for city: %s", city)
+	logging.Debugf("Weather summary request for city: %s", truncateForLog(city))
+	tracing.SpanFromContext(r.Context()).SetTag(tracing.TagWeatherCity, city)
 
 	// Get weather summary
-	summary, err := h.weatherService.GetWeatherSummary(city)
+	summary, err := h.weatherService.GetWeatherSummaryCtx(r.Context(), city)
 	if err != nil {
 		// Check if it's an API error to determine status code
 		if apiErr, ok := err.(*models.APIError); ok {
-			h.writeErrorResponse(w, err, apiErr.Code)
+			h.writeErrorResponse(w, r, err, apiErr.Code)
 		} else {
-			h.writeErrorResponse(w, err, http.StatusInternalServerError)
+			h.writeErrorResponse(w, r, err, http.StatusInternalServerError)
 		}
 		return
 	}
@@ -216,35 +931,230 @@ func (h *Handler) GetWeatherSummary(w http.ResponseWriter, r *http.Request) {
 		"summary": summary,
 	}
 
-	h.writeSuccessResponse(w, summaryData)
-	log.Printf("Weather summary request completed successfully for city: %s", city)
+	h.writeSuccessResponse(w, r, summaryData, newResponseMeta(start, ""))
+	logging.Infof("Weather summary request completed successfully for city: %s", truncateForLog(city))
 }
 
-// GetStockSummary handles GET /stock/summary?symbol=<symbol> requests
-func (h *Handler) GetStockSummary(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET requests
-	if r.Method != http.MethodGet {
-		h.writeErrorResponse(w, fmt.Errorf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+// GetWeatherDetail handles GET /weather/detail requests, returning a
+// multi-line summary with every available metric
+func (h *Handler) GetWeatherDetail(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	city := r.URL.Query().Get("city")
+	if city == "" {
+		h.writeErrorResponse(w, r, fmt.Errorf("missing required parameter 'city'"), http.StatusBadRequest)
 		return
 	}
 
+	logging.Debugf("Weather detail request for city: %s", truncateForLog(city))
+	tracing.SpanFromContext(r.Context()).SetTag(tracing.TagWeatherCity, city)
+
+	detail, err := h.weatherService.GetDetailedSummaryCtx(r.Context(), city)
+	if err != nil {
+		if apiErr, ok := err.(*models.APIError); ok {
+			h.writeErrorResponse(w, r, err, apiErr.Code)
+		} else {
+			h.writeErrorResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	detailData := map[string]interface{}{
+		"city":    city,
+		"summary": detail,
+	}
+
+	h.writeSuccessResponse(w, r, detailData, newResponseMeta(start, ""))
+	logging.Infof("Weather detail request completed successfully for city: %s", truncateForLog(city))
+}
+
+// GetWeatherCities handles GET /weather/cities requests, listing the cities
+// that resolve without a geocoding request, sorted by name
+func (h *Handler) GetWeatherCities(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	cities := h.weatherService.ListCachedCities()
+	citiesData := map[string]interface{}{
+		"count":  len(cities),
+		"cities": cities,
+	}
+
+	h.writeSuccessResponse(w, r, citiesData, newResponseMeta(start, ""))
+}
+
+// GetDashboard handles GET /dashboard?city=<name>&symbol=<symbol> requests,
+// fetching the weather and the stock quote concurrently. Either parameter
+// may be left out; a section that fails carries its error while the other
+// is still returned.
+func (h *Handler) GetDashboard(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	city := strings.TrimSpace(r.URL.Query().Get("city"))
+	symbol := normalizeSymbol(r.URL.Query().Get("symbol"))
+	if city == "" && symbol == "" {
+		h.writeErrorResponse(w, r, fmt.Errorf("missing required parameter 'city' or 'symbol'"), http.StatusBadRequest)
+		return
+	}
+
+	logging.Debugf("Dashboard request for city %q and symbol %q", truncateForLog(city), truncateForLog(symbol))
+
+	var (
+		dashboard DashboardResponse
+		wg        sync.WaitGroup
+	)
+	if city != "" {
+		dashboard.Weather = &DashboardWeather{City: city}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			weatherData, err := h.weatherService.GetWeatherWithValidationCtx(r.Context(), city)
+			if err != nil {
+				dashboard.Weather.Error = err.Error()
+				return
+			}
+			dashboard.Weather.Weather = weatherData
+		}()
+	}
+	if symbol != "" {
+		dashboard.Stock = &DashboardStock{Symbol: symbol}
+		tracing.SpanFromContext(r.Context()).SetTag(tracing.TagStockSymbol, symbol)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stockData, err := h.stockService.GetCurrentPriceCtx(r.Context(), symbol)
+			if err != nil {
+				dashboard.Stock.Error = err.Error()
+				return
+			}
+			dashboard.Stock.Stock = stockData
+		}()
+	}
+	wg.Wait()
+
+	h.writeSuccessResponse(w, r, dashboard, newResponseMeta(start, ""))
+	logging.Infof("Dashboard request completed for city %q and symbol %q", truncateForLog(city), truncateForLog(symbol))
+}
+
+// GetNearestCity handles GET /weather/nearest?lat=<lat>&lon=<lon> requests,
+// naming the city of the static table closest to the point without any
+// upstream request
+func (h *Handler) GetNearestCity(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	lat, err := parseCoordinate(r, "lat")
+	if err != nil {
+		h.writeErrorResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+	lon, err := parseCoordinate(r, "lon")
+	if err != nil {
+		h.writeErrorResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if err := weather.ValidateCoordinates(lat, lon); err != nil {
+		h.writeErrorResponse(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	name, country, km := weather.NearestCachedCity(lat, lon)
+	nearestData := map[string]interface{}{
+		"city":        name,
+		"country":     country,
+		"distance_km": math.Round(km*10) / 10,
+	}
+
+	h.writeSuccessResponse(w, r, nearestData, newResponseMeta(start, ""))
+}
+
+// GetWeatherCodes handles GET /weather/codes requests, returning the static
+// reference of weather codes with their conditions, descriptions, and icons
+func (h *Handler) GetWeatherCodes(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	codes := models.WeatherCodeReference()
+	codesData := map[string]interface{}{
+		"count": len(codes),
+		"codes": codes,
+	}
+
+	h.writeSuccessResponse(w, r, codesData, newResponseMeta(start, ""))
+}
+
+// maxWeatherSummaryBatchCities bounds /weather/summary/batch, which is not paged
+const maxWeatherSummaryBatchCities = 50
+
+// GetWeatherSummaryBatch handles GET /weather/summary/batch?cities=<a,b,...>
+// requests, returning a map of city to summary. A city that cannot be
+// summarized maps to an error string instead of failing the request. With
+// Accept: application/x-ndjson each city is streamed as one line instead, in
+// the order the cities finish.
+func (h *Handler) GetWeatherSummaryBatch(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	cities := splitList(r.URL.Query().Get("cities"))
+	if len(cities) == 0 {
+		h.writeErrorResponse(w, r, fmt.Errorf("missing required parameter 'cities'"), http.StatusBadRequest)
+		return
+	}
+	if len(cities) > maxWeatherSummaryBatchCities {
+		h.writeErrorResponse(w, r, fmt.Errorf("at most %d cities are allowed per request", maxWeatherSummaryBatchCities), http.StatusBadRequest)
+		return
+	}
+
+	logging.Debugf("Weather summary batch request for %d cities", len(cities))
+
+	if negotiateFormat(r) == formatNDJSON {
+		h.streamWeatherSummaryBatch(w, r, cities)
+		return
+	}
+
+	summaries := h.weatherService.GetBatchSummariesCtx(r.Context(), cities)
+
+	h.writeSuccessResponse(w, r, summaries, newResponseMeta(start, ""))
+	logging.Infof("Weather summary batch request completed successfully for %d cities", len(cities))
+}
+
+// streamWeatherSummaryBatch writes one summary result per line as each city
+// is summarized, in completion order
+func (h *Handler) streamWeatherSummaryBatch(w http.ResponseWriter, r *http.Request, cities []string) {
+	stream := newNDJSONStream(w)
+
+	var writeErr error
+	h.weatherService.StreamBatchSummariesCtx(r.Context(), cities, func(result weather.SummaryResult) {
+		if writeErr == nil {
+			writeErr = stream.Write(result)
+		}
+	})
+
+	if writeErr != nil {
+		logging.Errorf("Weather summary batch stream write failed: %v", writeErr)
+		return
+	}
+	logging.Infof("Weather summary batch stream completed successfully for %d cities", len(cities))
+}
+
+// GetStockSummary handles GET /stock/summary?symbol=<symbol> requests
+func (h *Handler) GetStockSummary(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
 	// Get symbol parameter from query string
-	symbol := r.URL.Query().Get("symbol")
+	symbol := normalizeSymbol(r.URL.Query().Get("symbol"))
 	if symbol == "" {
-		h.writeErrorResponse(w, fmt.Errorf("missing required parameter 'symbol'"), http.StatusBadRequest)
+		h.writeErrorResponse(w, r, fmt.Errorf("missing required parameter 'symbol'"), http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Stock summary request for symbol: %s", symbol)
+	logging.Debugf("Stock summary request for symbol: %s", truncateForLog(symbol))
+	tracing.SpanFromContext(r.Context()).SetTag(tracing.TagStockSymbol, symbol)
 
 	// Get stock summary
-	summary, err := h.stockService.GetStockSummary(symbol)
+	summary, err := h.stockService.GetStockSummaryCtx(r.Context(), symbol)
 	if err != nil {
 		// Check if it's an API error to determine status code
 		if apiErr, ok := err.(*models.APIError); ok {
-			h.writeErrorResponse(w, err, apiErr.Code)
+			h.writeErrorResponse(w, r, err, apiErr.Code)
 		} else {
-			h.writeErrorResponse(w, err, http.StatusInternalServerError)
+			h.writeErrorResponse(w, r, err, http.StatusInternalServerError)
 		}
 		return
 	}
@@ -254,8 +1164,44 @@ func (h *Handler) GetStockSummary(w http.ResponseWriter, r *http.Request) {
 		"summary": summary,
 	}
 
-	h.writeSuccessResponse(w, summaryData)
-	log.Printf("Stock summary request completed successfully for symbol: %s", symbol)
+	h.writeSuccessResponse(w, r, summaryData, newResponseMeta(start, ""))
+	logging.Infof("Stock summary request completed successfully for symbol: %s", truncateForLog(symbol))
+}
+
+// GetStockMarketState handles GET /stock/market-state?symbol=<symbol>
+// requests, reporting only whether the symbol's market is open for widgets
+// that show an open/closed indicator
+func (h *Handler) GetStockMarketState(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	symbol := normalizeSymbol(r.URL.Query().Get("symbol"))
+	if symbol == "" {
+		h.writeErrorResponse(w, r, fmt.Errorf("missing required parameter 'symbol'"), http.StatusBadRequest)
+		return
+	}
+
+	logging.Debugf("Market state request for symbol: %s", truncateForLog(symbol))
+	tracing.SpanFromContext(r.Context()).SetTag(tracing.TagStockSymbol, symbol)
+
+	stockData, err := h.stockService.GetCurrentPriceCtx(r.Context(), symbol)
+	if err != nil {
+		if apiErr, ok := err.(*models.APIError); ok {
+			h.writeErrorResponse(w, r, err, apiErr.Code)
+		} else {
+			h.writeErrorResponse(w, r, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	stateData := map[string]interface{}{
+		"symbol":       stockData.Symbol,
+		"market_state": stockData.MarketState,
+		"is_open":      stockData.MarketState.IsOpen(),
+		"display":      stockData.MarketState.DisplayText(),
+	}
+
+	h.writeSuccessResponse(w, r, stateData, newResponseMeta(start, stockData.Metadata.Source).withCacheAge(stockData.Metadata.CachedAt))
+	logging.Infof("Market state request completed successfully for symbol: %s", truncateForLog(symbol))
 }
 
 // Global variable to track server start time for uptime calculation
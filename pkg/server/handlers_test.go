@@ -0,0 +1,1604 @@
+package server
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/internal/testutils"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/cache"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/health"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/stock"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/weather"
+)
+
+const (
+	stuttgartWeatherURL = "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+	ddogQuoteURL        = "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+)
+
+// newTestHandler creates a handler backed by services using the given mock client
+func newTestHandler(mockClient *testutils.MockHTTPClient) *Handler {
+	return NewHandler(DefaultConfig(), weather.NewService(mockClient), stock.NewService(mockClient))
+}
+
+func TestHandler_PostWeather(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{
+			name:        "valid JSON body",
+			contentType: "application/json",
+			body:        `{"city": "Stuttgart"}`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "JSON body with charset",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"city": "Stuttgart"}`,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "text/plain",
+			body:        `{"city": "Stuttgart"}`,
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "missing city",
+			contentType: "application/json",
+			body:        `{}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "malformed JSON",
+			contentType: "application/json",
+			body:        `{"city": `,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "oversized body",
+			contentType: "application/json",
+			body:        `{"city": "` + strings.Repeat("a", maxRequestBodyBytes) + `"}`,
+			wantStatus:  http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse(stuttgartWeatherURL, 200, testutils.OpenMeteoWeatherResponse)
+			handler := newTestHandler(mockClient)
+
+			req := httptest.NewRequest(http.MethodPost, "/weather", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+
+			handler.GetWeather(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandler_PostStock(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(ddogQuoteURL, 200, testutils.YahooFinanceStockResponse)
+	handler := newTestHandler(mockClient)
+
+	req := httptest.NewRequest(http.MethodPost, "/stock", strings.NewReader(`{"symbol": "DDOG"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	handler.GetStock(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Success bool `json:"success"`
+		Data    struct {
+			Symbol string `json:"symbol"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if !resp.Success || resp.Data.Symbol != "DDOG" {
+		t.Errorf("Expected successful DDOG response, got %+v", resp)
+	}
+}
+
+func TestHandler_StockRejectsOtherMethods(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	router := NewRouter(DefaultConfig(), weather.NewService(mockClient), stock.NewService(mockClient))
+
+	req := httptest.NewRequest(http.MethodDelete, "/stock?symbol=DDOG", nil)
+	rec := httptest.NewRecorder()
+
+	router.GetHandler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Allow"); got != "GET, POST" {
+		t.Errorf("Expected Allow header \"GET, POST\", got %q", got)
+	}
+}
+
+func TestHandler_HealthCheckReportsBuildInfo(t *testing.T) {
+	config := DefaultConfig()
+	config.BuildInfo = BuildInfo{Version: "2.3.4", BuildTime: "2024-01-15", GitCommit: "abc123"}
+	handler := NewHandler(config, weather.NewService(nil), stock.NewService(nil))
+
+	rec := httptest.NewRecorder()
+	handler.HealthCheck(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var resp struct {
+		Data struct {
+			Version string    `json:"version"`
+			Build   BuildInfo `json:"build"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Data.Version != "2.3.4" {
+		t.Errorf("Expected version 2.3.4, got %q", resp.Data.Version)
+	}
+	if resp.Data.Build != config.BuildInfo {
+		t.Errorf("Expected build info %+v, got %+v", config.BuildInfo, resp.Data.Build)
+	}
+}
+
+func TestHandler_ReadinessCheck(t *testing.T) {
+	config := DefaultConfig()
+	config.HealthTracker = health.NewTracker()
+	handler := NewHandler(config, weather.NewService(nil), stock.NewService(nil))
+
+	rec := httptest.NewRecorder()
+	handler.ReadinessCheck(rec, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 before any upstream success, got %d", rec.Code)
+	}
+
+	config.HealthTracker.RecordSuccess("weather")
+	rec = httptest.NewRecorder()
+	handler.ReadinessCheck(rec, httptest.NewRequest(http.MethodGet, "/health/ready", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 after an upstream success, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "last_failure") {
+		t.Errorf("Expected no last_failure for an upstream that never failed, got %s", rec.Body.String())
+	}
+}
+
+func TestHandler_GetStock_ResponseMeta(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantSource string
+	}{
+		{
+			name:       "live data",
+			status:     200,
+			body:       testutils.YahooFinanceStockResponse,
+			wantSource: "Yahoo Finance",
+		},
+		{
+			name:       "demo fallback",
+			status:     503,
+			body:       testutils.APIErrorResponse,
+			wantSource: "Demo Mode (Simulated Data)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse(ddogQuoteURL, tt.status, tt.body)
+			handler := newTestHandler(mockClient)
+
+			rec := httptest.NewRecorder()
+			handler.GetStock(rec, httptest.NewRequest(http.MethodGet, "/stock?symbol=DDOG", nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+
+			var resp SuccessResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if resp.Meta == nil {
+				t.Fatalf("Expected meta in response")
+			}
+			if resp.Meta.UpstreamSource != tt.wantSource {
+				t.Errorf("Expected upstream source %q, got %q", tt.wantSource, resp.Meta.UpstreamSource)
+			}
+			if resp.Meta.DurationMs < 0 {
+				t.Errorf("Expected non-negative duration, got %d", resp.Meta.DurationMs)
+			}
+		})
+	}
+}
+
+func TestHandler_GetWeather_Cache(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(stuttgartWeatherURL, 200, testutils.OpenMeteoWeatherResponse)
+	weatherSvc := weather.NewService(mockClient, weather.WithCache(cache.NewMemoryCache(0), time.Minute))
+	handler := NewHandler(DefaultConfig(), weatherSvc, stock.NewService(mockClient))
+
+	for i, wantCached := range []bool{false, true} {
+		rec := httptest.NewRecorder()
+		handler.GetWeather(rec, httptest.NewRequest(http.MethodGet, "/weather?city=Stuttgart", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status 200, got %d", i+1, rec.Code)
+		}
+
+		var resp SuccessResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if resp.Meta.Cached != wantCached || (resp.Meta.CacheAge != nil) != wantCached {
+			t.Errorf("Request %d: expected cached %v, got %+v", i+1, wantCached, resp.Meta)
+		}
+	}
+
+	if count := mockClient.GetCallCount(stuttgartWeatherURL); count != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", count)
+	}
+}
+
+func TestHandler_GetStock_Cache(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(ddogQuoteURL, 200, testutils.YahooFinanceStockResponse)
+	stockSvc := stock.NewService(mockClient,
+		stock.WithRateLimit(0),
+		stock.WithCache(cache.NewMemoryCache(0), time.Minute),
+	)
+	handler := NewHandler(DefaultConfig(), weather.NewService(mockClient), stockSvc)
+
+	get := func(target string) (*httptest.ResponseRecorder, SuccessResponse) {
+		rec := httptest.NewRecorder()
+		handler.GetStock(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		var resp SuccessResponse
+		if rec.Code == http.StatusOK {
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+		}
+		return rec, resp
+	}
+
+	if rec, resp := get("/stock?symbol=DDOG"); rec.Code != http.StatusOK || resp.Meta.Cached || resp.Meta.CacheAge != nil {
+		t.Fatalf("Expected a live response without cache_age, got %d %+v", rec.Code, resp.Meta)
+	}
+
+	rec, resp := get("/stock?symbol=DDOG")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if !resp.Meta.Cached || resp.Meta.CacheAge == nil || *resp.Meta.CacheAge < 0 {
+		t.Errorf("Expected a cached response with cache_age, got %+v", resp.Meta)
+	}
+
+	rec, resp = get("/stock?symbol=DDOG&fresh=true")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if resp.Meta.Cached || resp.Meta.CacheAge != nil {
+		t.Errorf("Expected fresh=true to bypass the cache, got cache_age %v", *resp.Meta.CacheAge)
+	}
+	if count := mockClient.GetCallCount(ddogQuoteURL); count != 2 {
+		t.Errorf("Expected 2 upstream calls, got %d", count)
+	}
+
+	if rec, _ := get("/stock?symbol=DDOG&fresh=maybe"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid fresh value, got %d", rec.Code)
+	}
+}
+
+func TestHandler_GetDatadogStock_QueryParameters(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(ddogQuoteURL, 200, testutils.YahooFinanceStockResponse)
+	stockSvc := stock.NewService(mockClient,
+		stock.WithRateLimit(0),
+		stock.WithCache(cache.NewMemoryCache(0), time.Minute),
+	)
+	handler := NewHandler(DefaultConfig(), weather.NewService(mockClient), stockSvc)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.GetDatadogStock(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	for _, target := range []string{"/stock/datadog", "/stock/datadog?symbol=AAPL", "/stock/datadog?fresh=true"} {
+		rec := get(target)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", target, rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Data models.StockResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", target, err)
+		}
+		if resp.Data.Symbol != "DDOG" {
+			t.Errorf("%s: expected symbol DDOG, got %s", target, resp.Data.Symbol)
+		}
+	}
+
+	// The second request was cached; fresh=true went upstream again
+	if count := mockClient.GetCallCount(ddogQuoteURL); count != 2 {
+		t.Errorf("Expected fresh=true to bypass the cache for 2 upstream calls, got %d", count)
+	}
+	if rec := get("/stock/datadog?fresh=maybe"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid fresh value, got %d", rec.Code)
+	}
+}
+
+func TestHandler_GetDashboard(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(stuttgartWeatherURL, 200, testutils.OpenMeteoWeatherResponse)
+	handler := newTestHandler(mockClient)
+
+	t.Run("partial results", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.GetDashboard(rec, httptest.NewRequest(http.MethodGet, "/dashboard?city=Stuttgart&symbol=DD0G", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp struct {
+			Data DashboardResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+
+		if resp.Data.Weather == nil || resp.Data.Weather.Error != "" || resp.Data.Weather.Weather == nil {
+			t.Fatalf("Expected the weather section, got %+v", resp.Data.Weather)
+		}
+		if resp.Data.Weather.Weather.Temperature != 22.5 {
+			t.Errorf("Expected temperature 22.5, got %v", resp.Data.Weather.Weather.Temperature)
+		}
+		if resp.Data.Stock == nil || resp.Data.Stock.Error == "" || resp.Data.Stock.Stock != nil {
+			t.Errorf("Expected the stock section to carry an error, got %+v", resp.Data.Stock)
+		}
+	})
+
+	t.Run("a missing parameter omits its section", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.GetDashboard(rec, httptest.NewRequest(http.MethodGet, "/dashboard?city=Stuttgart", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if strings.Contains(rec.Body.String(), `"stock"`) {
+			t.Errorf("Expected no stock section, got %s", rec.Body.String())
+		}
+	})
+
+	t.Run("both parameters missing", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.GetDashboard(rec, httptest.NewRequest(http.MethodGet, "/dashboard", nil))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandler_PrettyResponses(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultPretty bool
+		target        string
+		wantPretty    bool
+	}{
+		{"compact by default", false, "/weather/codes", false},
+		{"pretty=true", false, "/weather/codes?pretty=true", true},
+		{"configured default", true, "/weather/codes", true},
+		{"pretty=false overrides the default", true, "/weather/codes?pretty=false", false},
+		{"invalid value keeps the default", false, "/weather/codes?pretty=very", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.PrettyJSON = tt.defaultPretty
+			handler := NewHandler(config, weather.NewService(testutils.NewMockHTTPClient()), stock.NewService(testutils.NewMockHTTPClient()))
+
+			rec := httptest.NewRecorder()
+			handler.GetWeatherCodes(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			body := strings.TrimSuffix(rec.Body.String(), "\n")
+			gotPretty := strings.Contains(body, "\n  \"success\": true")
+			if gotPretty != tt.wantPretty {
+				t.Errorf("Expected pretty %v, got body starting %q", tt.wantPretty, truncate(body, 40))
+			}
+			if !tt.wantPretty && strings.Contains(body, "\n") {
+				t.Errorf("Expected a single-line body, got %q", truncate(body, 40))
+			}
+			if !json.Valid(rec.Body.Bytes()) {
+				t.Error("Expected valid JSON")
+			}
+		})
+	}
+
+	t.Run("error responses", func(t *testing.T) {
+		handler := newTestHandler(testutils.NewMockHTTPClient())
+		rec := httptest.NewRecorder()
+		handler.GetDashboard(rec, httptest.NewRequest(http.MethodGet, "/dashboard?pretty=1", nil))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status 400, got %d", rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), "\n  \"error\": ") {
+			t.Errorf("Expected an indented error body, got %q", rec.Body.String())
+		}
+	})
+}
+
+func TestHandler_CacheHealthCheck(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(ddogQuoteURL, 200, testutils.YahooFinanceStockResponse)
+	stockSvc := stock.NewService(mockClient,
+		stock.WithRateLimit(0),
+		stock.WithCache(cache.NewMemoryCache(0), time.Minute),
+	)
+	handler := NewHandler(DefaultConfig(), weather.NewService(mockClient), stockSvc)
+
+	// A miss that stores the quote, then a hit
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.GetStock(rec, httptest.NewRequest(http.MethodGet, "/stock?symbol=DDOG", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.CacheHealthCheck(rec, httptest.NewRequest(http.MethodGet, "/health/cache", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Caches map[string]cache.Stats `json:"caches"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	want := cache.Stats{Size: 1, Hits: 1, Misses: 1, HitRatio: 0.5}
+	if got := resp.Data.Caches[stock.CacheName]; got != want {
+		t.Errorf("Expected stock cache stats %+v, got %+v", want, got)
+	}
+	if _, ok := resp.Data.Caches[weather.GeocodeCacheName]; !ok {
+		t.Errorf("Expected geocode cache stats, got %v", resp.Data.Caches)
+	}
+	if _, ok := resp.Data.Caches[weather.WeatherCacheName]; ok {
+		t.Error("Expected no weather cache stats without a weather cache")
+	}
+}
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", formatJSON},
+		{"application/json", formatJSON},
+		{"application/xml", formatXML},
+		{"text/xml", formatXML},
+		{"text/html, application/xml;q=0.9, */*;q=0.8", formatXML},
+		{"application/json;q=0.5, application/xml", formatXML},
+		{"application/xml;q=0.5, application/json", formatJSON},
+		{"application/xml;q=0", formatJSON},
+		{"*/*", formatJSON},
+		{"application/x-ndjson", formatNDJSON},
+		{"application/x-ndjson;q=0.5, application/json", formatJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			if got := negotiateFormat(req); got != tt.want {
+				t.Errorf("negotiateFormat(%q) = %s, want %s", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler_ContentNegotiation(t *testing.T) {
+	t.Run("stock as XML", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(ddogQuoteURL, 200, testutils.YahooFinanceStockResponse)
+		handler := newTestHandler(mockClient)
+
+		req := httptest.NewRequest(http.MethodGet, "/stock?symbol=DDOG", nil)
+		req.Header.Set("Accept", "application/xml")
+		rec := httptest.NewRecorder()
+		handler.GetStock(rec, req)
+
+		if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/xml") {
+			t.Errorf("Expected XML content type, got %s", got)
+		}
+
+		var resp struct {
+			Success bool   `xml:"success"`
+			Symbol  string `xml:"data>symbol"`
+			Price   string `xml:"data>price"`
+			Source  string `xml:"meta>upstream_source"`
+		}
+		if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode XML: %v\n%s", err, rec.Body.String())
+		}
+		if !resp.Success || resp.Symbol != "DDOG" || resp.Price != "125.67" || resp.Source != "Yahoo Finance" {
+			t.Errorf("Unexpected XML response: %+v", resp)
+		}
+	})
+
+	t.Run("map data as XML", func(t *testing.T) {
+		handler := newTestHandler(testutils.NewMockHTTPClient())
+
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set("Accept", "application/xml")
+		rec := httptest.NewRecorder()
+		handler.HealthCheck(rec, req)
+
+		var resp struct {
+			Status  string `xml:"data>status"`
+			Version string `xml:"data>build>version"`
+		}
+		if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode XML: %v\n%s", err, rec.Body.String())
+		}
+		if resp.Status != "healthy" || resp.Version != DefaultConfig().BuildInfo.Version {
+			t.Errorf("Unexpected XML response: %+v", resp)
+		}
+	})
+
+	t.Run("map keys that are not XML names", func(t *testing.T) {
+		handler := newTestHandler(testutils.NewMockHTTPClient())
+		req := httptest.NewRequest(http.MethodGet, "/weather/summary/batch", nil)
+		req.Header.Set("Accept", "application/xml")
+		rec := httptest.NewRecorder()
+		handler.writeSuccessResponse(rec, req, map[string]string{
+			"New York":  "sunny",
+			"1st place": "Stuttgart",
+			"city_1":    "Berlin",
+		})
+
+		var resp struct {
+			Entries []struct {
+				Key   string `xml:"key,attr"`
+				Value string `xml:",chardata"`
+			} `xml:"data>entry"`
+			City string `xml:"data>city_1"`
+		}
+		if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode XML: %v\n%s", err, rec.Body.String())
+		}
+		if len(resp.Entries) != 2 || resp.Entries[0].Key != "1st place" || resp.Entries[0].Value != "Stuttgart" ||
+			resp.Entries[1].Key != "New York" || resp.Entries[1].Value != "sunny" {
+			t.Errorf("Expected entry elements for invalid names, got %s", rec.Body.String())
+		}
+		if resp.City != "Berlin" {
+			t.Errorf("Expected valid names to stay elements, got %s", rec.Body.String())
+		}
+	})
+
+	t.Run("error as XML", func(t *testing.T) {
+		handler := newTestHandler(testutils.NewMockHTTPClient())
+
+		req := httptest.NewRequest(http.MethodGet, "/stock", nil)
+		req.Header.Set("Accept", "text/xml")
+		rec := httptest.NewRecorder()
+		handler.GetStock(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rec.Code)
+		}
+
+		var resp ErrorResponse
+		if err := xml.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode XML: %v\n%s", err, rec.Body.String())
+		}
+		if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Error, "symbol") {
+			t.Errorf("Unexpected XML error: %+v", resp)
+		}
+	})
+
+	t.Run("JSON by default", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(ddogQuoteURL, 200, testutils.YahooFinanceStockResponse)
+		handler := newTestHandler(mockClient)
+
+		rec := httptest.NewRecorder()
+		handler.GetStock(rec, httptest.NewRequest(http.MethodGet, "/stock?symbol=DDOG", nil))
+
+		if got := rec.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("Expected JSON content type, got %s", got)
+		}
+
+		var resp SuccessResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || !resp.Success {
+			t.Errorf("Expected JSON success response, got %v", err)
+		}
+	})
+}
+
+func TestHandler_GetStockSearch(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		body       string
+		wantStatus int
+		wantCount  int
+	}{
+		{"matches", "?q=apple", testutils.YahooFinanceSearchResponse, http.StatusOK, 2},
+		{"no matches", "?q=apple", testutils.YahooFinanceSearchNoMatches, http.StatusOK, 0},
+		{"missing query", "", "", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse("https://query1.finance.yahoo.com/v1/finance/search?q=apple", 200, tt.body)
+			handler := newTestHandler(mockClient)
+
+			rec := httptest.NewRecorder()
+			handler.GetStockSearch(rec, httptest.NewRequest(http.MethodGet, "/stock/search"+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Data struct {
+					Count   int                  `json:"count"`
+					Matches []models.SymbolMatch `json:"matches"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Data.Count != tt.wantCount || len(resp.Data.Matches) != tt.wantCount {
+				t.Errorf("Expected %d matches, got count %d with %d entries", tt.wantCount, resp.Data.Count, len(resp.Data.Matches))
+			}
+			if resp.Data.Matches == nil {
+				t.Error("Expected matches to encode as an array, got null")
+			}
+		})
+	}
+}
+
+func TestHandler_GetStockBatchCSV(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(ddogQuoteURL, 200, testutils.YahooFinanceStockResponse)
+	mockClient.AddResponse("https://query1.finance.yahoo.com/v7/finance/quote?symbols=AAPL", 200, testutils.YahooFinanceQuote("AAPL", 175.5, -1.25))
+	handler := NewHandler(DefaultConfig(), weather.NewService(mockClient), stock.NewService(mockClient, stock.WithRateLimit(0)))
+
+	rec := httptest.NewRecorder()
+	handler.GetStockBatchCSV(rec, httptest.NewRequest(http.MethodGet, "/stock/batch.csv?symbols=ddog,AAPL,NOPE", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/csv") {
+		t.Errorf("Expected text/csv content type, got %s", got)
+	}
+
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+
+	want := [][]string{
+		{"symbol", "company", "price", "change", "change_percent", "market_state", "currency"},
+		{"DDOG", "Datadog, Inc.", "125.67", "2.34", "1.89", "REGULAR", "USD"},
+		{"AAPL", "AAPL Corp", "175.50", "-2.22", "-1.25", "REGULAR", "USD"},
+		{"NOPE", "", "", "", "", "", ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d rows, got %d: %v", len(want), len(records), records)
+	}
+	for i, row := range records {
+		if len(row) != len(want[i]) {
+			t.Errorf("Row %d: expected %d fields, got %d", i, len(want[i]), len(row))
+			continue
+		}
+		for j := range row {
+			if row[j] != want[i][j] {
+				t.Errorf("Row %d field %d: expected %q, got %q", i, j, want[i][j], row[j])
+			}
+		}
+	}
+}
+
+func TestHandler_GetStockBatchCSV_InvalidInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"missing symbols", ""},
+		{"invalid symbol", "?symbols=DDOG,DD0G"},
+		{"too many symbols", "?symbols=" + strings.TrimSuffix(strings.Repeat("A,", maxBatchSymbols+1), ",")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newTestHandler(testutils.NewMockHTTPClient())
+
+			rec := httptest.NewRecorder()
+			handler.GetStockBatchCSV(rec, httptest.NewRequest(http.MethodGet, "/stock/batch.csv"+tt.query, nil))
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_GetStockMovers_InvalidInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"invalid limit", "?limit=0"},
+		{"too many symbols", "?symbols=" + strings.TrimSuffix(strings.Repeat("A,", maxBatchSymbols+1), ",")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			handler := newTestHandler(mockClient)
+
+			rec := httptest.NewRecorder()
+			handler.GetStockMovers(rec, httptest.NewRequest(http.MethodGet, "/stock/movers"+tt.query, nil))
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", rec.Code)
+			}
+			if calls := len(mockClient.GetCalls()); calls != 0 {
+				t.Errorf("Expected no upstream calls, got %d", calls)
+			}
+		})
+	}
+}
+
+func TestHandler_GetWeatherBatch(t *testing.T) {
+	cities := "Stuttgart,S,Stuttgart,Atlantis,Stuttgart"
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantLimit  int
+		wantOffset int
+		wantCities []string
+	}{
+		{
+			name:       "default page",
+			query:      "?cities=" + cities,
+			wantStatus: http.StatusOK,
+			wantLimit:  10,
+			wantCities: []string{"Stuttgart", "S", "Stuttgart", "Atlantis", "Stuttgart"},
+		},
+		{
+			name:       "second page",
+			query:      "?cities=" + cities + "&limit=2&offset=2",
+			wantStatus: http.StatusOK,
+			wantLimit:  2,
+			wantOffset: 2,
+			wantCities: []string{"Stuttgart", "Atlantis"},
+		},
+		{
+			name:       "offset past the end",
+			query:      "?cities=" + cities + "&offset=10",
+			wantStatus: http.StatusOK,
+			wantLimit:  10,
+			wantOffset: 10,
+			wantCities: []string{},
+		},
+		{
+			name:       "limit is capped",
+			query:      "?cities=" + cities + "&limit=500",
+			wantStatus: http.StatusOK,
+			wantLimit:  maxWeatherBatchLimit,
+			wantCities: []string{"Stuttgart", "S", "Stuttgart", "Atlantis", "Stuttgart"},
+		},
+		{
+			name:       "zero limit",
+			query:      "?cities=" + cities + "&limit=0",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "negative offset",
+			query:      "?cities=" + cities + "&offset=-1",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing cities",
+			query:      "",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "workers and timeout",
+			query:      "?cities=" + cities + "&workers=1&timeout=5s",
+			wantStatus: http.StatusOK,
+			wantLimit:  10,
+			wantCities: []string{"Stuttgart", "S", "Stuttgart", "Atlantis", "Stuttgart"},
+		},
+		{
+			name:       "zero workers",
+			query:      "?cities=" + cities + "&workers=0",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid timeout",
+			query:      "?cities=" + cities + "&timeout=soon",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse(stuttgartWeatherURL, 200, testutils.OpenMeteoWeatherResponse)
+			handler := newTestHandler(mockClient)
+
+			rec := httptest.NewRecorder()
+			handler.GetWeatherBatch(rec, httptest.NewRequest(http.MethodGet, "/weather/batch"+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Data struct {
+					Total   int                   `json:"total"`
+					Limit   int                   `json:"limit"`
+					Offset  int                   `json:"offset"`
+					Results []weather.BatchResult `json:"results"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if resp.Data.Total != 5 || resp.Data.Limit != tt.wantLimit || resp.Data.Offset != tt.wantOffset {
+				t.Errorf("Expected total 5, limit %d, offset %d, got %d, %d, %d",
+					tt.wantLimit, tt.wantOffset, resp.Data.Total, resp.Data.Limit, resp.Data.Offset)
+			}
+
+			if len(resp.Data.Results) != len(tt.wantCities) {
+				t.Fatalf("Expected %d results, got %d", len(tt.wantCities), len(resp.Data.Results))
+			}
+			for i, result := range resp.Data.Results {
+				if result.City != tt.wantCities[i] {
+					t.Errorf("Result %d: expected %s, got %s", i, tt.wantCities[i], result.City)
+				}
+				if (result.Error == "") != (result.City == "Stuttgart") {
+					t.Errorf("Result %d: unexpected error state %+v", i, result)
+				}
+			}
+		})
+	}
+}
+
+func TestWeatherBatchOptions(t *testing.T) {
+	tests := []struct {
+		query       string
+		wantWorkers int
+		wantTimeout time.Duration
+		wantErr     bool
+	}{
+		{query: "", wantWorkers: weather.BatchWorkers},
+		{query: "?workers=2&timeout=1500ms", wantWorkers: 2, wantTimeout: 1500 * time.Millisecond},
+		{query: "?workers=1000&timeout=1h", wantWorkers: maxWeatherBatchWorkers, wantTimeout: maxWeatherBatchTimeout},
+		{query: "?workers=-1", wantErr: true},
+		{query: "?workers=many", wantErr: true},
+		{query: "?timeout=0s", wantErr: true},
+		{query: "?timeout=5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			opts, err := weatherBatchOptions(httptest.NewRequest(http.MethodGet, "/weather/batch"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if opts.Workers != tt.wantWorkers || opts.Timeout != tt.wantTimeout {
+				t.Errorf("Expected workers %d and timeout %v, got %d and %v",
+					tt.wantWorkers, tt.wantTimeout, opts.Workers, opts.Timeout)
+			}
+		})
+	}
+}
+
+func TestHandler_GetWeatherBatch_NDJSON(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(stuttgartWeatherURL, 200, testutils.OpenMeteoWeatherResponse)
+	handler := newTestHandler(mockClient)
+
+	req := httptest.NewRequest(http.MethodGet, "/weather/batch?cities=Stuttgart,S,Stuttgart,Atlantis", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	handler.GetWeatherBatch(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Expected Content-Type application/x-ndjson, got %q", got)
+	}
+	if !rec.Flushed {
+		t.Error("Expected the stream to be flushed")
+	}
+
+	// Results arrive in completion order, so count them per city
+	got := make(map[string]int)
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var result weather.BatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to decode line %q: %v", scanner.Text(), err)
+		}
+
+		wantError := result.City != "Stuttgart"
+		if wantError && (result.Error == "" || result.Weather != nil) {
+			t.Errorf("Expected an error for %s, got %+v", result.City, result)
+		}
+		if !wantError && (result.Error != "" || result.Weather == nil) {
+			t.Errorf("Expected weather for %s, got %+v", result.City, result)
+		}
+		got[result.City]++
+	}
+
+	want := map[string]int{"Stuttgart": 2, "S": 1, "Atlantis": 1}
+	if len(got) != len(want) {
+		t.Fatalf("Expected results for %v, got %v", want, got)
+	}
+	for city, count := range want {
+		if got[city] != count {
+			t.Errorf("Expected %d results for %s, got %d", count, city, got[city])
+		}
+	}
+}
+
+func TestHandler_GetWeather_Timezone(t *testing.T) {
+	utcWeatherURL := strings.Replace(stuttgartWeatherURL, "timezone=auto", "timezone=UTC", 1)
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(stuttgartWeatherURL, 200, testutils.OpenMeteoWeatherResponse)
+	mockClient.AddResponse(utcWeatherURL, 200, testutils.OpenMeteoWeatherResponse)
+	handler := newTestHandler(mockClient)
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus int
+		wantURL    string
+	}{
+		{"defaults to auto", "/weather?city=Stuttgart", http.StatusOK, stuttgartWeatherURL},
+		{"explicit timezone", "/weather?city=Stuttgart&timezone=UTC", http.StatusOK, utcWeatherURL},
+		{"invalid timezone", "/weather?city=Stuttgart&timezone=Mars/Base", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient.CallCount = make(map[string]int)
+
+			rec := httptest.NewRecorder()
+			handler.GetWeather(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantURL != "" && mockClient.GetCallCount(tt.wantURL) != 1 {
+				t.Errorf("Expected one upstream request to %s", tt.wantURL)
+			}
+		})
+	}
+}
+
+func TestHandler_GetStockDemoSymbols(t *testing.T) {
+	handler := newTestHandler(testutils.NewMockHTTPClient())
+
+	rec := httptest.NewRecorder()
+	handler.GetStockDemoSymbols(rec, httptest.NewRequest(http.MethodGet, "/stock/demo/symbols", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Count   int                 `json:"count"`
+			Symbols []models.SymbolInfo `json:"symbols"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Data.Count != len(resp.Data.Symbols) {
+		t.Errorf("Expected count %d to match the %d entries", resp.Data.Count, len(resp.Data.Symbols))
+	}
+	names := make(map[string]string, len(resp.Data.Symbols))
+	for _, info := range resp.Data.Symbols {
+		names[info.Symbol] = info.Name
+	}
+	for _, symbol := range []string{"DDOG", "AAPL", "GOOGL", "MSFT", "TSLA"} {
+		if names[symbol] == "" {
+			t.Errorf("Expected %s with a company name in the demo symbols, got %v", symbol, resp.Data.Symbols)
+		}
+	}
+}
+
+func TestHandler_GetNearestCity(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantStatus  int
+		wantCity    string
+		wantMessage string
+	}{
+		{"near Stuttgart", "?lat=48&lon=9", http.StatusOK, "Stuttgart", ""},
+		{"near New York", "?lat=40.73&lon=-73.99", http.StatusOK, "New York", ""},
+		{"missing longitude", "?lat=48", http.StatusBadRequest, "", "missing required parameter 'lon'"},
+		{"latitude out of range", "?lat=-91&lon=9", http.StatusBadRequest, "", "Latitude must be between -90 and 90"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			handler := newTestHandler(mockClient)
+
+			rec := httptest.NewRecorder()
+			handler.GetNearestCity(rec, httptest.NewRequest(http.MethodGet, "/weather/nearest"+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if len(mockClient.GetCalls()) != 0 {
+				t.Errorf("Expected no upstream calls, got %v", mockClient.GetCalls())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if !strings.Contains(rec.Body.String(), tt.wantMessage) {
+					t.Errorf("Expected message containing %q, got %s", tt.wantMessage, rec.Body.String())
+				}
+				return
+			}
+
+			var resp struct {
+				Data struct {
+					City       string  `json:"city"`
+					DistanceKm float64 `json:"distance_km"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Data.City != tt.wantCity {
+				t.Errorf("Expected city %s, got %s", tt.wantCity, resp.Data.City)
+			}
+			if resp.Data.DistanceKm <= 0 || resp.Data.DistanceKm > 100 {
+				t.Errorf("Expected a distance within 100 km, got %v", resp.Data.DistanceKm)
+			}
+		})
+	}
+}
+
+func TestHandler_GetWeatherCodes(t *testing.T) {
+	handler := newTestHandler(testutils.NewMockHTTPClient())
+
+	rec := httptest.NewRecorder()
+	handler.GetWeatherCodes(rec, httptest.NewRequest(http.MethodGet, "/weather/codes", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Count int                       `json:"count"`
+			Codes []models.WeatherCodeEntry `json:"codes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Data.Count != len(models.WeatherCodeMap) || len(resp.Data.Codes) != resp.Data.Count {
+		t.Fatalf("Expected %d codes, got count %d with %d entries", len(models.WeatherCodeMap), resp.Data.Count, len(resp.Data.Codes))
+	}
+	seen := make(map[int]bool, len(resp.Data.Codes))
+	for _, entry := range resp.Data.Codes {
+		seen[entry.Code] = true
+	}
+	for code := range models.WeatherCodeMap {
+		if !seen[code] {
+			t.Errorf("Expected code %d in the reference", code)
+		}
+	}
+}
+
+func TestHandler_GetWeatherCities(t *testing.T) {
+	handler := newTestHandler(testutils.NewMockHTTPClient())
+
+	rec := httptest.NewRecorder()
+	handler.GetWeatherCities(rec, httptest.NewRequest(http.MethodGet, "/weather/cities", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Count  int               `json:"count"`
+			Cities []models.CityInfo `json:"cities"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if resp.Data.Count != len(weather.CityCoordinates) || len(resp.Data.Cities) != resp.Data.Count {
+		t.Fatalf("Expected %d cities, got count %d with %d entries", len(weather.CityCoordinates), resp.Data.Count, len(resp.Data.Cities))
+	}
+	want := []string{"Berlin", "London", "Munich", "New York", "Paris", "Stuttgart"}
+	for i, city := range resp.Data.Cities {
+		if city.Name != want[i] {
+			t.Errorf("City %d: expected %s, got %s", i, want[i], city.Name)
+		}
+		if city.Country == "" {
+			t.Errorf("City %d: expected a country for %s", i, city.Name)
+		}
+	}
+}
+
+func TestHandler_GetWeatherSummaryBatch(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(stuttgartWeatherURL, 200, testutils.OpenMeteoWeatherResponse)
+	handler := newTestHandler(mockClient)
+
+	rec := httptest.NewRecorder()
+	handler.GetWeatherSummaryBatch(rec, httptest.NewRequest(http.MethodGet, "/weather/summary/batch?cities=Stuttgart,Atlantis", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(resp.Data) != 2 {
+		t.Fatalf("Expected 2 summaries, got %d: %v", len(resp.Data), resp.Data)
+	}
+	if summary := resp.Data["Stuttgart"]; !strings.Contains(summary, "Stuttgart") || strings.HasPrefix(summary, "error:") {
+		t.Errorf("Expected a summary for Stuttgart, got %q", summary)
+	}
+	if summary := resp.Data["Atlantis"]; !strings.HasPrefix(summary, "error:") {
+		t.Errorf("Expected an error string for Atlantis, got %q", summary)
+	}
+
+	t.Run("missing cities", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.GetWeatherSummaryBatch(rec, httptest.NewRequest(http.MethodGet, "/weather/summary/batch", nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandler_GetWeatherSummaryBatch_NDJSON(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(stuttgartWeatherURL, 200, testutils.OpenMeteoWeatherResponse)
+	handler := newTestHandler(mockClient)
+
+	req := httptest.NewRequest(http.MethodGet, "/weather/summary/batch?cities=Stuttgart,Atlantis", nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+	rec := httptest.NewRecorder()
+	handler.GetWeatherSummaryBatch(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/x-ndjson" {
+		t.Errorf("Expected Content-Type application/x-ndjson, got %q", got)
+	}
+	if !rec.Flushed {
+		t.Error("Expected the stream to be flushed")
+	}
+
+	// Results arrive in completion order, so key them by city
+	got := make(map[string]weather.SummaryResult)
+	scanner := bufio.NewScanner(rec.Body)
+	for scanner.Scan() {
+		var result weather.SummaryResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("Failed to decode line %q: %v", scanner.Text(), err)
+		}
+		got[result.City] = result
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 results, got %d: %v", len(got), got)
+	}
+	if result := got["Stuttgart"]; !strings.Contains(result.Summary, "Stuttgart") || result.Error != "" {
+		t.Errorf("Expected a summary for Stuttgart, got %+v", result)
+	}
+	if result := got["Atlantis"]; result.Error == "" || result.Summary != "" {
+		t.Errorf("Expected an error for Atlantis, got %+v", result)
+	}
+}
+
+func TestHandler_LastModified(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(stuttgartWeatherURL, 200, testutils.OpenMeteoWeatherResponse)
+	handler := newTestHandler(mockClient)
+
+	t.Run("weather response", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.GetWeather(rec, httptest.NewRequest(http.MethodGet, "/weather?city=Stuttgart", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+		// The fixture observation is 2024-01-15T14:00 in UTC
+		if got, want := rec.Header().Get("Last-Modified"), "Mon, 15 Jan 2024 14:00:00 GMT"; got != want {
+			t.Errorf("Expected Last-Modified %q, got %q", want, got)
+		}
+	})
+
+	t.Run("data without a timestamp", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.GetWeatherCities(rec, httptest.NewRequest(http.MethodGet, "/weather/cities", nil))
+
+		if got := rec.Header().Get("Last-Modified"); got != "" {
+			t.Errorf("Expected no Last-Modified header, got %q", got)
+		}
+	})
+}
+
+func TestHandler_GetWeather_ETag(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(stuttgartWeatherURL, 200, testutils.OpenMeteoWeatherResponse)
+	weatherService := weather.NewService(mockClient, weather.WithCache(cache.NewMemoryCache(0), time.Minute))
+	handler := NewHandler(DefaultConfig(), weatherService, stock.NewService(mockClient))
+
+	first := httptest.NewRecorder()
+	handler.GetWeather(first, httptest.NewRequest(http.MethodGet, "/weather?city=Stuttgart", nil))
+
+	if first.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", first.Code)
+	}
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag header on the first response")
+	}
+
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		accept      string
+		wantStatus  int
+	}{
+		{name: "matching tag", ifNoneMatch: etag, wantStatus: http.StatusNotModified},
+		{name: "weak matching tag", ifNoneMatch: `"other", W/` + etag, wantStatus: http.StatusNotModified},
+		{name: "stale tag", ifNoneMatch: `"stale"`, wantStatus: http.StatusOK},
+		{name: "other format", ifNoneMatch: etag, accept: "application/xml", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/weather?city=Stuttgart", nil)
+			req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			handler.GetWeather(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantStatus == http.StatusNotModified {
+				if rec.Body.Len() != 0 {
+					t.Errorf("Expected empty body for 304, got %q", rec.Body.String())
+				}
+				if rec.Header().Get("ETag") != etag {
+					t.Errorf("Expected ETag %s, got %s", etag, rec.Header().Get("ETag"))
+				}
+			}
+		})
+	}
+
+	if calls := mockClient.GetCallCount(stuttgartWeatherURL); calls != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", calls)
+	}
+}
+
+func TestRouter_WeatherRaw(t *testing.T) {
+	tests := []struct {
+		name           string
+		debugEndpoints bool
+		wantStatus     int
+	}{
+		{name: "disabled by default", wantStatus: http.StatusNotFound},
+		{name: "enabled", debugEndpoints: true, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse(stuttgartWeatherURL, 200, testutils.OpenMeteoWeatherResponse)
+
+			config := DefaultConfig()
+			config.DebugEndpoints = tt.debugEndpoints
+			router := NewRouter(config, weather.NewService(mockClient), stock.NewService(mockClient))
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/weather/raw?city=Stuttgart", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Data weather.RawWeather `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Data.Country != "Germany" || resp.Data.Coordinates.Latitude != 48.7758 {
+				t.Errorf("Unexpected resolved location: %+v", resp.Data)
+			}
+			if resp.Data.Upstream == nil || resp.Data.Upstream.CurrentUnits.Temperature2m == "" {
+				t.Errorf("Expected the upstream payload, got %+v", resp.Data.Upstream)
+			}
+		})
+	}
+}
+
+func TestHandler_HealthCheck_Deep(t *testing.T) {
+	geocodeURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=Stuttgart"
+	fallbackQuoteURL := "https://query2.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+
+	tests := []struct {
+		name          string
+		query         string
+		wantStatus    int
+		wantHealth    string
+		wantUpstreams map[string]string
+	}{
+		{name: "shallow", query: "", wantStatus: http.StatusOK, wantHealth: "healthy"},
+		{name: "deep disabled", query: "?deep=false", wantStatus: http.StatusOK, wantHealth: "healthy"},
+		{
+			name:       "deep",
+			query:      "?deep=true",
+			wantStatus: http.StatusOK,
+			wantHealth: "degraded",
+			wantUpstreams: map[string]string{
+				"open_meteo": "ok",
+				"yahoo":      "degraded",
+			},
+		},
+		{name: "invalid deep", query: "?deep=very", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse(geocodeURL, 200, testutils.OpenMeteoGeocodeResponse)
+			mockClient.AddResponse(ddogQuoteURL, 503, "unavailable")
+			mockClient.AddResponse(fallbackQuoteURL, 503, "unavailable")
+			handler := newTestHandler(mockClient)
+
+			rec := httptest.NewRecorder()
+			handler.HealthCheck(rec, httptest.NewRequest(http.MethodGet, "/health"+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Data map[string]interface{} `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+
+			if status := resp.Data["status"]; status != tt.wantHealth {
+				t.Errorf("Expected status %s, got %v", tt.wantHealth, status)
+			}
+			if _, nested := resp.Data["upstreams"]; nested {
+				t.Errorf("Expected upstream states at the top level, got %v", resp.Data["upstreams"])
+			}
+			for _, name := range []string{"open_meteo", "yahoo"} {
+				got, reported := resp.Data[name]
+				want, wanted := tt.wantUpstreams[name]
+				if reported != wanted || (wanted && got != want) {
+					t.Errorf("Expected %s to be %q, got %v", name, want, got)
+				}
+			}
+			if tt.wantUpstreams == nil && mockClient.GetCallCount(geocodeURL) != 0 {
+				t.Errorf("Expected the shallow check not to call upstreams")
+			}
+		})
+	}
+}
+
+func TestHandler_GetWeatherByCoordinates(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantStatus  int
+		wantMessage string
+	}{
+		{"valid coordinates", "?lat=48.7758&lon=9.1829", http.StatusOK, ""},
+		{"latitude too high", "?lat=91&lon=9.1829", http.StatusBadRequest, "Latitude must be between -90 and 90"},
+		{"longitude too low", "?lat=48.7758&lon=-180.5", http.StatusBadRequest, "Longitude must be between -180 and 180"},
+		{"missing latitude", "?lon=9.1829", http.StatusBadRequest, "missing required parameter 'lat'"},
+		{"malformed longitude", "?lat=48.7758&lon=east", http.StatusBadRequest, "invalid lon"},
+		{"not a number", "?lat=NaN&lon=9.1829", http.StatusBadRequest, "Latitude"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse(stuttgartWeatherURL, 200, testutils.OpenMeteoWeatherResponse)
+			handler := newTestHandler(mockClient)
+
+			rec := httptest.NewRecorder()
+			handler.GetWeatherByCoordinates(rec, httptest.NewRequest(http.MethodGet, "/weather/coordinates"+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if !strings.Contains(rec.Body.String(), tt.wantMessage) {
+					t.Errorf("Expected message containing %q, got %s", tt.wantMessage, rec.Body.String())
+				}
+				if count := mockClient.GetCallCount(stuttgartWeatherURL); count != 0 {
+					t.Errorf("Expected no upstream call for invalid input, got %d", count)
+				}
+				return
+			}
+
+			var resp struct {
+				Data models.WeatherResponse `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Data.Temperature != 22.5 || resp.Data.Coordinates.Latitude != 48.7758 {
+				t.Errorf("Expected the converted Stuttgart weather, got %+v", resp.Data)
+			}
+			if resp.Data.City != "Stuttgart" || resp.Data.Country != "Germany" {
+				t.Errorf("Expected the point to be labeled Stuttgart, Germany, got %q, %q", resp.Data.City, resp.Data.Country)
+			}
+		})
+	}
+}
+
+func TestHandler_GetStockMarketState(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		body       string
+		wantStatus int
+		wantState  string
+		wantOpen   bool
+		wantText   string
+	}{
+		{"open market", "?symbol=DDOG", testutils.YahooFinanceStockResponse, http.StatusOK, "REGULAR", true, "Market Open"},
+		{"closed market", "?symbol=DDOG", testutils.YahooFinanceMarketClosed, http.StatusOK, "CLOSED", false, "Market Closed"},
+		{"missing symbol", "", "", http.StatusBadRequest, "", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse(ddogQuoteURL, 200, tt.body)
+			handler := newTestHandler(mockClient)
+
+			rec := httptest.NewRecorder()
+			handler.GetStockMarketState(rec, httptest.NewRequest(http.MethodGet, "/stock/market-state"+tt.query, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Data struct {
+					Symbol      string `json:"symbol"`
+					MarketState string `json:"market_state"`
+					IsOpen      bool   `json:"is_open"`
+					Display     string `json:"display"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Data.Symbol != "DDOG" || resp.Data.MarketState != tt.wantState || resp.Data.IsOpen != tt.wantOpen || resp.Data.Display != tt.wantText {
+				t.Errorf("Expected DDOG %s (open %v, %q), got %+v", tt.wantState, tt.wantOpen, tt.wantText, resp.Data)
+			}
+		})
+	}
+}
+
+func TestHandler_GetStockSummary_UppercasesSymbol(t *testing.T) {
+	for _, query := range []string{"ddog", "%20dDoG%20"} {
+		t.Run(query, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse(ddogQuoteURL, 200, testutils.YahooFinanceStockResponse)
+			handler := newTestHandler(mockClient)
+
+			rec := httptest.NewRecorder()
+			handler.GetStockSummary(rec, httptest.NewRequest(http.MethodGet, "/stock/summary?symbol="+query, nil))
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+
+			var resp struct {
+				Data struct {
+					Symbol string `json:"symbol"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if resp.Data.Symbol != "DDOG" {
+				t.Errorf("Expected echoed symbol DDOG, got %q", resp.Data.Symbol)
+			}
+		})
+	}
+}
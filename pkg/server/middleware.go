@@ -1,9 +1,16 @@
 package server
 
 import (
-	"log"
+	"context"
+	"fmt"
 	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/tracing"
 )
 
 // LoggingMiddleware logs HTTP requests
@@ -22,11 +29,11 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 
 		// Log the request
 		duration := time.Since(start)
-		log.Printf(
+		logging.Infof(
 			"%s %s %s %d %v %s",
-			r.RemoteAddr,
+			clientIP(r),
 			r.Method,
-			r.URL.Path,
+			truncate(r.URL.Path, maxLoggedPathLength),
 			lrw.statusCode,
 			duration,
 			r.UserAgent(),
@@ -34,6 +41,9 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// maxLoggedPathLength caps the request path written to the access log
+const maxLoggedPathLength = 256
+
 // loggingResponseWriter wraps http.ResponseWriter to capture status code
 type loggingResponseWriter struct {
 	http.ResponseWriter
@@ -45,32 +55,157 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
-// CORSMiddleware adds CORS headers
+// Flush forwards to the underlying writer so streamed responses are not held back
+func (lrw *loggingResponseWriter) Flush() {
+	if flusher, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// TracingMiddleware starts a span for every request and stores it in the
+// request context so handlers can add tags to it
+func TracingMiddleware(tracer tracing.Tracer) func(http.Handler) http.Handler {
+	tracer = tracing.OrNoop(tracer)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span := tracer.StartSpan("http.request")
+			defer span.Finish()
+
+			span.SetTag(tracing.TagHTTPMethod, r.Method)
+			span.SetTag(tracing.TagHTTPURL, r.URL.String())
+
+			lrw := &loggingResponseWriter{
+				ResponseWriter: w,
+				statusCode:     200,
+			}
+
+			next.ServeHTTP(lrw, r.WithContext(tracing.ContextWithSpan(r.Context(), span)))
+
+			span.SetTag(tracing.TagHTTPStatusCode, lrw.statusCode)
+		})
+	}
+}
+
+// RequestSizeLimitMiddleware rejects requests whose URL, including the query
+// string, is longer than maxURLBytes with a 414. A limit of zero or less
+// disables the check.
+func RequestSizeLimitMiddleware(maxURLBytes int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if maxURLBytes <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if size := len(r.URL.RequestURI()); size > maxURLBytes {
+				logging.Warnf("Rejected request with a %d byte URL (limit %d)", size, maxURLBytes)
+				writeEncoded(w, negotiateFormat(r), http.StatusRequestURITooLong, ErrorResponse{
+					Error:   fmt.Sprintf("request URL exceeds %d bytes", maxURLBytes),
+					Code:    http.StatusRequestURITooLong,
+					Message: "Request failed",
+					Time:    time.Now(),
+				}, wantsPretty(r, false))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// MethodMiddleware only lets requests with one of the given methods through.
+// Other methods get a 405 error response with an Allow header listing the
+// permitted ones.
+func MethodMiddleware(methods ...string) func(http.Handler) http.Handler {
+	allow := strings.Join(methods, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, method := range methods {
+				if r.Method == method {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			logging.Warnf("Rejected %s %s: allowed methods are %s", r.Method, r.URL.Path, allow)
+			w.Header().Set("Allow", allow)
+			writeEncoded(w, negotiateFormat(r), http.StatusMethodNotAllowed, ErrorResponse{
+				Error:   fmt.Sprintf("method %s not allowed", r.Method),
+				Code:    http.StatusMethodNotAllowed,
+				Message: "Request failed",
+				Time:    time.Now(),
+			}, wantsPretty(r, false))
+		})
+	}
+}
+
+// corsAllowedMethods lists every method served by at least one route
+const corsAllowedMethods = "GET, POST, OPTIONS"
+
+// CORSMiddleware adds CORS headers allowing any origin
 func CORSMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-		// Handle preflight requests
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
+	return CORSMiddlewareWithOrigins(nil)(next)
+}
+
+// CORSMiddlewareWithOrigins adds CORS headers for the given allowed origins.
+// An empty list or a "*" entry allows any origin.
+func CORSMiddlewareWithOrigins(allowedOrigins []string) func(http.Handler) http.Handler {
+	allowAll := len(allowedOrigins) == 0
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			allowAll = true
 		}
+		allowed[origin] = true
+	}
 
-		// Call the next handler
-		next.ServeHTTP(w, r)
-	})
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Set CORS headers
+			if allowAll {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Add("Vary", "Origin")
+				if origin := r.Header.Get("Origin"); allowed[origin] {
+					w.Header().Set("Access-Control-Allow-Origin", origin)
+				}
+			}
+			w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+			// Answer preflight requests here, before the per-route method
+			// check would reject OPTIONS with a 405
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			// Call the next handler
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
-// RecoveryMiddleware recovers from panics and returns a 500 error
+// RecoveryMiddleware recovers from panics, logs the stack trace, and returns
+// a 500 ErrorResponse
 func RecoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("Panic recovered: %v", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				if err == http.ErrAbortHandler {
+					// Let net/http abort the connection as intended
+					panic(err)
+				}
+				logging.Errorf("Panic recovered: %v\n%s", err, debug.Stack())
+
+				// The panic detail stays in the log; clients get a generic message
+				writeEncoded(w, negotiateFormat(r), http.StatusInternalServerError, ErrorResponse{
+					Error:   "internal server error",
+					Code:    http.StatusInternalServerError,
+					Message: "Request failed",
+					Time:    time.Now(),
+				}, wantsPretty(r, false))
 			}
 		}()
 
@@ -101,3 +236,164 @@ func SecurityMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// MaintenanceHeader is set on every response while the service is in
+// maintenance mode
+const MaintenanceHeader = "X-Maintenance-Mode"
+
+// MaintenanceMiddleware marks every response with the maintenance header when
+// enabled. The services themselves stop calling the upstreams; see
+// Config.Maintenance.
+func MaintenanceMiddleware(enabled bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !enabled {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(MaintenanceHeader, "true")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TimeoutMiddleware gives each request a context deadline of d. Handlers that
+// pass the request context to upstream calls are canceled when it expires.
+// If the handler has not written anything by then, a JSON 503 is sent and
+// later writes are discarded; a handler that already started streaming is
+// left to finish. A non-positive d disables the timeout.
+func TimeoutMiddleware(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if d <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{ResponseWriter: w, header: w.Header().Clone(), ctx: ctx}
+			done := make(chan struct{})
+			panicked := make(chan interface{}, 1)
+
+			go func() {
+				defer func() {
+					if err := recover(); err != nil {
+						panicked <- err
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case err := <-panicked:
+				// Re-panic on this goroutine so RecoveryMiddleware sees it
+				panic(err)
+			case <-ctx.Done():
+			}
+
+			// Abandon the writer for any context error, not just the deadline,
+			// so a handler still running after a client cancel cannot write
+			// to w once we return
+			tw.mutex.Lock()
+			committed := tw.wroteHeader
+			if !committed && ctx.Err() != nil {
+				tw.abandoned = true
+			}
+			abandoned := tw.abandoned
+			tw.mutex.Unlock()
+
+			if committed {
+				// The response is already on its way; let the handler finish it
+				select {
+				case <-done:
+				case err := <-panicked:
+					panic(err)
+				}
+				return
+			}
+
+			if abandoned && ctx.Err() == context.DeadlineExceeded {
+				logging.Warnf("Request %s %s exceeded timeout of %v", r.Method, r.URL.Path, d)
+				writeEncoded(w, formatJSON, http.StatusServiceUnavailable, ErrorResponse{
+					Error:   fmt.Sprintf("request exceeded timeout of %v", d),
+					Code:    http.StatusServiceUnavailable,
+					Message: "Request timed out",
+					Time:    time.Now(),
+				}, wantsPretty(r, false))
+			}
+		})
+	}
+}
+
+// timeoutWriter passes writes through until the request has timed out or been
+// canceled. The handler gets its own header map so it cannot race with the
+// timeout response.
+type timeoutWriter struct {
+	http.ResponseWriter
+	header      http.Header
+	ctx         context.Context
+	mutex       sync.Mutex
+	wroteHeader bool
+	abandoned   bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(statusCode int) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	tw.writeHeaderLocked(statusCode)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	tw.writeHeaderLocked(http.StatusOK)
+	if tw.abandoned {
+		return 0, http.ErrHandlerTimeout
+	}
+	return tw.ResponseWriter.Write(b)
+}
+
+// writeHeaderLocked copies the handler's headers and sends the status once.
+// A handler that only starts responding after the context is done is
+// abandoned, so the 503 wins over its late error response and nothing is
+// written for a client that has gone away.
+func (tw *timeoutWriter) writeHeaderLocked(statusCode int) {
+	if tw.abandoned || tw.wroteHeader {
+		return
+	}
+	if tw.ctx.Err() != nil {
+		tw.abandoned = true
+		return
+	}
+	tw.wroteHeader = true
+
+	dst := tw.ResponseWriter.Header()
+	for key := range dst {
+		if _, kept := tw.header[key]; !kept {
+			dst.Del(key)
+		}
+	}
+	for key, values := range tw.header {
+		dst[key] = values
+	}
+	tw.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Flush forwards to the underlying writer so streaming handlers keep working
+func (tw *timeoutWriter) Flush() {
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+	if tw.abandoned {
+		return
+	}
+	if flusher, ok := tw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,744 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/internal/testutils"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/health"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/stock"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/tracing"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/weather"
+)
+
+func TestTimeoutMiddleware(t *testing.T) {
+	t.Run("slow handler gets 503", func(t *testing.T) {
+		handlerDone := make(chan error, 1)
+		slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			_, err := w.Write([]byte("too late"))
+			handlerDone <- err
+		})
+
+		rec := httptest.NewRecorder()
+		TimeoutMiddleware(20*time.Millisecond)(slow).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503, got %d", rec.Code)
+		}
+		if got := rec.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("Expected JSON content type, got %s", got)
+		}
+
+		var resp ErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode error response: %v", err)
+		}
+		if resp.Code != http.StatusServiceUnavailable || !strings.Contains(resp.Error, "timeout") {
+			t.Errorf("Unexpected error response: %+v", resp)
+		}
+
+		select {
+		case err := <-handlerDone:
+			if err != http.ErrHandlerTimeout {
+				t.Errorf("Expected late write to fail with ErrHandlerTimeout, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Handler was not released after the timeout")
+		}
+	})
+
+	t.Run("fast handler passes through", func(t *testing.T) {
+		fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Test", "yes")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte("ok"))
+		})
+
+		rec := httptest.NewRecorder()
+		TimeoutMiddleware(time.Second)(fast).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rec.Code != http.StatusCreated || rec.Body.String() != "ok" || rec.Header().Get("X-Test") != "yes" {
+			t.Errorf("Unexpected response: %d %q %v", rec.Code, rec.Body.String(), rec.Header())
+		}
+	})
+
+	t.Run("started stream is allowed to finish", func(t *testing.T) {
+		streaming := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("first,"))
+			<-r.Context().Done()
+			w.Write([]byte("last"))
+		})
+
+		rec := httptest.NewRecorder()
+		TimeoutMiddleware(20*time.Millisecond)(streaming).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rec.Code != http.StatusOK || rec.Body.String() != "first,last" {
+			t.Errorf("Expected completed stream, got %d %q", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("client cancel abandons the writer", func(t *testing.T) {
+		handlerDone := make(chan error, 1)
+		slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			time.Sleep(10 * time.Millisecond)
+			_, err := w.Write([]byte("too late"))
+			handlerDone <- err
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		rec := httptest.NewRecorder()
+		TimeoutMiddleware(time.Second)(slow).ServeHTTP(rec, req)
+
+		select {
+		case err := <-handlerDone:
+			if err != http.ErrHandlerTimeout {
+				t.Errorf("Expected late write to fail with ErrHandlerTimeout, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Handler was not released after the cancel")
+		}
+		if rec.Body.Len() != 0 {
+			t.Errorf("Expected nothing written for a canceled request, got %q", rec.Body.String())
+		}
+	})
+
+	t.Run("disabled with zero duration", func(t *testing.T) {
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, hasDeadline := r.Context().Deadline(); hasDeadline {
+				t.Errorf("Expected no deadline when the timeout is disabled")
+			}
+		})
+
+		TimeoutMiddleware(0)(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
+
+func TestTimeoutMiddleware_CancelsUpstream(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(ddogQuoteURL, 200, testutils.YahooFinanceStockResponse)
+	mockClient.AddDelay(ddogQuoteURL, 5*time.Second)
+
+	tracker := health.NewTracker()
+	config := DefaultConfig()
+	config.RequestTimeout = 50 * time.Millisecond
+	config.HealthTracker = tracker
+
+	server := NewServer(config,
+		weather.NewService(mockClient),
+		stock.NewService(mockClient, stock.WithHealthTracker(tracker)),
+	)
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stock?symbol=DDOG", nil))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the request to be cut short, took %v", elapsed)
+	}
+
+	// Give the canceled handler a moment to finish, then make sure the
+	// cancellation was not reported as an upstream failure
+	time.Sleep(20 * time.Millisecond)
+	if status, exists := tracker.Snapshot()[stock.UpstreamName]; exists && !status.LastFailure.IsZero() {
+		t.Errorf("Expected canceled request not to be recorded as an upstream failure")
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("secret database password in panic message")
+	})
+
+	rec := httptest.NewRecorder()
+	RecoveryMiddleware(panicking).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected JSON content type, got %s", got)
+	}
+
+	body := rec.Body.String()
+	if !strings.Contains(body, `"code":500`) {
+		t.Errorf("Expected body to contain \"code\":500, got %s", body)
+	}
+	if strings.Contains(body, "secret") {
+		t.Errorf("Expected panic detail not to leak to the client, got %s", body)
+	}
+
+	var resp ErrorResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Errorf("Expected valid JSON, got %v: %s", err, body)
+	}
+}
+
+func TestRecoveryMiddleware_ThroughRouterChain(t *testing.T) {
+	router := NewRouter(DefaultConfig(), nil, nil)
+	router.mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	rec := httptest.NewRecorder()
+	router.GetHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/panic", nil))
+
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Expected valid JSON, got %v", err)
+	}
+	if rec.Code != http.StatusInternalServerError || resp.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 error response, got %d %+v", rec.Code, resp)
+	}
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	var (
+		mutex sync.Mutex
+		spans = make(map[string]map[string]interface{})
+	)
+	tracer := tracing.TracerFunc(func(name string) tracing.Span {
+		mutex.Lock()
+		defer mutex.Unlock()
+		spans[name] = make(map[string]interface{})
+		return &mapSpan{mutex: &mutex, tags: spans[name]}
+	})
+
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(ddogQuoteURL, 200, testutils.YahooFinanceStockResponse)
+
+	config := DefaultConfig()
+	config.Tracer = tracer
+	router := NewRouter(config,
+		weather.NewService(mockClient),
+		stock.NewService(mockClient, stock.WithRateLimit(0), stock.WithTracer(tracer)))
+
+	rec := httptest.NewRecorder()
+	router.GetHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stock?symbol=DDOG", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	request := spans["http.request"]
+	if request == nil {
+		t.Fatal("Expected an http.request span")
+	}
+	if request[tracing.TagHTTPStatusCode] != http.StatusOK || request[tracing.TagStockSymbol] != "DDOG" {
+		t.Errorf("Unexpected request span tags: %v", request)
+	}
+
+	upstream := spans["stock.quote"]
+	if upstream == nil {
+		t.Fatal("Expected a stock.quote span")
+	}
+	if upstream[tracing.TagHTTPURL] != ddogQuoteURL || upstream[tracing.TagStockSymbol] != "DDOG" {
+		t.Errorf("Unexpected upstream span tags: %v", upstream)
+	}
+}
+
+type mapSpan struct {
+	mutex *sync.Mutex
+	tags  map[string]interface{}
+}
+
+func (s *mapSpan) SetTag(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tags[key] = value
+}
+
+func (s *mapSpan) Finish() {}
+
+func TestRequestSizeLimitMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name           string
+		limit          int
+		target         string
+		expectedStatus int
+	}{
+		{"short URL passes", 64, "/weather?city=Stuttgart", http.StatusOK},
+		{"oversized query is rejected", 64, "/weather?city=" + strings.Repeat("a", 100), http.StatusRequestURITooLong},
+		{"oversized path is rejected", 64, "/" + strings.Repeat("b", 100), http.StatusRequestURITooLong},
+		{"zero limit disables the check", 0, "/weather?city=" + strings.Repeat("a", 10000), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			RequestSizeLimitMiddleware(tt.limit)(ok).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedStatus == http.StatusOK {
+				return
+			}
+
+			var resp ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			if resp.Code != http.StatusRequestURITooLong || !strings.Contains(resp.Error, "64 bytes") {
+				t.Errorf("Unexpected error response: %+v", resp)
+			}
+		})
+	}
+}
+
+func TestRouter_RejectsOversizedQuery(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxURLBytes = 128
+	router := NewRouter(config, weather.NewService(testutils.NewMockHTTPClient()), stock.NewService(testutils.NewMockHTTPClient()))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/weather?city="+strings.Repeat("x", 200), nil)
+	router.GetHandler().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestURITooLong {
+		t.Errorf("Expected status 414, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Expected JSON content type, got %s", got)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		max      int
+		expected string
+	}{
+		{"short value unchanged", "Stuttgart", 64, "Stuttgart"},
+		{"exact length unchanged", "abcd", 4, "abcd"},
+		{"long value cut", "abcdefgh", 4, "abcd…"},
+		{"multibyte rune not split", "Zürich", 2, "Z…"},
+		{"cut after multibyte rune", "Zürich", 3, "Zü…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncate(tt.value, tt.max); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	if got := truncateForLog(strings.Repeat("a", 1000)); len(got) != maxLoggedValueLength+len("…") {
+		t.Errorf("Expected truncateForLog to cap at %d bytes, got %d", maxLoggedValueLength, len(got))
+	}
+}
+
+func TestMethodMiddleware(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := MethodMiddleware(http.MethodGet, http.MethodPost)(ok)
+
+	tests := []struct {
+		method         string
+		expectedStatus int
+	}{
+		{http.MethodGet, http.StatusOK},
+		{http.MethodPost, http.StatusOK},
+		{http.MethodPut, http.StatusMethodNotAllowed},
+		{http.MethodDelete, http.StatusMethodNotAllowed},
+		{http.MethodHead, http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, "/weather", nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedStatus == http.StatusOK {
+				return
+			}
+
+			if got := rec.Header().Get("Allow"); got != "GET, POST" {
+				t.Errorf("Expected Allow header \"GET, POST\", got %q", got)
+			}
+			var resp ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			if resp.Code != http.StatusMethodNotAllowed || !strings.Contains(resp.Error, tt.method) {
+				t.Errorf("Unexpected error response: %+v", resp)
+			}
+		})
+	}
+}
+
+func TestRouter_MethodNotAllowed(t *testing.T) {
+	config := DefaultConfig()
+	config.DebugEndpoints = true
+	handler := NewRouter(config, weather.NewService(testutils.NewMockHTTPClient()), stock.NewService(testutils.NewMockHTTPClient())).GetHandler()
+
+	tests := []struct {
+		method    string
+		path      string
+		wantAllow string
+	}{
+		{http.MethodPost, "/", "GET"},
+		{http.MethodPost, "/health", "GET"},
+		{http.MethodPost, "/health/ready", "GET"},
+		{http.MethodPut, "/weather", "GET, POST"},
+		{http.MethodPost, "/weather/summary", "GET"},
+		{http.MethodPost, "/weather/detail", "GET"},
+		{http.MethodPost, "/weather/summary/batch", "GET"},
+		{http.MethodDelete, "/weather/batch", "GET, POST"},
+		{http.MethodPost, "/weather/cities", "GET"},
+		{http.MethodPost, "/weather/raw", "GET"},
+		{http.MethodPatch, "/stock", "GET, POST"},
+		{http.MethodPost, "/stock/datadog", "GET"},
+		{http.MethodPost, "/stock/summary", "GET"},
+		{http.MethodPost, "/stock/movers", "GET"},
+		{http.MethodPost, "/stock/batch.csv", "GET"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Errorf("Expected status 405, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Expected Allow header %q, got %q", tt.wantAllow, got)
+			}
+		})
+	}
+}
+
+func TestRouter_TrailingSlash(t *testing.T) {
+	config := DefaultConfig()
+	config.DebugEndpoints = true
+	handler := NewRouter(config, weather.NewService(testutils.NewMockHTTPClient()), stock.NewService(testutils.NewMockHTTPClient())).GetHandler()
+
+	paths := []string{
+		"/health", "/health/live", "/health/ready", "/health/cache",
+		"/weather", "/weather/summary", "/weather/detail", "/weather/coordinates",
+		"/weather/summary/batch", "/weather/batch", "/weather/cities", "/weather/codes", "/weather/raw",
+		"/weather/nearest",
+		"/stock", "/stock/datadog", "/stock/search", "/stock/demo/symbols", "/stock/summary",
+		"/stock/market-state", "/stock/movers", "/stock/batch.csv", "/dashboard",
+	}
+
+	// An unsupported method reaches the method check of the route without
+	// calling an upstream, so both variants must agree on the Allow header
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, path, nil))
+		return rec
+	}
+
+	for _, path := range paths {
+		t.Run(path+"/", func(t *testing.T) {
+			canonical, slashed := serve(path), serve(path+"/")
+
+			if canonical.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("Expected status 405 for %s, got %d", path, canonical.Code)
+			}
+			if slashed.Code != canonical.Code || slashed.Header().Get("Allow") != canonical.Header().Get("Allow") {
+				t.Errorf("Expected %d with Allow %q, got %d with Allow %q",
+					canonical.Code, canonical.Header().Get("Allow"), slashed.Code, slashed.Header().Get("Allow"))
+			}
+		})
+	}
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+	if code := get("/weather/codes/"); code != http.StatusOK {
+		t.Errorf("Expected status 200 for GET /weather/codes/, got %d", code)
+	}
+	for _, path := range []string{"/weather/unknown", "/weather/summary/unknown", "/stock/datadog/extra"} {
+		if code := get(path); code != http.StatusNotFound {
+			t.Errorf("Expected status 404 for %s, got %d", path, code)
+		}
+	}
+}
+
+func TestRouter_UnknownPath(t *testing.T) {
+	handler := NewRouter(DefaultConfig(), weather.NewService(testutils.NewMockHTTPClient()), stock.NewService(testutils.NewMockHTTPClient())).GetHandler()
+
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		t.Run(method, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(method, "/does-not-exist", nil))
+
+			if rec.Code != http.StatusNotFound {
+				t.Errorf("Expected status 404, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("Allow"); got != "" {
+				t.Errorf("Expected no Allow header, got %q", got)
+			}
+		})
+	}
+}
+
+func TestRouter_Pprof(t *testing.T) {
+	tests := []struct {
+		name       string
+		enable     bool
+		path       string
+		wantStatus int
+	}{
+		{"disabled by default", false, "/debug/pprof/", http.StatusNotFound},
+		{"index when enabled", true, "/debug/pprof/", http.StatusOK},
+		{"cmdline when enabled", true, "/debug/pprof/cmdline", http.StatusOK},
+		{"api still served when enabled", true, "/health", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.EnablePprof = tt.enable
+			handler := NewRouter(config, weather.NewService(testutils.NewMockHTTPClient()), stock.NewService(testutils.NewMockHTTPClient())).GetHandler()
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if tt.enable && strings.HasPrefix(tt.path, PprofPrefix) {
+				if got := rec.Header().Get("Content-Type"); strings.HasPrefix(got, "application/json") {
+					t.Errorf("Expected pprof to bypass the JSON content type, got %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		trusted    []string
+		want       string
+	}{
+		{"IPv4 with port", "192.0.2.10:54321", nil, nil, "192.0.2.10"},
+		{"IPv6 with port", "[::1]:54321", nil, nil, "::1"},
+		{"IPv6 without port", "2001:db8::1", nil, nil, "2001:db8::1"},
+		{"IPv4 without port", "192.0.2.10", nil, nil, "192.0.2.10"},
+		{"unparseable remote address", "pipe", nil, nil, "pipe"},
+		{
+			name:       "forwarded headers ignored when untrusted",
+			remoteAddr: "192.0.2.10:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Real-IP": "203.0.113.8"},
+			want:       "192.0.2.10",
+		},
+		{
+			name:       "right-most X-Forwarded-For entry when trusted",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7, 198.51.100.4"},
+			trusted:    DefaultTrustedProxyHeaders,
+			want:       "198.51.100.4",
+		},
+		{
+			name:       "spoofed left-most X-Forwarded-For entry is ignored",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.7"},
+			trusted:    DefaultTrustedProxyHeaders,
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "IPv6 X-Forwarded-For entry with port",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "[2001:db8::7]:443"},
+			trusted:    DefaultTrustedProxyHeaders,
+			want:       "2001:db8::7",
+		},
+		{
+			name:       "X-Real-IP when trusted",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Real-IP": "203.0.113.8"},
+			trusted:    DefaultTrustedProxyHeaders,
+			want:       "203.0.113.8",
+		},
+		{
+			name:       "invalid forwarded value falls back to RemoteAddr",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "not-an-ip"},
+			trusted:    DefaultTrustedProxyHeaders,
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "configured header when trusted",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"CF-Connecting-IP": "203.0.113.9"},
+			trusted:    []string{"CF-Connecting-IP"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "headers outside the trusted set are ignored",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7", "X-Real-IP": "203.0.113.8"},
+			trusted:    []string{"CF-Connecting-IP"},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "trusted headers are tried in order",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "203.0.113.7", "CF-Connecting-IP": "203.0.113.9"},
+			trusted:    []string{"CF-Connecting-IP", "X-Forwarded-For"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "configured list-valued header uses the right-most entry",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Original-Forwarded-For": "1.2.3.4, 203.0.113.9"},
+			trusted:    []string{"X-Original-Forwarded-For"},
+			want:       "203.0.113.9",
+		},
+		{
+			name:       "configured header names are case-insensitive",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"CF-Connecting-IP": "203.0.113.9"},
+			trusted:    []string{"cf-connecting-ip"},
+			want:       "203.0.113.9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			var got string
+			handler := ClientIPMiddleware(tt.trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = clientIP(r)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Errorf("Expected client IP %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("repeated X-Forwarded-For lines use the last entry", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Add("X-Forwarded-For", "203.0.113.7")
+		req.Header.Add("X-Forwarded-For", "1.2.3.4, 198.51.100.4")
+		if got := resolveClientIP(req, DefaultTrustedProxyHeaders); got != "198.51.100.4" {
+			t.Errorf("Expected client IP %q, got %q", "198.51.100.4", got)
+		}
+	})
+
+	t.Run("without the middleware", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "[::1]:54321"
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		if got := clientIP(req); got != "::1" {
+			t.Errorf("Expected client IP %q, got %q", "::1", got)
+		}
+	})
+}
+
+func TestRouter_Preflight(t *testing.T) {
+	config := DefaultConfig()
+	config.CORSOrigins = []string{"https://app.example.com"}
+	handler := NewRouter(config, weather.NewService(testutils.NewMockHTTPClient()), stock.NewService(testutils.NewMockHTTPClient())).GetHandler()
+
+	for _, path := range []string{"/weather", "/stock/datadog", "/health"} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, path, nil)
+			req.Header.Set("Origin", "https://app.example.com")
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusNoContent {
+				t.Fatalf("Expected status 204, got %d", rec.Code)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, http.MethodGet) {
+				t.Errorf("Expected Access-Control-Allow-Methods to include GET, got %q", got)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+				t.Errorf("Expected Access-Control-Allow-Origin to echo the origin, got %q", got)
+			}
+			if rec.Body.Len() != 0 {
+				t.Errorf("Expected an empty body, got %q", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRouter_Maintenance(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	config := DefaultConfig()
+	config.Maintenance = true
+	handler := NewRouter(config,
+		weather.NewService(mockClient, weather.WithMaintenance(true)),
+		stock.NewService(mockClient, stock.WithMaintenance(true)),
+	).GetHandler()
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{path: "/weather?city=Stuttgart", wantStatus: http.StatusOK, wantBody: weather.MaintenanceDemoSource},
+		{path: "/weather?city=Tokyo", wantStatus: http.StatusServiceUnavailable, wantBody: "maintenance mode"},
+		{path: "/stock?symbol=DDOG&fresh=true", wantStatus: http.StatusOK, wantBody: stock.MaintenanceDemoSource},
+		{path: "/stock?symbol=NFLX", wantStatus: http.StatusServiceUnavailable, wantBody: "maintenance mode"},
+		{path: "/stock/search?q=apple", wantStatus: http.StatusServiceUnavailable, wantBody: "maintenance mode"},
+		{path: "/health?deep=true", wantStatus: http.StatusOK, wantBody: `"maintenance":true`},
+		{path: "/health/ready", wantStatus: http.StatusOK, wantBody: `"maintenance":true`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if got := rec.Header().Get(MaintenanceHeader); got != "true" {
+				t.Errorf("Expected %s: true, got %q", MaintenanceHeader, got)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("Expected body to contain %q, got %s", tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+
+	if len(mockClient.CallCount) != 0 {
+		t.Errorf("Expected no upstream calls in maintenance mode, got %v", mockClient.CallCount)
+	}
+}
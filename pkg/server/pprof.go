@@ -0,0 +1,23 @@
+package server
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// PprofPrefix is the path under which the profiling endpoints are served
+const PprofPrefix = "/debug/pprof/"
+
+// pprofHandler serves the net/http/pprof endpoints on a private mux. Importing
+// net/http/pprof also registers them on http.DefaultServeMux; they stay
+// unexposed only because the server never serves DefaultServeMux, so that
+// must not change.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PprofPrefix, pprof.Index)
+	mux.HandleFunc(PprofPrefix+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(PprofPrefix+"profile", pprof.Profile)
+	mux.HandleFunc(PprofPrefix+"symbol", pprof.Symbol)
+	mux.HandleFunc(PprofPrefix+"trace", pprof.Trace)
+	return mux
+}
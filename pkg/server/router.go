@@ -14,8 +14,8 @@ type Router struct {
 }
 
 // NewRouter creates a new router with all routes configured
-func NewRouter(weatherService *weather.Service, stockService *stock.Service) *Router {
-	handler := NewHandler(weatherService, stockService)
+func NewRouter(config *Config, weatherService *weather.Service, stockService *stock.Service) *Router {
+	handler := NewHandler(config, weatherService, stockService)
 	mux := http.NewServeMux()
 
 	router := &Router{
@@ -29,77 +29,206 @@ func NewRouter(weatherService *weather.Service, stockService *stock.Service) *Ro
 
 // setupRoutes configures all the HTTP routes
 func (router *Router) setupRoutes() {
-	// Health check endpoint
-	router.mux.HandleFunc("/health", router.handler.HealthCheck)
+	// Health check endpoints (/health is an alias for liveness)
+	router.handle("/health", router.handler.HealthCheck, http.MethodGet)
+	router.handle("/health/live", router.handler.HealthCheck, http.MethodGet)
+	router.handle("/health/ready", router.handler.ReadinessCheck, http.MethodGet)
+	router.handle("/health/cache", router.handler.CacheHealthCheck, http.MethodGet)
 
 	// Weather endpoints
-	router.mux.HandleFunc("/weather", router.handler.GetWeather)
-	router.mux.HandleFunc("/weather/summary", router.handler.GetWeatherSummary)
+	router.handle("/weather", router.handler.GetWeather, http.MethodGet, http.MethodPost)
+	router.handle("/weather/summary", router.handler.GetWeatherSummary, http.MethodGet)
+	router.handle("/weather/detail", router.handler.GetWeatherDetail, http.MethodGet)
+	router.handle("/weather/coordinates", router.handler.GetWeatherByCoordinates, http.MethodGet)
+	router.handle("/weather/summary/batch", router.handler.GetWeatherSummaryBatch, http.MethodGet)
+	router.handle("/weather/batch", router.handler.GetWeatherBatch, http.MethodGet, http.MethodPost)
+	router.handle("/weather/cities", router.handler.GetWeatherCities, http.MethodGet)
+	router.handle("/weather/codes", router.handler.GetWeatherCodes, http.MethodGet)
+	router.handle("/weather/nearest", router.handler.GetNearestCity, http.MethodGet)
+	if router.handler.config.DebugEndpoints {
+		router.handle("/weather/raw", router.handler.GetWeatherRaw, http.MethodGet)
+	}
 
 	// Stock endpoints
-	router.mux.HandleFunc("/stock", router.handler.GetStock)
-	router.mux.HandleFunc("/stock/datadog", router.handler.GetDatadogStock)
-	router.mux.HandleFunc("/stock/summary", router.handler.GetStockSummary)
+	router.handle("/stock", router.handler.GetStock, http.MethodGet, http.MethodPost)
+	router.handle("/stock/datadog", router.handler.GetDatadogStock, http.MethodGet)
+	router.handle("/stock/search", router.handler.GetStockSearch, http.MethodGet)
+	router.handle("/stock/demo/symbols", router.handler.GetStockDemoSymbols, http.MethodGet)
+	router.handle("/stock/summary", router.handler.GetStockSummary, http.MethodGet)
+	router.handle("/stock/market-state", router.handler.GetStockMarketState, http.MethodGet)
+	router.handle("/stock/movers", router.handler.GetStockMovers, http.MethodGet)
+	router.handle("/stock/batch.csv", router.handler.GetStockBatchCSV, http.MethodGet)
+
+	// Combined endpoints
+	router.handle("/dashboard", router.handler.GetDashboard, http.MethodGet)
+
+	// Add a root endpoint for basic info. Every other path falls through to
+	// the catch-all, which answers 404 before any method check, so that
+	// POST /does-not-exist is a 404 rather than a 405.
+	router.mux.Handle("/{$}", MethodMiddleware(http.MethodGet)(http.HandlerFunc(router.rootHandler)))
+	router.mux.HandleFunc("/", http.NotFound)
+}
+
+// handle registers fn for path and for path with a trailing slash, answering
+// any method not listed in methods with a 405
+func (router *Router) handle(path string, fn http.HandlerFunc, methods ...string) {
+	handler := MethodMiddleware(methods...)(fn)
+	router.mux.Handle(path, handler)
 
-	// Add a root endpoint for basic info
-	router.mux.HandleFunc("/", router.rootHandler)
+	// A pattern ending in a slash would claim the whole subtree, e.g.
+	// /weather/ every unknown /weather/... path; {$} matches the slash only
+	router.mux.Handle(path+"/{$}", handler)
 }
 
 // rootHandler provides basic API information
 func (router *Router) rootHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		router.handler.writeErrorResponse(w, http.ErrNotSupported, http.StatusMethodNotAllowed)
-		return
+	endpoints := map[string]interface{}{
+		"health": map[string]string{
+			"method":      "GET",
+			"path":        "/health?deep=<bool>",
+			"description": "Health check endpoint (alias for liveness); deep=true also pings the upstreams",
+		},
+		"liveness": map[string]string{
+			"method":      "GET",
+			"path":        "/health/live",
+			"description": "Liveness probe, healthy while the process runs",
+		},
+		"readiness": map[string]string{
+			"method":      "GET",
+			"path":        "/health/ready",
+			"description": "Readiness probe, 503 when upstreams keep failing",
+		},
+		"cache_health": map[string]string{
+			"method":      "GET",
+			"path":        "/health/cache",
+			"description": "Size, hit and miss counts, and hit ratio of the weather, geocoding, and stock caches",
+		},
+		"weather": map[string]string{
+			"method":      "GET, POST",
+			"path":        "/weather?city=<city_name>&timezone=<zone>",
+			"description": "Get current weather for a city; timezone is optional (default auto, e.g. UTC or Europe/Berlin) and POST accepts {\"city\": \"<city_name>\", \"timezone\": \"<zone>\"}",
+			"example":     "/weather?city=Stuttgart",
+		},
+		"weather_summary": map[string]string{
+			"method":      "GET",
+			"path":        "/weather/summary?city=<city_name>",
+			"description": "Get weather summary for a city",
+			"example":     "/weather/summary?city=Stuttgart",
+		},
+		"weather_detail": map[string]string{
+			"method":      "GET",
+			"path":        "/weather/detail?city=<city_name>",
+			"description": "Get a multi-line weather summary listing every available metric",
+			"example":     "/weather/detail?city=Stuttgart",
+		},
+		"weather_coordinates": map[string]string{
+			"method":      "GET",
+			"path":        "/weather/coordinates?lat=<latitude>&lon=<longitude>",
+			"description": "Get current weather for a point; lat must be within [-90, 90] and lon within [-180, 180]",
+			"example":     "/weather/coordinates?lat=48.7758&lon=9.1829",
+		},
+		"weather_batch": map[string]string{
+			"method":      "GET, POST",
+			"path":        "/weather/batch?cities=<a,b,...>&limit=<n>&offset=<n>",
+			"description": "Get weather for several cities, paged in input order (limit defaults to 10, max 50; workers sets the concurrent fetches, default 5, max 10; timeout bounds each city, e.g. 5s, max 30s; POST accepts {\"cities\": [...]}; Accept: application/x-ndjson streams one result per line)",
+			"example":     "/weather/batch?cities=Stuttgart,Berlin&limit=1&offset=1",
+		},
+		"weather_summary_batch": map[string]string{
+			"method":      "GET",
+			"path":        "/weather/summary/batch?cities=<a,b,...>",
+			"description": "Get weather summaries for several cities as a map of city to summary (max 50; Accept: application/x-ndjson streams one result per line)",
+			"example":     "/weather/summary/batch?cities=Stuttgart,Berlin",
+		},
+		"weather_cities": map[string]string{
+			"method":      "GET",
+			"path":        "/weather/cities",
+			"description": "List cities that resolve without a geocoding request, sorted by name",
+			"example":     "/weather/cities",
+		},
+		"weather_codes": map[string]string{
+			"method":      "GET",
+			"path":        "/weather/codes",
+			"description": "List the weather codes with their conditions, descriptions, severities, and icon names, sorted by code",
+			"example":     "/weather/codes",
+		},
+		"weather_nearest": map[string]string{
+			"method":      "GET",
+			"path":        "/weather/nearest?lat=<latitude>&lon=<longitude>",
+			"description": "Name the city of the static table closest to a point, with its distance in kilometers",
+			"example":     "/weather/nearest?lat=48&lon=9",
+		},
+		"stock": map[string]string{
+			"method":      "GET, POST",
+			"path":        "/stock?symbol=<symbol>",
+			"description": "Get current stock price for a symbol (POST accepts {\"symbol\": \"<symbol>\"})",
+			"example":     "/stock?symbol=DDOG",
+		},
+		"stock_search": map[string]string{
+			"method":      "GET",
+			"path":        "/stock/search?q=<company name>",
+			"description": "Look up ticker symbols by company name",
+			"example":     "/stock/search?q=apple",
+		},
+		"stock_demo_symbols": map[string]string{
+			"method":      "GET",
+			"path":        "/stock/demo/symbols",
+			"description": "List the symbols available in demo mode with their company names, sorted by symbol",
+			"example":     "/stock/demo/symbols",
+		},
+		"datadog_stock": map[string]string{
+			"method":      "GET",
+			"path":        "/stock/datadog",
+			"description": "Get current Datadog stock price (accepts the query parameters of /stock, such as fresh=true)",
+		},
+		"dashboard": map[string]string{
+			"method":      "GET",
+			"path":        "/dashboard?city=<name>&symbol=<symbol>",
+			"description": "Get a city's weather and a stock quote in one call; either parameter may be omitted and a failed section carries an error",
+			"example":     "/dashboard?city=Stuttgart&symbol=DDOG",
+		},
+		"stock_market_state": map[string]string{
+			"method":      "GET",
+			"path":        "/stock/market-state?symbol=<symbol>",
+			"description": "Get only the market state of a stock and whether its market is open",
+			"example":     "/stock/market-state?symbol=DDOG",
+		},
+		"stock_summary": map[string]string{
+			"method":      "GET",
+			"path":        "/stock/summary?symbol=<symbol>",
+			"description": "Get stock summary for a symbol",
+			"example":     "/stock/summary?symbol=DDOG",
+		},
+		"stock_movers": map[string]string{
+			"method":      "GET",
+			"path":        "/stock/movers?symbols=<a,b,...>&limit=<n>",
+			"description": "Get top gainers and losers (defaults to the demo symbols and a limit of 3)",
+			"example":     "/stock/movers?limit=2",
+		},
+		"stock_batch_csv": map[string]string{
+			"method":      "GET",
+			"path":        "/stock/batch.csv?symbols=<a,b,...>",
+			"description": "Export quotes for up to 20 symbols as CSV",
+			"example":     "/stock/batch.csv?symbols=DDOG,AAPL",
+		},
 	}
-
-	if r.URL.Path != "/" {
-		http.NotFound(w, r)
-		return
+	if router.handler.config.DebugEndpoints {
+		endpoints["weather_raw"] = map[string]string{
+			"method":      "GET",
+			"path":        "/weather/raw?city=<city_name>",
+			"description": "Get the untransformed Open-Meteo payload for a city (debug)",
+			"example":     "/weather/raw?city=Stuttgart",
+		}
 	}
 
 	apiInfo := map[string]interface{}{
 		"service":     "Weather & Stock API",
-		"version":     "1.0.0",
+		"version":     router.handler.config.BuildInfo.Version,
+		"build":       router.handler.config.BuildInfo,
 		"description": "A simple API to get weather information and stock prices",
-		"endpoints": map[string]interface{}{
-			"health": map[string]string{
-				"method":      "GET",
-				"path":        "/health",
-				"description": "Health check endpoint",
-			},
-			"weather": map[string]string{
-				"method":      "GET",
-				"path":        "/weather?city=<city_name>",
-				"description": "Get current weather for a city",
-				"example":     "/weather?city=Stuttgart",
-			},
-			"weather_summary": map[string]string{
-				"method":      "GET",
-				"path":        "/weather/summary?city=<city_name>",
-				"description": "Get weather summary for a city",
-				"example":     "/weather/summary?city=Stuttgart",
-			},
-			"stock": map[string]string{
-				"method":      "GET",
-				"path":        "/stock?symbol=<symbol>",
-				"description": "Get current stock price for a symbol",
-				"example":     "/stock?symbol=DDOG",
-			},
-			"datadog_stock": map[string]string{
-				"method":      "GET",
-				"path":        "/stock/datadog",
-				"description": "Get current Datadog stock price",
-			},
-			"stock_summary": map[string]string{
-				"method":      "GET",
-				"path":        "/stock/summary?symbol=<symbol>",
-				"description": "Get stock summary for a symbol",
-				"example":     "/stock/summary?symbol=DDOG",
-			},
-		},
+		"endpoints":   endpoints,
 	}
 
-	router.handler.writeSuccessResponse(w, apiInfo)
+	router.handler.writeSuccessResponse(w, r, apiInfo)
 }
 
 // ServeHTTP implements the http.Handler interface
@@ -112,10 +241,46 @@ func (router *Router) GetHandler() http.Handler {
 	// Apply middleware in reverse order (last applied is executed first)
 	var handler http.Handler = router.mux
 	handler = SecurityMiddleware(handler)
+	handler = MaintenanceMiddleware(router.handler.config.Maintenance)(handler)
 	handler = ContentTypeMiddleware(handler)
-	handler = CORSMiddleware(handler)
+	handler = TimeoutMiddleware(router.handler.config.RequestTimeout)(handler)
+	handler = CORSMiddlewareWithOrigins(router.handler.config.CORSOrigins)(handler)
+	handler = RecoveryMiddleware(handler)
+	handler = TracingMiddleware(router.handler.config.Tracer)(handler)
+	handler = RequestSizeLimitMiddleware(router.handler.config.MaxURLBytes)(handler)
+
+	// The profiler bypasses the API middleware: its responses are not JSON
+	// and a CPU profile or trace may run longer than the request timeout
+	if router.handler.config.EnablePprof && router.handler.config.AdminPort <= 0 {
+		mux := http.NewServeMux()
+		mux.Handle(PprofPrefix, RecoveryMiddleware(pprofHandler()))
+		mux.Handle("/", handler)
+		handler = mux
+	}
+
+	handler = LoggingMiddleware(handler)
+	handler = ClientIPMiddleware(router.handler.config.ProxyHeaders())(handler)
+
+	return handler
+}
+
+// GetAdminHandler returns the handler served on the admin port: the health
+// checks, with deep checks allowed, and the profiler when it is enabled
+func (router *Router) GetAdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/health", MethodMiddleware(http.MethodGet)(http.HandlerFunc(router.handler.AdminHealthCheck)))
+	mux.Handle("/health/live", MethodMiddleware(http.MethodGet)(http.HandlerFunc(router.handler.AdminHealthCheck)))
+	mux.Handle("/health/ready", MethodMiddleware(http.MethodGet)(http.HandlerFunc(router.handler.ReadinessCheck)))
+	mux.Handle("/health/cache", MethodMiddleware(http.MethodGet)(http.HandlerFunc(router.handler.CacheHealthCheck)))
+	if router.handler.config.EnablePprof {
+		mux.Handle(PprofPrefix, pprofHandler())
+	}
+
+	var handler http.Handler = mux
+	handler = MaintenanceMiddleware(router.handler.config.Maintenance)(handler)
 	handler = RecoveryMiddleware(handler)
 	handler = LoggingMiddleware(handler)
+	handler = ClientIPMiddleware(router.handler.config.ProxyHeaders())(handler)
 
 	return handler
 }
@@ -4,22 +4,37 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/health"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/stock"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/tracing"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/weather"
 )
 
 // Server represents the HTTP server
 type Server struct {
 	httpServer     *http.Server
+	adminServer    *http.Server
 	weatherService *weather.Service
 	stockService   *stock.Service
 	router         *Router
+	certFile       string
+	keyFile        string
+
+	// running is set while the listener is accepting connections
+	running       atomic.Bool
+	addrLock      sync.RWMutex
+	listener      net.Listener
+	adminListener net.Listener
 }
 
 // Config holds server configuration
@@ -29,6 +44,133 @@ type Config struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+	CertFile     string
+	KeyFile      string
+
+	// BuildInfo is reported by the health and root endpoints
+	BuildInfo BuildInfo
+
+	// CORSOrigins lists allowed CORS origins; empty allows any origin
+	CORSOrigins []string
+
+	// TrustedProxyHeaders lists the forwarded headers, such as
+	// X-Forwarded-For or CF-Connecting-IP, the client address is taken from,
+	// tried in order. List-valued headers use their right-most entry, the
+	// one appended by the proxy in front of the server; entries further
+	// left come from the client. Only set it behind a reverse proxy that
+	// sets or appends to them, since clients can send these headers
+	// themselves.
+	TrustedProxyHeaders []string
+	// TrustProxyHeaders trusts DefaultTrustedProxyHeaders when
+	// TrustedProxyHeaders is empty
+	TrustProxyHeaders bool
+
+	// HealthTracker is shared with the services to derive readiness
+	HealthTracker *health.Tracker
+	// ReadinessMaxAge is how recent an upstream success must be, and how long
+	// a failing upstream may go without one, for /health/ready to report the
+	// service as ready
+	ReadinessMaxAge time.Duration
+
+	// RequestTimeout bounds how long a handler may run before a 503 is sent;
+	// zero uses WriteTimeout
+	RequestTimeout time.Duration
+
+	// Tracer records a span per request; nil disables tracing
+	Tracer tracing.Tracer
+
+	// DebugEndpoints exposes diagnostic endpoints such as /weather/raw
+	DebugEndpoints bool
+	// PrettyJSON indents response bodies unless a request asks otherwise
+	// with pretty=false; meant for development, as it enlarges responses
+	PrettyJSON bool
+
+	// EnablePprof serves the Go profiler under /debug/pprof/. The endpoints
+	// expose process internals and have no authentication of their own, so
+	// only enable them behind an authenticating proxy or on a private network.
+	EnablePprof bool
+
+	// AdminPort moves the operational endpoints (deep health checks and
+	// pprof) to a second listener on the same host, so they can be kept off
+	// the public network. Zero serves everything on Port.
+	AdminPort int
+
+	// MaxURLBytes is the longest request URL accepted before a 414 is sent;
+	// zero disables the limit
+	MaxURLBytes int
+
+	// Maintenance marks responses with the X-Maintenance-Mode header and
+	// reports the mode from the health checks. The weather and stock
+	// services must be put in maintenance mode as well, with their
+	// WithMaintenance options, to stop the upstream calls.
+	Maintenance bool
+}
+
+// Validate checks the configuration for inconsistent settings
+func (c *Config) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return fmt.Errorf("TLS requires both a certificate and a key file (cert: %q, key: %q)", c.CertFile, c.KeyFile)
+	}
+	for _, header := range c.TrustedProxyHeaders {
+		if !validHeaderName(header) {
+			return fmt.Errorf("invalid trusted proxy header %q", header)
+		}
+	}
+	return nil
+}
+
+// ProxyHeaders returns the forwarded headers the client address may be taken
+// from: TrustedProxyHeaders, or the defaults when only TrustProxyHeaders is set
+func (c *Config) ProxyHeaders() []string {
+	if len(c.TrustedProxyHeaders) > 0 {
+		return c.TrustedProxyHeaders
+	}
+	if c.TrustProxyHeaders {
+		return DefaultTrustedProxyHeaders
+	}
+	return nil
+}
+
+// DefaultMaxURLBytes is the default limit on the request URL length
+const DefaultMaxURLBytes = 8 * 1024
+
+// BindAllHost is the host that listens on every IPv4 interface
+const BindAllHost = "0.0.0.0"
+
+// IsPublic reports whether the host listens on all interfaces rather than a
+// specific address such as loopback
+func (c *Config) IsPublic() bool {
+	if c.Host == "" {
+		return true
+	}
+	ip := net.ParseIP(c.Host)
+	return ip != nil && ip.IsUnspecified()
+}
+
+// CheckHost verifies that the host is an IP address or resolves to one, so a
+// typo fails at startup with a clear message instead of at listen time
+func (c *Config) CheckHost() error {
+	if c.Host == "" || net.ParseIP(c.Host) != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hostLookupTimeout)
+	defer cancel()
+
+	if _, err := net.DefaultResolver.LookupHost(ctx, c.Host); err != nil {
+		return fmt.Errorf("server host %q does not resolve: %v", c.Host, err)
+	}
+	return nil
+}
+
+// hostLookupTimeout bounds the DNS lookup done by CheckHost
+const hostLookupTimeout = 5 * time.Second
+
+// BuildInfo describes the version of the running binary
+type BuildInfo struct {
+	Version   string `json:"version" xml:"version"`
+	BuildTime string `json:"build_time" xml:"build_time"`
+	GitCommit string `json:"git_commit" xml:"git_commit"`
 }
 
 // DefaultConfig returns default server configuration
@@ -39,6 +181,14 @@ func DefaultConfig() *Config {
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		BuildInfo: BuildInfo{
+			Version:   "1.0.0",
+			BuildTime: "development",
+			GitCommit: "unknown",
+		},
+
+		ReadinessMaxAge: 5 * time.Minute,
+		MaxURLBytes:     DefaultMaxURLBytes,
 	}
 }
 
@@ -48,27 +198,119 @@ func NewServer(config *Config, weatherService *weather.Service, stockService *st
 		config = DefaultConfig()
 	}
 
-	router := NewRouter(weatherService, stockService)
+	routerConfig := *config
+	if routerConfig.ReadinessMaxAge <= 0 {
+		routerConfig.ReadinessMaxAge = DefaultConfig().ReadinessMaxAge
+	}
+	if routerConfig.RequestTimeout <= 0 {
+		routerConfig.RequestTimeout = config.WriteTimeout
+	}
+
+	router := NewRouter(&routerConfig, weatherService, stockService)
 
 	server := &Server{
 		weatherService: weatherService,
 		stockService:   stockService,
 		router:         router,
+		certFile:       config.CertFile,
+		keyFile:        config.KeyFile,
 	}
 
 	server.httpServer = &http.Server{
-		Addr:         fmt.Sprintf("%s:%d", config.Host, config.Port),
+		Addr:         net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
 		Handler:      router.GetHandler(),
 		ReadTimeout:  config.ReadTimeout,
 		WriteTimeout: config.WriteTimeout,
 		IdleTimeout:  config.IdleTimeout,
 	}
 
+	if config.AdminPort > 0 {
+		// No write timeout, so CPU profiles and traces can run their full duration
+		server.adminServer = &http.Server{
+			Addr:        net.JoinHostPort(config.Host, strconv.Itoa(config.AdminPort)),
+			Handler:     router.GetAdminHandler(),
+			ReadTimeout: config.ReadTimeout,
+			IdleTimeout: config.IdleTimeout,
+		}
+	}
+
 	return server
 }
 
 // Start starts the HTTP server
 func (s *Server) Start() error {
+	s.logStartup()
+
+	ln, err := s.listen()
+	if err != nil {
+		return err
+	}
+	defer s.running.Store(false)
+
+	return s.httpServer.Serve(ln)
+}
+
+// StartTLS starts the HTTPS server using the configured certificate and key
+func (s *Server) StartTLS() error {
+	s.logStartup()
+	log.Printf("  TLS certificate: %s", s.certFile)
+
+	ln, err := s.listen()
+	if err != nil {
+		return err
+	}
+	defer s.running.Store(false)
+
+	return s.httpServer.ServeTLS(ln, s.certFile, s.keyFile)
+}
+
+// listen opens the TCP listener and marks the server as running
+func (s *Server) listen() (net.Listener, error) {
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.startAdmin(); err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("admin listener: %w", err)
+	}
+
+	s.addrLock.Lock()
+	s.listener = ln
+	s.addrLock.Unlock()
+
+	s.running.Store(true)
+	log.Printf("Server is accepting connections on %s", ln.Addr())
+	return ln, nil
+}
+
+// startAdmin opens the admin listener and serves it in the background. The
+// admin port is always plain HTTP since it is meant for a private network.
+func (s *Server) startAdmin() error {
+	if s.adminServer == nil {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", s.adminServer.Addr)
+	if err != nil {
+		return err
+	}
+
+	s.addrLock.Lock()
+	s.adminListener = ln
+	s.addrLock.Unlock()
+
+	log.Printf("Admin endpoints are accepting connections on %s", ln.Addr())
+	go func() {
+		if err := s.adminServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("Admin server failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+// logStartup prints the server configuration and available endpoints
+func (s *Server) logStartup() {
 	log.Printf("Starting server on %s", s.httpServer.Addr)
 	log.Printf("Server configuration:")
 	log.Printf("  Read timeout: %v", s.httpServer.ReadTimeout)
@@ -77,8 +319,11 @@ func (s *Server) Start() error {
 
 	// Print available endpoints
 	s.printAvailableEndpoints()
+}
 
-	return s.httpServer.ListenAndServe()
+// tlsEnabled reports whether the server should serve HTTPS
+func (s *Server) tlsEnabled() bool {
+	return s.certFile != "" && s.keyFile != ""
 }
 
 // StartWithGracefulShutdown starts the server with graceful shutdown support
@@ -89,7 +334,11 @@ func (s *Server) StartWithGracefulShutdown() error {
 
 	// Start server in a goroutine
 	go func() {
-		if err := s.Start(); err != nil && err != http.ErrServerClosed {
+		start := s.Start
+		if s.tlsEnabled() {
+			start = s.StartTLS
+		}
+		if err := start(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server failed to start: %v", err)
 		}
 	}()
@@ -106,32 +355,114 @@ func (s *Server) StartWithGracefulShutdown() error {
 	return s.Shutdown(ctx)
 }
 
-// Shutdown gracefully shuts down the server
+// Shutdown gracefully shuts down the server and the admin server, if any
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.httpServer.Shutdown(ctx)
+	s.running.Store(false)
+
+	err := s.httpServer.Shutdown(ctx)
+	if s.adminServer != nil {
+		if adminErr := s.adminServer.Shutdown(ctx); err == nil {
+			err = adminErr
+		}
+	}
+	return err
+}
+
+// RegisterOnShutdown registers f to be called when Shutdown starts, for
+// stopping background work tied to the server's lifetime
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.httpServer.RegisterOnShutdown(f)
 }
 
 // printAvailableEndpoints prints all available API endpoints
 func (s *Server) printAvailableEndpoints() {
-	baseURL := fmt.Sprintf("http://%s", s.httpServer.Addr)
+	scheme := "http"
+	if s.tlsEnabled() {
+		scheme = "https"
+	}
+	baseURL := fmt.Sprintf("%s://%s", scheme, s.httpServer.Addr)
 
 	log.Println("Available endpoints:")
 	log.Printf("  GET %s/                    - API information", baseURL)
-	log.Printf("  GET %s/health              - Health check", baseURL)
+	log.Printf("  GET %s/health              - Health check (liveness)", baseURL)
+	log.Printf("  GET %s/health?deep=true    - Health check that pings the upstreams", baseURL)
+	log.Printf("  GET %s/health/live         - Liveness probe", baseURL)
+	log.Printf("  GET %s/health/ready        - Readiness probe", baseURL)
+	log.Printf("  GET %s/health/cache        - Cache sizes, hits, misses, and hit ratios", baseURL)
 	log.Printf("  GET %s/weather?city=<name> - Get weather (example: ?city=Stuttgart)", baseURL)
 	log.Printf("  GET %s/weather/summary?city=<name> - Get weather summary", baseURL)
+	log.Printf("  GET %s/weather/detail?city=<name> - Get multi-line weather detail", baseURL)
+	log.Printf("  GET %s/weather/coordinates?lat=<lat>&lon=<lon> - Get weather for a point", baseURL)
+	log.Printf("  GET %s/weather/batch?cities=<a,b>&limit=<n>&offset=<n> - Get paged weather for several cities", baseURL)
+	log.Printf("  GET %s/weather/codes       - List weather codes with conditions and icons", baseURL)
+	log.Printf("  GET %s/weather/nearest?lat=<lat>&lon=<lon> - Name the closest known city", baseURL)
+	if s.router.handler.config.DebugEndpoints {
+		log.Printf("  GET %s/weather/raw?city=<name> - Get the untransformed Open-Meteo payload (debug)", baseURL)
+	}
+	if s.adminServer != nil {
+		adminURL := fmt.Sprintf("http://%s", s.adminServer.Addr)
+		log.Printf("  GET %s/health?deep=true - Deep health check (admin port)", adminURL)
+		if s.router.handler.config.EnablePprof {
+			log.Printf("  GET %s%s - Go profiler (admin port)", adminURL, PprofPrefix)
+		}
+	} else if s.router.handler.config.EnablePprof {
+		log.Printf("  GET %s%s        - Go profiler (pprof)", baseURL, PprofPrefix)
+	}
 	log.Printf("  GET %s/stock?symbol=<sym>  - Get stock price (example: ?symbol=DDOG)", baseURL)
+	log.Printf("  POST %s/weather {\"city\": \"<name>\"} - Get weather from a JSON body", baseURL)
+	log.Printf("  POST %s/stock {\"symbol\": \"<sym>\"} - Get stock price from a JSON body", baseURL)
 	log.Printf("  GET %s/stock/datadog       - Get Datadog stock price", baseURL)
+	log.Printf("  GET %s/stock/search?q=<name> - Look up symbols by company name", baseURL)
+	log.Printf("  GET %s/stock/demo/symbols  - List the demo-mode symbols", baseURL)
 	log.Printf("  GET %s/stock/summary?symbol=<sym> - Get stock summary", baseURL)
+	log.Printf("  GET %s/stock/market-state?symbol=<sym> - Get whether the market is open", baseURL)
+	log.Printf("  GET %s/stock/movers        - Get top gainers and losers", baseURL)
+	log.Printf("  GET %s/stock/batch.csv?symbols=<a,b> - Export quotes as CSV", baseURL)
+	log.Printf("  GET %s/dashboard?city=<name>&symbol=<sym> - Get weather and a stock quote together", baseURL)
 	log.Println()
 }
 
-// GetAddr returns the server address
+// GetAddr returns the server address, resolved to the actual listener
+// address (e.g. the chosen port when configured with port 0) once started
 func (s *Server) GetAddr() string {
+	s.addrLock.RLock()
+	defer s.addrLock.RUnlock()
+
+	if s.listener != nil {
+		return s.listener.Addr().String()
+	}
 	return s.httpServer.Addr
 }
 
-// IsRunning checks if the server is running (simplified check)
+// GetAdminAddr returns the admin server address, resolved to the actual
+// listener address once started, or "" when no admin port is configured
+func (s *Server) GetAdminAddr() string {
+	if s.adminServer == nil {
+		return ""
+	}
+
+	s.addrLock.RLock()
+	defer s.addrLock.RUnlock()
+
+	if s.adminListener != nil {
+		return s.adminListener.Addr().String()
+	}
+	return s.adminServer.Addr
+}
+
+// IsRunning reports whether the server is currently accepting connections
 func (s *Server) IsRunning() bool {
-	return s.httpServer != nil
+	return s.running.Load()
+}
+
+// WaitUntilReady blocks until the server is accepting connections or the timeout elapses
+func (s *Server) WaitUntilReady(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !s.IsRunning() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("server not ready after %v", timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
 }
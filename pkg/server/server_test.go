@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/internal/testutils"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/stock"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/weather"
+)
+
+func TestServer_Lifecycle(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	config := DefaultConfig()
+	config.Host = "127.0.0.1"
+	config.Port = 0
+
+	srv := NewServer(config, weather.NewService(mockClient), stock.NewService(mockClient))
+
+	if srv.IsRunning() {
+		t.Errorf("Expected server not to be running before start")
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.Start()
+	}()
+
+	if err := srv.WaitUntilReady(2 * time.Second); err != nil {
+		t.Fatalf("Server did not become ready: %v", err)
+	}
+
+	if !srv.IsRunning() {
+		t.Errorf("Expected server to be running after WaitUntilReady")
+	}
+
+	resp, err := http.Get("http://" + srv.GetAddr() + "/health")
+	if err != nil {
+		t.Fatalf("Unexpected error calling running server: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected shutdown error: %v", err)
+	}
+
+	if err := <-errChan; err != http.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+
+	if srv.IsRunning() {
+		t.Errorf("Expected server not to be running after shutdown")
+	}
+}
+
+func TestServer_AdminPort(t *testing.T) {
+	// Reserve a free port for the admin listener, which cannot use port 0
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve a port: %v", err)
+	}
+	adminPort := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	mockClient := testutils.NewMockHTTPClient()
+	config := DefaultConfig()
+	config.Host = "127.0.0.1"
+	config.Port = 0
+	config.AdminPort = adminPort
+	config.EnablePprof = true
+
+	srv := NewServer(config, weather.NewService(mockClient), stock.NewService(mockClient))
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- srv.Start()
+	}()
+
+	if err := srv.WaitUntilReady(2 * time.Second); err != nil {
+		t.Fatalf("Server did not become ready: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+	}{
+		{"api on main port", "http://" + srv.GetAddr() + "/health", http.StatusOK},
+		{"no pprof on main port", "http://" + srv.GetAddr() + "/debug/pprof/", http.StatusNotFound},
+		{"no deep health on main port", "http://" + srv.GetAddr() + "/health?deep=true", http.StatusForbidden},
+		{"health on admin port", "http://" + srv.GetAdminAddr() + "/health", http.StatusOK},
+		{"pprof on admin port", "http://" + srv.GetAdminAddr() + "/debug/pprof/", http.StatusOK},
+		{"no api on admin port", "http://" + srv.GetAdminAddr() + "/weather?city=Stuttgart", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(tt.url)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected shutdown error: %v", err)
+	}
+	if err := <-errChan; err != http.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+	if _, err := http.Get("http://" + srv.GetAdminAddr() + "/health"); err == nil {
+		t.Errorf("Expected the admin port to be closed after shutdown")
+	}
+}
+
+func TestServer_WaitUntilReadyTimeout(t *testing.T) {
+	srv := NewServer(DefaultConfig(), weather.NewService(nil), stock.NewService(nil))
+
+	start := time.Now()
+	if err := srv.WaitUntilReady(50 * time.Millisecond); err == nil {
+		t.Errorf("Expected timeout error for a server that was never started")
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected WaitUntilReady to return promptly, took %v", elapsed)
+	}
+}
+
+func TestConfig_HostChecks(t *testing.T) {
+	tests := []struct {
+		host       string
+		wantPublic bool
+		wantError  bool
+	}{
+		{host: "localhost"},
+		{host: "127.0.0.1"},
+		{host: "::1"},
+		{host: BindAllHost, wantPublic: true},
+		{host: "::", wantPublic: true},
+		{host: "", wantPublic: true},
+		{host: "no-such-host.invalid", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			config := DefaultConfig()
+			config.Host = tt.host
+
+			if got := config.IsPublic(); got != tt.wantPublic {
+				t.Errorf("IsPublic() = %v, want %v", got, tt.wantPublic)
+			}
+			if err := config.CheckHost(); (err != nil) != tt.wantError {
+				t.Errorf("CheckHost() error = %v, wantError %v", err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestConfig_ProxyHeaders(t *testing.T) {
+	tests := []struct {
+		name      string
+		trust     bool
+		headers   []string
+		want      []string
+		wantError bool
+	}{
+		{name: "nothing trusted by default"},
+		{name: "legacy switch trusts the defaults", trust: true, want: DefaultTrustedProxyHeaders},
+		{name: "explicit list", headers: []string{"CF-Connecting-IP"}, want: []string{"CF-Connecting-IP"}},
+		{name: "explicit list wins over the switch", trust: true, headers: []string{"CF-Connecting-IP"}, want: []string{"CF-Connecting-IP"}},
+		{name: "invalid header name", headers: []string{"X-Forwarded-For:"}, wantError: true},
+		{name: "empty header name", headers: []string{""}, wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.TrustProxyHeaders = tt.trust
+			config.TrustedProxyHeaders = tt.headers
+
+			if err := config.Validate(); (err != nil) != tt.wantError {
+				t.Fatalf("Validate() error = %v, wantError %v", err, tt.wantError)
+			}
+			if tt.wantError {
+				return
+			}
+			if got := config.ProxyHeaders(); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Expected proxy headers %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewServer_IPv6Addr(t *testing.T) {
+	config := DefaultConfig()
+	config.Host = "::"
+	config.Port = 8080
+
+	srv := NewServer(config, weather.NewService(nil), stock.NewService(nil))
+	if got := srv.GetAddr(); got != "[::]:8080" {
+		t.Errorf("Expected [::]:8080, got %s", got)
+	}
+}
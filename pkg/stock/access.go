@@ -0,0 +1,58 @@
+package stock
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+)
+
+// WithAllowedSymbols restricts quotes to the given symbols; other symbols
+// are rejected with a 403. No symbols allows every symbol.
+func WithAllowedSymbols(symbols ...string) Option {
+	return func(s *Service) {
+		s.allowedSymbols = symbolSet(symbols)
+	}
+}
+
+// WithDeniedSymbols rejects quotes for the given symbols with a 403, even
+// when they are also allowed
+func WithDeniedSymbols(symbols ...string) Option {
+	return func(s *Service) {
+		s.deniedSymbols = symbolSet(symbols)
+	}
+}
+
+// symbolSet normalizes symbols into a set, or nil when there are none
+func symbolSet(symbols []string) map[string]bool {
+	var set map[string]bool
+	for _, symbol := range symbols {
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		if symbol == "" {
+			continue
+		}
+		if set == nil {
+			set = make(map[string]bool)
+		}
+		set[symbol] = true
+	}
+	return set
+}
+
+// checkSymbolAccess validates symbol and rejects it with a 403 APIError when
+// it is denied or missing from a non-empty allowlist. Without either list
+// every symbol passes unchecked, leaving validation to the client.
+func (s *Service) checkSymbolAccess(symbol string) error {
+	if s.allowedSymbols == nil && s.deniedSymbols == nil {
+		return nil
+	}
+	if err := s.client.ValidateSymbol(symbol); err != nil {
+		return err
+	}
+
+	key := strings.ToUpper(strings.TrimSpace(symbol))
+	if s.deniedSymbols[key] || (s.allowedSymbols != nil && !s.allowedSymbols[key]) {
+		return models.NewAPIError("Stock", fmt.Sprintf("Symbol %s is not available on this server", key), 403)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package stock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/httpclient"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+)
+
+// DefaultAlertCooldown is the least time between two webhooks for the same
+// rule, so a change hovering around the threshold does not flood it
+const DefaultAlertCooldown = 15 * time.Minute
+
+// DefaultAlertTimeout bounds each webhook request, so a webhook that never
+// answers cannot hold up background refresh
+const DefaultAlertTimeout = 10 * time.Second
+
+// AlertUserAgent identifies this service to webhooks; they get none of the
+// browser headers sent to Yahoo Finance
+const AlertUserAgent = "weather-stock-api-alerts (+https://github.com/JSGette/agent_summit_bazel_workshop)"
+
+// AlertRule posts the quote of Symbol to WebhookURL when its daily change
+// crosses ThresholdPercent: rising to or above a positive threshold, or
+// falling to or below a negative one
+type AlertRule struct {
+	Symbol           string  `json:"symbol"`
+	ThresholdPercent float64 `json:"threshold_percent"`
+	WebhookURL       string  `json:"webhook_url"`
+}
+
+// triggered reports whether changePercent is past the rule's threshold
+func (r AlertRule) triggered(changePercent float64) bool {
+	if r.ThresholdPercent < 0 {
+		return changePercent <= r.ThresholdPercent
+	}
+	return changePercent >= r.ThresholdPercent
+}
+
+// validate normalizes the rule's symbol and checks its threshold and webhook
+func (r *AlertRule) validate() error {
+	r.Symbol = strings.ToUpper(strings.TrimSpace(r.Symbol))
+	if r.Symbol == "" {
+		return fmt.Errorf("alert rule without a symbol")
+	}
+	if r.ThresholdPercent == 0 {
+		return fmt.Errorf("alert rule for %s: threshold_percent must not be zero", r.Symbol)
+	}
+	parsed, err := url.Parse(r.WebhookURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("alert rule for %s: invalid webhook_url %q", r.Symbol, r.WebhookURL)
+	}
+	return nil
+}
+
+// LoadAlertRules reads alert rules from a JSON file holding an array of
+// rules, e.g. [{"symbol": "DDOG", "threshold_percent": -5, "webhook_url":
+// "https://example.com/hook"}]
+func LoadAlertRules(path string) ([]AlertRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading alert rules: %w", err)
+	}
+
+	var rules []AlertRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("alerts file %s: %w", path, err)
+	}
+	for i := range rules {
+		if err := rules[i].validate(); err != nil {
+			return nil, fmt.Errorf("alerts file %s: %w", path, err)
+		}
+	}
+	return rules, nil
+}
+
+// WithAlertRules evaluates rules against the quotes fetched by background
+// refresh, which also refreshes the rules' symbols. Rules are expected to be
+// valid, as LoadAlertRules returns them.
+func WithAlertRules(rules ...AlertRule) Option {
+	return func(s *Service) {
+		s.alerts.rules = append([]AlertRule(nil), rules...)
+		s.alerts.state = make([]alertState, len(rules))
+	}
+}
+
+// WithAlertCooldown sets the least time between two webhooks for the same
+// rule; zero only debounces by requiring the change to fall back past the
+// threshold first
+func WithAlertCooldown(cooldown time.Duration) Option {
+	return func(s *Service) {
+		s.alerts.cooldown = cooldown
+	}
+}
+
+// WithAlertTimeout bounds each webhook request; zero or less keeps
+// DefaultAlertTimeout
+func WithAlertTimeout(timeout time.Duration) Option {
+	return func(s *Service) {
+		if timeout > 0 {
+			s.alerts.timeout = timeout
+		}
+	}
+}
+
+// WithAlertHTTPClient sends webhook requests through client instead of the
+// default one, which sends only AlertUserAgent
+func WithAlertHTTPClient(client HTTPClient) Option {
+	return func(s *Service) {
+		s.alerts.client = client
+	}
+}
+
+// newAlertHTTPClient returns the default client for webhook requests
+func newAlertHTTPClient() HTTPClient {
+	return httpclient.New(
+		httpclient.Headers(http.Header{"User-Agent": {AlertUserAgent}}),
+		httpclient.Timeout(DefaultAlertTimeout),
+	)
+}
+
+// alertEvaluator holds the alert rules and when each last fired
+type alertEvaluator struct {
+	rules    []AlertRule
+	cooldown time.Duration
+	timeout  time.Duration
+	client   HTTPClient
+
+	mutex sync.Mutex
+	state []alertState
+}
+
+// alertState tracks one rule between evaluations
+type alertState struct {
+	// active is set once the rule fired and until the change falls back
+	// past the threshold
+	active    bool
+	lastFired time.Time
+}
+
+// alertSymbols returns the symbols watched by alert rules
+func (s *Service) alertSymbols() []string {
+	symbols := make([]string, 0, len(s.alerts.rules))
+	for _, rule := range s.alerts.rules {
+		symbols = append(symbols, rule.Symbol)
+	}
+	return symbols
+}
+
+// evaluateAlerts fires the webhook of every rule for stock that has just
+// crossed its threshold. A rule fires once per crossing and at most once per
+// cooldown; a failed webhook is retried on the next evaluation. Demo data is
+// never alerted on. Webhook requests are canceled when ctx is done.
+func (s *Service) evaluateAlerts(ctx context.Context, stock *models.StockResponse) {
+	if len(s.alerts.rules) == 0 || stock.Metadata.Source == DemoSource {
+		return
+	}
+
+	now := s.clock.Now()
+	for i, rule := range s.alerts.rules {
+		if rule.Symbol != stock.Symbol {
+			continue
+		}
+
+		s.alerts.mutex.Lock()
+		state := &s.alerts.state[i]
+		due := false
+		switch {
+		case !rule.triggered(stock.ChangePercent):
+			state.active = false
+		case state.active:
+		case !state.lastFired.IsZero() && now.Sub(state.lastFired) < s.alerts.cooldown:
+		default:
+			due = true
+		}
+		s.alerts.mutex.Unlock()
+		if !due {
+			continue
+		}
+
+		if err := s.postAlert(ctx, rule, stock); err != nil {
+			logging.Warnf("Alert webhook for %s failed: %v", rule.Symbol, err)
+			continue
+		}
+		logging.Infof("Alert fired for %s: change %.2f%% crossed %.2f%%", rule.Symbol, stock.ChangePercent, rule.ThresholdPercent)
+
+		s.alerts.mutex.Lock()
+		state.active = true
+		state.lastFired = now
+		s.alerts.mutex.Unlock()
+	}
+}
+
+// postAlert sends stock as JSON to the webhook of rule, giving up after the
+// alert timeout or when ctx is done
+func (s *Service) postAlert(ctx context.Context, rule AlertRule, stock *models.StockResponse) error {
+	body, err := json.Marshal(stock)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.alerts.timeout)
+	defer cancel()
+	resp, err := httpclient.PostCtx(ctx, s.alerts.client, rule.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -1,60 +1,262 @@
 package stock
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/httpclient"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/tracing"
 )
 
 // HTTPClient interface for dependency injection and testing
-type HTTPClient interface {
-	Get(url string) (*http.Response, error)
+type HTTPClient = httpclient.HTTPClient
+
+// ContextHTTPClient is an HTTPClient whose requests can be canceled through a context
+type ContextHTTPClient = httpclient.ContextHTTPClient
+
+// DefaultUserAgent is the browser User-Agent sent to Yahoo Finance by default
+const DefaultUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36"
+
+// DefaultHeaders returns the browser-like headers sent with quote requests
+// by default to avoid being blocked
+func DefaultHeaders() http.Header {
+	return http.Header{
+		"User-Agent":      {DefaultUserAgent},
+		"Accept":          {"application/json,text/plain,*/*"},
+		"Accept-Language": {"en-US,en;q=0.9"},
+		"Cache-Control":   {"no-cache"},
+		"Pragma":          {"no-cache"},
+	}
 }
 
-// DefaultHTTPClient wraps the standard http.Client with proper headers
-type DefaultHTTPClient struct{}
+// DefaultHTTPClient is an httpclient.Client sending browser-like headers.
+// The zero value sends DefaultHeaders. Cookies set by responses are kept and
+// sent with later requests, as the crumb handshake requires.
+type DefaultHTTPClient struct {
+	headers http.Header
+
+	once   sync.Once
+	client *httpclient.Client
+}
+
+// NewDefaultHTTPClientWithHeaders returns a client that sends headers with
+// every request instead of DefaultHeaders
+func NewDefaultHTTPClientWithHeaders(headers http.Header) *DefaultHTTPClient {
+	return &DefaultHTTPClient{headers: headers.Clone()}
+}
+
+// shared returns the client sending the configured headers and keeping
+// cookies
+func (c *DefaultHTTPClient) shared() *httpclient.Client {
+	c.once.Do(func() {
+		headers := c.headers
+		if headers == nil {
+			headers = DefaultHeaders()
+		}
+		c.client = httpclient.New(httpclient.Headers(headers), httpclient.Cookies(true))
+	})
+	return c.client
+}
 
 func (c *DefaultHTTPClient) Get(url string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
+	return c.shared().Get(url)
+}
 
-	// Add headers to avoid being blocked
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	req.Header.Set("Accept", "application/json,text/plain,*/*")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
-	req.Header.Set("Cache-Control", "no-cache")
-	req.Header.Set("Pragma", "no-cache")
+// GetWithContext performs a GET request that is canceled when ctx is done
+func (c *DefaultHTTPClient) GetWithContext(ctx context.Context, url string) (*http.Response, error) {
+	return c.shared().GetWithContext(ctx, url)
+}
+
+// Post sends body as a POST request of the given content type, e.g. to a
+// webhook
+func (c *DefaultHTTPClient) Post(url, contentType string, body io.Reader) (*http.Response, error) {
+	return c.shared().Post(url, contentType, body)
+}
 
-	client := &http.Client{}
-	return client.Do(req)
+// PostWithContext is Post with a request that is canceled when ctx is done
+func (c *DefaultHTTPClient) PostWithContext(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	return c.shared().PostWithContext(ctx, url, contentType, body)
 }
 
+// Default Yahoo Finance quote endpoints. Yahoo serves the same API from the
+// query1 and query2 hosts, so the second one is used for failover.
+const (
+	DefaultBaseURL         = "https://query1.finance.yahoo.com/v7/finance/quote"
+	DefaultFallbackBaseURL = "https://query2.finance.yahoo.com/v7/finance/quote"
+)
+
+// DefaultSearchURL is the Yahoo Finance endpoint used to look up symbols by
+// company name
+const DefaultSearchURL = "https://query1.finance.yahoo.com/v1/finance/search"
+
+// DefaultChartURL is the Yahoo Finance endpoint serving price histories; the
+// symbol is appended as a path segment
+const DefaultChartURL = "https://query1.finance.yahoo.com/v8/finance/chart"
+
 // Client handles stock API requests
 type Client struct {
-	httpClient HTTPClient
-	baseURL    string
+	httpClient      HTTPClient
+	baseURL         string
+	fallbackBaseURL string
+	searchURL       string
+	chartURL        string
+	tracer          tracing.Tracer
+	// maxResponseBytes caps the size of a decoded response body
+	maxResponseBytes int
+	// conversion controls how quotes are normalized
+	conversion models.StockConversionOptions
+
+	// crumbHandshake adds a session crumb to quote requests; crumb caches
+	// it, guarded by crumbMutex
+	crumbHandshake bool
+	cookieURL      string
+	crumbURL       string
+	crumbMutex     sync.Mutex
+	crumb          string
+}
+
+// ClientOption configures optional client behavior
+type ClientOption func(*Client)
+
+// BaseURL sets the primary quote endpoint
+func BaseURL(baseURL string) ClientOption {
+	return func(c *Client) {
+		c.baseURL = baseURL
+	}
+}
+
+// FallbackBaseURL sets the quote endpoint tried when the primary one fails
+// with a connection error or a 5xx response; an empty URL disables failover
+func FallbackBaseURL(baseURL string) ClientOption {
+	return func(c *Client) {
+		c.fallbackBaseURL = baseURL
+	}
+}
+
+// SearchURL sets the symbol search endpoint
+func SearchURL(searchURL string) ClientOption {
+	return func(c *Client) {
+		c.searchURL = searchURL
+	}
+}
+
+// ChartURL sets the price history endpoint
+func ChartURL(chartURL string) ClientOption {
+	return func(c *Client) {
+		c.chartURL = chartURL
+	}
+}
+
+// MaxResponseBytes caps the size of response bodies read from Yahoo Finance;
+// zero or less uses models.DefaultMaxResponseBytes
+func MaxResponseBytes(n int) ClientOption {
+	return func(c *Client) {
+		c.maxResponseBytes = n
+	}
+}
+
+// RepairChangePercentSign recomputes the change percent of quotes whose
+// change and change percent disagree in sign
+func RepairChangePercentSign(repair bool) ClientOption {
+	return func(c *Client) {
+		c.conversion.RepairChangePercentSign = repair
+	}
+}
+
+// Decimals sets how many decimal places prices and changes are rounded to; a
+// negative value keeps the upstream precision
+func Decimals(n int) ClientOption {
+	return func(c *Client) {
+		c.conversion.Decimals = n
+	}
 }
 
 // NewClient creates a new stock client
-func NewClient(httpClient HTTPClient) *Client {
+func NewClient(httpClient HTTPClient, opts ...ClientOption) *Client {
 	if httpClient == nil {
 		httpClient = &DefaultHTTPClient{}
 	}
 
-	return &Client{
-		httpClient: httpClient,
-		baseURL:    "https://query1.finance.yahoo.com/v7/finance/quote",
+	client := &Client{
+		httpClient:       httpClient,
+		baseURL:          DefaultBaseURL,
+		fallbackBaseURL:  DefaultFallbackBaseURL,
+		searchURL:        DefaultSearchURL,
+		chartURL:         DefaultChartURL,
+		maxResponseBytes: models.DefaultMaxResponseBytes,
+		conversion:       models.StockConversionOptions{Decimals: models.DefaultStockDecimals},
+		tracer:           tracing.NoopTracer{},
+		cookieURL:        DefaultCookieURL,
+		crumbURL:         DefaultCrumbURL,
+	}
+
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	return client
+}
+
+// SetTracer records a span for every upstream request; nil disables tracing
+func (c *Client) SetTracer(t tracing.Tracer) {
+	c.tracer = tracing.OrNoop(t)
+}
+
+// get issues a GET request, passing ctx along when the HTTP client supports it
+func (c *Client) get(ctx context.Context, requestURL string) (*http.Response, error) {
+	return httpclient.GetCtx(ctx, c.httpClient, requestURL)
+}
+
+// fetchQuote requests a quote from the primary endpoint and, when that fails
+// with a connection error or a 5xx response, from the fallback endpoint. The
+// primary's result is returned when the fallback does not succeed either.
+func (c *Client) fetchQuote(ctx context.Context, params url.Values, span tracing.Span) (*http.Response, error) {
+	requestURL := httpclient.BuildURL(c.baseURL, params)
+	span.SetTag(tracing.TagHTTPURL, requestURL)
+
+	resp, err := c.get(ctx, requestURL)
+	if c.fallbackBaseURL == "" || ctx.Err() != nil || (err == nil && resp.StatusCode < 500) {
+		return resp, err
+	}
+
+	fallbackURL := httpclient.BuildURL(c.fallbackBaseURL, params)
+	if err != nil {
+		logging.Warnf("Yahoo Finance request to %s failed: %v; trying %s", requestURL, err, fallbackURL)
+	} else {
+		logging.Warnf("Yahoo Finance request to %s returned status %d; trying %s", requestURL, resp.StatusCode, fallbackURL)
+	}
+
+	fallbackResp, fallbackErr := c.get(ctx, fallbackURL)
+	if fallbackErr != nil {
+		return resp, err
+	}
+	if fallbackResp.StatusCode != http.StatusOK {
+		fallbackResp.Body.Close()
+		return resp, err
 	}
+
+	if resp != nil {
+		resp.Body.Close()
+	}
+	span.SetTag(tracing.TagHTTPURL, fallbackURL)
+	return fallbackResp, nil
 }
 
 // GetStockPrice fetches stock data for a given symbol
 func (c *Client) GetStockPrice(symbol string) (*models.StockResponse, error) {
+	return c.GetStockPriceCtx(context.Background(), symbol)
+}
+
+// GetStockPriceCtx fetches stock data for a given symbol, canceling the
+// upstream request when ctx is done
+func (c *Client) GetStockPriceCtx(ctx context.Context, symbol string) (*models.StockResponse, error) {
 	if strings.TrimSpace(symbol) == "" {
 		return nil, models.NewAPIError("Stock", "Symbol cannot be empty", 400)
 	}
@@ -66,14 +268,18 @@ func (c *Client) GetStockPrice(symbol string) (*models.StockResponse, error) {
 	params := url.Values{}
 	params.Add("symbols", symbol)
 
-	requestURL := fmt.Sprintf("%s?%s", c.baseURL, params.Encode())
+	span := c.tracer.StartSpan("stock.quote")
+	span.SetTag(tracing.TagStockSymbol, symbol)
+	defer span.Finish()
 
 	// Make the HTTP request
-	resp, err := c.httpClient.Get(requestURL)
+	resp, err := c.quote(ctx, params, span)
 	if err != nil {
-		return nil, models.NewAPIError("Yahoo Finance", fmt.Sprintf("Failed to make request: %v", err), 500)
+		span.SetTag(tracing.TagError, err.Error())
+		return nil, models.NewWrappedAPIError("Yahoo Finance", fmt.Sprintf("Failed to make request: %v", err), 500, err)
 	}
 	defer resp.Body.Close()
+	span.SetTag(tracing.TagHTTPStatusCode, resp.StatusCode)
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, models.NewAPIError("Yahoo Finance", fmt.Sprintf("API returned status %d", resp.StatusCode), resp.StatusCode)
@@ -81,12 +287,12 @@ func (c *Client) GetStockPrice(symbol string) (*models.StockResponse, error) {
 
 	// Parse the response
 	var yahooResp models.YahooFinanceResponse
-	if err := json.NewDecoder(resp.Body).Decode(&yahooResp); err != nil {
-		return nil, models.NewAPIError("Yahoo Finance", fmt.Sprintf("Failed to parse response: %v", err), 500)
+	if err := models.DecodeResponse("Yahoo Finance", resp.Body, c.maxResponseBytes, &yahooResp); err != nil {
+		return nil, err
 	}
 
 	// Convert to our standard format
-	stockResp, err := models.ConvertYahooFinanceResponse(&yahooResp)
+	stockResp, err := models.ConvertYahooFinanceResponse(&yahooResp, c.conversion)
 	if err != nil {
 		return nil, err
 	}
@@ -94,6 +300,99 @@ func (c *Client) GetStockPrice(symbol string) (*models.StockResponse, error) {
 	return stockResp, nil
 }
 
+// SearchSymbols looks up ticker symbols matching a company name
+func (c *Client) SearchSymbols(query string) ([]models.SymbolMatch, error) {
+	return c.SearchSymbolsCtx(context.Background(), query)
+}
+
+// SearchSymbolsCtx looks up ticker symbols matching a company name, canceling
+// the upstream request when ctx is done. No matches is an empty slice, not an
+// error.
+func (c *Client) SearchSymbolsCtx(ctx context.Context, query string) ([]models.SymbolMatch, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, models.NewAPIError("Stock", "Search query cannot be empty", 400)
+	}
+
+	params := url.Values{}
+	params.Add("q", query)
+	requestURL := httpclient.BuildURL(c.searchURL, params)
+
+	span := c.tracer.StartSpan("stock.search")
+	span.SetTag(tracing.TagHTTPURL, requestURL)
+	defer span.Finish()
+
+	resp, err := c.get(ctx, requestURL)
+	if err != nil {
+		span.SetTag(tracing.TagError, err.Error())
+		return nil, models.NewWrappedAPIError("Yahoo Finance", fmt.Sprintf("Failed to make request: %v", err), 500, err)
+	}
+	defer resp.Body.Close()
+	span.SetTag(tracing.TagHTTPStatusCode, resp.StatusCode)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, models.NewAPIError("Yahoo Finance", fmt.Sprintf("API returned status %d", resp.StatusCode), resp.StatusCode)
+	}
+
+	var searchResp models.YahooFinanceSearchResponse
+	if err := models.DecodeResponse("Yahoo Finance", resp.Body, c.maxResponseBytes, &searchResp); err != nil {
+		return nil, err
+	}
+
+	return models.ConvertYahooFinanceSearchResponse(&searchResp), nil
+}
+
+// GetHistory fetches the price history of symbol over range r at interval i
+func (c *Client) GetHistory(symbol string, r models.HistoryRange, i models.HistoryInterval) (*models.StockHistory, error) {
+	return c.GetHistoryCtx(context.Background(), symbol, r, i)
+}
+
+// GetHistoryCtx fetches the price history of symbol over range r at interval
+// i, canceling the upstream request when ctx is done. The range and interval
+// are validated first, so combinations Yahoo Finance rejects are never sent.
+func (c *Client) GetHistoryCtx(ctx context.Context, symbol string, r models.HistoryRange, i models.HistoryInterval) (*models.StockHistory, error) {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if symbol == "" {
+		return nil, models.NewAPIError("Stock", "Symbol cannot be empty", 400)
+	}
+	if err := models.ValidateHistory(r, i); err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Add("range", string(r))
+	params.Add("interval", string(i))
+	chartURL, err := url.JoinPath(c.chartURL, symbol)
+	if err != nil {
+		return nil, models.NewWrappedAPIError("Stock", fmt.Sprintf("Invalid chart URL: %v", err), 500, err)
+	}
+	requestURL := httpclient.BuildURL(chartURL, params)
+
+	span := c.tracer.StartSpan("stock.history")
+	span.SetTag(tracing.TagStockSymbol, symbol)
+	span.SetTag(tracing.TagHTTPURL, requestURL)
+	defer span.Finish()
+
+	resp, err := c.get(ctx, requestURL)
+	if err != nil {
+		span.SetTag(tracing.TagError, err.Error())
+		return nil, models.NewWrappedAPIError("Yahoo Finance", fmt.Sprintf("Failed to make request: %v", err), 500, err)
+	}
+	defer resp.Body.Close()
+	span.SetTag(tracing.TagHTTPStatusCode, resp.StatusCode)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, models.NewAPIError("Yahoo Finance", fmt.Sprintf("API returned status %d", resp.StatusCode), resp.StatusCode)
+	}
+
+	var chartResp models.YahooFinanceChartResponse
+	if err := models.DecodeResponse("Yahoo Finance", resp.Body, c.maxResponseBytes, &chartResp); err != nil {
+		return nil, err
+	}
+
+	return models.ConvertYahooFinanceChartResponse(&chartResp, r, i, c.conversion)
+}
+
 // GetDatadogStock is a convenience method to get Datadog (DDOG) stock price
 func (c *Client) GetDatadogStock() (*models.StockResponse, error) {
 	return c.GetStockPrice("DDOG")
@@ -123,9 +422,15 @@ func (c *Client) ValidateSymbol(symbol string) error {
 
 // GetStockPriceWithValidation fetches stock data with input validation
 func (c *Client) GetStockPriceWithValidation(symbol string) (*models.StockResponse, error) {
+	return c.GetStockPriceWithValidationCtx(context.Background(), symbol)
+}
+
+// GetStockPriceWithValidationCtx fetches stock data with input validation,
+// canceling the upstream request when ctx is done
+func (c *Client) GetStockPriceWithValidationCtx(ctx context.Context, symbol string) (*models.StockResponse, error) {
 	if err := c.ValidateSymbol(symbol); err != nil {
 		return nil, err
 	}
 
-	return c.GetStockPrice(symbol)
+	return c.GetStockPriceCtx(ctx, symbol)
 }
@@ -1,11 +1,16 @@
 package stock
 
 import (
+	"encoding/json"
 	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/JSGette/agent_summit_bazel_workshop/internal/testutils"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
 )
 
 func TestClient_GetStockPrice(t *testing.T) {
@@ -67,6 +72,13 @@ func TestClient_GetStockPrice(t *testing.T) {
 			mockStatusCode: 200,
 			wantError:      true,
 		},
+		{
+			name:           "zero price quote",
+			symbol:         "DLST",
+			mockResponse:   testutils.YahooFinanceZeroPrice,
+			mockStatusCode: 200,
+			wantError:      true,
+		},
 		{
 			name:           "API returns 500 error",
 			symbol:         "DDOG",
@@ -157,6 +169,99 @@ func TestClient_GetDatadogStock(t *testing.T) {
 	}
 }
 
+func TestClient_GetStockPrice_InconsistentChangeSign(t *testing.T) {
+	tests := []struct {
+		name              string
+		repair            bool
+		wantChangePercent float64
+	}{
+		{
+			name:              "flagged but left untouched by default",
+			repair:            false,
+			wantChangePercent: -1.89,
+		},
+		{
+			name:   "repaired from change and previous close",
+			repair: true,
+			// 2.34 / 123.33 * 100, rounded to models.DefaultStockDecimals
+			wantChangePercent: 1.90,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			client := NewClient(mockClient, RepairChangePercentSign(tt.repair))
+
+			expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+			mockClient.AddResponse(expectedURL, 200, testutils.YahooFinanceInconsistentSign)
+
+			result, err := client.GetStockPrice("DDOG")
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			if math.Abs(result.ChangePercent-tt.wantChangePercent) > 1e-9 {
+				t.Errorf("Expected change percent %v, got %v", tt.wantChangePercent, result.ChangePercent)
+			}
+
+			if result.Change != 2.34 {
+				t.Errorf("Expected change to stay 2.34, got %v", result.Change)
+			}
+		})
+	}
+}
+
+func TestClient_GetStockPrice_Decimals(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse("https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG", 200, testutils.YahooFinanceStockResponse)
+	client := NewClient(mockClient, Decimals(0))
+
+	result, err := client.GetStockPrice("DDOG")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Price != 126 || result.Change != 2 {
+		t.Errorf("Expected price 126 and change 2, got %v and %v", result.Price, result.Change)
+	}
+}
+
+func TestClient_GetStockPrice_WrapsUnderlyingError(t *testing.T) {
+	expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+
+	t.Run("parse error", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(expectedURL, 200, `{"quoteResponse": invalid}`)
+		client := NewClient(mockClient)
+
+		_, err := client.GetStockPrice("DDOG")
+
+		var syntaxErr *json.SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Expected JSON decoding error to be reachable, got %v", err)
+		}
+	})
+
+	t.Run("network error", func(t *testing.T) {
+		networkErr := errors.New("network error")
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddError(expectedURL, networkErr)
+		client := NewClient(mockClient)
+
+		_, err := client.GetStockPrice("DDOG")
+
+		if !errors.Is(err, networkErr) {
+			t.Errorf("Expected network error to be reachable, got %v", err)
+		}
+
+		var apiErr *models.APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != 500 {
+			t.Errorf("Expected APIError with code 500, got %v", err)
+		}
+	})
+}
+
 func TestClient_ValidateSymbol(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -317,3 +422,367 @@ func TestNewClient(t *testing.T) {
 		}
 	})
 }
+
+func TestClient_CustomBaseURLs(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	quoteURL := "http://localhost:8080/yahoo/quote?apikey=secret&symbols=DDOG"
+	fallbackURL := "http://localhost:8081/yahoo/quote?apikey=secret&symbols=DDOG"
+	searchURL := "http://localhost:8080/yahoo/search?apikey=secret&q=datadog"
+	chartURL := "http://localhost:8080/yahoo/chart/DDOG?apikey=secret&interval=1d&range=5d"
+	mockClient.AddResponse(quoteURL, 503, "unavailable")
+	mockClient.AddResponse(fallbackURL, 200, testutils.YahooFinanceStockResponse)
+	mockClient.AddResponse(searchURL, 200, testutils.YahooFinanceSearchResponse)
+	mockClient.AddResponse(chartURL, 200, testutils.YahooFinanceChartResponse)
+
+	client := NewClient(mockClient,
+		BaseURL("http://localhost:8080/yahoo/quote?apikey=secret"),
+		FallbackBaseURL("http://localhost:8081/yahoo/quote?apikey=secret"),
+		SearchURL("http://localhost:8080/yahoo/search?apikey=secret"),
+		ChartURL("http://localhost:8080/yahoo/chart?apikey=secret"),
+	)
+
+	if _, err := client.GetStockPrice("DDOG"); err != nil {
+		t.Errorf("Unexpected quote error: %v", err)
+	}
+	if _, err := client.SearchSymbols("datadog"); err != nil {
+		t.Errorf("Unexpected search error: %v", err)
+	}
+	if _, err := client.GetHistory("DDOG", models.HistoryRange5Days, models.HistoryInterval1Day); err != nil {
+		t.Errorf("Unexpected history error: %v", err)
+	}
+
+	for _, requestURL := range []string{quoteURL, fallbackURL, searchURL, chartURL} {
+		if calls := mockClient.GetCallCount(requestURL); calls != 1 {
+			t.Errorf("Expected one call to %s, got %v", requestURL, mockClient.GetCalls())
+		}
+	}
+}
+
+func TestClient_GetStockPrice_Failover(t *testing.T) {
+	primaryURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+	fallbackURL := "https://query2.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+
+	tests := []struct {
+		name          string
+		setup         func(m *testutils.MockHTTPClient)
+		opts          []ClientOption
+		wantError     bool
+		wantFallbacks int
+	}{
+		{
+			name: "primary succeeds",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddResponse(primaryURL, 200, testutils.YahooFinanceStockResponse)
+				m.AddResponse(fallbackURL, 200, testutils.YahooFinanceStockResponse)
+			},
+		},
+		{
+			name: "primary 5xx fails over",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddResponse(primaryURL, 502, "bad gateway")
+				m.AddResponse(fallbackURL, 200, testutils.YahooFinanceStockResponse)
+			},
+			wantFallbacks: 1,
+		},
+		{
+			name: "primary connection error fails over",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddError(primaryURL, errors.New("connection refused"))
+				m.AddResponse(fallbackURL, 200, testutils.YahooFinanceStockResponse)
+			},
+			wantFallbacks: 1,
+		},
+		{
+			name: "primary 4xx does not fail over",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddResponse(primaryURL, 404, "not found")
+				m.AddResponse(fallbackURL, 200, testutils.YahooFinanceStockResponse)
+			},
+			wantError: true,
+		},
+		{
+			name: "both fail",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddResponse(primaryURL, 503, "unavailable")
+				m.AddResponse(fallbackURL, 503, "unavailable")
+			},
+			wantError:     true,
+			wantFallbacks: 1,
+		},
+		{
+			name: "failover disabled",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddResponse(primaryURL, 503, "unavailable")
+				m.AddResponse(fallbackURL, 200, testutils.YahooFinanceStockResponse)
+			},
+			opts:      []ClientOption{FallbackBaseURL("")},
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			tt.setup(mockClient)
+			client := NewClient(mockClient, tt.opts...)
+
+			_, err := client.GetStockPrice("DDOG")
+
+			if (err != nil) != tt.wantError {
+				t.Errorf("Expected error %v, got %v", tt.wantError, err)
+			}
+			if calls := mockClient.GetCallCount(fallbackURL); calls != tt.wantFallbacks {
+				t.Errorf("Expected %d fallback calls, got %d", tt.wantFallbacks, calls)
+			}
+		})
+	}
+
+	t.Run("custom base URL", func(t *testing.T) {
+		customURL := "http://localhost:9000/v8/finance/quote?symbols=DDOG"
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(customURL, 200, testutils.YahooFinanceStockResponse)
+		client := NewClient(mockClient, BaseURL("http://localhost:9000/v8/finance/quote"))
+
+		if _, err := client.GetStockPrice("DDOG"); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if calls := mockClient.GetCallCount(customURL); calls != 1 {
+			t.Errorf("Expected 1 call to the custom endpoint, got %d", calls)
+		}
+	})
+}
+
+func TestDefaultHTTPClient_Headers(t *testing.T) {
+	received := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		client        *DefaultHTTPClient
+		wantUserAgent string
+		wantAccept    string
+	}{
+		{"zero value sends defaults", &DefaultHTTPClient{}, DefaultUserAgent, "application/json,text/plain,*/*"},
+		{
+			"custom headers replace defaults",
+			NewDefaultHTTPClientWithHeaders(http.Header{"user-agent": {"ops-bot/2.0"}}),
+			"ops-bot/2.0",
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			headers := <-received
+			if got := headers.Get("User-Agent"); got != tt.wantUserAgent {
+				t.Errorf("Expected User-Agent %q, got %q", tt.wantUserAgent, got)
+			}
+			if got := headers.Get("Accept"); got != tt.wantAccept {
+				t.Errorf("Expected Accept %q, got %q", tt.wantAccept, got)
+			}
+		})
+	}
+}
+
+func TestClient_GetStockPrice_OversizedBody(t *testing.T) {
+	expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+	padding := strings.Repeat(" ", 1024)
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(expectedURL, 200, padding+testutils.YahooFinanceStockResponse)
+
+	client := NewClient(mockClient, FallbackBaseURL(""), MaxResponseBytes(512))
+	_, err := client.GetStockPrice("DDOG")
+
+	var apiErr *models.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 502 {
+		t.Fatalf("Expected APIError with code 502, got %v", err)
+	}
+	if !strings.Contains(apiErr.Message, "exceeds 512 bytes") {
+		t.Errorf("Expected the message to name the cap, got %q", apiErr.Message)
+	}
+}
+
+func TestClient_GetStockPrice_CrumbHandshake(t *testing.T) {
+	const (
+		cookieURL = "https://fc.yahoo.com"
+		crumbURL  = "https://query1.finance.yahoo.com/v1/test/getcrumb"
+		quoteURL  = "https://query1.finance.yahoo.com/v7/finance/quote?crumb=abc123&symbols=DDOG"
+	)
+
+	tests := []struct {
+		name        string
+		setup       func(m *testutils.MockHTTPClient)
+		requests    int
+		wantError   bool
+		wantCrumbs  int
+		wantQuotes  int
+		wantCookies int
+	}{
+		{
+			name: "crumb is fetched once and reused",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddResponse(cookieURL, 404, "")
+				m.AddResponse(crumbURL, 200, "abc123\n")
+				m.AddResponse(quoteURL, 200, testutils.YahooFinanceStockResponse)
+			},
+			requests:    2,
+			wantCookies: 1,
+			wantCrumbs:  1,
+			wantQuotes:  2,
+		},
+		{
+			name: "401 repeats the handshake once",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddResponse(cookieURL, 404, "")
+				m.AddResponse(crumbURL, 200, "abc123")
+				m.AddTransientResponse(quoteURL, 401, `{"finance": {"error": {"code": "Unauthorized"}}}`)
+				m.AddResponse(quoteURL, 200, testutils.YahooFinanceStockResponse)
+			},
+			requests:    1,
+			wantCookies: 2,
+			wantCrumbs:  2,
+			wantQuotes:  2,
+		},
+		{
+			name: "repeated 401 is returned",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddResponse(cookieURL, 404, "")
+				m.AddResponse(crumbURL, 200, "abc123")
+				m.AddResponse(quoteURL, 401, "")
+			},
+			requests:    1,
+			wantError:   true,
+			wantCookies: 2,
+			wantCrumbs:  2,
+			wantQuotes:  2,
+		},
+		{
+			name: "failed handshake skips the quote",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddResponse(cookieURL, 404, "")
+				m.AddResponse(crumbURL, 403, "")
+			},
+			requests:    1,
+			wantError:   true,
+			wantCookies: 1,
+			wantCrumbs:  1,
+		},
+		{
+			name: "empty crumb fails the handshake",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddResponse(cookieURL, 404, "")
+				m.AddResponse(crumbURL, 200, "  ")
+			},
+			requests:    1,
+			wantError:   true,
+			wantCookies: 1,
+			wantCrumbs:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			tt.setup(mockClient)
+			client := NewClient(mockClient, CrumbHandshake(true), FallbackBaseURL(""))
+
+			for i := 0; i < tt.requests; i++ {
+				stock, err := client.GetStockPrice("DDOG")
+				if tt.wantError {
+					if err == nil {
+						t.Fatal("Expected an error, got nil")
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("Request %d: unexpected error: %v", i+1, err)
+				}
+				if stock.Symbol != "DDOG" {
+					t.Errorf("Expected DDOG, got %s", stock.Symbol)
+				}
+			}
+
+			if got := mockClient.GetCallCount(cookieURL); got != tt.wantCookies {
+				t.Errorf("Expected %d cookie requests, got %d", tt.wantCookies, got)
+			}
+			if got := mockClient.GetCallCount(crumbURL); got != tt.wantCrumbs {
+				t.Errorf("Expected %d crumb requests, got %d", tt.wantCrumbs, got)
+			}
+			if got := mockClient.GetCallCount(quoteURL); got != tt.wantQuotes {
+				t.Errorf("Expected %d quote requests, got %d", tt.wantQuotes, got)
+			}
+		})
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse("https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG", 200, testutils.YahooFinanceStockResponse)
+
+		if _, err := NewClient(mockClient).GetStockPrice("DDOG"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := mockClient.GetCallCount(crumbURL); got != 0 {
+			t.Errorf("Expected no crumb requests, got %d", got)
+		}
+	})
+}
+
+func TestClient_GetHistory(t *testing.T) {
+	chartURL := "https://query1.finance.yahoo.com/v8/finance/chart/DDOG?interval=1d&range=5d"
+
+	tests := []struct {
+		name        string
+		symbol      string
+		rng         models.HistoryRange
+		interval    models.HistoryInterval
+		status      int
+		wantPoints  int
+		wantErrCode int
+	}{
+		{name: "history", symbol: "ddog", rng: models.HistoryRange5Days, interval: models.HistoryInterval1Day, status: 200, wantPoints: 3},
+		{name: "empty symbol", symbol: "  ", rng: models.HistoryRange5Days, interval: models.HistoryInterval1Day, wantErrCode: 400},
+		{name: "unsupported range", symbol: "DDOG", rng: "2d", interval: models.HistoryInterval1Day, wantErrCode: 400},
+		{name: "interval not served for range", symbol: "DDOG", rng: models.HistoryRange1Year, interval: models.HistoryInterval1Minute, wantErrCode: 400},
+		{name: "upstream error", symbol: "DDOG", rng: models.HistoryRange5Days, interval: models.HistoryInterval1Day, status: 404, wantErrCode: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			if tt.status == 200 {
+				mockClient.AddResponse(chartURL, tt.status, testutils.YahooFinanceChartResponse)
+			} else if tt.status != 0 {
+				mockClient.AddResponse(chartURL, tt.status, testutils.APIErrorResponse)
+			}
+			client := NewClient(mockClient)
+
+			history, err := client.GetHistory(tt.symbol, tt.rng, tt.interval)
+			if tt.wantErrCode != 0 {
+				var apiErr *models.APIError
+				if !errors.As(err, &apiErr) || apiErr.Code != tt.wantErrCode {
+					t.Fatalf("Expected API error with code %d, got %v", tt.wantErrCode, err)
+				}
+				if tt.status == 0 && len(mockClient.GetCalls()) != 0 {
+					t.Errorf("Expected no upstream request, got %v", mockClient.GetCalls())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if history.Symbol != "DDOG" || len(history.Points) != tt.wantPoints {
+				t.Errorf("Expected %d points for DDOG, got %d for %s", tt.wantPoints, len(history.Points), history.Symbol)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package stock
+
+import "time"
+
+// Clock tells the current time. The service reads time through a Clock so
+// tests can pin it, e.g. to check the demo market state at a given hour.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the Clock backed by time.Now
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the default Clock, reporting the real time
+var SystemClock Clock = systemClock{}
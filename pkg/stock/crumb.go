@@ -0,0 +1,135 @@
+package stock
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/tracing"
+)
+
+// Default Yahoo Finance handshake endpoints. The cookie endpoint sets the
+// session cookie (it answers 404, which is expected); the crumb endpoint
+// returns the crumb tied to that cookie as plain text.
+const (
+	DefaultCookieURL = "https://fc.yahoo.com"
+	DefaultCrumbURL  = "https://query1.finance.yahoo.com/v1/test/getcrumb"
+)
+
+// maxCrumbBytes caps the size of a crumb response; real crumbs are a few
+// characters long
+const maxCrumbBytes = 1 << 10
+
+// CrumbHandshake makes quote requests carry a session crumb, which Yahoo
+// Finance increasingly requires before answering with anything but a 401.
+// The crumb is fetched once and reused until a quote request is rejected
+// with a 401, which repeats the handshake and the request once. The session
+// cookie must be kept between requests, as DefaultHTTPClient does.
+func CrumbHandshake(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.crumbHandshake = enabled
+	}
+}
+
+// CrumbURLs sets the endpoints used by the crumb handshake
+func CrumbURLs(cookieURL, crumbURL string) ClientOption {
+	return func(c *Client) {
+		c.cookieURL = cookieURL
+		c.crumbURL = crumbURL
+	}
+}
+
+// quote requests a quote for params, adding the session crumb when the
+// handshake is enabled
+func (c *Client) quote(ctx context.Context, params url.Values, span tracing.Span) (*http.Response, error) {
+	if !c.crumbHandshake {
+		return c.fetchQuote(ctx, params, span)
+	}
+
+	for attempt := 1; ; attempt++ {
+		crumb, err := c.sessionCrumb(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		params.Set("crumb", crumb)
+		resp, err := c.fetchQuote(ctx, params, span)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || attempt > 1 {
+			return resp, err
+		}
+
+		resp.Body.Close()
+		logging.Warnf("Yahoo Finance rejected the session crumb; repeating the handshake")
+		c.resetCrumb(crumb)
+	}
+}
+
+// sessionCrumb returns the cached crumb, performing the handshake first when
+// there is none. Concurrent callers wait for a single handshake.
+func (c *Client) sessionCrumb(ctx context.Context) (string, error) {
+	c.crumbMutex.Lock()
+	defer c.crumbMutex.Unlock()
+
+	if c.crumb == "" {
+		crumb, err := c.handshake(ctx)
+		if err != nil {
+			return "", err
+		}
+		c.crumb = crumb
+	}
+	return c.crumb, nil
+}
+
+// resetCrumb forgets crumb unless another request already replaced it
+func (c *Client) resetCrumb(crumb string) {
+	c.crumbMutex.Lock()
+	defer c.crumbMutex.Unlock()
+
+	if c.crumb == crumb {
+		c.crumb = ""
+	}
+}
+
+// handshake obtains a session cookie and the crumb that goes with it
+func (c *Client) handshake(ctx context.Context) (string, error) {
+	span := c.tracer.StartSpan("stock.crumb")
+	defer span.Finish()
+
+	// Only the cookie matters; the status of this response does not
+	resp, err := c.get(ctx, c.cookieURL)
+	if err != nil {
+		span.SetTag(tracing.TagError, err.Error())
+		return "", fmt.Errorf("crumb handshake: fetching the session cookie: %w", err)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxCrumbBytes))
+	resp.Body.Close()
+
+	span.SetTag(tracing.TagHTTPURL, c.crumbURL)
+	resp, err = c.get(ctx, c.crumbURL)
+	if err != nil {
+		span.SetTag(tracing.TagError, err.Error())
+		return "", fmt.Errorf("crumb handshake: fetching the crumb: %w", err)
+	}
+	defer resp.Body.Close()
+	span.SetTag(tracing.TagHTTPStatusCode, resp.StatusCode)
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("crumb handshake: crumb endpoint returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCrumbBytes))
+	if err != nil {
+		return "", fmt.Errorf("crumb handshake: reading the crumb: %w", err)
+	}
+	crumb := strings.TrimSpace(string(body))
+	if crumb == "" {
+		return "", fmt.Errorf("crumb handshake: crumb endpoint returned an empty crumb")
+	}
+
+	logging.Debugf("Obtained a Yahoo Finance session crumb")
+	return crumb, nil
+}
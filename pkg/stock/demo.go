@@ -2,11 +2,23 @@ package stock
 
 import (
 	"math/rand"
+	"sort"
 	"time"
 
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
 )
 
+// Metadata sources of simulated stock responses
+const (
+	DemoSource = "Demo Mode (Simulated Data)"
+	// BudgetDemoSource marks demo data served because a live quote would
+	// have exceeded the response budget
+	BudgetDemoSource = "Demo Mode (Response Budget Exceeded)"
+	// MaintenanceDemoSource marks demo data served because the service is in
+	// maintenance mode
+	MaintenanceDemoSource = "Demo Mode (Maintenance)"
+)
+
 // DemoStockData contains realistic demo data for stocks
 var DemoStockData = map[string]struct {
 	Name      string
@@ -46,15 +58,15 @@ var DemoStockData = map[string]struct {
 	},
 }
 
-// generateDemoStockResponse creates a realistic stock response with simulated price movements
-func generateDemoStockResponse(symbol string) (*models.StockResponse, error) {
+// generateDemoStockResponse creates a realistic stock response with simulated
+// price movements as of now
+func generateDemoStockResponse(symbol string, now time.Time) (*models.StockResponse, error) {
 	data, exists := DemoStockData[symbol]
 	if !exists {
 		return nil, models.NewAPIError("Demo Stock", "Stock symbol not found in demo data", 404)
 	}
 
 	// Create a deterministic but varying price based on current time
-	now := time.Now()
 	seed := now.Hour()*60 + now.Minute() // Changes every minute
 	r := rand.New(rand.NewSource(int64(seed + len(symbol))))
 
@@ -71,20 +83,9 @@ func generateDemoStockResponse(symbol string) (*models.StockResponse, error) {
 	// Generate volume (random but reasonable)
 	volume := int64(500000 + r.Intn(2000000)) // 500K to 2.5M shares
 
-	// Determine market state based on time (simplified)
-	var marketState models.MarketState
-	hour := now.Hour()
-	if hour >= 9 && hour < 16 { // 9 AM to 4 PM (simplified US market hours)
-		marketState = models.MarketStateRegular
-	} else if hour >= 4 && hour < 9 { // Pre-market
-		marketState = models.MarketStatePremarket
-	} else if hour >= 16 && hour < 20 { // After hours
-		marketState = models.MarketStatePostmarket
-	} else {
-		marketState = models.MarketStateClosed
-	}
+	marketState := demoMarketState(now)
 
-	return &models.StockResponse{
+	stock := &models.StockResponse{
 		Symbol:        symbol,
 		CompanyName:   data.Name,
 		Price:         currentPrice,
@@ -97,12 +98,79 @@ func generateDemoStockResponse(symbol string) (*models.StockResponse, error) {
 		Currency:      data.Currency,
 		Metadata: models.ResponseMetadata{
 			Timestamp: now,
-			Source:    "Demo Mode (Simulated Data)",
+			Source:    DemoSource,
 		},
-	}, nil
+	}
+	stock.SetDisplayFields()
+
+	return stock, nil
+}
+
+// easternTime is the zone of the US exchanges the demo symbols trade on.
+// Without the tz database, standard time is assumed all year.
+var easternTime = func() *time.Location {
+	if location, err := time.LoadLocation("America/New_York"); err == nil {
+		return location
+	}
+	return time.FixedZone("EST", -5*60*60)
+}()
+
+// demoMarketState returns the US market session at now, whatever the server
+// timezone: pre-market 4:00-9:30, regular 9:30-16:00, and after hours
+// 16:00-20:00 Eastern time on weekdays, closed otherwise. Holidays are not
+// taken into account.
+func demoMarketState(now time.Time) models.MarketState {
+	eastern := now.In(easternTime)
+	if weekday := eastern.Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+		return models.MarketStateClosed
+	}
+
+	minutes := eastern.Hour()*60 + eastern.Minute()
+	switch {
+	case minutes >= 4*60 && minutes < 9*60+30:
+		return models.MarketStatePremarket
+	case minutes >= 9*60+30 && minutes < 16*60:
+		return models.MarketStateRegular
+	case minutes >= 16*60 && minutes < 20*60:
+		return models.MarketStatePostmarket
+	default:
+		return models.MarketStateClosed
+	}
 }
 
 // GetDemoStock returns demo stock data for the given symbol
 func GetDemoStock(symbol string) (*models.StockResponse, error) {
-	return generateDemoStockResponse(symbol)
+	return GetDemoStockAt(symbol, time.Now())
+}
+
+// GetDemoStockAt returns demo stock data for the given symbol as of now,
+// which sets the simulated price, market state, and timestamp
+func GetDemoStockAt(symbol string, now time.Time) (*models.StockResponse, error) {
+	return generateDemoStockResponse(symbol, now)
+}
+
+// DemoSymbols returns the symbols available in demo mode in alphabetical order
+func DemoSymbols() []string {
+	symbols := make([]string, 0, len(DemoStockData))
+	for symbol := range DemoStockData {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols
+}
+
+// ListDemoSymbols returns the symbols available in demo mode with their
+// company names and currencies, in alphabetical order of symbol
+func ListDemoSymbols() []models.SymbolInfo {
+	symbols := DemoSymbols()
+	infos := make([]models.SymbolInfo, 0, len(symbols))
+	for _, symbol := range symbols {
+		data := DemoStockData[symbol]
+		infos = append(infos, models.SymbolInfo{
+			Symbol:   symbol,
+			Name:     data.Name,
+			Currency: data.Currency,
+		})
+	}
+	return infos
 }
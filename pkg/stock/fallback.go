@@ -0,0 +1,49 @@
+package stock
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultFallbackCodes lists the upstream status codes answered with demo
+// data by default, in the syntax accepted by ParseFallbackCodes
+const DefaultFallbackCodes = "401,403,429,5xx"
+
+// DefaultFallback reports whether an upstream status code is answered with
+// demo data by default: auth errors (401/403), rate limiting (429), and
+// server errors (5xx)
+func DefaultFallback(code int) bool {
+	return code == 401 || code == 403 || code == 429 || (code >= 500 && code <= 599)
+}
+
+// ParseFallbackCodes parses a comma-separated list of status codes, such as
+// "404,429,5xx", into a fallback predicate for WithFallback. An entry like
+// "5xx" covers the whole class. "none" or an empty list returns nil, which
+// disables the fallback.
+func ParseFallbackCodes(spec string) (func(code int) bool, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || strings.EqualFold(spec, "none") {
+		return nil, nil
+	}
+
+	codes := make(map[int]bool)
+	classes := make(map[int]bool)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if len(entry) == 3 && strings.HasSuffix(entry, "xx") && entry[0] >= '1' && entry[0] <= '5' {
+			classes[int(entry[0]-'0')] = true
+			continue
+		}
+
+		code, err := strconv.Atoi(entry)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid fallback status code %q (expected e.g. 404 or 5xx)", entry)
+		}
+		codes[code] = true
+	}
+
+	return func(code int) bool {
+		return codes[code] || classes[code/100]
+	}, nil
+}
@@ -0,0 +1,58 @@
+package stock
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+)
+
+// LoadCompanyNames reads display name overrides from a JSON file mapping
+// symbols to names, e.g. {"DDOG": "Datadog"}. Symbols are matched case
+// insensitively; an empty name is rejected.
+func LoadCompanyNames(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading company names: %w", err)
+	}
+
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("company names file %s: %w", path, err)
+	}
+
+	names := make(map[string]string, len(raw))
+	for symbol, name := range raw {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("company names file %s: empty name for %q", path, symbol)
+		}
+		names[strings.ToUpper(strings.TrimSpace(symbol))] = name
+	}
+	return names, nil
+}
+
+// WithCompanyNames sets display names used by stock summaries in place of
+// the upstream company names, keyed by symbol
+func WithCompanyNames(names map[string]string) Option {
+	return func(s *Service) {
+		s.companyNames = make(map[string]string, len(names))
+		for symbol, name := range names {
+			s.companyNames[strings.ToUpper(strings.TrimSpace(symbol))] = name
+		}
+	}
+}
+
+// displayName returns the name summaries show for stock: the configured
+// override, else the upstream company name, else the symbol
+func (s *Service) displayName(stock *models.StockResponse) string {
+	if name, ok := s.companyNames[stock.Symbol]; ok {
+		return name
+	}
+	if stock.CompanyName != "" {
+		return stock.CompanyName
+	}
+	return stock.Symbol
+}
@@ -0,0 +1,108 @@
+package stock
+
+import (
+	"context"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+)
+
+// StockProvider is a source of stock quotes. Providers name themselves in
+// the Metadata.Source of the quotes they return.
+type StockProvider interface {
+	GetStockPrice(symbol string) (*models.StockResponse, error)
+}
+
+// contextProvider is implemented by providers whose requests stop when ctx
+// is done, such as YahooProvider
+type contextProvider interface {
+	GetStockPriceCtx(ctx context.Context, symbol string) (*models.StockResponse, error)
+}
+
+// YahooProvider serves live quotes from Yahoo Finance
+type YahooProvider struct {
+	client *Client
+}
+
+// NewYahooProvider creates a provider that quotes symbols through client
+func NewYahooProvider(client *Client) *YahooProvider {
+	return &YahooProvider{client: client}
+}
+
+// GetStockPrice validates symbol and fetches its quote
+func (p *YahooProvider) GetStockPrice(symbol string) (*models.StockResponse, error) {
+	return p.GetStockPriceCtx(context.Background(), symbol)
+}
+
+// GetStockPriceCtx is GetStockPrice with a context that cancels the request
+func (p *YahooProvider) GetStockPriceCtx(ctx context.Context, symbol string) (*models.StockResponse, error) {
+	return p.client.GetStockPriceWithValidationCtx(ctx, symbol)
+}
+
+// DemoProvider serves simulated quotes for the demo symbols without any
+// network request; other symbols fail with a 404
+type DemoProvider struct {
+	clock Clock
+}
+
+// NewDemoProvider creates a provider that simulates quotes as of clock, or
+// the system clock when clock is nil
+func NewDemoProvider(clock Clock) *DemoProvider {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &DemoProvider{clock: clock}
+}
+
+// GetStockPrice returns the simulated quote for symbol
+func (p *DemoProvider) GetStockPrice(symbol string) (*models.StockResponse, error) {
+	return GetDemoStockAt(symbol, p.clock.Now())
+}
+
+// WithProviders sets the providers asked for quotes, in order. A provider is
+// only tried when the previous one failed with a status code the fallback
+// policy accepts (see WithFallback). No providers restores the default of
+// Yahoo Finance followed by demo data.
+func WithProviders(providers ...StockProvider) Option {
+	return func(s *Service) {
+		s.providers = append([]StockProvider(nil), providers...)
+	}
+}
+
+// defaultProviders returns the live Yahoo Finance provider followed by demo
+// data as of the service clock
+func (s *Service) defaultProviders() []StockProvider {
+	return []StockProvider{NewYahooProvider(s.client), NewDemoProvider(s.clock)}
+}
+
+// quoteFrom asks provider for a quote of symbol. Providers other than
+// DemoProvider call out over the network, so they take an upstream slot and
+// their outcome is reported to the health tracker and latency estimate.
+func (s *Service) quoteFrom(ctx context.Context, provider StockProvider, symbol string) (*models.StockResponse, error) {
+	if _, local := provider.(*DemoProvider); local {
+		return provider.GetStockPrice(symbol)
+	}
+
+	if err := s.upstream.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	fetchStart := s.clock.Now()
+	var stock *models.StockResponse
+	var err error
+	if p, ok := provider.(contextProvider); ok {
+		stock, err = p.GetStockPriceCtx(ctx, symbol)
+	} else {
+		stock, err = provider.GetStockPrice(symbol)
+	}
+	latency := s.clock.Now().Sub(fetchStart)
+	s.upstream.Release()
+
+	if err != nil {
+		if ctx.Err() == nil && isUpstreamFailure(err) {
+			s.health.RecordFailure(UpstreamName)
+		}
+		return nil, err
+	}
+	s.health.RecordSuccess(UpstreamName)
+	s.recordLatency(latency)
+	return stock, nil
+}
@@ -0,0 +1,102 @@
+package stock
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
+)
+
+// DefaultRefreshInterval is how often background refresh fetches its
+// symbols; it is shorter than DefaultCacheTTL so refreshed quotes never expire
+const DefaultRefreshInterval = 10 * time.Second
+
+// StartBackgroundRefresh keeps the cached quotes for symbols warm by fetching
+// them on a background goroutine right away and then every interval, until
+// stop is closed. The symbols of alert rules are refreshed too, and each
+// refreshed quote is checked against the rules. Fetches wait for the rate
+// limiter like client requests do; failures are logged and retried on the
+// next round. Closing stop also cancels a fetch in progress.
+//
+// Nothing is started without symbols, a positive interval, or a cache to
+// keep warm, or in maintenance mode.
+func (s *Service) StartBackgroundRefresh(symbols []string, interval time.Duration, stop <-chan struct{}) {
+	symbols = append(append([]string(nil), symbols...), s.alertSymbols()...)
+	if len(symbols) == 0 || interval <= 0 || s.cache == nil || s.maintenance {
+		if len(s.alerts.rules) > 0 {
+			logging.Warnf("Stock alerts are disabled: they need background refresh with a cache outside maintenance mode")
+		}
+		return
+	}
+
+	normalized := make([]string, 0, len(symbols))
+	seen := make(map[string]bool, len(symbols))
+	for _, symbol := range symbols {
+		symbol = strings.ToUpper(strings.TrimSpace(symbol))
+		if seen[symbol] {
+			continue
+		}
+		seen[symbol] = true
+		if err := s.client.ValidateSymbol(symbol); err != nil {
+			logging.Warnf("Skipping invalid background refresh symbol %q: %v", symbol, err)
+			continue
+		}
+		if err := s.checkSymbolAccess(symbol); err != nil {
+			logging.Warnf("Skipping background refresh symbol %q: %v", symbol, err)
+			continue
+		}
+		normalized = append(normalized, symbol)
+	}
+	if len(normalized) == 0 {
+		return
+	}
+
+	logging.Infof("Refreshing %d stock symbols every %v in the background", len(normalized), interval)
+	go s.refreshLoop(normalized, interval, stop)
+}
+
+// refreshLoop fetches symbols every interval until stop is closed
+func (s *Service) refreshLoop(symbols []string, interval time.Duration, stop <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.refreshSymbols(ctx, symbols)
+
+		select {
+		case <-ctx.Done():
+			logging.Debugf("Background stock refresh stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshSymbols fetches each symbol once, storing successful quotes in the
+// cache and evaluating alert rules against them. Demo data served by the
+// fallback is never cached.
+func (s *Service) refreshSymbols(ctx context.Context, symbols []string) {
+	for _, symbol := range symbols {
+		if ctx.Err() != nil {
+			return
+		}
+		stock, err := s.GetFreshPriceCtx(ctx, symbol)
+		if err != nil {
+			if ctx.Err() == nil {
+				logging.Warnf("Background refresh of %s failed: %v", symbol, err)
+			}
+			continue
+		}
+		s.evaluateAlerts(ctx, stock)
+	}
+}
@@ -1,130 +1,658 @@
 package stock
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"math"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/cache"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/coalesce"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/health"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/limiter"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/tracing"
 )
 
+// DefaultRateLimit is the default minimum delay between upstream requests
+const DefaultRateLimit = 2 * time.Second
+
+// DefaultCacheTTL is how long quotes are served from cache; prices move, so
+// it only absorbs bursts of identical requests
+const DefaultCacheTTL = 15 * time.Second
+
+// DefaultMaxConcurrency is the default limit on concurrent upstream requests
+const DefaultMaxConcurrency = 8
+
+// DefaultLatencyEstimate is the assumed upstream latency before any request
+// has been timed
+const DefaultLatencyEstimate = 500 * time.Millisecond
+
+// UpstreamName identifies the stock upstream in health reporting
+const UpstreamName = "yahoo_finance"
+
 // Service provides high-level stock operations with caching and logging
 type Service struct {
 	client      *Client
-	lastRequest time.Time
+	health      *health.Tracker
+	rateLimit   time.Duration
+	lastRequest map[string]time.Time
 	mutex       sync.Mutex
+
+	// upstream bounds concurrent upstream requests; nil means unlimited
+	upstream *limiter.Limiter
+
+	cache    cache.Cache
+	cacheTTL time.Duration
+
+	// inFlight coalesces concurrent fetches of the same symbol
+	inFlight coalesce.Group[*models.StockResponse]
+
+	// providers are asked for quotes in order, by default Yahoo Finance
+	// then demo data
+	providers []StockProvider
+
+	// fallback decides which upstream status codes are answered with demo
+	// data; nil disables the fallback
+	fallback func(code int) bool
+	// demoFallbacks counts the quotes answered with demo data after an
+	// upstream error, by status code; guarded by mutex
+	demoFallbacks map[int]int64
+
+	// responseBudget caps the expected time of a live quote; zero disables it
+	responseBudget time.Duration
+	// latencyEstimate is a moving average of upstream latency, guarded by mutex
+	latencyEstimate time.Duration
+
+	// maintenance serves only cached and demo data, never calling the upstream
+	maintenance bool
+
+	// companyNames overrides the company names shown in summaries, by symbol
+	companyNames map[string]string
+
+	// allowedSymbols, when set, lists the only symbols that can be quoted;
+	// deniedSymbols can never be quoted
+	allowedSymbols map[string]bool
+	deniedSymbols  map[string]bool
+
+	// alerts posts quotes fetched by background refresh to webhooks
+	alerts alertEvaluator
+
+	// clock tells the time for rate limiting, cache ages, and demo data
+	clock Clock
+}
+
+// maxTrackedSymbols bounds the per-symbol rate limit state; beyond it, entries
+// whose delay has already elapsed are dropped
+const maxTrackedSymbols = 1024
+
+// Option configures optional service behavior
+type Option func(*Service)
+
+// WithHealthTracker records upstream successes and failures in the given tracker
+func WithHealthTracker(tracker *health.Tracker) Option {
+	return func(s *Service) {
+		s.health = tracker
+	}
+}
+
+// WithCache serves repeated requests for the same symbol from c for ttl,
+// without waiting on the rate limiter. A ttl of zero or less disables caching.
+func WithCache(c cache.Cache, ttl time.Duration) Option {
+	return func(s *Service) {
+		s.cache = nil
+		if ttl > 0 {
+			s.cache = c
+			s.cacheTTL = ttl
+		}
+	}
+}
+
+// WithResponseBudget serves demo data right away when a live quote, including
+// the rate limit wait and the estimated upstream latency, is expected to take
+// longer than budget. Zero or less disables the budget.
+func WithResponseBudget(budget time.Duration) Option {
+	return func(s *Service) {
+		s.responseBudget = budget
+	}
+}
+
+// WithFallback sets the predicate deciding which upstream status codes are
+// answered with demo data instead of an error; nil disables the fallback
+func WithFallback(fallback func(code int) bool) Option {
+	return func(s *Service) {
+		s.fallback = fallback
+	}
+}
+
+// WithFallbackCodes answers exactly the given upstream status codes with demo
+// data; with no codes the fallback is disabled
+func WithFallbackCodes(codes ...int) Option {
+	set := make(map[int]bool, len(codes))
+	for _, code := range codes {
+		set[code] = true
+	}
+	return WithFallback(func(code int) bool {
+		return set[code]
+	})
+}
+
+// WithRateLimit sets the minimum delay between upstream requests
+func WithRateLimit(delay time.Duration) Option {
+	return func(s *Service) {
+		s.rateLimit = delay
+	}
+}
+
+// WithMaxConcurrency limits the number of upstream requests in flight at
+// once; further requests wait for a free slot. Zero or less removes the limit.
+func WithMaxConcurrency(n int) Option {
+	return func(s *Service) {
+		s.upstream = limiter.New(n)
+	}
+}
+
+// WithClientOptions applies client options, such as custom base URLs, to the
+// service's upstream client
+func WithClientOptions(opts ...ClientOption) Option {
+	return func(s *Service) {
+		for _, opt := range opts {
+			opt(s.client)
+		}
+	}
+}
+
+// WithMaintenance puts the service in maintenance mode: quotes are served
+// from the cache or demo data only and no upstream request is made. Requests
+// that cannot be answered that way fail with a 503.
+func WithMaintenance(enabled bool) Option {
+	return func(s *Service) {
+		s.maintenance = enabled
+	}
+}
+
+// WithClock reads the current time from c instead of the system clock; nil
+// restores the system clock
+func WithClock(c Clock) Option {
+	return func(s *Service) {
+		s.clock = c
+		if c == nil {
+			s.clock = SystemClock
+		}
+	}
+}
+
+// WithTracer records a span for every upstream request
+func WithTracer(t tracing.Tracer) Option {
+	return func(s *Service) {
+		s.client.SetTracer(t)
+	}
 }
 
 // NewService creates a new stock service
-func NewService(httpClient HTTPClient) *Service {
-	return &Service{
-		client: NewClient(httpClient),
+func NewService(httpClient HTTPClient, opts ...Option) *Service {
+	service := &Service{
+		client:          NewClient(httpClient),
+		rateLimit:       DefaultRateLimit,
+		lastRequest:     make(map[string]time.Time),
+		latencyEstimate: DefaultLatencyEstimate,
+		fallback:        DefaultFallback,
+		clock:           SystemClock,
 	}
+	service.alerts.cooldown = DefaultAlertCooldown
+	service.alerts.timeout = DefaultAlertTimeout
+	service.alerts.client = newAlertHTTPClient()
+	WithMaxConcurrency(DefaultMaxConcurrency)(service)
+
+	for _, opt := range opts {
+		opt(service)
+	}
+	if len(service.providers) == 0 {
+		service.providers = service.defaultProviders()
+	}
+
+	return service
 }
 
-// rateLimitDelay enforces a minimum delay between API requests
-func (s *Service) rateLimitDelay() {
+// rateLimitDelayCtx enforces a minimum delay between API requests for the
+// same symbol. Each caller reserves its slot under the lock and waits outside
+// it, so requests for different symbols proceed in parallel. When the wait
+// would outlast the deadline of ctx, it fails right away with a 503 APIError
+// wrapping context.DeadlineExceeded instead of sleeping first. The wait ends
+// early with ctx.Err() when ctx is done. Either way the slot is given back if
+// no later request has queued behind it.
+func (s *Service) rateLimitDelayCtx(ctx context.Context, symbol string) error {
+	key := strings.ToUpper(strings.TrimSpace(symbol))
+	now := s.clock.Now()
+
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	if len(s.lastRequest) >= maxTrackedSymbols {
+		for tracked, last := range s.lastRequest {
+			if now.Sub(last) >= s.rateLimit {
+				delete(s.lastRequest, tracked)
+			}
+		}
+	}
 
-	const minDelay = 2 * time.Second // 2 seconds between requests
-	timeSinceLastRequest := time.Since(s.lastRequest)
+	previous, tracked := s.lastRequest[key]
+	next := now
+	if tracked && previous.Add(s.rateLimit).After(now) {
+		next = previous.Add(s.rateLimit)
+	}
+	s.lastRequest[key] = next
+	s.mutex.Unlock()
 
-	if timeSinceLastRequest < minDelay {
-		sleepTime := minDelay - timeSinceLastRequest
-		log.Printf("Rate limiting: sleeping for %v", sleepTime)
-		time.Sleep(sleepTime)
+	sleepTime := next.Sub(now)
+	if sleepTime <= 0 {
+		return nil
 	}
 
-	s.lastRequest = time.Now()
+	releaseSlot := func() {
+		s.mutex.Lock()
+		if s.lastRequest[key].Equal(next) {
+			s.lastRequest[key] = previous
+		}
+		s.mutex.Unlock()
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && sleepTime > time.Until(deadline) {
+		releaseSlot()
+		logging.Debugf("Rate limiting %s: a %v wait exceeds the request deadline", key, sleepTime)
+		return models.NewWrappedAPIError("Stock",
+			fmt.Sprintf("Rate limit wait of %v exceeds the request deadline", sleepTime.Round(time.Millisecond)),
+			503, context.DeadlineExceeded)
+	}
+
+	logging.Debugf("Rate limiting %s: sleeping for %v", key, sleepTime)
+	timer := time.NewTimer(sleepTime)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		releaseSlot()
+		return ctx.Err()
+	}
+}
+
+// expectedWait returns how long a live quote for symbol is expected to take:
+// the remaining rate limit delay plus the estimated upstream latency
+func (s *Service) expectedWait(symbol string) time.Duration {
+	key := strings.ToUpper(strings.TrimSpace(symbol))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	wait := s.latencyEstimate
+	if last, tracked := s.lastRequest[key]; tracked {
+		if remaining := last.Add(s.rateLimit).Sub(s.clock.Now()); remaining > 0 {
+			wait += remaining
+		}
+	}
+	return wait
+}
+
+// recordLatency folds an observed upstream latency into the estimate
+func (s *Service) recordLatency(latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.latencyEstimate = (s.latencyEstimate*7 + latency) / 8
 }
 
 // GetCurrentPrice fetches current stock price for a symbol with enhanced error handling
 func (s *Service) GetCurrentPrice(symbol string) (*models.StockResponse, error) {
-	start := time.Now()
+	return s.GetCurrentPriceCtx(context.Background(), symbol)
+}
 
-	log.Printf("Fetching stock price for symbol: %s", symbol)
+// GetCurrentPriceCtx fetches current stock price for a symbol, canceling the
+// upstream request when ctx is done. Quotes cached within the cache TTL are
+// returned without an upstream request; their Metadata.CachedAt is set. With
+// a response budget, demo data is returned instead of a live quote expected
+// to exceed it. Symbols excluded by the allow or deny list fail with a 403.
+func (s *Service) GetCurrentPriceCtx(ctx context.Context, symbol string) (*models.StockResponse, error) {
+	if err := s.checkSymbolAccess(symbol); err != nil {
+		return nil, err
+	}
 
-	// Apply rate limiting
-	s.rateLimitDelay()
+	if cached, found := s.cachedQuote(symbol); found {
+		logging.Debugf("Serving cached stock price for symbol: %s", symbol)
+		return cached, nil
+	}
+
+	if s.responseBudget > 0 {
+		if wait := s.expectedWait(symbol); wait > s.responseBudget {
+			if demoStock, err := s.demoStock(symbol); err == nil {
+				logging.Infof("Live quote for %s expected to take %v (budget %v), serving demo data", symbol, wait, s.responseBudget)
+				demoStock.Metadata.Source = BudgetDemoSource
+				return demoStock, nil
+			}
+		}
+	}
+
+	return s.GetFreshPriceCtx(ctx, symbol)
+}
 
-	stock, err := s.client.GetStockPriceWithValidation(symbol)
+// GetFreshPriceCtx fetches the current stock price from the upstream,
+// bypassing the cache, and stores the result for later cached requests.
+// Concurrent requests for the same symbol share one upstream fetch.
+func (s *Service) GetFreshPriceCtx(ctx context.Context, symbol string) (*models.StockResponse, error) {
+	if err := s.checkSymbolAccess(symbol); err != nil {
+		return nil, err
+	}
+	if s.maintenance {
+		return s.maintenancePrice(symbol)
+	}
+
+	stock, err := s.inFlight.Do(ctx, quoteCacheKey(symbol), func(ctx context.Context) (*models.StockResponse, error) {
+		return s.fetchPrice(ctx, symbol)
+	})
 	if err != nil {
-		log.Printf("Error fetching stock price for %s: %v", symbol, err)
-
-		// Check if it's a rate limit error (429), auth error (401/403), or server error (5xx) - fall back to demo mode
-		if apiErr, ok := err.(*models.APIError); ok && (apiErr.Code == 401 || apiErr.Code == 403 || apiErr.Code == 429 || apiErr.Code >= 500) {
-			log.Printf("API error %d, falling back to demo mode for %s", apiErr.Code, symbol)
-			demoStock, demoErr := GetDemoStock(symbol)
-			if demoErr != nil {
-				log.Printf("Demo mode also failed for %s: %v", symbol, demoErr)
-				return nil, err // Return original error
+		return nil, err
+	}
+
+	// Each caller gets its own copy of the shared response
+	copied := *stock
+	return &copied, nil
+}
+
+// fetchPrice waits for the rate limiter and asks the providers for a quote
+// in order, moving to the next one only when the fallback policy accepts
+// the status code of the first failure. By default that answers rate limit
+// (429), auth (401/403), and server (5xx) errors with demo data.
+func (s *Service) fetchPrice(ctx context.Context, symbol string) (*models.StockResponse, error) {
+	start := s.clock.Now()
+
+	logging.Debugf("Fetching stock price for symbol: %s", symbol)
+
+	// Apply rate limiting
+	if err := s.rateLimitDelayCtx(ctx, symbol); err != nil {
+		if errors.Is(err, context.Canceled) {
+			logging.Warnf("Stock request for %s canceled while rate limited: %v", symbol, err)
+		} else {
+			logging.Warnf("Stock request for %s timed out while rate limited: %v", symbol, err)
+		}
+		return nil, err
+	}
+
+	var firstErr error
+	var fallbackCode int
+	for _, provider := range s.providers {
+		if firstErr != nil {
+			code, ok := s.fallbackCode(firstErr)
+			if !ok {
+				break
+			}
+			fallbackCode = code
+			logging.Warnf("Upstream error (%v), falling back to %T for %s", firstErr, provider, symbol)
+		}
+
+		stock, err := s.quoteFrom(ctx, provider, symbol)
+		if err != nil {
+			if ctx.Err() != nil {
+				// The caller gave up; neither a fallback nor a health failure is warranted
+				logging.Warnf("Stock request for %s canceled: %v", symbol, ctx.Err())
+				return nil, err
+			}
+			if firstErr == nil {
+				logging.Errorf("Error fetching stock price for %s: %v", symbol, err)
+				firstErr = err
+			} else {
+				logging.Errorf("Fallback for %s also failed: %v", symbol, err)
 			}
-			log.Printf("Successfully returned demo data for %s", symbol)
-			return demoStock, nil
+			continue
 		}
 
+		if firstErr != nil {
+			count, total := s.recordDemoFallback(fallbackCode)
+			logging.Warnf("Serving %s data for %s after upstream status %d (%d fallbacks for status %d, %d in total)",
+				stock.Metadata.Source, symbol, fallbackCode, count, fallbackCode, total)
+			return stock, nil
+		}
+
+		if s.cache != nil {
+			cached := *stock
+			cachedAt := s.clock.Now()
+			cached.Metadata.CachedAt = &cachedAt
+			s.cache.Set(quoteCacheKey(symbol), cached, s.cacheTTL)
+		}
+
+		duration := s.clock.Now().Sub(start)
+		logging.Infof("Successfully fetched stock price for %s in %v", symbol, duration)
+		return stock, nil
+	}
+
+	// The first error is the one from the live source, not from a fallback
+	return nil, firstErr
+}
+
+// maintenancePrice answers a quote request in maintenance mode from the
+// cache, then demo data, or with a 503 for symbols without either
+func (s *Service) maintenancePrice(symbol string) (*models.StockResponse, error) {
+	if cached, found := s.cachedQuote(symbol); found {
+		return cached, nil
+	}
+
+	demoStock, err := s.demoStock(strings.ToUpper(strings.TrimSpace(symbol)))
+	if err != nil {
+		logging.Debugf("No demo quote for %s in maintenance mode: %v", symbol, err)
+		return nil, errMaintenance()
+	}
+	demoStock.Metadata.Source = MaintenanceDemoSource
+	return demoStock, nil
+}
+
+// demoStock returns demo data for symbol as of the service clock
+func (s *Service) demoStock(symbol string) (*models.StockResponse, error) {
+	return GetDemoStockAt(symbol, s.clock.Now())
+}
+
+// errMaintenance is returned for requests that need the upstream while the
+// service is in maintenance mode
+func errMaintenance() error {
+	return models.NewAPIError("Stock", "Live stock data is unavailable in maintenance mode", 503)
+}
+
+// SearchSymbol looks up ticker symbols by company name, e.g. "apple" for AAPL
+func (s *Service) SearchSymbol(query string) ([]models.SymbolMatch, error) {
+	return s.SearchSymbolCtx(context.Background(), query)
+}
+
+// SearchSymbolCtx looks up ticker symbols by company name, canceling the
+// upstream request when ctx is done. Unlike quotes, searches have no demo
+// fallback.
+func (s *Service) SearchSymbolCtx(ctx context.Context, query string) ([]models.SymbolMatch, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, models.NewAPIError("Stock", "Search query cannot be empty", 400)
+	}
+	if len(query) > maxSearchQueryLength {
+		return nil, models.NewAPIError("Stock", fmt.Sprintf("Search query must be at most %d characters", maxSearchQueryLength), 400)
+	}
+	if s.maintenance {
+		return nil, errMaintenance()
+	}
+
+	if err := s.upstream.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	matches, err := s.client.SearchSymbolsCtx(ctx, query)
+	s.upstream.Release()
+	if err != nil {
+		if ctx.Err() == nil && isUpstreamFailure(err) {
+			s.health.RecordFailure(UpstreamName)
+		}
+		logging.Errorf("Error searching symbols for %q: %v", query, err)
 		return nil, err
 	}
 
-	duration := time.Since(start)
-	log.Printf("Successfully fetched stock price for %s in %v", symbol, duration)
+	s.health.RecordSuccess(UpstreamName)
+	return matches, nil
+}
+
+// maxSearchQueryLength bounds the company name passed to the search endpoint
+const maxSearchQueryLength = 100
 
-	return stock, nil
+// quoteCacheKey normalizes symbol for use as a cache key
+func quoteCacheKey(symbol string) string {
+	return strings.ToUpper(strings.TrimSpace(symbol))
+}
+
+// cachedQuote returns a copy of the cached quote for symbol, if any
+func (s *Service) cachedQuote(symbol string) (*models.StockResponse, bool) {
+	if s.cache == nil {
+		return nil, false
+	}
+
+	var stock models.StockResponse
+	if !cache.Load(s.cache, quoteCacheKey(symbol), &stock) {
+		return nil, false
+	}
+	return &stock, true
+}
+
+// fallbackCode returns the upstream status code err carries and whether the
+// fallback policy answers it with demo data
+func (s *Service) fallbackCode(err error) (int, bool) {
+	var apiErr *models.APIError
+	if s.fallback == nil || !errors.As(err, &apiErr) || !s.fallback(apiErr.Code) {
+		return 0, false
+	}
+	return apiErr.Code, true
+}
+
+// recordDemoFallback counts a quote answered with demo data after an
+// upstream error with status code, returning the count for that code and
+// the total
+func (s *Service) recordDemoFallback(code int) (count, total int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.demoFallbacks == nil {
+		s.demoFallbacks = make(map[int]int64)
+	}
+	s.demoFallbacks[code]++
+	for _, n := range s.demoFallbacks {
+		total += n
+	}
+	return s.demoFallbacks[code], total
+}
+
+// DemoFallbacks returns how many quotes were answered with demo data after
+// an upstream error, keyed by the status code that triggered the fallback.
+// Demo data served for a response budget or in maintenance mode is not
+// counted.
+func (s *Service) DemoFallbacks() map[int]int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	counts := make(map[int]int64, len(s.demoFallbacks))
+	for code, n := range s.demoFallbacks {
+		counts[code] = n
+	}
+	return counts
+}
+
+// CacheName is the key of the quote cache in CacheStats
+const CacheName = "stock"
+
+// CacheStats returns the statistics of the quote cache keyed by CacheName,
+// or no entry when the cache does not count its lookups
+func (s *Service) CacheStats() map[string]cache.Stats {
+	stats := make(map[string]cache.Stats, 1)
+	if reporter, ok := s.cache.(cache.StatsReporter); ok {
+		stats[CacheName] = reporter.Stats()
+	}
+	return stats
+}
+
+// isUpstreamFailure reports whether an error means the upstream is unusable
+// (auth rejected, rate limited, or unavailable) rather than a bad request
+func isUpstreamFailure(err error) bool {
+	if errors.Is(err, models.ErrRateLimited) || errors.Is(err, models.ErrUpstreamUnavailable) {
+		return true
+	}
+
+	var apiErr *models.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code == 401 || apiErr.Code == 403
+	}
+	return false
 }
 
 // GetDatadogPrice is a convenience method to get Datadog stock price
 func (s *Service) GetDatadogPrice() (*models.StockResponse, error) {
-	return s.GetCurrentPrice("DDOG")
+	return s.GetDatadogPriceCtx(context.Background())
+}
+
+// GetDatadogPriceCtx is GetDatadogPrice with a context that cancels the upstream request
+func (s *Service) GetDatadogPriceCtx(ctx context.Context) (*models.StockResponse, error) {
+	return s.GetCurrentPriceCtx(ctx, "DDOG")
+}
+
+// changeIcons maps a change direction to the arrow shown in summaries
+var changeIcons = map[string]string{
+	"up":      "↗",
+	"down":    "↘",
+	"neutral": "→",
 }
 
 // GetStockSummary returns a human-readable stock summary
 func (s *Service) GetStockSummary(symbol string) (string, error) {
-	stock, err := s.GetCurrentPrice(symbol)
+	return s.GetStockSummaryCtx(context.Background(), symbol)
+}
+
+// GetStockSummaryCtx returns a human-readable stock summary, canceling the
+// upstream request when ctx is done
+func (s *Service) GetStockSummaryCtx(ctx context.Context, symbol string) (string, error) {
+	stock, err := s.GetCurrentPriceCtx(ctx, symbol)
 	if err != nil {
 		return "", err
 	}
 
-	direction := "unchanged"
-	changeIcon := "→"
-
-	if stock.Change > 0 {
-		direction = "up"
-		changeIcon = "↗"
-	} else if stock.Change < 0 {
-		direction = "down"
-		changeIcon = "↘"
-	}
-
-	marketStateText := ""
-	switch stock.MarketState {
-	case models.MarketStateRegular:
-		marketStateText = "Market Open"
-	case models.MarketStatePremarket:
-		marketStateText = "Pre-Market"
-	case models.MarketStatePostmarket:
-		marketStateText = "After Hours"
-	case models.MarketStateClosed:
-		marketStateText = "Market Closed"
+	direction := stock.GetChangeDirection()
+	changeIcon := changeIcons[direction]
+	if direction == "neutral" {
+		direction = "unchanged"
 	}
 
 	summary := fmt.Sprintf(
-		"%s (%s): $%.2f %s %.2f (%.2f%%) - %s. %s. Last updated: %s",
-		stock.CompanyName,
+		"%s (%s): $%.2f %s %.2f (%.2f%%) - %s. %s. Volume: %s. Last updated: %s",
+		s.displayName(stock),
 		stock.Symbol,
 		stock.Price,
 		changeIcon,
 		stock.Change,
 		stock.ChangePercent,
 		direction,
-		marketStateText,
+		stock.MarketState.DisplayText(),
+		stock.FormattedVolume(),
 		stock.Metadata.Timestamp.Format("15:04 MST"),
 	)
 
 	return summary, nil
 }
 
+// Ping checks that Yahoo Finance answers by requesting a DDOG quote. It skips
+// the rate limiter and never falls back to demo data.
+func (s *Service) Ping(ctx context.Context) error {
+	if s.maintenance {
+		return errMaintenance()
+	}
+	if err := s.upstream.Acquire(ctx); err != nil {
+		return err
+	}
+	defer s.upstream.Release()
+
+	_, err := s.client.GetStockPriceCtx(ctx, "DDOG")
+	return err
+}
+
 // GetDatadogSummary returns a formatted summary for Datadog stock
 func (s *Service) GetDatadogSummary() (string, error) {
 	return s.GetStockSummary("DDOG")
@@ -132,12 +660,18 @@ func (s *Service) GetDatadogSummary() (string, error) {
 
 // IsMarketOpen checks if the market is currently open based on the stock data
 func (s *Service) IsMarketOpen(symbol string) (bool, error) {
-	stock, err := s.GetCurrentPrice(symbol)
+	return s.IsMarketOpenCtx(context.Background(), symbol)
+}
+
+// IsMarketOpenCtx checks if the market is currently open based on the stock
+// data, canceling the upstream request when ctx is done
+func (s *Service) IsMarketOpenCtx(ctx context.Context, symbol string) (bool, error) {
+	stock, err := s.GetCurrentPriceCtx(ctx, symbol)
 	if err != nil {
 		return false, err
 	}
 
-	return stock.MarketState == models.MarketStateRegular, nil
+	return stock.MarketState.IsOpen(), nil
 }
 
 // GetPriceChange returns formatted price change information
@@ -147,12 +681,83 @@ func (s *Service) GetPriceChange(symbol string) (string, error) {
 		return "", err
 	}
 
-	sign := ""
-	if stock.Change > 0 {
-		sign = "+"
+	return fmt.Sprintf("%s%.2f (%.2f%%)", stock.ChangeSign(), math.Abs(stock.Change), stock.ChangePercent), nil
+}
+
+// FetchPrices fetches quotes for the given symbols in order, calling yield
+// with each result as soon as it is available. Requests go through
+// GetCurrentPriceCtx, so the rate limiter and demo fallback apply. Once ctx
+// is done the remaining symbols are not fetched.
+func (s *Service) FetchPrices(ctx context.Context, symbols []string, yield func(symbol string, stock *models.StockResponse, err error)) {
+	for _, symbol := range symbols {
+		if ctx.Err() != nil {
+			return
+		}
+		stock, err := s.GetCurrentPriceCtx(ctx, symbol)
+		yield(symbol, stock, err)
+	}
+}
+
+// GetMovers fetches quotes for the given symbols and returns up to topN
+// gainers (largest ChangePercent first) and losers (smallest first).
+// Symbols that cannot be fetched are skipped; an error is returned only if
+// none could be fetched. A topN of zero or less returns all movers.
+func (s *Service) GetMovers(symbols []string, topN int) (gainers, losers []*models.StockResponse, err error) {
+	return s.GetMoversCtx(context.Background(), symbols, topN)
+}
+
+// GetMoversCtx is GetMovers with a context that cancels the upstream requests
+func (s *Service) GetMoversCtx(ctx context.Context, symbols []string, topN int) (gainers, losers []*models.StockResponse, err error) {
+	if len(symbols) == 0 {
+		return nil, nil, models.NewAPIError("Stock Service", "At least one symbol is required", 400)
+	}
+
+	var lastErr error
+	fetched := 0
+	s.FetchPrices(ctx, symbols, func(symbol string, stock *models.StockResponse, fetchErr error) {
+		if fetchErr != nil {
+			lastErr = fetchErr
+			return
+		}
+		fetched++
+
+		if stock.ChangePercent > 0 {
+			gainers = append(gainers, stock)
+		} else if stock.ChangePercent < 0 {
+			losers = append(losers, stock)
+		}
+	})
+
+	if ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	}
+	if fetched == 0 {
+		return nil, nil, lastErr
+	}
+
+	sort.SliceStable(gainers, func(i, j int) bool {
+		if gainers[i].ChangePercent != gainers[j].ChangePercent {
+			return gainers[i].ChangePercent > gainers[j].ChangePercent
+		}
+		return gainers[i].Symbol < gainers[j].Symbol
+	})
+	sort.SliceStable(losers, func(i, j int) bool {
+		if losers[i].ChangePercent != losers[j].ChangePercent {
+			return losers[i].ChangePercent < losers[j].ChangePercent
+		}
+		return losers[i].Symbol < losers[j].Symbol
+	})
+
+	if topN > 0 {
+		if len(gainers) > topN {
+			gainers = gainers[:topN]
+		}
+		if len(losers) > topN {
+			losers = losers[:topN]
+		}
 	}
 
-	return fmt.Sprintf("%s%.2f (%.2f%%)", sign, stock.Change, stock.ChangePercent), nil
+	return gainers, losers, nil
 }
 
 // ValidateAndNormalizeSymbol validates and normalizes a stock symbol
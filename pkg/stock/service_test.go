@@ -1,12 +1,21 @@
 package stock
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/JSGette/agent_summit_bazel_workshop/internal/testutils"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/cache"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
 )
 
@@ -167,13 +176,13 @@ func TestService_GetStockSummary(t *testing.T) {
 			name:         "positive change",
 			symbol:       "DDOG",
 			mockResponse: testutils.YahooFinanceStockResponse,
-			wantContains: []string{"DDOG", "125.67", "↗", "up", "Market Open"},
+			wantContains: []string{"DDOG", "125.67", "↗", "up", "Market Open", "Volume: 1.23M"},
 		},
 		{
 			name:         "market closed",
 			symbol:       "DDOG",
 			mockResponse: testutils.YahooFinanceMarketClosed,
-			wantContains: []string{"DDOG", "125.67", "↘", "down", "Market Closed"},
+			wantContains: []string{"DDOG", "125.67", "↘", "down", "Market Closed", "Volume: 987.65K"},
 		},
 	}
 
@@ -201,6 +210,116 @@ func TestService_GetStockSummary(t *testing.T) {
 	}
 }
 
+func TestService_GetStockSummary_CompanyNames(t *testing.T) {
+	const unnamedQuote = `{"quoteResponse": {"result": [{"symbol": "DDOG", "regularMarketPrice": 125.67,
+		"regularMarketPreviousClose": 123.33, "marketState": "REGULAR"}], "error": null}}`
+
+	path := filepath.Join(t.TempDir(), "names.json")
+	if err := os.WriteFile(path, []byte(`{"ddog": "Datadog"}`), 0o600); err != nil {
+		t.Fatalf("Failed to write names file: %v", err)
+	}
+	names, err := LoadCompanyNames(path)
+	if err != nil {
+		t.Fatalf("Unexpected error loading names: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		opts         []Option
+		mockResponse string
+		wantPrefix   string
+	}{
+		{"upstream name", nil, testutils.YahooFinanceStockResponse, "Datadog, Inc. (DDOG)"},
+		{"override", []Option{WithCompanyNames(names)}, testutils.YahooFinanceStockResponse, "Datadog (DDOG)"},
+		{"override of an unnamed quote", []Option{WithCompanyNames(names)}, unnamedQuote, "Datadog (DDOG)"},
+		{"unnamed quote falls back to the symbol", nil, unnamedQuote, "DDOG (DDOG)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse("https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG", 200, tt.mockResponse)
+			service := NewService(mockClient, append([]Option{WithRateLimit(0)}, tt.opts...)...)
+
+			summary, err := service.GetStockSummary("DDOG")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !strings.HasPrefix(summary, tt.wantPrefix+":") {
+				t.Errorf("Expected summary to start with %q, got: %s", tt.wantPrefix, summary)
+			}
+		})
+	}
+}
+
+func TestLoadCompanyNames_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"not_json", "DDOG=Datadog"},
+		{"empty_name", `{"DDOG": "  "}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("Failed to write names file: %v", err)
+			}
+			if _, err := LoadCompanyNames(path); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	if _, err := LoadCompanyNames(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestService_GetCurrentPrice_SymbolAccess(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		symbol   string
+		wantCode int
+	}{
+		{"no lists", nil, "DDOG", 0},
+		{"allowed symbol", []Option{WithAllowedSymbols("ddog", "AAPL")}, "DDOG", 0},
+		{"symbol not in the allowlist", []Option{WithAllowedSymbols("AAPL")}, "DDOG", 403},
+		{"denied symbol", []Option{WithDeniedSymbols("DDOG")}, "ddog", 403},
+		{"denied wins over allowed", []Option{WithAllowedSymbols("DDOG"), WithDeniedSymbols("DDOG")}, "DDOG", 403},
+		{"invalid symbol is still a 400", []Option{WithAllowedSymbols("AAPL")}, "DD0G", 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+			mockClient.AddResponse(expectedURL, 200, testutils.YahooFinanceStockResponse)
+			service := NewService(mockClient, append([]Option{WithRateLimit(0)}, tt.opts...)...)
+
+			_, err := service.GetCurrentPrice(tt.symbol)
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+
+			var apiErr *models.APIError
+			if !errors.As(err, &apiErr) || apiErr.Code != tt.wantCode {
+				t.Fatalf("Expected a %d APIError, got %v", tt.wantCode, err)
+			}
+			if calls := mockClient.GetCallCount(expectedURL); calls != 0 {
+				t.Errorf("Expected no upstream request, got %d", calls)
+			}
+		})
+	}
+}
+
 func TestService_GetDatadogSummary(t *testing.T) {
 	mockClient := testutils.NewMockHTTPClient()
 	service := NewService(mockClient)
@@ -427,4 +546,1108 @@ func TestStockResponse_Methods(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("ChangeSign", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			change float64
+			want   string
+		}{
+			{"positive change", 1.5, "+"},
+			{"negative change", -1.5, "-"},
+			{"zero change", 0.0, ""},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				stock := &models.StockResponse{Change: tt.change}
+				if got := stock.ChangeSign(); got != tt.want {
+					t.Errorf("ChangeSign() = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+}
+
+func TestService_GetMovers(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	service := NewService(mockClient, WithRateLimit(0))
+
+	quotes := map[string]float64{
+		"AAA":  3.5,
+		"BBB":  -2.25,
+		"CCC":  1.1,
+		"DDD":  -4.0,
+		"EEE":  0,
+		"FFF":  3.5,
+		"GGG":  -0.5,
+		"HHHH": 0.2,
+	}
+	for symbol, changePercent := range quotes {
+		expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=" + symbol
+		mockClient.AddResponse(expectedURL, 200, testutils.YahooFinanceQuote(symbol, 100, changePercent))
+	}
+
+	symbols := []string{"AAA", "BBB", "CCC", "DDD", "EEE", "FFF", "GGG", "HHHH", "NOPE"}
+	gainers, losers, err := service.GetMovers(symbols, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var gotGainers, gotLosers []string
+	for _, stock := range gainers {
+		gotGainers = append(gotGainers, stock.Symbol)
+	}
+	for _, stock := range losers {
+		gotLosers = append(gotLosers, stock.Symbol)
+	}
+
+	// Ties are broken alphabetically; unchanged and unknown symbols are left out
+	if want := "AAA,FFF,CCC"; strings.Join(gotGainers, ",") != want {
+		t.Errorf("Expected gainers %s, got %v", want, gotGainers)
+	}
+	if want := "DDD,BBB,GGG"; strings.Join(gotLosers, ",") != want {
+		t.Errorf("Expected losers %s, got %v", want, gotLosers)
+	}
+}
+
+func TestService_GetMovers_AllFail(t *testing.T) {
+	service := NewService(testutils.NewMockHTTPClient(), WithRateLimit(0))
+
+	if _, _, err := service.GetMovers([]string{"NOPE"}, 3); err == nil {
+		t.Errorf("Expected error when no quotes could be fetched")
+	}
+
+	if _, _, err := service.GetMovers(nil, 3); err == nil {
+		t.Errorf("Expected error for empty symbol list")
+	}
+}
+
+func TestService_GetCurrentPriceCtx_Canceled(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse("https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG", 200, testutils.YahooFinanceStockResponse)
+	service := NewService(mockClient)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := service.GetCurrentPriceCtx(ctx, "DDOG")
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if result != nil {
+		t.Errorf("Expected no demo fallback for a canceled request, got %+v", result)
+	}
+}
+
+func TestService_RateLimitPerSymbol(t *testing.T) {
+	const rateLimit = 200 * time.Millisecond
+
+	mockClient := testutils.NewMockHTTPClient()
+	for _, symbol := range []string{"AAA", "BBB"} {
+		expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=" + symbol
+		mockClient.AddResponse(expectedURL, 200, testutils.YahooFinanceQuote(symbol, 100, 1))
+	}
+	service := NewService(mockClient, WithRateLimit(rateLimit))
+
+	t.Run("different symbols are not serialized", func(t *testing.T) {
+		start := time.Now()
+		for _, symbol := range []string{"AAA", "BBB"} {
+			if _, err := service.GetCurrentPrice(symbol); err != nil {
+				t.Fatalf("Unexpected error for %s: %v", symbol, err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed >= rateLimit {
+			t.Errorf("Expected independent symbols to skip the delay, took %v", elapsed)
+		}
+	})
+
+	t.Run("same symbol is throttled", func(t *testing.T) {
+		start := time.Now()
+		if _, err := service.GetCurrentPrice("aaa"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < rateLimit/2 {
+			t.Errorf("Expected a repeated symbol to wait for the rate limit, took %v", elapsed)
+		}
+	})
+}
+
+func TestService_GetCurrentPriceCtx_CanceledWhileRateLimited(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+	mockClient.AddResponse(expectedURL, 200, testutils.YahooFinanceStockResponse)
+	service := NewService(mockClient, WithRateLimit(2*time.Second))
+
+	if _, err := service.GetCurrentPrice("DDOG"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := service.GetCurrentPriceCtx(ctx, "DDOG")
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the rate limit wait to be interrupted, took %v", elapsed)
+	}
+	if calls := mockClient.GetCallCount(expectedURL); calls != 1 {
+		t.Errorf("Expected the canceled request not to reach the upstream, got %d calls", calls)
+	}
+}
+
+func TestService_RateLimitDelayCtx_DeadlineTooShort(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+	mockClient.AddResponse(expectedURL, 200, testutils.YahooFinanceStockResponse)
+	service := NewService(mockClient, WithRateLimit(2*time.Second))
+
+	if _, err := service.GetCurrentPrice("DDOG"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	service.mutex.Lock()
+	reserved := service.lastRequest["DDOG"]
+	service.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := service.rateLimitDelayCtx(ctx, "DDOG")
+	elapsed := time.Since(start)
+
+	var apiErr *models.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 503 {
+		t.Fatalf("Expected a 503 APIError, got %v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the error to wrap context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed > 100*time.Millisecond {
+		t.Errorf("Expected an immediate error, took %v", elapsed)
+	}
+	if ctx.Err() != nil {
+		t.Error("Expected the error before the deadline passed")
+	}
+
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+	if !service.lastRequest["DDOG"].Equal(reserved) {
+		t.Errorf("Expected the rejected request to give its slot back, got %v instead of %v",
+			service.lastRequest["DDOG"], reserved)
+	}
+}
+
+// inFlightClient records the peak number of concurrent upstream requests
+type inFlightClient struct {
+	*testutils.MockHTTPClient
+
+	mutex    sync.Mutex
+	inFlight int
+	peak     int
+}
+
+func (c *inFlightClient) GetWithContext(ctx context.Context, url string) (*http.Response, error) {
+	c.mutex.Lock()
+	c.inFlight++
+	c.peak = max(c.peak, c.inFlight)
+	c.mutex.Unlock()
+
+	defer func() {
+		c.mutex.Lock()
+		c.inFlight--
+		c.mutex.Unlock()
+	}()
+
+	return c.MockHTTPClient.GetWithContext(ctx, url)
+}
+
+func TestService_MaxConcurrency(t *testing.T) {
+	const limit = 3
+	const requests = 12
+
+	mockClient := testutils.NewMockHTTPClient()
+	for i := 0; i < requests; i++ {
+		symbol := fmt.Sprintf("SYM%c", 'A'+i)
+		expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=" + symbol
+		mockClient.AddResponse(expectedURL, 200, testutils.YahooFinanceQuote(symbol, 100, 1))
+		mockClient.AddDelay(expectedURL, 20*time.Millisecond)
+	}
+	client := &inFlightClient{MockHTTPClient: mockClient}
+	service := NewService(client, WithRateLimit(0), WithMaxConcurrency(limit))
+
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(symbol string) {
+			defer wg.Done()
+			if _, err := service.GetCurrentPrice(symbol); err != nil {
+				t.Errorf("Unexpected error for %s: %v", symbol, err)
+			}
+		}(fmt.Sprintf("SYM%c", 'A'+i))
+	}
+	wg.Wait()
+
+	if client.peak > limit {
+		t.Errorf("Expected at most %d requests in flight, got %d", limit, client.peak)
+	}
+	if client.peak == 0 {
+		t.Errorf("Expected upstream requests to be made")
+	}
+}
+
+func TestService_MaxConcurrency_CanceledWhileWaiting(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+	mockClient.AddResponse(expectedURL, 200, testutils.YahooFinanceStockResponse)
+	service := NewService(mockClient, WithRateLimit(0), WithMaxConcurrency(1))
+
+	// Hold the only slot so the next request has to wait
+	if err := service.upstream.Acquire(context.Background()); err != nil {
+		t.Fatalf("Unexpected error acquiring slot: %v", err)
+	}
+	defer service.upstream.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := service.GetCurrentPriceCtx(ctx, "DDOG")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if calls := mockClient.GetCallCount(expectedURL); calls != 0 {
+		t.Errorf("Expected the waiting request not to reach the upstream, got %d calls", calls)
+	}
+}
+
+func TestService_Cache(t *testing.T) {
+	const rateLimit = 2 * time.Second
+	expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(expectedURL, 200, testutils.YahooFinanceQuote("DDOG", 120, 1.5))
+	service := NewService(mockClient,
+		WithRateLimit(rateLimit),
+		WithCache(cache.NewMemoryCache(0), time.Minute),
+	)
+
+	first, err := service.GetCurrentPrice("DDOG")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first.Metadata.CachedAt != nil {
+		t.Errorf("Expected a live quote to have no cached_at, got %v", first.Metadata.CachedAt)
+	}
+
+	t.Run("repeated lookups are served from cache", func(t *testing.T) {
+		start := time.Now()
+		second, err := service.GetCurrentPrice("ddog")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed >= rateLimit/2 {
+			t.Errorf("Expected a cached quote to skip the rate limit, took %v", elapsed)
+		}
+		if second.Metadata.CachedAt == nil {
+			t.Error("Expected a cached quote to carry cached_at")
+		}
+		if second.Price != first.Price {
+			t.Errorf("Expected cached price %.2f, got %.2f", first.Price, second.Price)
+		}
+		if count := mockClient.GetCallCount(expectedURL); count != 1 {
+			t.Errorf("Expected 1 upstream call, got %d", count)
+		}
+	})
+
+	t.Run("fresh lookups bypass the cache", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		fresh, err := service.GetFreshPriceCtx(ctx, "DDOG")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if fresh.Metadata.CachedAt != nil {
+			t.Errorf("Expected a fresh quote to have no cached_at, got %v", fresh.Metadata.CachedAt)
+		}
+		if count := mockClient.GetCallCount(expectedURL); count != 2 {
+			t.Errorf("Expected 2 upstream calls, got %d", count)
+		}
+	})
+}
+
+func TestService_SearchSymbol(t *testing.T) {
+	searchURL := "https://query1.finance.yahoo.com/v1/finance/search?q=apple"
+
+	tests := []struct {
+		name        string
+		query       string
+		status      int
+		body        string
+		wantSymbols []string
+		wantErrCode int
+	}{
+		{
+			name:        "matches",
+			query:       "apple",
+			status:      200,
+			body:        testutils.YahooFinanceSearchResponse,
+			wantSymbols: []string{"AAPL", "AAPL.NE"},
+		},
+		{
+			name:        "no matches",
+			query:       " apple ",
+			status:      200,
+			body:        testutils.YahooFinanceSearchNoMatches,
+			wantSymbols: []string{},
+		},
+		{
+			name:        "empty query",
+			query:       "  ",
+			wantErrCode: 400,
+		},
+		{
+			name:        "upstream error",
+			query:       "apple",
+			status:      503,
+			body:        testutils.APIErrorResponse,
+			wantErrCode: 503,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			if tt.status != 0 {
+				mockClient.AddResponse(searchURL, tt.status, tt.body)
+			}
+			service := NewService(mockClient)
+
+			matches, err := service.SearchSymbol(tt.query)
+			if tt.wantErrCode != 0 {
+				var apiErr *models.APIError
+				if !errors.As(err, &apiErr) || apiErr.Code != tt.wantErrCode {
+					t.Fatalf("Expected API error with code %d, got %v", tt.wantErrCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if matches == nil {
+				t.Fatal("Expected a non-nil slice")
+			}
+			if len(matches) != len(tt.wantSymbols) {
+				t.Fatalf("Expected %d matches, got %d: %+v", len(tt.wantSymbols), len(matches), matches)
+			}
+			for i, want := range tt.wantSymbols {
+				if matches[i].Symbol != want {
+					t.Errorf("Expected match %d to be %s, got %s", i, want, matches[i].Symbol)
+				}
+				if matches[i].Name == "" {
+					t.Errorf("Expected match %s to have a name", matches[i].Symbol)
+				}
+			}
+		})
+	}
+}
+
+func TestService_ResponseBudget(t *testing.T) {
+	const ddogURL = "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+
+	t.Run("tiny budget serves demo data without a network call", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(ddogURL, 200, testutils.YahooFinanceStockResponse)
+		service := NewService(mockClient, WithResponseBudget(time.Millisecond))
+
+		stock, err := service.GetCurrentPrice("DDOG")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if stock.Metadata.Source != BudgetDemoSource {
+			t.Errorf("Expected source %q, got %q", BudgetDemoSource, stock.Metadata.Source)
+		}
+		if count := mockClient.GetCallCount(ddogURL); count != 0 {
+			t.Errorf("Expected no upstream calls, got %d", count)
+		}
+	})
+
+	t.Run("rate limit wait counts against the budget", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(ddogURL, 200, testutils.YahooFinanceStockResponse)
+		service := NewService(mockClient, WithRateLimit(time.Minute), WithResponseBudget(time.Second))
+
+		first, err := service.GetCurrentPrice("DDOG")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if first.Metadata.Source == BudgetDemoSource {
+			t.Fatalf("Expected the first quote to be live")
+		}
+
+		start := time.Now()
+		second, err := service.GetCurrentPrice("DDOG")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected the budget to skip the rate limit wait, took %v", elapsed)
+		}
+		if second.Metadata.Source != BudgetDemoSource {
+			t.Errorf("Expected source %q, got %q", BudgetDemoSource, second.Metadata.Source)
+		}
+		if count := mockClient.GetCallCount(ddogURL); count != 1 {
+			t.Errorf("Expected 1 upstream call, got %d", count)
+		}
+	})
+
+	t.Run("symbols without demo data are still fetched", func(t *testing.T) {
+		expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=ZZZ"
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(expectedURL, 200, testutils.YahooFinanceQuote("ZZZ", 10, 1))
+		service := NewService(mockClient, WithResponseBudget(time.Millisecond))
+
+		if _, err := service.GetCurrentPrice("ZZZ"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if count := mockClient.GetCallCount(expectedURL); count != 1 {
+			t.Errorf("Expected 1 upstream call, got %d", count)
+		}
+	})
+}
+
+func TestService_CoalescesConcurrentRequests(t *testing.T) {
+	expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(expectedURL, 200, testutils.YahooFinanceStockResponse)
+	mockClient.AddDelay(expectedURL, 100*time.Millisecond)
+	service := NewService(mockClient, WithRateLimit(time.Minute))
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([]*models.StockResponse, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = service.GetCurrentPrice("DDOG")
+		}(i)
+	}
+	wg.Wait()
+
+	if count := mockClient.GetCallCount(expectedURL); count != 1 {
+		t.Errorf("Expected exactly 1 upstream call, got %d", count)
+	}
+	for i := 0; i < callers; i++ {
+		if errs[i] != nil {
+			t.Fatalf("Unexpected error for caller %d: %v", i, errs[i])
+		}
+		if results[i].Price != results[0].Price {
+			t.Errorf("Expected caller %d to get price %.2f, got %.2f", i, results[0].Price, results[i].Price)
+		}
+	}
+	if results[0] == results[1] {
+		t.Error("Expected each caller to get its own copy of the response")
+	}
+}
+
+func TestService_FallbackCodes(t *testing.T) {
+	expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		status   int
+		body     string
+		wantDemo bool
+	}{
+		{"default falls back on 503", nil, 503, testutils.APIErrorResponse, true},
+		{"default does not fall back on 404", nil, 200, testutils.YahooFinanceStockNotFound, false},
+		{"custom set falls back on 404", []Option{WithFallbackCodes(404, 503)}, 200, testutils.YahooFinanceStockNotFound, true},
+		{"custom set without 429", []Option{WithFallbackCodes(404)}, 429, testutils.RateLimitErrorResponse, false},
+		{"disabled on 503", []Option{WithFallbackCodes()}, 503, testutils.APIErrorResponse, false},
+		{"nil predicate disables", []Option{WithFallback(nil)}, 503, testutils.APIErrorResponse, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse(expectedURL, tt.status, tt.body)
+			// Disable failover so the 5xx cases only hit the primary endpoint
+			opts := append([]Option{WithRateLimit(0), WithClientOptions(FallbackBaseURL(""))}, tt.opts...)
+			service := NewService(mockClient, opts...)
+
+			stock, err := service.GetCurrentPrice("DDOG")
+			if !tt.wantDemo {
+				if err == nil {
+					t.Fatalf("Expected an error, got %+v", stock)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected demo data, got error: %v", err)
+			}
+			if stock.Metadata.Source != DemoSource {
+				t.Errorf("Expected source %q, got %q", DemoSource, stock.Metadata.Source)
+			}
+		})
+	}
+}
+
+func TestService_DemoFallbacks(t *testing.T) {
+	expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+	mockClient := testutils.NewMockHTTPClient()
+	service := NewService(mockClient, WithRateLimit(0), WithClientOptions(FallbackBaseURL("")))
+
+	if counts := service.DemoFallbacks(); len(counts) != 0 {
+		t.Fatalf("Expected no demo fallbacks yet, got %v", counts)
+	}
+
+	mockClient.AddResponse(expectedURL, 429, testutils.RateLimitErrorResponse)
+	for i := 0; i < 2; i++ {
+		if _, err := service.GetCurrentPrice("DDOG"); err != nil {
+			t.Fatalf("Expected demo data, got error: %v", err)
+		}
+	}
+	mockClient.AddResponse(expectedURL, 503, testutils.APIErrorResponse)
+	if _, err := service.GetCurrentPrice("DDOG"); err != nil {
+		t.Fatalf("Expected demo data, got error: %v", err)
+	}
+
+	// Errors that are not answered with demo data are not counted
+	mockClient.AddResponse(expectedURL, 200, testutils.YahooFinanceStockNotFound)
+	if _, err := service.GetCurrentPrice("DDOG"); err == nil {
+		t.Fatal("Expected an error for an unknown symbol")
+	}
+
+	counts := service.DemoFallbacks()
+	if len(counts) != 2 || counts[429] != 2 || counts[503] != 1 {
+		t.Errorf("Expected 2 fallbacks for 429 and 1 for 503, got %v", counts)
+	}
+
+	// The returned map is a copy
+	counts[429] = 100
+	if got := service.DemoFallbacks()[429]; got != 2 {
+		t.Errorf("Expected the counter to stay at 2, got %d", got)
+	}
+}
+
+func TestParseFallbackCodes(t *testing.T) {
+	tests := []struct {
+		spec       string
+		wantErr    bool
+		wantNil    bool
+		fallback   []int
+		noFallback []int
+	}{
+		{spec: DefaultFallbackCodes, fallback: []int{401, 403, 429, 500, 503, 599}, noFallback: []int{400, 404}},
+		{spec: " 404, 5XX ", fallback: []int{404, 502}, noFallback: []int{401, 429}},
+		{spec: "none", wantNil: true},
+		{spec: "", wantNil: true},
+		{spec: "404,abc", wantErr: true},
+		{spec: "42", wantErr: true},
+		{spec: "9xx", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			fallback, err := ParseFallbackCodes(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error for %q", tt.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.wantNil {
+				if fallback != nil {
+					t.Errorf("Expected a nil predicate for %q", tt.spec)
+				}
+				return
+			}
+			for _, code := range tt.fallback {
+				if !fallback(code) {
+					t.Errorf("Expected %d to fall back", code)
+				}
+			}
+			for _, code := range tt.noFallback {
+				if fallback(code) {
+					t.Errorf("Expected %d not to fall back", code)
+				}
+			}
+		})
+	}
+}
+
+func TestGetDemoStock_DisplayFields(t *testing.T) {
+	stock, err := GetDemoStock("DDOG")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if stock.MarketCapDisplay != "40,000,000,000" {
+		t.Errorf("Expected market cap display 40,000,000,000, got %q", stock.MarketCapDisplay)
+	}
+	if stock.VolumeDisplay != models.FormatThousands(stock.Volume) {
+		t.Errorf("Expected volume display for %d, got %q", stock.Volume, stock.VolumeDisplay)
+	}
+}
+
+func TestListDemoSymbols(t *testing.T) {
+	symbols := ListDemoSymbols()
+
+	want := []string{"AAPL", "DDOG", "GOOGL", "MSFT", "TSLA"}
+	if len(symbols) != len(want) {
+		t.Fatalf("Expected %d symbols, got %d", len(want), len(symbols))
+	}
+	for i, info := range symbols {
+		if info.Symbol != want[i] {
+			t.Errorf("Symbol %d: expected %s, got %s", i, want[i], info.Symbol)
+		}
+		if info.Name != DemoStockData[info.Symbol].Name {
+			t.Errorf("Expected name %q for %s, got %q", DemoStockData[info.Symbol].Name, info.Symbol, info.Name)
+		}
+	}
+}
+
+func TestService_StartBackgroundRefresh(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	ddogURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+	aaplURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=AAPL"
+
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(ddogURL, 200, testutils.YahooFinanceQuote("DDOG", 120, 1.5))
+	mockClient.AddResponse(aaplURL, 200, testutils.YahooFinanceQuote("AAPL", 180, -0.5))
+	service := NewService(mockClient,
+		WithRateLimit(0),
+		WithCache(cache.NewMemoryCache(0), time.Minute),
+	)
+
+	stop := make(chan struct{})
+	service.StartBackgroundRefresh([]string{"ddog", " AAPL ", "not a symbol!"}, interval, stop)
+
+	t.Run("the cache is populated", func(t *testing.T) {
+		deadline := time.Now().Add(time.Second)
+		for {
+			_, ddogCached := service.cachedQuote("DDOG")
+			_, aaplCached := service.cachedQuote("AAPL")
+			if ddogCached && aaplCached {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Expected both symbols to be cached")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+
+	t.Run("symbols are refreshed every interval", func(t *testing.T) {
+		time.Sleep(5 * interval)
+		if count := mockClient.GetCallCount(ddogURL); count < 3 {
+			t.Errorf("Expected repeated refreshes, got %d calls", count)
+		}
+	})
+
+	t.Run("refreshing stops when stop is closed", func(t *testing.T) {
+		close(stop)
+		time.Sleep(2 * interval)
+		before := mockClient.GetCallCount(ddogURL)
+		time.Sleep(5 * interval)
+		if after := mockClient.GetCallCount(ddogURL); after != before {
+			t.Errorf("Expected no calls after stop, got %d more", after-before)
+		}
+	})
+}
+
+func TestService_Alerts(t *testing.T) {
+	const webhook = "https://hooks.example.com/stocks"
+	ddogURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+	aaplURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=AAPL"
+
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(webhook, 204, "")
+	clock := testutils.NewMockClock(time.Date(2024, 1, 15, 15, 0, 0, 0, time.UTC))
+	service := NewService(mockClient,
+		WithRateLimit(0),
+		WithClock(clock),
+		WithAlertCooldown(time.Hour),
+		WithAlertHTTPClient(mockClient),
+		WithAlertRules(
+			AlertRule{Symbol: "DDOG", ThresholdPercent: 3, WebhookURL: webhook},
+			AlertRule{Symbol: "AAPL", ThresholdPercent: -5, WebhookURL: webhook},
+		),
+	)
+
+	// refresh quotes DDOG and AAPL at the given changes, returning the
+	// webhook posts it caused
+	refresh := func(ddogChange, aaplChange float64) []testutils.MockPost {
+		before := len(mockClient.GetPosts())
+		mockClient.AddResponse(ddogURL, 200, testutils.YahooFinanceQuote("DDOG", 120, ddogChange))
+		mockClient.AddResponse(aaplURL, 200, testutils.YahooFinanceQuote("AAPL", 180, aaplChange))
+		service.refreshSymbols(context.Background(), []string{"DDOG", "AAPL"})
+		return mockClient.GetPosts()[before:]
+	}
+
+	if posts := refresh(1.5, -0.5); len(posts) != 0 {
+		t.Fatalf("Expected no webhook below the thresholds, got %d", len(posts))
+	}
+
+	posts := refresh(4, -0.5)
+	if len(posts) != 1 {
+		t.Fatalf("Expected one webhook when DDOG crosses 3%%, got %d", len(posts))
+	}
+	if posts[0].URL != webhook || posts[0].ContentType != "application/json" {
+		t.Errorf("Expected a JSON post to %s, got %+v", webhook, posts[0])
+	}
+	if !strings.Contains(posts[0].Body, `"symbol":"DDOG"`) {
+		t.Errorf("Expected the DDOG quote in the webhook body, got %s", posts[0].Body)
+	}
+
+	if posts := refresh(4.5, -6); len(posts) != 1 || !strings.Contains(posts[0].Body, `"symbol":"AAPL"`) {
+		t.Errorf("Expected only the AAPL rule to fire while DDOG stays above 3%%, got %+v", posts)
+	}
+
+	// DDOG falls back and crosses again within the cooldown
+	refresh(1, -6)
+	if posts := refresh(4, -6); len(posts) != 0 {
+		t.Errorf("Expected no webhook within the cooldown, got %d", len(posts))
+	}
+	clock.Advance(time.Hour)
+	if posts := refresh(4, -6); len(posts) != 1 {
+		t.Errorf("Expected the DDOG webhook once the cooldown passed, got %d", len(posts))
+	}
+}
+
+func TestService_Alerts_WebhookFailureRetried(t *testing.T) {
+	const webhook = "https://hooks.example.com/stocks"
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse("https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG", 200, testutils.YahooFinanceQuote("DDOG", 120, 4))
+	mockClient.AddTransientResponse(webhook, 500, "")
+	mockClient.AddResponse(webhook, 200, "")
+	service := NewService(mockClient, WithRateLimit(0), WithAlertHTTPClient(mockClient),
+		WithAlertRules(AlertRule{Symbol: "DDOG", ThresholdPercent: 3, WebhookURL: webhook}))
+
+	for i := 0; i < 3; i++ {
+		service.refreshSymbols(context.Background(), []string{"DDOG"})
+	}
+	if posts := mockClient.GetPosts(); len(posts) != 2 {
+		t.Errorf("Expected the failed webhook to be retried once, got %d posts", len(posts))
+	}
+}
+
+func TestService_Alerts_HangingWebhook(t *testing.T) {
+	const webhook = "https://hooks.example.com/stocks"
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse("https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG", 200, testutils.YahooFinanceQuote("DDOG", 120, 4))
+	mockClient.AddResponse(webhook, 200, "")
+	mockClient.AddDelay(webhook, time.Hour)
+	newService := func() *Service {
+		return NewService(mockClient, WithRateLimit(0), WithAlertHTTPClient(mockClient),
+			WithAlertTimeout(50*time.Millisecond),
+			WithAlertRules(AlertRule{Symbol: "DDOG", ThresholdPercent: 3, WebhookURL: webhook}))
+	}
+
+	t.Run("the timeout ends the request", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			newService().refreshSymbols(context.Background(), []string{"DDOG"})
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected refresh to give up on the webhook after the alert timeout")
+		}
+	})
+
+	t.Run("stopping refresh cancels the request", func(t *testing.T) {
+		service := newService()
+		service.alerts.timeout = time.Hour
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			service.refreshSymbols(ctx, []string{"DDOG"})
+			close(done)
+		}()
+
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected canceling refresh to cancel the webhook")
+		}
+	})
+}
+
+func TestService_Alerts_DefaultClientHeaders(t *testing.T) {
+	received := make(chan http.Header, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+	}))
+	defer webhook.Close()
+
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse("https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG", 200, testutils.YahooFinanceQuote("DDOG", 120, 4))
+	service := NewService(mockClient, WithRateLimit(0),
+		WithAlertRules(AlertRule{Symbol: "DDOG", ThresholdPercent: 3, WebhookURL: webhook.URL}))
+	service.refreshSymbols(context.Background(), []string{"DDOG"})
+
+	select {
+	case headers := <-received:
+		if got := headers.Get("User-Agent"); got != AlertUserAgent {
+			t.Errorf("Expected User-Agent %q, got %q", AlertUserAgent, got)
+		}
+		if got := headers.Get("Accept-Language"); got != "" {
+			t.Errorf("Expected no browser headers, got Accept-Language %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the webhook to be called")
+	}
+}
+
+func TestLoadAlertRules(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"valid", `[{"symbol": " ddog ", "threshold_percent": -5, "webhook_url": "https://hooks.example.com/a"}]`, false},
+		{"not_json", `DDOG,-5`, true},
+		{"zero_threshold", `[{"symbol": "DDOG", "threshold_percent": 0, "webhook_url": "https://hooks.example.com/a"}]`, true},
+		{"missing_symbol", `[{"threshold_percent": 2, "webhook_url": "https://hooks.example.com/a"}]`, true},
+		{"bad_webhook", `[{"symbol": "DDOG", "threshold_percent": 2, "webhook_url": "hooks.example.com"}]`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatalf("Failed to write alerts file: %v", err)
+			}
+			rules, err := LoadAlertRules(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && rules[0].Symbol != "DDOG" {
+				t.Errorf("Expected symbol DDOG, got %q", rules[0].Symbol)
+			}
+		})
+	}
+}
+
+// fakeProvider answers every symbol with a quote labeled source, or err,
+// counting calls
+type fakeProvider struct {
+	source string
+	err    error
+	calls  int
+}
+
+func (p *fakeProvider) GetStockPrice(symbol string) (*models.StockResponse, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &models.StockResponse{
+		Symbol:   symbol,
+		Price:    42,
+		Metadata: models.ResponseMetadata{Timestamp: time.Now(), Source: p.source},
+	}, nil
+}
+
+func TestService_Providers(t *testing.T) {
+	tests := []struct {
+		name          string
+		firstCode     int // status of the first provider's error; 0 succeeds
+		wantSource    string
+		wantSecond    int
+		wantFallbacks int64
+	}{
+		{name: "first succeeds", wantSource: "First"},
+		{name: "server error falls through", firstCode: 503, wantSource: "Second", wantSecond: 1, wantFallbacks: 1},
+		{name: "rate limit falls through", firstCode: 429, wantSource: "Second", wantSecond: 1, wantFallbacks: 1},
+		{name: "not found does not fall through", firstCode: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := &fakeProvider{source: "First"}
+			if tt.firstCode != 0 {
+				first.err = models.NewAPIError("First", "Request failed", tt.firstCode)
+			}
+			second := &fakeProvider{source: "Second"}
+			service := NewService(testutils.NewMockHTTPClient(), WithRateLimit(0), WithProviders(first, second))
+
+			stock, err := service.GetCurrentPrice("DDOG")
+			if tt.wantSource == "" {
+				if !errors.Is(err, first.err) {
+					t.Fatalf("Expected the first provider's error, got %v", err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			} else if stock.Metadata.Source != tt.wantSource {
+				t.Errorf("Expected source %s, got %s", tt.wantSource, stock.Metadata.Source)
+			}
+
+			if first.calls != 1 || second.calls != tt.wantSecond {
+				t.Errorf("Expected 1 and %d provider calls, got %d and %d", tt.wantSecond, first.calls, second.calls)
+			}
+			if got := service.DemoFallbacks()[tt.firstCode]; got != tt.wantFallbacks {
+				t.Errorf("Expected %d fallbacks for status %d, got %d", tt.wantFallbacks, tt.firstCode, got)
+			}
+		})
+	}
+}
+
+func TestService_DefaultProviders_SourceLabels(t *testing.T) {
+	expectedURL := "https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG"
+
+	t.Run("live quote", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(expectedURL, 200, testutils.YahooFinanceStockResponse)
+		service := NewService(mockClient, WithRateLimit(0))
+
+		stock, err := service.GetCurrentPrice("DDOG")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if stock.Metadata.Source != "Yahoo Finance" {
+			t.Errorf("Expected source Yahoo Finance, got %s", stock.Metadata.Source)
+		}
+	})
+
+	t.Run("demo after upstream error", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(expectedURL, 500, testutils.APIErrorResponse)
+		service := NewService(mockClient, WithRateLimit(0))
+
+		stock, err := service.GetCurrentPrice("DDOG")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if stock.Metadata.Source != DemoSource {
+			t.Errorf("Expected source %s, got %s", DemoSource, stock.Metadata.Source)
+		}
+	})
+
+	t.Run("unknown demo symbol keeps the upstream error", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse("https://query1.finance.yahoo.com/v7/finance/quote?symbols=ZZZZ", 500, testutils.APIErrorResponse)
+		service := NewService(mockClient, WithRateLimit(0))
+
+		_, err := service.GetCurrentPrice("ZZZZ")
+		var apiErr *models.APIError
+		if !errors.As(err, &apiErr) || apiErr.Service == "Demo Stock" {
+			t.Errorf("Expected the upstream error, got %v", err)
+		}
+	})
+}
+
+func TestService_Clock(t *testing.T) {
+	// Monday, January 15, 2024 in New York, which is UTC-5 in winter
+	day := func(hour int) time.Time {
+		return time.Date(2024, 1, 15, hour+5, 0, 0, 0, time.UTC)
+	}
+
+	t.Run("demo market state follows the clock", func(t *testing.T) {
+		tests := []struct {
+			hour int
+			want models.MarketState
+		}{
+			{0, models.MarketStateClosed},
+			{5, models.MarketStatePremarket},
+			{10, models.MarketStateRegular},
+			{17, models.MarketStatePostmarket},
+			{22, models.MarketStateClosed},
+		}
+
+		clock := testutils.NewMockClock(day(0))
+		service := NewService(testutils.NewMockHTTPClient(), WithClock(clock), WithMaintenance(true))
+		for _, tt := range tests {
+			clock.Set(day(tt.hour))
+			stock, err := service.GetCurrentPrice("DDOG")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if stock.MarketState != tt.want {
+				t.Errorf("Expected market state %s at %02d:00, got %s", tt.want, tt.hour, stock.MarketState)
+			}
+			if !stock.Metadata.Timestamp.Equal(day(tt.hour)) {
+				t.Errorf("Expected the demo timestamp to be the clock time, got %v", stock.Metadata.Timestamp)
+			}
+		}
+	})
+
+	t.Run("cached quotes are stamped with the clock", func(t *testing.T) {
+		clock := testutils.NewMockClock(day(12))
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse("https://query1.finance.yahoo.com/v7/finance/quote?symbols=DDOG", 200, testutils.YahooFinanceQuote("DDOG", 120, 1.5))
+		service := NewService(mockClient, WithClock(clock), WithRateLimit(0), WithCache(cache.NewMemoryCache(0), time.Minute))
+
+		if _, err := service.GetCurrentPrice("DDOG"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		cached, err := service.GetCurrentPrice("DDOG")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if cached.Metadata.CachedAt == nil || !cached.Metadata.CachedAt.Equal(day(12)) {
+			t.Errorf("Expected cached_at %v, got %v", day(12), cached.Metadata.CachedAt)
+		}
+	})
+}
+
+func TestDemoMarketState(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("tz database unavailable: %v", err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("tz database unavailable: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want models.MarketState
+	}{
+		{"before pre-market", time.Date(2024, 7, 15, 3, 59, 0, 0, newYork), models.MarketStateClosed},
+		{"pre-market opens", time.Date(2024, 7, 15, 4, 0, 0, 0, newYork), models.MarketStatePremarket},
+		{"last pre-market minute", time.Date(2024, 7, 15, 9, 29, 0, 0, newYork), models.MarketStatePremarket},
+		{"regular session opens at 9:30", time.Date(2024, 7, 15, 9, 30, 0, 0, newYork), models.MarketStateRegular},
+		{"after hours at 16:00", time.Date(2024, 7, 15, 16, 0, 0, 0, newYork), models.MarketStatePostmarket},
+		{"closed at 20:00", time.Date(2024, 7, 15, 20, 0, 0, 0, newYork), models.MarketStateClosed},
+		{"weekend", time.Date(2024, 7, 13, 12, 0, 0, 0, newYork), models.MarketStateClosed},
+		// 15:45 in Berlin is 9:45 in New York during summer time
+		{"server in Europe", time.Date(2024, 7, 15, 15, 45, 0, 0, berlin), models.MarketStateRegular},
+		// 15:15 in Berlin is still 9:15 in New York
+		{"server in Europe before the open", time.Date(2024, 7, 15, 15, 15, 0, 0, berlin), models.MarketStatePremarket},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := testutils.NewMockClock(tt.now)
+			service := NewService(testutils.NewMockHTTPClient(), WithClock(clock), WithMaintenance(true))
+
+			stock, err := service.GetCurrentPrice("AAPL")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if stock.MarketState != tt.want {
+				t.Errorf("Expected %s at %v, got %s", tt.want, tt.now, stock.MarketState)
+			}
+		})
+	}
 }
@@ -0,0 +1,134 @@
+// Package tracing defines the small tracing surface used by the server and
+// upstream clients, so an APM library can be plugged in without the core
+// packages depending on it.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
+)
+
+// Common tag keys
+const (
+	TagHTTPMethod     = "http.method"
+	TagHTTPURL        = "http.url"
+	TagHTTPStatusCode = "http.status_code"
+	TagStockSymbol    = "stock.symbol"
+	TagWeatherCity    = "weather.city"
+	TagError          = "error"
+)
+
+// Span is a single timed operation
+type Span interface {
+	SetTag(key string, value interface{})
+	Finish()
+}
+
+// Tracer starts spans
+type Tracer interface {
+	StartSpan(name string) Span
+}
+
+// TracerFunc adapts a function to the Tracer interface, which is usually all
+// that is needed to wire in a real APM tracer
+type TracerFunc func(name string) Span
+
+// StartSpan calls f(name)
+func (f TracerFunc) StartSpan(name string) Span {
+	return f(name)
+}
+
+// NoopTracer discards all spans; it is the default everywhere
+type NoopTracer struct{}
+
+// StartSpan returns a span that does nothing
+func (NoopTracer) StartSpan(name string) Span {
+	return noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetTag(key string, value interface{}) {}
+func (noopSpan) Finish()                              {}
+
+// OrNoop returns t, or a NoopTracer when t is nil
+func OrNoop(t Tracer) Tracer {
+	if t == nil {
+		return NoopTracer{}
+	}
+	return t
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span stored in ctx, or a no-op span
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+// LogTracer writes each finished span to the debug log. It is meant for
+// local development and as a reference adapter.
+type LogTracer struct{}
+
+// StartSpan starts a span that is logged when finished
+func (LogTracer) StartSpan(name string) Span {
+	return &logSpan{name: name, start: time.Now(), tags: make(map[string]interface{})}
+}
+
+type logSpan struct {
+	name  string
+	start time.Time
+
+	mutex sync.Mutex
+	tags  map[string]interface{}
+}
+
+func (s *logSpan) SetTag(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.tags[key] = value
+}
+
+func (s *logSpan) Finish() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	keys := make([]string, 0, len(s.tags))
+	for key := range s.tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%v", key, s.tags[key]))
+	}
+
+	logging.Debugf("span %s %v %s", s.name, time.Since(s.start), strings.Join(parts, " "))
+}
+
+// New returns the tracer registered under name ("none" or "log")
+func New(name string) (Tracer, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "none":
+		return NoopTracer{}, nil
+	case "log":
+		return LogTracer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown tracer %q (expected none or log)", name)
+	}
+}
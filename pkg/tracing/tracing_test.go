@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+)
+
+type recordingSpan struct {
+	tags     map[string]interface{}
+	finished bool
+}
+
+func (s *recordingSpan) SetTag(key string, value interface{}) { s.tags[key] = value }
+func (s *recordingSpan) Finish()                              { s.finished = true }
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Tracer
+		wantErr bool
+	}{
+		{name: "", want: NoopTracer{}},
+		{name: "none", want: NoopTracer{}},
+		{name: "LOG", want: LogTracer{}},
+		{name: "datadog", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected tracer %T, got %T", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSpanFromContext(t *testing.T) {
+	// A context without a span yields a usable no-op span
+	SpanFromContext(context.Background()).SetTag("key", "value")
+
+	span := &recordingSpan{tags: make(map[string]interface{})}
+	ctx := ContextWithSpan(context.Background(), span)
+	SpanFromContext(ctx).SetTag(TagStockSymbol, "DDOG")
+
+	if span.tags[TagStockSymbol] != "DDOG" {
+		t.Errorf("Expected tag on stored span, got %v", span.tags)
+	}
+}
+
+func TestTracerFunc(t *testing.T) {
+	var names []string
+	tracer := TracerFunc(func(name string) Span {
+		names = append(names, name)
+		return &recordingSpan{tags: make(map[string]interface{})}
+	})
+
+	tracer.StartSpan("a").Finish()
+	if len(names) != 1 || names[0] != "a" {
+		t.Errorf("Expected one span named a, got %v", names)
+	}
+}
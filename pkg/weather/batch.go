@@ -0,0 +1,165 @@
+package weather
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+)
+
+// BatchWorkers is how many cities are fetched concurrently in a batch by default
+const BatchWorkers = 5
+
+// BatchOptions tunes how a batch is fetched. The zero value fetches with
+// BatchWorkers workers and no per-city timeout.
+type BatchOptions struct {
+	// Workers is how many cities are fetched concurrently; values below 1
+	// mean BatchWorkers
+	Workers int
+	// Timeout bounds the fetch of each city; a city that runs out of time
+	// carries the error. Zero means no limit beyond the batch context.
+	Timeout time.Duration
+}
+
+// workers returns the number of concurrent fetches to use
+func (o BatchOptions) workers() int {
+	if o.Workers < 1 {
+		return BatchWorkers
+	}
+	return o.Workers
+}
+
+// BatchResult is the outcome of fetching weather for one city in a batch
+type BatchResult struct {
+	City    string                  `json:"city" xml:"city"`
+	Weather *models.WeatherResponse `json:"weather,omitempty" xml:"weather,omitempty"`
+	Error   string                  `json:"error,omitempty" xml:"error,omitempty"`
+}
+
+// GetBatchWeatherCtx fetches weather for several cities using a small worker
+// pool sized by opts. Results are returned in input order; a failed city
+// carries its error message instead of failing the whole batch.
+func (s *Service) GetBatchWeatherCtx(ctx context.Context, cities []string, opts BatchOptions) []BatchResult {
+	results := make([]BatchResult, len(cities))
+
+	runBatch(opts.workers(), len(cities), func(i int) {
+		results[i] = s.batchResult(ctx, cities[i], opts.Timeout)
+	})
+
+	return results
+}
+
+// StreamBatchWeatherCtx is GetBatchWeatherCtx for streaming responses: it
+// calls yield with each result as soon as it is fetched, so results arrive
+// in completion order rather than input order. yield is never called
+// concurrently and the method returns once every city has been yielded.
+func (s *Service) StreamBatchWeatherCtx(ctx context.Context, cities []string, opts BatchOptions, yield func(BatchResult)) {
+	var mutex sync.Mutex
+
+	runBatch(opts.workers(), len(cities), func(i int) {
+		result := s.batchResult(ctx, cities[i], opts.Timeout)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		yield(result)
+	})
+}
+
+// batchResult fetches one city of a batch, giving up after timeout when it
+// is positive
+func (s *Service) batchResult(ctx context.Context, city string, timeout time.Duration) BatchResult {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	weather, err := s.GetWeatherWithValidationCtx(ctx, city)
+	if err != nil {
+		return BatchResult{City: city, Error: err.Error()}
+	}
+	return BatchResult{City: city, Weather: weather}
+}
+
+// GetBatchSummariesCtx returns the weather summary for each city, keyed by
+// the city as given. A city that fails maps to "error: <message>" instead of
+// failing the whole batch.
+func (s *Service) GetBatchSummariesCtx(ctx context.Context, cities []string) map[string]string {
+	summaries := make([]string, len(cities))
+
+	runBatch(BatchWorkers, len(cities), func(i int) {
+		result := s.summaryResult(ctx, cities[i])
+		if result.Error != "" {
+			summaries[i] = "error: " + result.Error
+			return
+		}
+		summaries[i] = result.Summary
+	})
+
+	results := make(map[string]string, len(cities))
+	for i, city := range cities {
+		results[city] = summaries[i]
+	}
+	return results
+}
+
+// SummaryResult is the outcome of summarizing the weather of one city in a
+// batch
+type SummaryResult struct {
+	City    string `json:"city" xml:"city"`
+	Summary string `json:"summary,omitempty" xml:"summary,omitempty"`
+	Error   string `json:"error,omitempty" xml:"error,omitempty"`
+}
+
+// StreamBatchSummariesCtx is GetBatchSummariesCtx for streaming responses:
+// it calls yield with each result as soon as it is ready, in completion
+// order. yield is never called concurrently and the method returns once
+// every city has been yielded.
+func (s *Service) StreamBatchSummariesCtx(ctx context.Context, cities []string, yield func(SummaryResult)) {
+	var mutex sync.Mutex
+
+	runBatch(BatchWorkers, len(cities), func(i int) {
+		result := s.summaryResult(ctx, cities[i])
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		yield(result)
+	})
+}
+
+// summaryResult summarizes the weather of one city of a batch
+func (s *Service) summaryResult(ctx context.Context, city string) SummaryResult {
+	if err := s.ValidateLocation(city); err != nil {
+		return SummaryResult{City: city, Error: err.Error()}
+	}
+	summary, err := s.GetWeatherSummaryCtx(ctx, city)
+	if err != nil {
+		return SummaryResult{City: city, Error: err.Error()}
+	}
+	return SummaryResult{City: city, Summary: summary}
+}
+
+// runBatch calls fn for every index in [0, count) using at most workers
+// goroutines and returns once all calls have finished
+func runBatch(workers, count int, fn func(i int)) {
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	workers = min(workers, count)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
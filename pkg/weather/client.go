@@ -1,12 +1,17 @@
 package weather
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/httpclient"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/tracing"
 )
 
 // Client handles weather API requests
@@ -14,50 +19,317 @@ type Client struct {
 	httpClient HTTPClient
 	geocoder   *Geocoder
 	baseURL    string
+	tracer     tracing.Tracer
+	// maxResponseBytes caps the size of a decoded response body
+	maxResponseBytes int
+
+	forecastAttempts int
+	forecastBackoff  time.Duration
+}
+
+// Forecast retry defaults. A transient forecast failure is retried once so
+// a city that was just geocoded is not given up on right away.
+const (
+	DefaultForecastAttempts = 2
+	DefaultForecastBackoff  = 100 * time.Millisecond
+)
+
+// ForecastError reports a forecast request that failed after its city was
+// geocoded. Callers can retry with GetWeatherByCoordinatesCtx using
+// Coordinates instead of geocoding the city again.
+type ForecastError struct {
+	City        string
+	Country     string
+	Coordinates models.Coordinates
+	Err         error
+}
+
+func (e *ForecastError) Error() string {
+	return fmt.Sprintf("forecast for %s (%.4f, %.4f) failed: %v", e.City, e.Coordinates.Latitude, e.Coordinates.Longitude, e.Err)
+}
+
+// Unwrap returns the forecast request's error
+func (e *ForecastError) Unwrap() error {
+	return e.Err
+}
+
+// Default Open-Meteo endpoints
+const (
+	DefaultWeatherBaseURL = "https://api.open-meteo.com/v1/forecast"
+	DefaultGeocodeBaseURL = "https://geocoding-api.open-meteo.com/v1/search"
+)
+
+// currentForecastDays is the forecast_days sent with forecast requests,
+// which only read current conditions
+const currentForecastDays = "1"
+
+// DefaultTimezone asks Open-Meteo to report times in the zone local to the coordinates
+const DefaultTimezone = "auto"
+
+// ValidateTimezone checks that timezone is empty, "auto", or a zone known to
+// time.LoadLocation, such as "UTC" or "Europe/Berlin"
+func ValidateTimezone(timezone string) error {
+	if timezone == "" || timezone == DefaultTimezone {
+		return nil
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return models.NewAPIError("Weather", fmt.Sprintf("Unknown timezone %q", timezone), 400)
+	}
+	return nil
+}
+
+// ValidateCoordinates checks that lat is within [-90, 90] and lon within
+// [-180, 180], naming the offending field in the 400 error
+func ValidateCoordinates(lat, lon float64) error {
+	if !(lat >= -90 && lat <= 90) {
+		return models.NewAPIError("Weather", fmt.Sprintf("Latitude must be between -90 and 90, got %v", lat), 400)
+	}
+	if !(lon >= -180 && lon <= 180) {
+		return models.NewAPIError("Weather", fmt.Sprintf("Longitude must be between -180 and 180, got %v", lon), 400)
+	}
+	return nil
+}
+
+// ClientOption configures optional client behavior
+type ClientOption func(*Client)
+
+// WeatherBaseURL points forecast requests at a different Open-Meteo
+// compatible endpoint, such as a local proxy or a self-hosted instance
+func WeatherBaseURL(baseURL string) ClientOption {
+	return func(c *Client) {
+		c.baseURL = baseURL
+	}
+}
+
+// GeocodeBaseURL points geocoding requests at a different Open-Meteo
+// compatible endpoint
+func GeocodeBaseURL(baseURL string) ClientOption {
+	return func(c *Client) {
+		c.geocoder.baseURL = baseURL
+	}
+}
+
+// GeocodeRetry sets how many times geocoding requests are attempted and the
+// initial backoff between attempts
+func GeocodeRetry(attempts int, backoff time.Duration) ClientOption {
+	return func(c *Client) {
+		c.geocoder.SetRetry(attempts, backoff)
+	}
+}
+
+// TransliterateCityNames strips accents from city names sent to the
+// geocoding API
+func TransliterateCityNames(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.geocoder.SetTransliterate(enabled)
+	}
+}
+
+// ForecastRetry sets how many times forecast requests are attempted and the
+// initial backoff between attempts
+func ForecastRetry(attempts int, backoff time.Duration) ClientOption {
+	return func(c *Client) {
+		c.forecastAttempts = max(attempts, 1)
+		c.forecastBackoff = backoff
+	}
+}
+
+// MaxResponseBytes caps the size of response bodies read from the forecast
+// and geocoding APIs; zero or less uses models.DefaultMaxResponseBytes
+func MaxResponseBytes(n int) ClientOption {
+	return func(c *Client) {
+		c.maxResponseBytes = n
+		c.geocoder.maxResponseBytes = n
+	}
 }
 
 // NewClient creates a new weather client
-func NewClient(httpClient HTTPClient) *Client {
+func NewClient(httpClient HTTPClient, opts ...ClientOption) *Client {
 	if httpClient == nil {
 		httpClient = &DefaultHTTPClient{}
 	}
 
-	return &Client{
-		httpClient: httpClient,
-		geocoder:   NewGeocoder(httpClient),
-		baseURL:    "https://api.open-meteo.com/v1/forecast",
+	client := &Client{
+		httpClient:       httpClient,
+		geocoder:         NewGeocoder(httpClient),
+		baseURL:          DefaultWeatherBaseURL,
+		maxResponseBytes: models.DefaultMaxResponseBytes,
+		tracer:           tracing.NoopTracer{},
+		forecastAttempts: DefaultForecastAttempts,
+		forecastBackoff:  DefaultForecastBackoff,
 	}
+
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	return client
+}
+
+// SetTracer records a span for every upstream request, including geocoding;
+// nil disables tracing
+func (c *Client) SetTracer(t tracing.Tracer) {
+	c.tracer = tracing.OrNoop(t)
+	c.geocoder.SetTracer(t)
 }
 
 // GetWeatherByCity fetches weather data for a given city name
 func (c *Client) GetWeatherByCity(city string) (*models.WeatherResponse, error) {
+	return c.GetWeatherByCityCtx(context.Background(), city)
+}
+
+// GetWeatherByCityCtx fetches weather data for a given city name, canceling
+// the upstream requests when ctx is done
+func (c *Client) GetWeatherByCityCtx(ctx context.Context, city string) (*models.WeatherResponse, error) {
+	return c.weatherByCity(ctx, city, DefaultTimezone)
+}
+
+// weatherByCity resolves city and fetches its weather with times in timezone
+func (c *Client) weatherByCity(ctx context.Context, city, timezone string) (*models.WeatherResponse, error) {
 	// Get coordinates for the city
-	coords, country, err := c.geocoder.GetCoordinatesWithCache(city)
+	location, err := c.geocoder.GetLocationWithCacheCtx(ctx, city)
 	if err != nil {
 		return nil, err
 	}
 
 	// Get weather data using coordinates
-	return c.GetWeatherByCoordinates(coords.Latitude, coords.Longitude, city, country)
+	coords := location.Coordinates
+	weatherResp, err := c.weatherByCoordinates(ctx, coords.Latitude, coords.Longitude, city, location.Country, timezone)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		return nil, forecastFailure(city, location, err)
+	}
+	weatherResp.Region = location.Region
+	return weatherResp, nil
+}
+
+// forecastFailure turns the error of a forecast request made for a geocoded
+// city into an APIError with the same status that names the coordinates and
+// wraps a ForecastError carrying them
+func forecastFailure(city string, location *models.ResolvedLocation, err error) error {
+	code, message := 500, err.Error()
+	var apiErr *models.APIError
+	if errors.As(err, &apiErr) {
+		code, message = apiErr.Code, apiErr.Message
+	}
+
+	coords := location.Coordinates
+	return models.NewWrappedAPIError("Open-Meteo",
+		fmt.Sprintf("Weather for %s unavailable at %.4f, %.4f: %s", city, coords.Latitude, coords.Longitude, message), code,
+		&ForecastError{City: city, Country: location.Country, Coordinates: coords, Err: err})
 }
 
 // GetWeatherByCoordinates fetches weather data for given coordinates
 func (c *Client) GetWeatherByCoordinates(lat, lon float64, city, country string) (*models.WeatherResponse, error) {
+	return c.GetWeatherByCoordinatesCtx(context.Background(), lat, lon, city, country)
+}
+
+// GetWeatherByCoordinatesCtx fetches weather data for given coordinates,
+// canceling the upstream request when ctx is done
+func (c *Client) GetWeatherByCoordinatesCtx(ctx context.Context, lat, lon float64, city, country string) (*models.WeatherResponse, error) {
+	return c.weatherByCoordinates(ctx, lat, lon, city, country, DefaultTimezone)
+}
+
+// weatherByCoordinates fetches and converts the weather for the given
+// coordinates with times in timezone
+func (c *Client) weatherByCoordinates(ctx context.Context, lat, lon float64, city, country, timezone string) (*models.WeatherResponse, error) {
+	openMeteoResp, err := c.fetchForecast(ctx, lat, lon, city, timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert to our standard format
+	coords := models.Coordinates{Latitude: lat, Longitude: lon}
+	weatherResp := models.ConvertOpenMeteoResponse(openMeteoResp, city, country, coords)
+
+	return weatherResp, nil
+}
+
+// RawWeather is the untransformed Open-Meteo payload for a city together with
+// the coordinates and country the geocoder resolved it to
+type RawWeather struct {
+	City        string                    `json:"city" xml:"city"`
+	Country     string                    `json:"country" xml:"country"`
+	Coordinates models.Coordinates        `json:"coordinates" xml:"coordinates"`
+	Upstream    *models.OpenMeteoResponse `json:"upstream" xml:"upstream"`
+}
+
+// GetRawWeatherCtx resolves city and returns the forecast payload as decoded
+// from Open-Meteo, before ConvertOpenMeteoResponse is applied
+func (c *Client) GetRawWeatherCtx(ctx context.Context, city string) (*RawWeather, error) {
+	coords, country, err := c.geocoder.GetCoordinatesWithCacheCtx(ctx, city)
+	if err != nil {
+		return nil, err
+	}
+
+	openMeteoResp, err := c.fetchForecast(ctx, coords.Latitude, coords.Longitude, city, DefaultTimezone)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RawWeather{
+		City:        city,
+		Country:     country,
+		Coordinates: *coords,
+		Upstream:    openMeteoResp,
+	}, nil
+}
+
+// fetchForecast requests and decodes the current conditions for the given
+// coordinates, with times in timezone ("auto" or an IANA name). Network
+// errors and 5xx responses are retried with exponential backoff.
+func (c *Client) fetchForecast(ctx context.Context, lat, lon float64, city, timezone string) (*models.OpenMeteoResponse, error) {
+	delay := c.forecastBackoff
+	for attempt := 1; ; attempt++ {
+		openMeteoResp, err := c.fetchForecastOnce(ctx, lat, lon, city, timezone)
+		if err == nil || attempt >= c.forecastAttempts || !isRetryable(err) || ctx.Err() != nil {
+			return openMeteoResp, err
+		}
+
+		logging.Debugf("Forecast for %s failed (attempt %d of %d), retrying in %v: %v", city, attempt, c.forecastAttempts, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+		delay *= 2
+	}
+}
+
+// fetchForecastOnce makes a single forecast API request
+func (c *Client) fetchForecastOnce(ctx context.Context, lat, lon float64, city, timezone string) (*models.OpenMeteoResponse, error) {
+	if timezone == "" {
+		timezone = DefaultTimezone
+	}
+
 	// Prepare URL with query parameters
 	params := url.Values{}
 	params.Add("latitude", fmt.Sprintf("%.4f", lat))
 	params.Add("longitude", fmt.Sprintf("%.4f", lon))
-	params.Add("current", "temperature_2m,weather_code,is_day")
-	params.Add("timezone", "auto")
+	params.Add("current", "temperature_2m,weather_code,is_day,uv_index,apparent_temperature")
+	params.Add("timezone", timezone)
+	// Only the current block is used; one forecast day keeps the payload small
+	params.Add("forecast_days", currentForecastDays)
+
+	requestURL := httpclient.BuildURL(c.baseURL, params)
 
-	requestURL := fmt.Sprintf("%s?%s", c.baseURL, params.Encode())
+	span := c.tracer.StartSpan("weather.forecast")
+	span.SetTag(tracing.TagWeatherCity, city)
+	span.SetTag(tracing.TagHTTPURL, requestURL)
+	defer span.Finish()
 
 	// Make the HTTP request
-	resp, err := c.httpClient.Get(requestURL)
+	resp, err := httpclient.GetCtx(ctx, c.httpClient, requestURL)
 	if err != nil {
-		return nil, models.NewAPIError("Open-Meteo", fmt.Sprintf("Failed to make request: %v", err), 500)
+		span.SetTag(tracing.TagError, err.Error())
+		return nil, models.NewWrappedAPIError("Open-Meteo", fmt.Sprintf("Failed to make request: %v", err), 500, err)
 	}
 	defer resp.Body.Close()
+	span.SetTag(tracing.TagHTTPStatusCode, resp.StatusCode)
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, models.NewAPIError("Open-Meteo", fmt.Sprintf("API returned status %d", resp.StatusCode), resp.StatusCode)
@@ -65,24 +337,31 @@ func (c *Client) GetWeatherByCoordinates(lat, lon float64, city, country string)
 
 	// Parse the response
 	var openMeteoResp models.OpenMeteoResponse
-	if err := json.NewDecoder(resp.Body).Decode(&openMeteoResp); err != nil {
-		return nil, models.NewAPIError("Open-Meteo", fmt.Sprintf("Failed to parse response: %v", err), 500)
+	if err := models.DecodeResponse("Open-Meteo", resp.Body, c.maxResponseBytes, &openMeteoResp); err != nil {
+		return nil, err
 	}
 
-	// Convert to our standard format
-	coords := models.Coordinates{Latitude: lat, Longitude: lon}
-	weatherResp := models.ConvertOpenMeteoResponse(&openMeteoResp, city, country, coords)
-
-	return weatherResp, nil
+	return &openMeteoResp, nil
 }
 
 // GetWeather is a convenience method that handles both city names and coordinates
 func (c *Client) GetWeather(location string) (*models.WeatherResponse, error) {
+	return c.GetWeatherCtx(context.Background(), location)
+}
+
+// GetWeatherCtx is GetWeather with a context that cancels the upstream requests
+func (c *Client) GetWeatherCtx(ctx context.Context, location string) (*models.WeatherResponse, error) {
+	return c.GetWeatherInTimezoneCtx(ctx, location, DefaultTimezone)
+}
+
+// GetWeatherInTimezoneCtx is GetWeatherCtx with times reported in timezone,
+// either "auto" or an IANA name such as "UTC"
+func (c *Client) GetWeatherInTimezoneCtx(ctx context.Context, location, timezone string) (*models.WeatherResponse, error) {
 	if location == "" {
 		return nil, models.NewAPIError("Weather", "Location cannot be empty", 400)
 	}
 
 	// For now, treat all inputs as city names
 	// In the future, we could add support for "lat,lon" format
-	return c.GetWeatherByCity(location)
+	return c.weatherByCity(ctx, location, timezone)
 }
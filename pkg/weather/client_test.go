@@ -1,9 +1,14 @@
 package weather
 
 import (
+	"context"
 	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/JSGette/agent_summit_bazel_workshop/internal/testutils"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
@@ -22,6 +27,7 @@ func TestClient_GetWeatherByCoordinates(t *testing.T) {
 		wantError      bool
 		wantTemp       float64
 		wantCondition  models.WeatherCondition
+		wantUVIndex    float64
 	}{
 		{
 			name:           "successful weather request",
@@ -34,6 +40,7 @@ func TestClient_GetWeatherByCoordinates(t *testing.T) {
 			wantError:      false,
 			wantTemp:       22.5,
 			wantCondition:  models.Cloudy,
+			wantUVIndex:    4.2,
 		},
 		{
 			name:           "API returns 500 error",
@@ -62,7 +69,7 @@ func TestClient_GetWeatherByCoordinates(t *testing.T) {
 			client := NewClient(mockClient)
 
 			// Prepare expected URL
-			expectedURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day&latitude=48.7758&longitude=9.1829&timezone=auto"
+			expectedURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
 
 			if tt.mockError != nil {
 				mockClient.AddError(expectedURL, tt.mockError)
@@ -97,6 +104,10 @@ func TestClient_GetWeatherByCoordinates(t *testing.T) {
 				t.Errorf("Expected condition %v, got %v", tt.wantCondition, result.Condition)
 			}
 
+			if result.UVIndex != tt.wantUVIndex {
+				t.Errorf("Expected UV index %v, got %v", tt.wantUVIndex, result.UVIndex)
+			}
+
 			if result.City != tt.city {
 				t.Errorf("Expected city %v, got %v", tt.city, result.City)
 			}
@@ -108,6 +119,25 @@ func TestClient_GetWeatherByCoordinates(t *testing.T) {
 	}
 }
 
+func TestClient_GetWeatherByCoordinates_WrapsUnderlyingError(t *testing.T) {
+	networkErr := errors.New("network error")
+	mockClient := testutils.NewMockHTTPClient()
+	client := NewClient(mockClient)
+
+	expectedURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+	mockClient.AddError(expectedURL, networkErr)
+
+	_, err := client.GetWeatherByCoordinates(48.7758, 9.1829, "Stuttgart", "Germany")
+
+	if !errors.Is(err, networkErr) {
+		t.Errorf("Expected network error to be reachable, got %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "Failed to make request: network error") {
+		t.Errorf("Expected error message to be unchanged, got %v", err)
+	}
+}
+
 func TestClient_GetWeatherByCity(t *testing.T) {
 	tests := []struct {
 		name              string
@@ -120,6 +150,7 @@ func TestClient_GetWeatherByCity(t *testing.T) {
 		mockWeatherError  error
 		wantError         bool
 		wantCity          string
+		wantRegion        string
 	}{
 		{
 			name:              "successful request for Stuttgart",
@@ -130,6 +161,7 @@ func TestClient_GetWeatherByCity(t *testing.T) {
 			mockWeatherStatus: 200,
 			wantError:         false,
 			wantCity:          "Stuttgart",
+			wantRegion:        "Baden-Württemberg",
 		},
 		{
 			name:              "city not found",
@@ -161,7 +193,7 @@ func TestClient_GetWeatherByCity(t *testing.T) {
 
 			// Setup weather mock if geocoding succeeds
 			if !tt.wantError && tt.mockGeocodeError == nil && tt.mockGeocodeStatus == 200 {
-				weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day&latitude=48.7758&longitude=9.1829&timezone=auto"
+				weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
 				if tt.mockWeatherError != nil {
 					mockClient.AddError(weatherURL, tt.mockWeatherError)
 				} else {
@@ -191,6 +223,9 @@ func TestClient_GetWeatherByCity(t *testing.T) {
 			if result.City != tt.wantCity {
 				t.Errorf("Expected city %v, got %v", tt.wantCity, result.City)
 			}
+			if result.Region != tt.wantRegion {
+				t.Errorf("Expected region %v, got %v", tt.wantRegion, result.Region)
+			}
 		})
 	}
 }
@@ -225,7 +260,7 @@ func TestClient_GetWeather(t *testing.T) {
 				geocodeURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=" + tt.location
 				mockClient.AddResponse(geocodeURL, 200, testutils.OpenMeteoGeocodeResponse)
 
-				weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day&latitude=48.7758&longitude=9.1829&timezone=auto"
+				weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
 				mockClient.AddResponse(weatherURL, 200, testutils.OpenMeteoWeatherResponse)
 			}
 
@@ -248,3 +283,314 @@ func TestClient_GetWeather(t *testing.T) {
 		})
 	}
 }
+
+func TestGetWeatherCondition_AllWMOCodes(t *testing.T) {
+	// Full set of WMO weather interpretation codes returned by Open-Meteo
+	wmoCodes := []int{
+		0, 1, 2, 3,
+		45, 48,
+		51, 53, 55, 56, 57,
+		61, 63, 65, 66, 67,
+		71, 73, 75, 77,
+		80, 81, 82, 85, 86,
+		95, 96, 99,
+	}
+
+	for _, code := range wmoCodes {
+		condition, description := models.GetWeatherCondition(code)
+		if condition == models.Unknown {
+			t.Errorf("Expected WMO code %d to map to a known condition", code)
+		}
+		if description == "" || description == "Unknown weather condition" {
+			t.Errorf("Expected WMO code %d to have a description, got %q", code, description)
+		}
+	}
+
+	if condition, _ := models.GetWeatherCondition(42); condition != models.Unknown {
+		t.Errorf("Expected unmapped code to return Unknown, got %v", condition)
+	}
+}
+
+func TestClient_GetWeatherCtx_Deadline(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+	mockClient.AddResponse(weatherURL, 200, testutils.OpenMeteoWeatherResponse)
+	mockClient.AddDelay(weatherURL, 5*time.Second)
+	client := NewClient(mockClient)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetWeatherCtx(ctx, "Stuttgart")
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the upstream call to be canceled, took %v", elapsed)
+	}
+}
+
+func TestClient_CustomBaseURLs(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	geocodeURL := "http://localhost:8080/open-meteo/search?count=1&format=json&language=en&name=Stuttgart"
+	weatherURL := "http://localhost:8080/open-meteo/forecast?apikey=secret&current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+	mockClient.AddResponse(geocodeURL, 200, testutils.OpenMeteoGeocodeResponse)
+	mockClient.AddResponse(weatherURL, 200, testutils.OpenMeteoWeatherResponse)
+
+	client := NewClient(mockClient,
+		WeatherBaseURL("http://localhost:8080/open-meteo/forecast?apikey=secret"),
+		GeocodeBaseURL("http://localhost:8080/open-meteo/search"),
+	)
+
+	if _, _, err := client.geocoder.GetCoordinates("Stuttgart"); err != nil {
+		t.Errorf("Unexpected geocoding error: %v", err)
+	}
+	if _, err := client.GetWeatherByCoordinates(48.7758, 9.1829, "Stuttgart", "Germany"); err != nil {
+		t.Errorf("Unexpected weather error: %v", err)
+	}
+
+	if mockClient.GetCallCount(geocodeURL) != 1 || mockClient.GetCallCount(weatherURL) != 1 {
+		t.Errorf("Expected one call to each custom endpoint, got %v", mockClient.CallCount)
+	}
+}
+
+func TestDefaultHTTPClient_Headers(t *testing.T) {
+	received := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name          string
+		client        *DefaultHTTPClient
+		wantUserAgent string
+		wantAccept    string
+	}{
+		{"zero value sends defaults", &DefaultHTTPClient{}, DefaultUserAgent, "application/json"},
+		{"custom header set", NewDefaultHTTPClientWithHeaders(http.Header{"User-Agent": {"ops-bot/2.0"}}), "ops-bot/2.0", ""},
+		{"custom User-Agent keeps Accept", NewDefaultHTTPClientWithUserAgent("ops-bot/2.0"), "ops-bot/2.0", "application/json"},
+		{"empty User-Agent keeps default", NewDefaultHTTPClientWithUserAgent(""), DefaultUserAgent, "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			headers := <-received
+			if got := headers.Get("User-Agent"); got != tt.wantUserAgent {
+				t.Errorf("Expected User-Agent %q, got %q", tt.wantUserAgent, got)
+			}
+			if got := headers.Get("Accept"); got != tt.wantAccept {
+				t.Errorf("Expected Accept %q, got %q", tt.wantAccept, got)
+			}
+		})
+	}
+}
+
+func TestDefaultHTTPClient_Post(t *testing.T) {
+	type request struct {
+		method  string
+		headers http.Header
+		body    string
+	}
+	received := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- request{r.Method, r.Header.Clone(), string(body)}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	resp, err := (&DefaultHTTPClient{}).Post(server.URL, "application/json", strings.NewReader(`{"city":"Stuttgart"}`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	got := <-received
+	if got.method != http.MethodPost {
+		t.Errorf("Expected method POST, got %s", got.method)
+	}
+	if ct := got.headers.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected Content-Type application/json, got %q", ct)
+	}
+	if ua := got.headers.Get("User-Agent"); ua != DefaultUserAgent {
+		t.Errorf("Expected User-Agent %q, got %q", DefaultUserAgent, ua)
+	}
+	if got.body != `{"city":"Stuttgart"}` {
+		t.Errorf("Expected the posted body, got %q", got.body)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", resp.StatusCode)
+	}
+}
+
+func TestValidateTimezone(t *testing.T) {
+	tests := []struct {
+		timezone string
+		wantErr  bool
+	}{
+		{"", false},
+		{"auto", false},
+		{"UTC", false},
+		{"Europe/Berlin", false},
+		{"Mars/Olympus_Mons", true},
+		{"not a zone", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.timezone, func(t *testing.T) {
+			err := ValidateTimezone(tt.timezone)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			var apiErr *models.APIError
+			if err != nil && (!errors.As(err, &apiErr) || apiErr.Code != 400) {
+				t.Errorf("Expected a 400 APIError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_GetWeatherInTimezoneCtx(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	expectedURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=UTC"
+	mockClient.AddResponse(expectedURL, 200, `{"current":{"time":"2024-01-15T13:00","temperature_2m":22.5,"weather_code":3,"is_day":1,"uv_index":4.2},"utc_offset_seconds":0,"timezone":"UTC"}`)
+	client := NewClient(mockClient)
+
+	weather, err := client.GetWeatherInTimezoneCtx(context.Background(), "Stuttgart", "UTC")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := time.Date(2024, 1, 15, 13, 0, 0, 0, time.UTC)
+	if !weather.Metadata.Timestamp.Equal(want) {
+		t.Errorf("Expected timestamp %v, got %v", want, weather.Metadata.Timestamp)
+	}
+	if name, offset := weather.Metadata.Timestamp.Zone(); name != "UTC" || offset != 0 {
+		t.Errorf("Expected the timestamp in UTC, got %s%+d", name, offset)
+	}
+}
+
+func TestClient_OversizedBody(t *testing.T) {
+	padding := strings.Repeat(" ", 1024)
+	geocodeURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=Stuttgart"
+	weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(geocodeURL, 200, padding+testutils.OpenMeteoGeocodeResponse)
+	mockClient.AddResponse(weatherURL, 200, padding+testutils.OpenMeteoWeatherResponse)
+	client := NewClient(mockClient, GeocodeRetry(1, 0), MaxResponseBytes(512))
+
+	t.Run("forecast", func(t *testing.T) {
+		_, err := client.GetWeatherByCoordinates(48.7758, 9.1829, "Stuttgart", "Germany")
+
+		var apiErr *models.APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != 502 || !strings.Contains(apiErr.Message, "exceeds 512 bytes") {
+			t.Errorf("Expected APIError with code 502 naming the cap, got %v", err)
+		}
+	})
+
+	t.Run("geocoding", func(t *testing.T) {
+		_, _, err := client.geocoder.GetCoordinates("Stuttgart")
+
+		var apiErr *models.APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != 502 || !strings.Contains(apiErr.Message, "exceeds 512 bytes") {
+			t.Errorf("Expected APIError with code 502 naming the cap, got %v", err)
+		}
+	})
+}
+
+func TestClient_GetWeatherByCity_ForecastRetry(t *testing.T) {
+	const weatherURL = "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+
+	t.Run("transient failure is retried", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddTransientResponse(weatherURL, 503, testutils.APIErrorResponse)
+		mockClient.AddResponse(weatherURL, 200, testutils.OpenMeteoWeatherResponse)
+		client := NewClient(mockClient, ForecastRetry(2, time.Millisecond))
+
+		weather, err := client.GetWeatherByCity("Stuttgart")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if weather.Temperature != 22.5 {
+			t.Errorf("Expected temperature 22.5, got %v", weather.Temperature)
+		}
+		if calls := mockClient.GetCallCount(weatherURL); calls != 2 {
+			t.Errorf("Expected 2 forecast requests, got %d", calls)
+		}
+	})
+
+	t.Run("persistent failure reports the coordinates", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(weatherURL, 503, testutils.APIErrorResponse)
+		client := NewClient(mockClient, ForecastRetry(2, time.Millisecond))
+
+		_, err := client.GetWeatherByCity("Stuttgart")
+
+		var apiErr *models.APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != 503 {
+			t.Fatalf("Expected a 503 APIError, got %v", err)
+		}
+		if !strings.Contains(apiErr.Message, "48.7758, 9.1829") {
+			t.Errorf("Expected the message to name the coordinates, got %q", apiErr.Message)
+		}
+
+		var forecastErr *ForecastError
+		if !errors.As(err, &forecastErr) {
+			t.Fatalf("Expected a ForecastError, got %v", err)
+		}
+		if forecastErr.Coordinates != (models.Coordinates{Latitude: 48.7758, Longitude: 9.1829}) || forecastErr.Country != "Germany" {
+			t.Errorf("Unexpected forecast error details: %+v", forecastErr)
+		}
+		if !errors.Is(err, models.ErrUpstreamUnavailable) {
+			t.Errorf("Expected the error to still match ErrUpstreamUnavailable")
+		}
+		if calls := mockClient.GetCallCount(weatherURL); calls != 2 {
+			t.Errorf("Expected 2 forecast requests, got %d", calls)
+		}
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(weatherURL, 400, testutils.APIErrorResponse)
+		client := NewClient(mockClient, ForecastRetry(2, time.Millisecond))
+
+		if _, err := client.GetWeatherByCity("Stuttgart"); err == nil {
+			t.Fatal("Expected an error, got nil")
+		}
+		if calls := mockClient.GetCallCount(weatherURL); calls != 1 {
+			t.Errorf("Expected 1 forecast request, got %d", calls)
+		}
+	})
+}
+
+func TestClient_GetWeatherByCoordinates_CurrentOnly(t *testing.T) {
+	var query map[string][]string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(testutils.OpenMeteoWeatherResponse))
+	}))
+	defer upstream.Close()
+
+	client := NewClient(&DefaultHTTPClient{}, WeatherBaseURL(upstream.URL))
+	weather, err := client.GetWeatherByCoordinates(48.7758, 9.1829, "Stuttgart", "Germany")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if got := query["forecast_days"]; len(got) != 1 || got[0] != "1" {
+		t.Errorf("Expected forecast_days=1 in the request, got %v", got)
+	}
+	if weather.Temperature != 22.5 || weather.Description == "" {
+		t.Errorf("Expected the current conditions to be parsed, got %+v", weather)
+	}
+}
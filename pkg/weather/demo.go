@@ -0,0 +1,81 @@
+package weather
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+)
+
+// Metadata sources of simulated weather responses
+const (
+	DemoSource = "Demo Mode (Simulated Data)"
+	// MaintenanceDemoSource marks demo data served because the service is in
+	// maintenance mode
+	MaintenanceDemoSource = "Demo Mode (Maintenance)"
+)
+
+// DemoWeatherData contains plausible conditions for the cities in CityCoordinates
+var DemoWeatherData = map[string]struct {
+	BaseTemperature float64
+	WeatherCode     int
+	UVIndex         float64
+}{
+	"stuttgart": {BaseTemperature: 14.0, WeatherCode: 2, UVIndex: 3.1},
+	"berlin":    {BaseTemperature: 12.5, WeatherCode: 3, UVIndex: 2.4},
+	"munich":    {BaseTemperature: 13.0, WeatherCode: 1, UVIndex: 3.5},
+	"london":    {BaseTemperature: 11.5, WeatherCode: 61, UVIndex: 1.8},
+	"paris":     {BaseTemperature: 15.0, WeatherCode: 2, UVIndex: 3.8},
+	"new york":  {BaseTemperature: 16.5, WeatherCode: 0, UVIndex: 4.6},
+}
+
+// generateDemoWeatherResponse creates a weather response with simulated temperature changes
+func generateDemoWeatherResponse(city string) (*models.WeatherResponse, error) {
+	key := strings.ToLower(strings.TrimSpace(city))
+	data, exists := DemoWeatherData[key]
+	location, known := CityCoordinates[key]
+	if !exists || !known {
+		return nil, models.NewAPIError("Demo Weather", "City not found in demo data", 404)
+	}
+
+	// Create a deterministic but varying temperature based on current time
+	now := time.Now()
+	seed := now.Hour()*60 + now.Minute() // Changes every minute
+	r := rand.New(rand.NewSource(int64(seed + len(key))))
+
+	// Vary the temperature by up to ±3 degrees
+	temperature := data.BaseTemperature + (r.Float64()-0.5)*6
+
+	// Simplified daylight hours
+	isDay := now.Hour() >= 7 && now.Hour() < 19
+	uvIndex := data.UVIndex
+	if !isDay {
+		uvIndex = 0
+	}
+
+	condition, description := models.GetWeatherCondition(data.WeatherCode)
+
+	return &models.WeatherResponse{
+		City:        city,
+		Country:     location.Country,
+		Region:      location.Region,
+		Temperature: temperature,
+		Condition:   condition,
+		Severity:    condition.Severity(),
+		Severe:      models.IsSevereWeatherCode(data.WeatherCode),
+		Description: description,
+		IsDay:       isDay,
+		UVIndex:     uvIndex,
+		Coordinates: location.Coords,
+		Metadata: models.ResponseMetadata{
+			Timestamp: now,
+			Source:    DemoSource,
+		},
+	}, nil
+}
+
+// GetDemoWeather returns demo weather data for the given city
+func GetDemoWeather(city string) (*models.WeatherResponse, error) {
+	return generateDemoWeatherResponse(city)
+}
@@ -1,13 +1,25 @@
 package weather
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/cache"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/httpclient"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/tracing"
 )
 
 // GeocodeResponse represents the response from Open-Meteo geocoding API
@@ -23,21 +35,113 @@ type GeocodeResponse struct {
 }
 
 // HTTPClient interface for dependency injection and testing
-type HTTPClient interface {
-	Get(url string) (*http.Response, error)
+type HTTPClient = httpclient.HTTPClient
+
+// ContextHTTPClient is an HTTPClient whose requests can be canceled through a context
+type ContextHTTPClient = httpclient.ContextHTTPClient
+
+// DefaultUserAgent identifies this service to Open-Meteo by default
+const DefaultUserAgent = "weather-stock-api (+https://github.com/JSGette/agent_summit_bazel_workshop)"
+
+// DefaultHeaders returns the headers sent with Open-Meteo requests by default
+func DefaultHeaders() http.Header {
+	return http.Header{
+		"User-Agent": {DefaultUserAgent},
+		"Accept":     {"application/json"},
+	}
 }
 
-// DefaultHTTPClient wraps the standard http.Client
-type DefaultHTTPClient struct{}
+// DefaultHTTPClient is an httpclient.Client sending Open-Meteo headers. The
+// zero value sends DefaultHeaders.
+type DefaultHTTPClient struct {
+	headers http.Header
+
+	once   sync.Once
+	client *httpclient.Client
+}
+
+// NewDefaultHTTPClientWithHeaders returns a client that sends headers with
+// every request instead of DefaultHeaders
+func NewDefaultHTTPClientWithHeaders(headers http.Header) *DefaultHTTPClient {
+	return &DefaultHTTPClient{headers: headers.Clone()}
+}
+
+// NewDefaultHTTPClientWithUserAgent returns a client that sends DefaultHeaders
+// with userAgent in place of DefaultUserAgent; an empty userAgent keeps the default
+func NewDefaultHTTPClientWithUserAgent(userAgent string) *DefaultHTTPClient {
+	headers := DefaultHeaders()
+	if userAgent != "" {
+		headers.Set("User-Agent", userAgent)
+	}
+	return &DefaultHTTPClient{headers: headers}
+}
+
+// shared returns the client sending the configured headers
+func (c *DefaultHTTPClient) shared() *httpclient.Client {
+	c.once.Do(func() {
+		headers := c.headers
+		if headers == nil {
+			headers = DefaultHeaders()
+		}
+		c.client = httpclient.New(httpclient.Headers(headers))
+	})
+	return c.client
+}
 
 func (c *DefaultHTTPClient) Get(url string) (*http.Response, error) {
-	return http.Get(url)
+	return c.shared().Get(url)
+}
+
+// GetWithContext performs a GET request that is canceled when ctx is done
+func (c *DefaultHTTPClient) GetWithContext(ctx context.Context, url string) (*http.Response, error) {
+	return c.shared().GetWithContext(ctx, url)
+}
+
+// Post sends body as a POST request of the given content type
+func (c *DefaultHTTPClient) Post(url, contentType string, body io.Reader) (*http.Response, error) {
+	return c.shared().Post(url, contentType, body)
 }
 
+// PostWithContext is Post with a request that is canceled when ctx is done
+func (c *DefaultHTTPClient) PostWithContext(ctx context.Context, url, contentType string, body io.Reader) (*http.Response, error) {
+	return c.shared().PostWithContext(ctx, url, contentType, body)
+}
+
+// GeocodeCacheTTL is how long cities resolved through the API are remembered
+const GeocodeCacheTTL = 24 * time.Hour
+
+// geocodeResult is a resolved city as stored in the geocoder cache
+type geocodeResult struct {
+	Coords  models.Coordinates
+	Country string
+	Region  string
+}
+
+// Geocoding retry defaults. Results are stable, so transient failures are
+// worth retrying; the backoff doubles after each attempt.
+const (
+	DefaultGeocodeAttempts = 3
+	DefaultGeocodeBackoff  = 100 * time.Millisecond
+)
+
 // Geocoder handles city name to coordinates conversion
 type Geocoder struct {
 	client  HTTPClient
 	baseURL string
+	cache   cache.Cache
+	tracer  tracing.Tracer
+
+	// ownCache is the cache the geocoder created, closed when replaced
+	ownCache *cache.MemoryCache
+
+	attempts int
+	backoff  time.Duration
+
+	// maxResponseBytes caps the size of a decoded response body
+	maxResponseBytes int
+
+	// transliterate strips accents from city names sent to the API
+	transliterate bool
 }
 
 // NewGeocoder creates a new geocoder instance
@@ -45,98 +149,446 @@ func NewGeocoder(client HTTPClient) *Geocoder {
 	if client == nil {
 		client = &DefaultHTTPClient{}
 	}
+	ownCache := cache.NewMemoryCache(cache.DefaultCleanupInterval)
 	return &Geocoder{
-		client:  client,
-		baseURL: "https://geocoding-api.open-meteo.com/v1/search",
+		client:   client,
+		baseURL:  DefaultGeocodeBaseURL,
+		cache:    ownCache,
+		ownCache: ownCache,
+		tracer:   tracing.NoopTracer{},
+
+		attempts: DefaultGeocodeAttempts,
+		backoff:  DefaultGeocodeBackoff,
+
+		maxResponseBytes: models.DefaultMaxResponseBytes,
 	}
 }
 
 // GetCoordinates converts a city name to coordinates using Open-Meteo geocoding API
 func (g *Geocoder) GetCoordinates(city string) (*models.Coordinates, string, error) {
+	return g.GetCoordinatesCtx(context.Background(), city)
+}
+
+// GetCoordinatesCtx converts a city name to coordinates and country,
+// canceling the API request when ctx is done. Use GetLocationCtx to also get
+// the region.
+func (g *Geocoder) GetCoordinatesCtx(ctx context.Context, city string) (*models.Coordinates, string, error) {
+	location, err := g.GetLocationCtx(ctx, city)
+	if err != nil {
+		return nil, "", err
+	}
+	return &location.Coordinates, location.Country, nil
+}
+
+// GetLocation resolves a city name to its coordinates, country, and region
+// using Open-Meteo geocoding API
+func (g *Geocoder) GetLocation(city string) (*models.ResolvedLocation, error) {
+	return g.GetLocationCtx(context.Background(), city)
+}
+
+// GetLocationCtx resolves a city name, canceling the API request when ctx is
+// done. When the best match is empty, a wider candidate search is tried
+// before reporting a 404 that suggests the closest known city.
+func (g *Geocoder) GetLocationCtx(ctx context.Context, city string) (*models.ResolvedLocation, error) {
 	if strings.TrimSpace(city) == "" {
-		return nil, "", models.NewAPIError("Geocoding", "City name cannot be empty", 400)
+		return nil, models.NewAPIError("Geocoding", "City name cannot be empty", 400)
+	}
+
+	geocodeResp, err := g.search(ctx, city, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if we got any results
+	if len(geocodeResp.Results) == 0 {
+		// The candidate search is best effort; its failures end in the 404 below
+		geocodeResp, err = g.search(ctx, city, geocodeCandidateCount)
+		if err != nil && ctx.Err() != nil {
+			return nil, err
+		}
+		if err != nil || len(geocodeResp.Results) == 0 {
+			return nil, notFoundError(city)
+		}
+	}
+
+	result := geocodeResp.Results[0]
+	return &models.ResolvedLocation{
+		Name:    result.Name,
+		Country: result.Country,
+		Region:  result.Admin1,
+		Coordinates: models.Coordinates{
+			Latitude:  result.Latitude,
+			Longitude: result.Longitude,
+		},
+	}, nil
+}
+
+// geocodeCandidateCount is how many results the fallback search asks for
+const geocodeCandidateCount = 10
+
+// search queries the geocoding API for up to count matches of city. Network
+// errors and 5xx responses are retried with exponential backoff; other
+// failures, such as a 400 or 404, are returned at once.
+func (g *Geocoder) search(ctx context.Context, city string, count int) (*GeocodeResponse, error) {
+	delay := g.backoff
+	for attempt := 1; ; attempt++ {
+		geocodeResp, err := g.searchOnce(ctx, city, count)
+		if err == nil || attempt >= g.attempts || !isRetryable(err) || ctx.Err() != nil {
+			return geocodeResp, err
+		}
+
+		logging.Debugf("Geocoding %s failed (attempt %d of %d), retrying in %v: %v", city, attempt, g.attempts, delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+		delay *= 2
+	}
+}
+
+// isRetryable reports whether a failed upstream request may succeed if repeated
+func isRetryable(err error) bool {
+	var apiErr *models.APIError
+	return errors.As(err, &apiErr) && apiErr.Code >= 500
+}
+
+// searchOnce makes a single geocoding API request
+func (g *Geocoder) searchOnce(ctx context.Context, city string, count int) (*GeocodeResponse, error) {
+	name := sanitizeCityName(city)
+	if g.transliterate {
+		name = transliterate(name)
 	}
 
 	// Prepare the URL with query parameters
 	params := url.Values{}
-	params.Add("name", city)
-	params.Add("count", "1")
+	params.Add("name", name)
+	params.Add("count", strconv.Itoa(count))
 	params.Add("language", "en")
 	params.Add("format", "json")
 
-	requestURL := fmt.Sprintf("%s?%s", g.baseURL, params.Encode())
+	requestURL := httpclient.BuildURL(g.baseURL, params)
+
+	span := g.tracer.StartSpan("weather.geocode")
+	span.SetTag(tracing.TagWeatherCity, name)
+	span.SetTag(tracing.TagHTTPURL, requestURL)
+	defer span.Finish()
 
 	// Make the HTTP request
-	resp, err := g.client.Get(requestURL)
+	resp, err := httpclient.GetCtx(ctx, g.client, requestURL)
 	if err != nil {
-		return nil, "", models.NewAPIError("Geocoding", fmt.Sprintf("Failed to make request: %v", err), 500)
+		span.SetTag(tracing.TagError, err.Error())
+		return nil, models.NewWrappedAPIError("Geocoding", fmt.Sprintf("Failed to make request: %v", err), 500, err)
 	}
 	defer resp.Body.Close()
+	span.SetTag(tracing.TagHTTPStatusCode, resp.StatusCode)
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, "", models.NewAPIError("Geocoding", fmt.Sprintf("API returned status %d", resp.StatusCode), resp.StatusCode)
+		return nil, models.NewAPIError("Geocoding", fmt.Sprintf("API returned status %d", resp.StatusCode), resp.StatusCode)
 	}
 
 	// Parse the response
 	var geocodeResp GeocodeResponse
-	if err := json.NewDecoder(resp.Body).Decode(&geocodeResp); err != nil {
-		return nil, "", models.NewAPIError("Geocoding", fmt.Sprintf("Failed to parse response: %v", err), 500)
+	if err := models.DecodeResponse("Geocoding", resp.Body, g.maxResponseBytes, &geocodeResp); err != nil {
+		return nil, err
 	}
 
-	// Check if we got any results
-	if len(geocodeResp.Results) == 0 {
-		return nil, "", models.NewAPIError("Geocoding", fmt.Sprintf("City '%s' not found", city), 404)
+	return &geocodeResp, nil
+}
+
+// notFoundError reports an unknown city, suggesting a close known one if any
+func notFoundError(city string) error {
+	if suggestion, ok := suggestCity(city); ok {
+		return models.NewAPIError("Geocoding", fmt.Sprintf("City '%s' not found, did you mean '%s'?", city, suggestion), 404)
 	}
+	return models.NewAPIError("Geocoding", fmt.Sprintf("City '%s' not found", city), 404)
+}
 
-	result := geocodeResp.Results[0]
-	coords := &models.Coordinates{
-		Latitude:  result.Latitude,
-		Longitude: result.Longitude,
+// ReverseGeocodeRadiusKm is how far from a known city coordinates may be
+// for ReverseGeocode to name them after it
+const ReverseGeocodeRadiusKm = 25.0
+
+// ReverseGeocode names the point at lat, lon after the closest known city:
+// the static table and cities already resolved at runtime. Open-Meteo has
+// no reverse geocoding API, so points farther than ReverseGeocodeRadiusKm
+// from every known city are labeled with the coordinates themselves and an
+// empty country. Coordinates out of range are a 400 error.
+func (g *Geocoder) ReverseGeocode(lat, lon float64) (name, country string, err error) {
+	if err := ValidateCoordinates(lat, lon); err != nil {
+		return "", "", err
+	}
+
+	bestDistance := ReverseGeocodeRadiusKm
+	for _, city := range g.CachedCities() {
+		distance := distanceKm(lat, lon, city.Coordinates.Latitude, city.Coordinates.Longitude)
+		if distance <= bestDistance {
+			name, country, bestDistance = city.Name, city.Country, distance
+		}
+	}
+
+	if name == "" {
+		return fmt.Sprintf("%.4f, %.4f", lat, lon), "", nil
+	}
+	return name, country, nil
+}
+
+// earthRadiusKm is the mean radius used for great-circle distances
+const earthRadiusKm = 6371.0
+
+// distanceKm returns the great-circle (haversine) distance between two points
+func distanceKm(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// NearestCachedCity returns the city of the static CityCoordinates table
+// closest to lat, lon, in title case, with its distance in kilometers. It
+// needs no network, so it can label points offline; ties go to the
+// alphabetically first city.
+func NearestCachedCity(lat, lon float64) (name, country string, km float64) {
+	best := ""
+	km = math.Inf(1)
+	for key, city := range CityCoordinates {
+		distance := distanceKm(lat, lon, city.Coords.Latitude, city.Coords.Longitude)
+		if distance < km || (distance == km && key < best) {
+			best, country, km = key, city.Country, distance
+		}
+	}
+	return titleCase(best), country, km
+}
+
+// suggestCity returns the entry of CityCoordinates closest to input by edit
+// distance, in title case. Only matches within a third of the input length
+// (and at most two edits) are suggested; ties go to the alphabetically first.
+func suggestCity(input string) (string, bool) {
+	normalized := strings.ToLower(strings.TrimSpace(input))
+	if normalized == "" {
+		return "", false
 	}
 
-	return coords, result.Country, nil
+	maxDistance := len([]rune(normalized)) / 3
+	if maxDistance > 2 {
+		maxDistance = 2
+	}
+
+	best, bestDistance := "", maxDistance+1
+	for name := range CityCoordinates {
+		distance := levenshtein(normalized, name)
+		if distance < bestDistance || (distance == bestDistance && name < best) {
+			best, bestDistance = name, distance
+		}
+	}
+
+	if best == "" || bestDistance == 0 {
+		return "", false
+	}
+	return titleCase(best), true
+}
+
+// levenshtein returns the number of single-rune edits turning a into b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(rb)]
+}
+
+// titleCase upper-cases the first letter of each space-separated word
+func titleCase(value string) string {
+	words := strings.Fields(value)
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
 }
 
 // CityCoordinates is a simple in-memory cache for common cities
 var CityCoordinates = map[string]struct {
 	Coords  models.Coordinates
 	Country string
+	Region  string
 }{
 	"stuttgart": {
 		Coords:  models.Coordinates{Latitude: 48.7758, Longitude: 9.1829},
 		Country: "Germany",
+		Region:  "Baden-Württemberg",
 	},
 	"berlin": {
 		Coords:  models.Coordinates{Latitude: 52.5200, Longitude: 13.4050},
 		Country: "Germany",
+		Region:  "Berlin",
 	},
 	"munich": {
 		Coords:  models.Coordinates{Latitude: 48.1351, Longitude: 11.5820},
 		Country: "Germany",
+		Region:  "Bavaria",
 	},
 	"london": {
 		Coords:  models.Coordinates{Latitude: 51.5074, Longitude: -0.1278},
 		Country: "United Kingdom",
+		Region:  "England",
 	},
 	"paris": {
 		Coords:  models.Coordinates{Latitude: 48.8566, Longitude: 2.3522},
 		Country: "France",
+		Region:  "Île-de-France",
 	},
 	"new york": {
 		Coords:  models.Coordinates{Latitude: 40.7128, Longitude: -74.0060},
 		Country: "United States",
+		Region:  "New York",
 	},
 }
 
-// GetCoordinatesWithCache tries cache first, then falls back to API
+// ListCachedCities returns the cities in the static CityCoordinates table,
+// sorted by name
+func ListCachedCities() []models.CityInfo {
+	cities := make([]models.CityInfo, 0, len(CityCoordinates))
+	for key, city := range CityCoordinates {
+		cities = append(cities, models.CityInfo{Name: titleCase(key), Country: city.Country, Coordinates: city.Coords})
+	}
+	sortCities(cities)
+	return cities
+}
+
+// CachedCities returns the cities in the static table plus those resolved
+// at runtime, sorted by name. Runtime entries are only listed when the
+// geocoder cache can enumerate its keys.
+func (g *Geocoder) CachedCities() []models.CityInfo {
+	cities := ListCachedCities()
+
+	lister, ok := g.cache.(cache.Lister)
+	if !ok {
+		return cities
+	}
+
+	for _, key := range lister.Keys() {
+		if _, static := CityCoordinates[key]; static {
+			continue
+		}
+		var cached geocodeResult
+		if cache.Load(g.cache, key, &cached) {
+			cities = append(cities, models.CityInfo{Name: titleCase(key), Country: cached.Country, Coordinates: cached.Coords})
+		}
+	}
+	sortCities(cities)
+	return cities
+}
+
+// sortCities orders cities by name, then country
+func sortCities(cities []models.CityInfo) {
+	sort.Slice(cities, func(i, j int) bool {
+		if cities[i].Name != cities[j].Name {
+			return cities[i].Name < cities[j].Name
+		}
+		return cities[i].Country < cities[j].Country
+	})
+}
+
+// CacheStats returns the statistics of the cache of cities resolved through
+// the API, if it keeps any
+func (g *Geocoder) CacheStats() (cache.Stats, bool) {
+	reporter, ok := g.cache.(cache.StatsReporter)
+	if !ok {
+		return cache.Stats{}, false
+	}
+	return reporter.Stats(), true
+}
+
+// SetCache replaces the cache used for cities resolved through the API. The
+// default cache is closed, stopping its cleanup goroutine; caches passed in
+// are left to the caller.
+func (g *Geocoder) SetCache(c cache.Cache) {
+	if g.ownCache != nil && c != cache.Cache(g.ownCache) {
+		g.ownCache.Close()
+		g.ownCache = nil
+	}
+	g.cache = c
+}
+
+// SetRetry sets how many times a geocoding request is attempted and the delay
+// before the first retry, which doubles after each attempt. Fewer than one
+// attempt is treated as one.
+func (g *Geocoder) SetRetry(attempts int, backoff time.Duration) {
+	g.attempts = max(attempts, 1)
+	g.backoff = backoff
+}
+
+// SetTransliterate makes geocoding requests spell accented city names in
+// ASCII, e.g. "Sao Paulo" for "São Paulo", for upstreams that only match
+// unaccented names
+func (g *Geocoder) SetTransliterate(enabled bool) {
+	g.transliterate = enabled
+}
+
+// SetTracer records a span for every geocoding API request; nil disables tracing
+func (g *Geocoder) SetTracer(t tracing.Tracer) {
+	g.tracer = tracing.OrNoop(t)
+}
+
+// GetCoordinatesWithCache tries the static city table and the runtime cache
+// first, then falls back to the API and caches the result
 func (g *Geocoder) GetCoordinatesWithCache(city string) (*models.Coordinates, string, error) {
-	cityLower := strings.ToLower(strings.TrimSpace(city))
+	return g.GetCoordinatesWithCacheCtx(context.Background(), city)
+}
+
+// GetCoordinatesWithCacheCtx is GetCoordinatesWithCache with a context for the API fallback
+func (g *Geocoder) GetCoordinatesWithCacheCtx(ctx context.Context, city string) (*models.Coordinates, string, error) {
+	location, err := g.GetLocationWithCacheCtx(ctx, city)
+	if err != nil {
+		return nil, "", err
+	}
+	return &location.Coordinates, location.Country, nil
+}
 
-	// Check cache first
+// GetLocationWithCacheCtx is GetLocationCtx backed by the static city table
+// and the runtime cache. The returned name is city as given.
+func (g *Geocoder) GetLocationWithCacheCtx(ctx context.Context, city string) (*models.ResolvedLocation, error) {
+	cityLower := strings.ToLower(sanitizeCityName(city))
+
+	// Check the static table first
 	if cached, exists := CityCoordinates[cityLower]; exists {
-		return &cached.Coords, cached.Country, nil
+		return &models.ResolvedLocation{Name: city, Country: cached.Country, Region: cached.Region, Coordinates: cached.Coords}, nil
+	}
+
+	// Then cities already resolved at runtime
+	var cached geocodeResult
+	if cache.Load(g.cache, cityLower, &cached) {
+		return &models.ResolvedLocation{Name: city, Country: cached.Country, Region: cached.Region, Coordinates: cached.Coords}, nil
 	}
 
 	// Fall back to API
-	return g.GetCoordinates(city)
+	location, err := g.GetLocationCtx(ctx, city)
+	if err != nil {
+		return nil, err
+	}
+
+	g.cache.Set(cityLower, geocodeResult{Coords: location.Coordinates, Country: location.Country, Region: location.Region}, GeocodeCacheTTL)
+	location.Name = city
+	return location, nil
 }
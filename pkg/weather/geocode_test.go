@@ -1,11 +1,17 @@
 package weather
 
 import (
+	"context"
 	"errors"
+	"net/url"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/JSGette/agent_summit_bazel_workshop/internal/testutils"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/cache"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
 )
 
 func TestGeocoder_GetCoordinates(t *testing.T) {
@@ -197,6 +203,32 @@ func TestGeocoder_GetCoordinatesWithCache(t *testing.T) {
 	}
 }
 
+func TestGeocoder_GetCoordinatesWithCache_RuntimeCache(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	geocoder := NewGeocoder(mockClient)
+
+	expectedURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=Tokyo"
+	mockClient.AddResponse(expectedURL, 200, testutils.OpenMeteoGeocodeResponse)
+
+	first, firstCountry, err := geocoder.GetCoordinatesWithCache("Tokyo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	second, secondCountry, err := geocoder.GetCoordinatesWithCache("tokyo")
+	if err != nil {
+		t.Fatalf("Unexpected error on cached lookup: %v", err)
+	}
+
+	if *first != *second || firstCountry != secondCountry {
+		t.Errorf("Expected cached result %v/%s, got %v/%s", *first, firstCountry, *second, secondCountry)
+	}
+
+	if count := mockClient.GetCallCount(expectedURL); count != 1 {
+		t.Errorf("Expected geocoding API to be called once, got %d", count)
+	}
+}
+
 func TestNewGeocoder(t *testing.T) {
 	t.Run("with nil client", func(t *testing.T) {
 		geocoder := NewGeocoder(nil)
@@ -219,3 +251,393 @@ func TestNewGeocoder(t *testing.T) {
 		}
 	})
 }
+
+func TestSuggestCity(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   string
+		wantOK bool
+	}{
+		{input: "Stutgart", want: "Stuttgart", wantOK: true},
+		{input: "Londun", want: "London", wantOK: true},
+		{input: "berln", want: "Berlin", wantOK: true},
+		{input: "  MUNCIH ", want: "Munich", wantOK: true},
+		{input: "New Yrok", want: "New York", wantOK: true},
+		{input: "Pari", want: "Paris", wantOK: true},
+		{input: "Paris", wantOK: false},
+		{input: "Rome", wantOK: false},
+		{input: "Tokyo", wantOK: false},
+		{input: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, ok := suggestCity(tt.input)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("suggestCity(%q) = %q, %v, want %q, %v", tt.input, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGeocoder_GetCoordinates_Fallbacks(t *testing.T) {
+	bestMatchURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=Stutgart"
+	candidatesURL := "https://geocoding-api.open-meteo.com/v1/search?count=10&format=json&language=en&name=Stutgart"
+
+	t.Run("candidate search finds a match", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(bestMatchURL, 200, testutils.OpenMeteoGeocodeNotFound)
+		mockClient.AddResponse(candidatesURL, 200, testutils.OpenMeteoGeocodeResponse)
+
+		coords, country, err := NewGeocoder(mockClient).GetCoordinates("Stutgart")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if coords.Latitude != 48.7758 || country != "Germany" {
+			t.Errorf("Unexpected result: %+v, %s", coords, country)
+		}
+	})
+
+	t.Run("suggestion in 404", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(bestMatchURL, 200, testutils.OpenMeteoGeocodeNotFound)
+		mockClient.AddResponse(candidatesURL, 200, testutils.OpenMeteoGeocodeNotFound)
+
+		_, _, err := NewGeocoder(mockClient).GetCoordinates("Stutgart")
+
+		var apiErr *models.APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != 404 {
+			t.Fatalf("Expected a 404 APIError, got %v", err)
+		}
+		if !strings.Contains(apiErr.Message, "did you mean 'Stuttgart'?") {
+			t.Errorf("Expected a suggestion, got %q", apiErr.Message)
+		}
+	})
+}
+
+func TestGeocoder_CachedCities(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	geocoder := NewGeocoder(mockClient)
+
+	static := ListCachedCities()
+	if len(static) != len(CityCoordinates) {
+		t.Fatalf("Expected %d static cities, got %d", len(CityCoordinates), len(static))
+	}
+	if static[0].Name != "Berlin" || static[0].Country != "Germany" {
+		t.Errorf("Expected Berlin first, got %+v", static[0])
+	}
+
+	// Resolve a city through the API so it lands in the runtime cache
+	geocodeURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=Amsterdam"
+	mockClient.AddResponse(geocodeURL, 200, `{"results":[{"name":"Amsterdam","country":"Netherlands","latitude":52.37,"longitude":4.89}]}`)
+	if _, _, err := geocoder.GetCoordinatesWithCache("Amsterdam"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, err := geocoder.GetCoordinatesWithCache("Berlin"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cities := geocoder.CachedCities()
+	if len(cities) != len(CityCoordinates)+1 {
+		t.Fatalf("Expected %d cities, got %d: %+v", len(CityCoordinates)+1, len(cities), cities)
+	}
+	for i := 1; i < len(cities); i++ {
+		if cities[i-1].Name > cities[i].Name {
+			t.Errorf("Expected cities sorted by name, got %s before %s", cities[i-1].Name, cities[i].Name)
+		}
+	}
+	if cities[0].Name != "Amsterdam" || cities[0].Country != "Netherlands" || cities[0].Coordinates.Latitude != 52.37 {
+		t.Errorf("Expected the runtime entry for Amsterdam first, got %+v", cities[0])
+	}
+}
+
+func TestGeocoder_GetCoordinates_Retry(t *testing.T) {
+	expectedURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=Tokyo"
+	tokyoResponse := `{"results":[{"name":"Tokyo","country":"Japan","latitude":35.6895,"longitude":139.6917}]}`
+
+	tests := []struct {
+		name      string
+		setup     func(m *testutils.MockHTTPClient)
+		wantErr   bool
+		wantCode  int
+		wantCalls int
+	}{
+		{
+			name: "network error then success",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddTransientError(expectedURL, errors.New("connection reset"))
+				m.AddResponse(expectedURL, 200, tokyoResponse)
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "503 then success",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddTransientResponse(expectedURL, 503, "unavailable")
+				m.AddResponse(expectedURL, 200, tokyoResponse)
+			},
+			wantCalls: 2,
+		},
+		{
+			name: "persistent 5xx gives up after all attempts",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddResponse(expectedURL, 502, "bad gateway")
+			},
+			wantErr:   true,
+			wantCode:  502,
+			wantCalls: 3,
+		},
+		{
+			name: "400 is not retried",
+			setup: func(m *testutils.MockHTTPClient) {
+				m.AddResponse(expectedURL, 400, "bad request")
+			},
+			wantErr:   true,
+			wantCode:  400,
+			wantCalls: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			tt.setup(mockClient)
+			geocoder := NewGeocoder(mockClient)
+			geocoder.SetRetry(3, time.Millisecond)
+
+			coords, country, err := geocoder.GetCoordinates("Tokyo")
+
+			if calls := mockClient.GetCallCount(expectedURL); calls != tt.wantCalls {
+				t.Errorf("Expected %d calls, got %d", tt.wantCalls, calls)
+			}
+			if tt.wantErr {
+				var apiErr *models.APIError
+				if !errors.As(err, &apiErr) || apiErr.Code != tt.wantCode {
+					t.Errorf("Expected a %d APIError, got %v", tt.wantCode, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if country != "Japan" || coords.Latitude != 35.6895 {
+				t.Errorf("Expected Tokyo, Japan, got %v, %s", coords, country)
+			}
+		})
+	}
+}
+
+func TestGeocoder_GetCoordinates_NotFoundIsNotRetried(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	geocoder := NewGeocoder(mockClient)
+	geocoder.SetRetry(3, time.Millisecond)
+
+	// Unmocked URLs answer 404
+	_, _, err := geocoder.GetCoordinates("Tokyo")
+
+	var apiErr *models.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != 404 {
+		t.Fatalf("Expected a 404 APIError, got %v", err)
+	}
+	url := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=Tokyo"
+	if calls := mockClient.GetCallCount(url); calls != 1 {
+		t.Errorf("Expected a single attempt, got %d", calls)
+	}
+}
+
+func TestGeocoder_GetLocation(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	geocoder := NewGeocoder(mockClient)
+
+	expectedURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=Tokyo"
+	mockClient.AddResponse(expectedURL, 200, testutils.OpenMeteoGeocodeResponse)
+
+	location, err := geocoder.GetLocation("Tokyo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := models.ResolvedLocation{
+		Name:        "Stuttgart",
+		Country:     "Germany",
+		Region:      "Baden-Württemberg",
+		Coordinates: models.Coordinates{Latitude: 48.7758, Longitude: 9.1829},
+	}
+	if *location != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *location)
+	}
+
+	t.Run("region is cached", func(t *testing.T) {
+		if _, err := geocoder.GetLocationWithCacheCtx(context.Background(), "Tokyo"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		cached, err := geocoder.GetLocationWithCacheCtx(context.Background(), "tokyo")
+		if err != nil {
+			t.Fatalf("Unexpected error on cached lookup: %v", err)
+		}
+
+		if cached.Region != "Baden-Württemberg" || cached.Name != "tokyo" {
+			t.Errorf("Expected the cached region under the requested name, got %+v", *cached)
+		}
+		if count := mockClient.GetCallCount(expectedURL); count != 2 {
+			t.Errorf("Expected one more API call for the uncached lookup, got %d in total", count)
+		}
+	})
+
+	t.Run("static table", func(t *testing.T) {
+		location, err := geocoder.GetLocationWithCacheCtx(context.Background(), "Munich")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if location.Region != "Bavaria" {
+			t.Errorf("Expected region Bavaria, got %q", location.Region)
+		}
+	})
+}
+
+func TestGeocoder_ReverseGeocode(t *testing.T) {
+	geocoder := NewGeocoder(testutils.NewMockHTTPClient())
+	geocoder.cache.Set("tokyo", geocodeResult{Coords: models.Coordinates{Latitude: 35.6895, Longitude: 139.6917}, Country: "Japan"}, time.Minute)
+
+	tests := []struct {
+		name        string
+		lat, lon    float64
+		wantName    string
+		wantCountry string
+	}{
+		{"exact static city", 48.7758, 9.1829, "Stuttgart", "Germany"},
+		{"near a static city", 48.80, 9.10, "Stuttgart", "Germany"},
+		{"near a runtime cached city", 35.70, 139.70, "Tokyo", "Japan"},
+		{"no city nearby", 0, 0, "0.0000, 0.0000", ""},
+		{"just outside the radius", 48.7758, 9.60, "48.7758, 9.6000", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, country, err := geocoder.ReverseGeocode(tt.lat, tt.lon)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if name != tt.wantName || country != tt.wantCountry {
+				t.Errorf("Expected %q/%q, got %q/%q", tt.wantName, tt.wantCountry, name, country)
+			}
+		})
+	}
+
+	t.Run("coordinates out of range", func(t *testing.T) {
+		if _, _, err := geocoder.ReverseGeocode(95, 0); err == nil {
+			t.Error("Expected an error for latitude 95")
+		}
+	})
+}
+
+func TestGeocoder_SetCache_ClosesDefaultCache(t *testing.T) {
+	const geocoders = 50
+	shared := cache.NewMemoryCache(0)
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < geocoders; i++ {
+		NewGeocoder(testutils.NewMockHTTPClient()).SetCache(shared)
+	}
+
+	// Closed cleanup loops exit asynchronously
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine()-before >= geocoders/2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if leaked := runtime.NumGoroutine() - before; leaked >= geocoders/2 {
+		t.Errorf("Expected the replaced default caches to stop, %d goroutines remain", leaked)
+	}
+}
+
+func TestNearestCachedCity(t *testing.T) {
+	tests := []struct {
+		name        string
+		lat, lon    float64
+		wantName    string
+		wantCountry string
+		minKm       float64
+		maxKm       float64
+	}{
+		{"exact static city", 48.7758, 9.1829, "Stuttgart", "Germany", 0, 0.001},
+		{"south west of Stuttgart", 48, 9, "Stuttgart", "Germany", 80, 95},
+		{"Manhattan", 40.7306, -73.9866, "New York", "United States", 1, 5},
+		{"New Jersey", 40.2, -74.7, "New York", "United States", 70, 90},
+		{"far from every city", -33.8688, 151.2093, "", "", 10000, 20000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, country, km := NearestCachedCity(tt.lat, tt.lon)
+			if tt.wantName != "" && (name != tt.wantName || country != tt.wantCountry) {
+				t.Errorf("Expected %q/%q, got %q/%q", tt.wantName, tt.wantCountry, name, country)
+			}
+			if name == "" {
+				t.Error("Expected a city even far from every entry")
+			}
+			if km < tt.minKm || km > tt.maxKm {
+				t.Errorf("Expected a distance between %.0f and %.0f km, got %.1f", tt.minKm, tt.maxKm, km)
+			}
+		})
+	}
+}
+
+func TestSanitizeCityName(t *testing.T) {
+	tests := []struct {
+		city string
+		want string
+	}{
+		{"Stuttgart", "Stuttgart"},
+		{"  New   York ", "New York"},
+		{"São\tPaulo\n", "São Paulo"},
+		{"Washington, D.C.", "Washington, D.C."},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := sanitizeCityName(tt.city); got != tt.want {
+			t.Errorf("sanitizeCityName(%q) = %q, want %q", tt.city, got, tt.want)
+		}
+	}
+}
+
+func TestGeocoder_SanitizedRequestURL(t *testing.T) {
+	const base = "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name="
+
+	tests := []struct {
+		name          string
+		city          string
+		transliterate bool
+		wantURL       string
+		wantName      string
+	}{
+		{"accents are percent-encoded", " São  Paulo ", false, base + "S%C3%A3o+Paulo", "São Paulo"},
+		{"accents are transliterated", "São Paulo", true, base + "Sao+Paulo", "Sao Paulo"},
+		{"internal punctuation", "Washington,  D.C.", false, base + "Washington%2C+D.C.", "Washington, D.C."},
+		{"apostrophes and ampersands", "Côte d'Ivoire & Co", true, base + "Cote+d%27Ivoire+%26+Co", "Cote d'Ivoire & Co"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse(tt.wantURL, 200, testutils.OpenMeteoGeocodeResponse)
+			geocoder := NewGeocoder(mockClient)
+			geocoder.SetTransliterate(tt.transliterate)
+
+			if _, err := geocoder.GetLocation(tt.city); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if calls := mockClient.GetCallCount(tt.wantURL); calls != 1 {
+				t.Errorf("Expected 1 request to %s, got %d", tt.wantURL, calls)
+			}
+
+			parsed, err := url.Parse(tt.wantURL)
+			if err != nil {
+				t.Fatalf("Request URL is malformed: %v", err)
+			}
+			if got := parsed.Query().Get("name"); got != tt.wantName {
+				t.Errorf("Expected the name parameter to decode to %q, got %q", tt.wantName, got)
+			}
+		})
+	}
+}
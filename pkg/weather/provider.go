@@ -0,0 +1,90 @@
+package weather
+
+import (
+	"context"
+	"errors"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+)
+
+// WeatherProvider is a source of current weather for a city. Providers name
+// themselves in the Metadata.Source of the responses they return.
+type WeatherProvider interface {
+	GetWeather(city string) (*models.WeatherResponse, error)
+}
+
+// timezoneProvider is implemented by providers that can report times in a
+// timezone and stop when the request is canceled, such as Client
+type timezoneProvider interface {
+	GetWeatherInTimezoneCtx(ctx context.Context, location, timezone string) (*models.WeatherResponse, error)
+}
+
+var _ timezoneProvider = (*Client)(nil)
+var _ WeatherProvider = (*Client)(nil)
+
+// WithProviders replaces the Open-Meteo client with providers, tried in order
+// until one returns weather
+func WithProviders(providers ...WeatherProvider) Option {
+	return func(s *Service) {
+		s.providers = append([]WeatherProvider(nil), providers...)
+	}
+}
+
+// WithFallbackProviders adds providers tried in order after the configured
+// ones fail
+func WithFallbackProviders(providers ...WeatherProvider) Option {
+	return func(s *Service) {
+		s.providers = append(s.providers, providers...)
+	}
+}
+
+// providerWeather asks each provider in turn for the weather at location,
+// returning the first response or the last error. A client error, such as an
+// unknown city, is returned at once, as the next provider would reject the
+// request too.
+func (s *Service) providerWeather(ctx context.Context, location, timezone string) (*models.WeatherResponse, error) {
+	if len(s.providers) == 0 {
+		return nil, models.NewAPIError("Weather", "No weather provider configured", 503)
+	}
+
+	var lastErr error
+	for i, provider := range s.providers {
+		weather, err := fetchFrom(ctx, provider, location, timezone)
+		if err == nil {
+			return weather, nil
+		}
+		if ctx.Err() != nil || isClientError(err) {
+			return nil, err
+		}
+		if i < len(s.providers)-1 {
+			logging.Warnf("Weather provider %d failed for %s, trying the next: %v", i+1, location, err)
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// isClientError reports whether err is a 4xx APIError about the request
+// itself. Authentication failures, timeouts, and rate limits concern only the
+// provider that returned them.
+func isClientError(err error) bool {
+	var apiErr *models.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case 401, 403, 408, 429:
+		return false
+	}
+	return apiErr.Code >= 400 && apiErr.Code <= 499
+}
+
+// fetchFrom gets weather from provider, passing ctx and timezone along when
+// the provider supports them
+func fetchFrom(ctx context.Context, provider WeatherProvider, location, timezone string) (*models.WeatherResponse, error) {
+	if p, ok := provider.(timezoneProvider); ok {
+		return p.GetWeatherInTimezoneCtx(ctx, location, timezone)
+	}
+	return provider.GetWeather(location)
+}
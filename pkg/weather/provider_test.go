@@ -0,0 +1,110 @@
+package weather
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JSGette/agent_summit_bazel_workshop/internal/testutils"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+)
+
+// fakeProvider answers every city with its weather or err, counting calls
+type fakeProvider struct {
+	source string
+	err    error
+	calls  int
+}
+
+func (p *fakeProvider) GetWeather(city string) (*models.WeatherResponse, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &models.WeatherResponse{
+		City:        city,
+		Temperature: 12.5,
+		Metadata:    models.ResponseMetadata{Timestamp: time.Now(), Source: p.source},
+	}, nil
+}
+
+func TestService_Providers_Fallback(t *testing.T) {
+	primary := &fakeProvider{source: "Primary", err: models.NewAPIError("Primary", "Service unavailable", 503)}
+	secondary := &fakeProvider{source: "Secondary"}
+	service := NewService(testutils.NewMockHTTPClient(), WithProviders(primary, secondary))
+
+	weather, err := service.GetCurrentWeather("Springfield")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if weather.Metadata.Source != "Secondary" {
+		t.Errorf("Expected source Secondary, got %s", weather.Metadata.Source)
+	}
+	if primary.calls != 1 || secondary.calls != 1 {
+		t.Errorf("Expected one call to each provider, got %d and %d", primary.calls, secondary.calls)
+	}
+}
+
+func TestService_Providers_AllFail(t *testing.T) {
+	lastErr := models.NewAPIError("Secondary", "Service unavailable", 503)
+	service := NewService(testutils.NewMockHTTPClient(), WithProviders(
+		&fakeProvider{err: errors.New("connection refused")},
+		&fakeProvider{err: lastErr},
+	))
+
+	_, err := service.GetCurrentWeather("Springfield")
+	if !errors.Is(err, lastErr) {
+		t.Errorf("Expected the last provider's error, got %v", err)
+	}
+}
+
+func TestService_Providers_ClientError(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantFallback bool
+	}{
+		{"city not found", models.NewAPIError("Primary", "City not found", 404), false},
+		{"bad request", models.NewAPIError("Primary", "Invalid city", 400), false},
+		{"rate limited", models.NewAPIError("Primary", "Too many requests", 429), true},
+		{"unauthorized", models.NewAPIError("Primary", "Invalid API key", 401), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &fakeProvider{source: "Primary", err: tt.err}
+			secondary := &fakeProvider{source: "Secondary"}
+			service := NewService(testutils.NewMockHTTPClient(), WithProviders(primary, secondary))
+
+			_, err := service.GetCurrentWeather("Springfield")
+			if tt.wantFallback {
+				if err != nil || secondary.calls != 1 {
+					t.Errorf("Expected the secondary provider to answer, got %d calls and %v", secondary.calls, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected the primary provider's error, got %v", err)
+			}
+			if secondary.calls != 0 {
+				t.Errorf("Expected no call to the secondary provider, got %d", secondary.calls)
+			}
+		})
+	}
+}
+
+func TestService_FallbackProviders(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+	mockClient.AddResponse(weatherURL, 500, testutils.APIErrorResponse)
+	fallback := &fakeProvider{source: "Fallback"}
+	service := NewService(mockClient, WithFallbackProviders(fallback))
+
+	weather, err := service.GetCurrentWeather("Stuttgart")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if weather.Metadata.Source != "Fallback" {
+		t.Errorf("Expected source Fallback, got %s", weather.Metadata.Source)
+	}
+}
@@ -0,0 +1,44 @@
+package weather
+
+import "strings"
+
+// sanitizeCityName trims a city name and collapses runs of whitespace,
+// including tabs and newlines, into single spaces. Punctuation and non-ASCII
+// letters are kept as they are; url.Values encodes them when the geocoding
+// URL is built.
+func sanitizeCityName(city string) string {
+	return strings.Join(strings.Fields(city), " ")
+}
+
+// transliterate replaces accented Latin letters with their unaccented ASCII
+// spelling, e.g. "São Paulo" becomes "Sao Paulo". Other characters are kept.
+func transliterate(city string) string {
+	return accentReplacer.Replace(city)
+}
+
+// accentReplacer maps the accented Latin letters common in city names to ASCII
+var accentReplacer = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "ą", "a", "ă", "a",
+	"À", "A", "Á", "A", "Â", "A", "Ã", "A", "Ä", "A", "Å", "A", "Ą", "A", "Ă", "A",
+	"æ", "ae", "Æ", "AE",
+	"ç", "c", "ć", "c", "č", "c", "Ç", "C", "Ć", "C", "Č", "C",
+	"ď", "d", "đ", "d", "Ď", "D", "Đ", "D",
+	"è", "e", "é", "e", "ê", "e", "ë", "e", "ę", "e", "ě", "e",
+	"È", "E", "É", "E", "Ê", "E", "Ë", "E", "Ę", "E", "Ě", "E",
+	"ğ", "g", "Ğ", "G",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ı", "i",
+	"Ì", "I", "Í", "I", "Î", "I", "Ï", "I", "İ", "I",
+	"ł", "l", "Ł", "L",
+	"ñ", "n", "ń", "n", "ň", "n", "Ñ", "N", "Ń", "N", "Ň", "N",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "ő", "o",
+	"Ò", "O", "Ó", "O", "Ô", "O", "Õ", "O", "Ö", "O", "Ø", "O", "Ő", "O",
+	"œ", "oe", "Œ", "OE",
+	"ř", "r", "Ř", "R",
+	"ś", "s", "š", "s", "ş", "s", "ș", "s", "ß", "ss",
+	"Ś", "S", "Š", "S", "Ş", "S", "Ș", "S",
+	"ť", "t", "ţ", "t", "ț", "t", "Ť", "T", "Ţ", "T", "Ț", "T",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "ů", "u", "ű", "u",
+	"Ù", "U", "Ú", "U", "Û", "U", "Ü", "U", "Ů", "U", "Ű", "U",
+	"ý", "y", "ÿ", "y", "Ý", "Y",
+	"ź", "z", "ż", "z", "ž", "z", "Ź", "Z", "Ż", "Z", "Ž", "Z",
+)
@@ -1,46 +1,278 @@
 package weather
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/cache"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/coalesce"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/health"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/limiter"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/logging"
 	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/tracing"
 )
 
+// DefaultMaxConcurrency is the default limit on concurrent upstream requests
+const DefaultMaxConcurrency = 8
+
+// UpstreamName identifies the weather upstream in health reporting
+const UpstreamName = "open_meteo"
+
+// DefaultCacheTTL is how long weather responses are served from cache;
+// Open-Meteo refreshes current conditions every 15 minutes
+const DefaultCacheTTL = 5 * time.Minute
+
+// DefaultStaleThreshold is the observation age past which weather is flagged
+// as stale; Open-Meteo normally reports conditions less than 15 minutes old
+const DefaultStaleThreshold = time.Hour
+
 // Service provides high-level weather operations with caching and logging
 type Service struct {
-	client *Client
+	client   *Client
+	health   *health.Tracker
+	cache    cache.Cache
+	cacheTTL time.Duration
+
+	// providers are asked for current weather in order; by default only client
+	providers []WeatherProvider
+
+	staleThreshold time.Duration
+
+	// upstream bounds concurrent upstream requests; nil means unlimited
+	upstream *limiter.Limiter
+
+	// inFlight coalesces concurrent fetches of the same location
+	inFlight coalesce.Group[*models.WeatherResponse]
+
+	// maintenance serves only cached and demo data, never calling the upstream
+	maintenance bool
+}
+
+// Option configures optional service behavior
+type Option func(*Service)
+
+// WithHealthTracker records upstream successes and failures in the given tracker
+func WithHealthTracker(tracker *health.Tracker) Option {
+	return func(s *Service) {
+		s.health = tracker
+	}
+}
+
+// WithCache serves repeated requests for the same location from c for ttl
+func WithCache(c cache.Cache, ttl time.Duration) Option {
+	return func(s *Service) {
+		s.cache = c
+		s.cacheTTL = ttl
+	}
+}
+
+// WithStaleThreshold flags responses observed longer ago than threshold as
+// stale; zero disables the check
+func WithStaleThreshold(threshold time.Duration) Option {
+	return func(s *Service) {
+		s.staleThreshold = threshold
+	}
+}
+
+// WithMaxConcurrency limits the number of upstream requests in flight at
+// once; further requests wait for a free slot. Zero or less removes the limit.
+func WithMaxConcurrency(n int) Option {
+	return func(s *Service) {
+		s.upstream = limiter.New(n)
+	}
+}
+
+// WithGeocodeCache stores cities resolved through the geocoding API in c
+func WithGeocodeCache(c cache.Cache) Option {
+	return func(s *Service) {
+		s.client.geocoder.SetCache(c)
+	}
+}
+
+// WithClientOptions applies client options, such as custom base URLs, to the
+// service's upstream client
+func WithClientOptions(opts ...ClientOption) Option {
+	return func(s *Service) {
+		for _, opt := range opts {
+			opt(s.client)
+		}
+	}
+}
+
+// WithMaintenance puts the service in maintenance mode: weather is served
+// from the cache or demo data only and no upstream request is made. Requests
+// that cannot be answered that way fail with a 503.
+func WithMaintenance(enabled bool) Option {
+	return func(s *Service) {
+		s.maintenance = enabled
+	}
+}
+
+// WithTracer records a span for every upstream request
+func WithTracer(t tracing.Tracer) Option {
+	return func(s *Service) {
+		s.client.SetTracer(t)
+	}
 }
 
 // NewService creates a new weather service
-func NewService(httpClient HTTPClient) *Service {
-	return &Service{
-		client: NewClient(httpClient),
+func NewService(httpClient HTTPClient, opts ...Option) *Service {
+	service := &Service{
+		client:         NewClient(httpClient),
+		staleThreshold: DefaultStaleThreshold,
+	}
+	service.providers = []WeatherProvider{service.client}
+	WithMaxConcurrency(DefaultMaxConcurrency)(service)
+
+	for _, opt := range opts {
+		opt(service)
 	}
+
+	return service
 }
 
 // GetCurrentWeather fetches current weather for a location with enhanced error handling
 func (s *Service) GetCurrentWeather(location string) (*models.WeatherResponse, error) {
+	return s.GetCurrentWeatherCtx(context.Background(), location)
+}
+
+// GetCurrentWeatherCtx fetches current weather for a location, canceling the
+// upstream requests when ctx is done
+func (s *Service) GetCurrentWeatherCtx(ctx context.Context, location string) (*models.WeatherResponse, error) {
+	return s.currentWeather(ctx, location, DefaultTimezone)
+}
+
+// currentWeather fetches current weather for a location with times in
+// timezone, serving it from and storing it in the cache
+func (s *Service) currentWeather(ctx context.Context, location, timezone string) (*models.WeatherResponse, error) {
 	start := time.Now()
 
-	log.Printf("Fetching weather for location: %s", location)
+	cacheKey := strings.ToLower(strings.TrimSpace(location))
+	if timezone != DefaultTimezone {
+		cacheKey += "|" + timezone
+	}
+	if cached, found := s.cachedWeather(cacheKey); found {
+		logging.Debugf("Serving cached weather for location: %s", location)
+		s.checkFreshness(cached)
+		return cached, nil
+	}
 
-	weather, err := s.client.GetWeather(location)
+	if s.maintenance {
+		return maintenanceWeather(location, timezone)
+	}
+
+	// Concurrent requests for the same location share one upstream fetch
+	shared, err := s.inFlight.Do(ctx, cacheKey, func(ctx context.Context) (*models.WeatherResponse, error) {
+		return s.fetchWeather(ctx, location, timezone, cacheKey)
+	})
 	if err != nil {
-		log.Printf("Error fetching weather for %s: %v", location, err)
 		return nil, err
 	}
 
-	duration := time.Since(start)
-	log.Printf("Successfully fetched weather for %s in %v", location, duration)
+	weather := *shared
+	logging.Infof("Weather request for %s completed in %v", location, time.Since(start))
+
+	s.checkFreshness(&weather)
+	return &weather, nil
+}
+
+// fetchWeather requests current weather from the upstream and caches it,
+// falling back to demo data when the upstream is unusable
+func (s *Service) fetchWeather(ctx context.Context, location, timezone, cacheKey string) (*models.WeatherResponse, error) {
+	logging.Debugf("Fetching weather for location: %s", location)
+
+	if err := s.upstream.Acquire(ctx); err != nil {
+		logging.Warnf("Weather request for %s canceled while waiting for an upstream slot: %v", location, err)
+		return nil, err
+	}
+	weather, err := s.providerWeather(ctx, location, timezone)
+	s.upstream.Release()
+	if err != nil {
+		if ctx.Err() != nil {
+			// The caller gave up; this says nothing about the upstream
+			logging.Warnf("Weather request for %s canceled: %v", location, ctx.Err())
+			return nil, err
+		}
+		logging.Errorf("Error fetching weather for %s: %v", location, err)
+		s.recordUpstreamFailure(err)
+
+		// Rate limiting (429) and server errors (5xx) fall back to demo mode
+		if isUpstreamFailure(err) {
+			logging.Warnf("Upstream error (%v), falling back to demo mode for %s", err, location)
+			demoWeather, demoErr := demoWeatherIn(location, timezone)
+			if demoErr != nil {
+				logging.Errorf("Demo mode also failed for %s: %v", location, demoErr)
+				return nil, err
+			}
+			logging.Infof("Successfully returned demo data for %s", location)
+			return demoWeather, nil
+		}
+
+		return nil, err
+	}
+	s.health.RecordSuccess(UpstreamName)
+
+	s.storeWeather(cacheKey, weather)
 
 	return weather, nil
 }
 
+// demoWeatherIn returns demo weather for location with its timestamp in timezone
+func demoWeatherIn(location, timezone string) (*models.WeatherResponse, error) {
+	demoWeather, err := GetDemoWeather(location)
+	if err != nil {
+		return nil, err
+	}
+	if zone, zoneErr := time.LoadLocation(timezone); zoneErr == nil {
+		demoWeather.Metadata.Timestamp = demoWeather.Metadata.Timestamp.In(zone)
+	}
+	return demoWeather, nil
+}
+
+// maintenanceWeather answers a request that missed the cache in maintenance
+// mode with demo data, or a 503 for cities without any
+func maintenanceWeather(location, timezone string) (*models.WeatherResponse, error) {
+	demoWeather, err := demoWeatherIn(location, timezone)
+	if err != nil {
+		logging.Debugf("No demo weather for %s in maintenance mode: %v", location, err)
+		return nil, errMaintenance()
+	}
+	demoWeather.Metadata.Source = MaintenanceDemoSource
+	return demoWeather, nil
+}
+
+// errMaintenance is returned for requests that need the upstream while the
+// service is in maintenance mode
+func errMaintenance() error {
+	return models.NewAPIError("Weather", "Live weather data is unavailable in maintenance mode", 503)
+}
+
+// checkFreshness flags weather older than the stale threshold and logs it
+func (s *Service) checkFreshness(weather *models.WeatherResponse) {
+	if s.staleThreshold <= 0 {
+		return
+	}
+
+	age := weather.Age()
+	weather.Stale = age > s.staleThreshold
+	if weather.Stale {
+		logging.Warnf("Weather for %s is stale: observed %v ago (threshold %v)", weather.City, age.Round(time.Minute), s.staleThreshold)
+	}
+}
+
 // GetWeatherSummary returns a human-readable weather summary
 func (s *Service) GetWeatherSummary(location string) (string, error) {
-	weather, err := s.GetCurrentWeather(location)
+	return s.GetWeatherSummaryCtx(context.Background(), location)
+}
+
+// GetWeatherSummaryCtx returns a human-readable weather summary, canceling
+// the upstream requests when ctx is done
+func (s *Service) GetWeatherSummaryCtx(ctx context.Context, location string) (string, error) {
+	weather, err := s.GetCurrentWeatherCtx(ctx, location)
 	if err != nil {
 		return "", err
 	}
@@ -50,19 +282,81 @@ func (s *Service) GetWeatherSummary(location string) (string, error) {
 		timeOfDay = "during the night"
 	}
 
+	feelsLike := ""
+	if weather.FeelsNotable() {
+		feelsLike = fmt.Sprintf(" (feels like %.1f°C)", *weather.ApparentTemperature)
+	}
+
+	// Like the detailed summary, leave the UV risk out when there is none,
+	// e.g. at night
+	uvRisk := ""
+	if weather.UVIndex > 0 {
+		uvRisk = fmt.Sprintf(" UV risk: %s.", weather.UVRiskLevel())
+	}
+
 	summary := fmt.Sprintf(
-		"Current weather in %s, %s: %.1f°C, %s %s. Last updated: %s",
+		"Current weather in %s, %s: %.1f°C%s, %s %s.%s Last updated: %s",
 		weather.City,
 		weather.Country,
 		weather.Temperature,
+		feelsLike,
 		weather.Description,
 		timeOfDay,
+		uvRisk,
 		weather.Metadata.Timestamp.Format("15:04 MST"),
 	)
 
 	return summary, nil
 }
 
+// GetDetailedSummary returns a multi-line weather summary with one line per
+// available metric
+func (s *Service) GetDetailedSummary(city string) (string, error) {
+	return s.GetDetailedSummaryCtx(context.Background(), city)
+}
+
+// GetDetailedSummaryCtx returns a multi-line weather summary, canceling the
+// upstream requests when ctx is done. Metrics that are unavailable, such as
+// the UV index at night, are left out.
+func (s *Service) GetDetailedSummaryCtx(ctx context.Context, city string) (string, error) {
+	weather, err := s.GetCurrentWeatherCtx(ctx, city)
+	if err != nil {
+		return "", err
+	}
+
+	place := weather.City
+	if weather.Country != "" {
+		place += ", " + weather.Country
+	}
+	timeOfDay := "day"
+	if !weather.IsDay {
+		timeOfDay = "night"
+	}
+
+	lines := []string{
+		"Weather in " + place,
+		fmt.Sprintf("Temperature: %.1f°C", weather.Temperature),
+	}
+	if weather.ApparentTemperature != nil {
+		lines = append(lines, fmt.Sprintf("Feels like: %.1f°C", *weather.ApparentTemperature))
+	}
+	lines = append(lines, fmt.Sprintf("Conditions: %s (%s)", weather.Description, timeOfDay))
+	if weather.UVIndex > 0 {
+		lines = append(lines, fmt.Sprintf("UV index: %.1f (%s)", weather.UVIndex, weather.UVRiskLevel()))
+	}
+	if weather.Coordinates != (models.Coordinates{}) {
+		lines = append(lines, fmt.Sprintf("Coordinates: %.4f, %.4f", weather.Coordinates.Latitude, weather.Coordinates.Longitude))
+	}
+	if !weather.Metadata.Timestamp.IsZero() {
+		lines = append(lines, "Last updated: "+weather.Metadata.Timestamp.Format("15:04 MST"))
+	}
+	if weather.Stale {
+		lines = append(lines, "Note: this observation is older than usual")
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
 // ValidateLocation checks if a location string is valid
 func (s *Service) ValidateLocation(location string) error {
 	if location == "" {
@@ -82,9 +376,205 @@ func (s *Service) ValidateLocation(location string) error {
 
 // GetWeatherWithValidation fetches weather with input validation
 func (s *Service) GetWeatherWithValidation(location string) (*models.WeatherResponse, error) {
+	return s.GetWeatherWithValidationCtx(context.Background(), location)
+}
+
+// GetWeatherWithValidationCtx fetches weather with input validation,
+// canceling the upstream requests when ctx is done
+func (s *Service) GetWeatherWithValidationCtx(ctx context.Context, location string) (*models.WeatherResponse, error) {
+	if err := s.ValidateLocation(location); err != nil {
+		return nil, err
+	}
+
+	return s.GetCurrentWeatherCtx(ctx, location)
+}
+
+// GetWeatherInTimezoneCtx is GetWeatherWithValidationCtx with times reported
+// in timezone, either "auto" or an IANA name such as "UTC". An unknown
+// timezone is a 400 error.
+func (s *Service) GetWeatherInTimezoneCtx(ctx context.Context, location, timezone string) (*models.WeatherResponse, error) {
+	if err := s.ValidateLocation(location); err != nil {
+		return nil, err
+	}
+	if err := ValidateTimezone(timezone); err != nil {
+		return nil, err
+	}
+	if timezone == "" {
+		timezone = DefaultTimezone
+	}
+
+	return s.currentWeather(ctx, location, timezone)
+}
+
+// GetWeatherByCoordinates fetches current weather for a point given by
+// latitude and longitude
+func (s *Service) GetWeatherByCoordinates(lat, lon float64) (*models.WeatherResponse, error) {
+	return s.GetWeatherByCoordinatesCtx(context.Background(), lat, lon)
+}
+
+// GetWeatherByCoordinatesCtx fetches current weather for a point, canceling
+// the upstream request when ctx is done. Coordinates out of range are a 400
+// error. The response is labeled by ReverseGeocode, either after a nearby
+// known city or with the coordinates themselves. There is no demo fallback
+// since demo data only exists for known cities.
+func (s *Service) GetWeatherByCoordinatesCtx(ctx context.Context, lat, lon float64) (*models.WeatherResponse, error) {
+	if err := ValidateCoordinates(lat, lon); err != nil {
+		return nil, err
+	}
+
+	// Open-Meteo is queried with four decimals, so nearby points share a key
+	cacheKey := fmt.Sprintf("coords:%.4f,%.4f", lat, lon)
+	if cached, found := s.cachedWeather(cacheKey); found {
+		logging.Debugf("Serving cached weather for coordinates %.4f,%.4f", lat, lon)
+		s.checkFreshness(cached)
+		return cached, nil
+	}
+
+	if s.maintenance {
+		return nil, errMaintenance()
+	}
+
+	shared, err := s.inFlight.Do(ctx, cacheKey, func(ctx context.Context) (*models.WeatherResponse, error) {
+		if err := s.upstream.Acquire(ctx); err != nil {
+			return nil, err
+		}
+		// Coordinates were validated above, so labeling cannot fail
+		name, country, _ := s.client.geocoder.ReverseGeocode(lat, lon)
+		weather, err := s.client.GetWeatherByCoordinatesCtx(ctx, lat, lon, name, country)
+		s.upstream.Release()
+		if err != nil {
+			if ctx.Err() == nil {
+				logging.Errorf("Error fetching weather for coordinates %.4f,%.4f: %v", lat, lon, err)
+				s.recordUpstreamFailure(err)
+			}
+			return nil, err
+		}
+		s.health.RecordSuccess(UpstreamName)
+
+		s.storeWeather(cacheKey, weather)
+		return weather, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	weather := *shared
+	s.checkFreshness(&weather)
+	return &weather, nil
+}
+
+// GetRawWeatherCtx validates the location and returns the untransformed
+// upstream payload for it, bypassing the cache. It is meant for debugging
+// the mapping to WeatherResponse.
+func (s *Service) GetRawWeatherCtx(ctx context.Context, location string) (*RawWeather, error) {
 	if err := s.ValidateLocation(location); err != nil {
 		return nil, err
 	}
 
-	return s.GetCurrentWeather(location)
+	if s.maintenance {
+		return nil, errMaintenance()
+	}
+
+	logging.Debugf("Fetching raw weather for location: %s", location)
+
+	if err := s.upstream.Acquire(ctx); err != nil {
+		return nil, err
+	}
+	raw, err := s.client.GetRawWeatherCtx(ctx, location)
+	s.upstream.Release()
+	if err != nil {
+		if ctx.Err() != nil {
+			logging.Warnf("Raw weather request for %s canceled: %v", location, ctx.Err())
+			return nil, err
+		}
+		logging.Errorf("Error fetching raw weather for %s: %v", location, err)
+		s.recordUpstreamFailure(err)
+		return nil, err
+	}
+	s.health.RecordSuccess(UpstreamName)
+
+	return raw, nil
+}
+
+// ListCachedCities returns every city that resolves without a geocoding
+// request: the static table plus cities cached at runtime, sorted by name
+func (s *Service) ListCachedCities() []models.CityInfo {
+	return s.client.geocoder.CachedCities()
+}
+
+// Cache names reported by CacheStats
+const (
+	WeatherCacheName = "weather"
+	GeocodeCacheName = "geocode"
+)
+
+// CacheStats returns the statistics of the weather and geocoding caches,
+// keyed by WeatherCacheName and GeocodeCacheName. Caches that do not count
+// their lookups are left out.
+func (s *Service) CacheStats() map[string]cache.Stats {
+	stats := make(map[string]cache.Stats, 2)
+	if reporter, ok := s.cache.(cache.StatsReporter); ok {
+		stats[WeatherCacheName] = reporter.Stats()
+	}
+	if geocode, ok := s.client.geocoder.CacheStats(); ok {
+		stats[GeocodeCacheName] = geocode
+	}
+	return stats
+}
+
+// pingCity is geocoded through the API by Ping
+const pingCity = "Stuttgart"
+
+// Ping checks that Open-Meteo answers by geocoding a well-known city through
+// the API, bypassing the static table and the caches
+func (s *Service) Ping(ctx context.Context) error {
+	if s.maintenance {
+		return errMaintenance()
+	}
+	if err := s.upstream.Acquire(ctx); err != nil {
+		return err
+	}
+	defer s.upstream.Release()
+
+	_, _, err := s.client.geocoder.GetCoordinatesCtx(ctx, pingCity)
+	return err
+}
+
+// cachedWeather returns a copy of the cached response for key, if any
+func (s *Service) cachedWeather(key string) (*models.WeatherResponse, bool) {
+	if s.cache == nil {
+		return nil, false
+	}
+
+	var weather models.WeatherResponse
+	if !cache.Load(s.cache, key, &weather) {
+		return nil, false
+	}
+	return &weather, true
+}
+
+// storeWeather caches a copy of weather under key, stamped with the time it
+// was cached so later hits can report their age
+func (s *Service) storeWeather(key string, weather *models.WeatherResponse) {
+	if s.cache == nil {
+		return
+	}
+
+	cached := *weather
+	cachedAt := time.Now()
+	cached.Metadata.CachedAt = &cachedAt
+	s.cache.Set(key, cached, s.cacheTTL)
+}
+
+// recordUpstreamFailure marks the upstream as failing unless the error was caused by the caller
+func (s *Service) recordUpstreamFailure(err error) {
+	if isUpstreamFailure(err) {
+		s.health.RecordFailure(UpstreamName)
+	}
+}
+
+// isUpstreamFailure reports whether an error means Open-Meteo is unusable
+// (rate limited or failing) rather than the request being invalid
+func isUpstreamFailure(err error) bool {
+	return errors.Is(err, models.ErrRateLimited) || errors.Is(err, models.ErrUpstreamUnavailable)
 }
@@ -1,10 +1,17 @@
 package weather
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/JSGette/agent_summit_bazel_workshop/internal/testutils"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/cache"
+	"github.com/JSGette/agent_summit_bazel_workshop/pkg/models"
 )
 
 func TestService_GetCurrentWeather(t *testing.T) {
@@ -39,7 +46,7 @@ func TestService_GetCurrentWeather(t *testing.T) {
 				geocodeURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=" + tt.location
 				mockClient.AddResponse(geocodeURL, 200, testutils.OpenMeteoGeocodeResponse)
 
-				weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day&latitude=48.7758&longitude=9.1829&timezone=auto"
+				weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
 				mockClient.AddResponse(weatherURL, tt.mockStatusCode, tt.mockResponse)
 			}
 
@@ -72,7 +79,7 @@ func TestService_GetWeatherSummary(t *testing.T) {
 	geocodeURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=Stuttgart"
 	mockClient.AddResponse(geocodeURL, 200, testutils.OpenMeteoGeocodeResponse)
 
-	weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day&latitude=48.7758&longitude=9.1829&timezone=auto"
+	weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
 	mockClient.AddResponse(weatherURL, 200, testutils.OpenMeteoWeatherResponse)
 
 	summary, err := service.GetWeatherSummary("Stuttgart")
@@ -82,7 +89,7 @@ func TestService_GetWeatherSummary(t *testing.T) {
 		return
 	}
 
-	expectedParts := []string{"Stuttgart", "Germany", "22.5°C", "Overcast"}
+	expectedParts := []string{"Stuttgart", "Germany", "22.5°C", "Overcast", "UV risk: Moderate"}
 	for _, part := range expectedParts {
 		if !strings.Contains(summary, part) {
 			t.Errorf("Expected summary to contain '%s', got: %s", part, summary)
@@ -90,6 +97,163 @@ func TestService_GetWeatherSummary(t *testing.T) {
 	}
 }
 
+func TestService_GetWeatherSummary_NoUV(t *testing.T) {
+	geocodeURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=Stuttgart"
+	weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(geocodeURL, 200, testutils.OpenMeteoGeocodeResponse)
+	mockClient.AddResponse(weatherURL, 200, `{"current": {"time": "2024-01-15T23:00", "temperature_2m": 8.5, "weather_code": 0, "is_day": 0, "uv_index": 0}}`)
+	service := NewService(mockClient)
+
+	summary, err := service.GetWeatherSummary("Stuttgart")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(summary, "UV") {
+		t.Errorf("Expected no UV risk for a UV index of 0, got: %s", summary)
+	}
+	if !strings.Contains(summary, "during the night. Last updated:") {
+		t.Errorf("Expected the summary to go on with the update time, got: %s", summary)
+	}
+}
+
+func TestService_GetWeatherSummary_FeelsLike(t *testing.T) {
+	geocodeURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=Stuttgart"
+	weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+
+	tests := []struct {
+		name        string
+		body        string
+		wantFeels   bool
+		wantSummary string
+	}{
+		{"differs by more than a degree", testutils.OpenMeteoWeatherFeelsColder, true, "22.5°C (feels like 18.3°C), Overcast"},
+		{"close to the actual temperature", `{"current": {"time": "2024-01-15T14:00", "temperature_2m": 22.5, "apparent_temperature": 22.0, "weather_code": 3, "is_day": 1}}`, false, "22.5°C, Overcast"},
+		{"not reported", testutils.OpenMeteoWeatherResponse, false, "22.5°C, Overcast"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse(geocodeURL, 200, testutils.OpenMeteoGeocodeResponse)
+			mockClient.AddResponse(weatherURL, 200, tt.body)
+			service := NewService(mockClient)
+
+			summary, err := service.GetWeatherSummary("Stuttgart")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !strings.Contains(summary, tt.wantSummary) {
+				t.Errorf("Expected summary to contain %q, got: %s", tt.wantSummary, summary)
+			}
+			if got := strings.Contains(summary, "feels like"); got != tt.wantFeels {
+				t.Errorf("Expected feels like shown = %v, got: %s", tt.wantFeels, summary)
+			}
+		})
+	}
+}
+
+func TestService_GetDetailedSummary(t *testing.T) {
+	geocodeURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=Stuttgart"
+	weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+	nightResponse := `{"current": {"time": "2024-01-15T23:00", "temperature_2m": 8.0, "weather_code": 0, "is_day": 0, "uv_index": 0}}`
+
+	tests := []struct {
+		name        string
+		body        string
+		wantLines   []string
+		wantMissing []string
+	}{
+		{
+			name: "all metrics",
+			body: testutils.OpenMeteoWeatherFeelsColder,
+			wantLines: []string{
+				"Weather in Stuttgart, Germany",
+				"Temperature: 22.5°C",
+				"Feels like: 18.3°C",
+				"Conditions: Overcast (day)",
+				"UV index: 4.2 (Moderate)",
+				"Coordinates: 48.7758, 9.1829",
+				"Last updated: ",
+			},
+		},
+		{
+			name: "UV index omitted at night",
+			body: nightResponse,
+			wantLines: []string{
+				"Temperature: 8.0°C",
+				"Conditions: Clear sky (night)",
+			},
+			wantMissing: []string{"UV index", "Feels like"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse(geocodeURL, 200, testutils.OpenMeteoGeocodeResponse)
+			mockClient.AddResponse(weatherURL, 200, tt.body)
+			service := NewService(mockClient)
+
+			detail, err := service.GetDetailedSummary("Stuttgart")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			lines := strings.Split(detail, "\n")
+			for _, want := range tt.wantLines {
+				found := false
+				for _, line := range lines {
+					if strings.HasPrefix(line, want) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Errorf("Expected a line starting with %q, got:\n%s", want, detail)
+				}
+			}
+			for _, missing := range tt.wantMissing {
+				if strings.Contains(detail, missing) {
+					t.Errorf("Expected %q to be omitted, got:\n%s", missing, detail)
+				}
+			}
+		})
+	}
+}
+
+func TestService_GetCurrentWeather_Cache(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	responseCache := cache.NewMemoryCache(0)
+	defer responseCache.Close()
+	service := NewService(mockClient, WithCache(responseCache, time.Minute))
+
+	weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+	mockClient.AddResponse(weatherURL, 200, testutils.OpenMeteoWeatherResponse)
+
+	first, err := service.GetCurrentWeather("Stuttgart")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Mutating a returned response must not affect the cached copy
+	first.Temperature = -100
+
+	second, err := service.GetCurrentWeather(" stuttgart ")
+	if err != nil {
+		t.Fatalf("Unexpected error on cached request: %v", err)
+	}
+
+	if second.Temperature != 22.5 {
+		t.Errorf("Expected cached temperature 22.5, got %v", second.Temperature)
+	}
+
+	if count := mockClient.GetCallCount(weatherURL); count != 1 {
+		t.Errorf("Expected weather API to be called once, got %d", count)
+	}
+}
+
 func TestService_ValidateLocation(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -189,7 +353,7 @@ func TestService_GetWeatherWithValidation(t *testing.T) {
 				geocodeURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=" + tt.location
 				mockClient.AddResponse(geocodeURL, 200, testutils.OpenMeteoGeocodeResponse)
 
-				weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day&latitude=48.7758&longitude=9.1829&timezone=auto"
+				weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
 				mockClient.AddResponse(weatherURL, 200, testutils.OpenMeteoWeatherResponse)
 			}
 
@@ -231,3 +395,277 @@ func TestNewService(t *testing.T) {
 		}
 	})
 }
+
+func TestWeatherResponse_UVRiskLevel(t *testing.T) {
+	tests := []struct {
+		name    string
+		uvIndex float64
+		want    string
+	}{
+		{"zero", 0, "Low"},
+		{"upper low band", 2.9, "Low"},
+		{"moderate", 3, "Moderate"},
+		{"upper moderate band", 5.9, "Moderate"},
+		{"high", 6, "High"},
+		{"very high", 8, "Very High"},
+		{"upper very high band", 10.9, "Very High"},
+		{"extreme", 11, "Extreme"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weather := &models.WeatherResponse{UVIndex: tt.uvIndex}
+			if got := weather.UVRiskLevel(); got != tt.want {
+				t.Errorf("UVRiskLevel() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestService_GetBatchWeatherCtx(t *testing.T) {
+	mockClient := testutils.NewMockHTTPClient()
+	service := NewService(mockClient)
+
+	weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+	mockClient.AddResponse(weatherURL, 200, testutils.OpenMeteoWeatherResponse)
+
+	cities := []string{"Stuttgart", "S", "Stuttgart", "Atlantis", "Stuttgart", "Stuttgart", "Stuttgart"}
+	results := service.GetBatchWeatherCtx(context.Background(), cities, BatchOptions{})
+
+	if len(results) != len(cities) {
+		t.Fatalf("Expected %d results, got %d", len(cities), len(results))
+	}
+
+	for i, result := range results {
+		if result.City != cities[i] {
+			t.Errorf("Result %d: expected city %s, got %s", i, cities[i], result.City)
+		}
+
+		wantError := cities[i] != "Stuttgart"
+		if wantError && (result.Error == "" || result.Weather != nil) {
+			t.Errorf("Result %d (%s): expected an error, got %+v", i, cities[i], result)
+		}
+		if !wantError && (result.Error != "" || result.Weather == nil) {
+			t.Errorf("Result %d (%s): expected weather, got %+v", i, cities[i], result)
+		}
+	}
+}
+
+func TestService_GetBatchWeatherCtx_Options(t *testing.T) {
+	stuttgartURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+	berlinURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=52.5200&longitude=13.4050&timezone=auto"
+
+	t.Run("one worker fetches serially", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(stuttgartURL, 200, testutils.OpenMeteoWeatherResponse)
+		mockClient.AddResponse(berlinURL, 200, testutils.OpenMeteoWeatherResponse)
+		// Berlin is answered last unless Stuttgart waits for it
+		mockClient.AddDelay(berlinURL, 50*time.Millisecond)
+		service := NewService(mockClient)
+
+		results := service.GetBatchWeatherCtx(context.Background(), []string{"Berlin", "Stuttgart"}, BatchOptions{Workers: 1})
+
+		for _, result := range results {
+			if result.Error != "" {
+				t.Errorf("Unexpected error for %s: %s", result.City, result.Error)
+			}
+		}
+		calls := mockClient.GetCalls()
+		if len(calls) != 2 || calls[0] != berlinURL || calls[1] != stuttgartURL {
+			t.Errorf("Expected Berlin to be fetched before Stuttgart, got %v", calls)
+		}
+	})
+
+	t.Run("timeout applies per city", func(t *testing.T) {
+		mockClient := testutils.NewMockHTTPClient()
+		mockClient.AddResponse(stuttgartURL, 200, testutils.OpenMeteoWeatherResponse)
+		mockClient.AddResponse(berlinURL, 200, testutils.OpenMeteoWeatherResponse)
+		mockClient.AddDelay(berlinURL, time.Second)
+		service := NewService(mockClient)
+
+		results := service.GetBatchWeatherCtx(context.Background(), []string{"Berlin", "Stuttgart"},
+			BatchOptions{Workers: 1, Timeout: 20 * time.Millisecond})
+
+		if results[0].Error == "" {
+			t.Errorf("Expected Berlin to time out, got %+v", results[0])
+		}
+		if results[1].Error != "" || results[1].Weather == nil {
+			t.Errorf("Expected weather for Stuttgart, got %+v", results[1])
+		}
+	})
+}
+
+func TestService_GetCurrentWeather_Freshness(t *testing.T) {
+	weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+
+	// Open-Meteo reports local time for the coordinates along with the offset
+	const offset = 2 * 60 * 60
+	local := time.Now().In(time.FixedZone("", offset))
+	observed := func(ago time.Duration) string {
+		return fmt.Sprintf(`{"current": {"time": %q, "temperature_2m": 20, "weather_code": 0, "is_day": 1}, "utc_offset_seconds": %d}`,
+			local.Add(-ago).Format("2006-01-02T15:04"), offset)
+	}
+
+	tests := []struct {
+		name      string
+		body      string
+		threshold time.Duration
+		wantStale bool
+		wantAge   time.Duration
+	}{
+		{name: "fresh", body: observed(10 * time.Minute), threshold: time.Hour, wantAge: 10 * time.Minute},
+		{name: "stale", body: observed(3 * time.Hour), threshold: time.Hour, wantStale: true, wantAge: 3 * time.Hour},
+		{name: "check disabled", body: observed(3 * time.Hour), wantAge: 3 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse(weatherURL, 200, tt.body)
+			service := NewService(mockClient, WithStaleThreshold(tt.threshold))
+
+			weather, err := service.GetCurrentWeather("Stuttgart")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if weather.Stale != tt.wantStale {
+				t.Errorf("Expected stale %v, got %v", tt.wantStale, weather.Stale)
+			}
+			if age := weather.Age(); age < tt.wantAge-time.Minute || age > tt.wantAge+time.Minute {
+				t.Errorf("Expected age around %v, got %v", tt.wantAge, age)
+			}
+		})
+	}
+}
+
+func TestWeatherResponse_Age_UnknownTime(t *testing.T) {
+	weather := &models.WeatherResponse{}
+	if age := weather.Age(); age != 0 {
+		t.Errorf("Expected zero age without a timestamp, got %v", age)
+	}
+}
+
+func TestService_GetCurrentWeather_DemoFallback(t *testing.T) {
+	weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+	atlantisURL := "https://geocoding-api.open-meteo.com/v1/search?count=1&format=json&language=en&name=Atlantis"
+
+	tests := []struct {
+		name       string
+		city       string
+		url        string
+		status     int
+		wantDemo   bool
+		wantErrors bool
+	}{
+		{name: "server error", city: "Stuttgart", url: weatherURL, status: 500, wantDemo: true},
+		{name: "rate limited", city: "Stuttgart", url: weatherURL, status: 429, wantDemo: true},
+		{name: "client error", city: "Stuttgart", url: weatherURL, status: 400, wantErrors: true},
+		{name: "unknown city", city: "Atlantis", url: atlantisURL, status: 503, wantErrors: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockClient := testutils.NewMockHTTPClient()
+			mockClient.AddResponse(tt.url, tt.status, testutils.APIErrorResponse)
+			service := NewService(mockClient)
+
+			weather, err := service.GetCurrentWeather(tt.city)
+
+			if tt.wantErrors {
+				if err == nil {
+					t.Errorf("Expected error, got %+v", weather)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if weather.Metadata.Source != DemoSource {
+				t.Errorf("Expected source %q, got %q", DemoSource, weather.Metadata.Source)
+			}
+			if weather.City != tt.city || weather.Country != "Germany" {
+				t.Errorf("Unexpected demo location: %s, %s", weather.City, weather.Country)
+			}
+			if weather.Temperature < 11 || weather.Temperature > 17 {
+				t.Errorf("Expected a plausible demo temperature, got %v", weather.Temperature)
+			}
+		})
+	}
+}
+
+func TestDemoWeatherData_CoversCityCoordinates(t *testing.T) {
+	for city := range CityCoordinates {
+		if _, err := GetDemoWeather(city); err != nil {
+			t.Errorf("Expected demo weather for %s, got %v", city, err)
+		}
+	}
+}
+
+func TestService_CoalescesConcurrentRequests(t *testing.T) {
+	weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(weatherURL, 200, testutils.OpenMeteoWeatherResponse)
+	mockClient.AddDelay(weatherURL, 100*time.Millisecond)
+	service := NewService(mockClient)
+
+	const callers = 10
+	var wg sync.WaitGroup
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = service.GetCurrentWeather("Stuttgart")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Unexpected error for caller %d: %v", i, err)
+		}
+	}
+	if count := mockClient.GetCallCount(weatherURL); count != 1 {
+		t.Errorf("Expected exactly 1 upstream call, got %d", count)
+	}
+}
+
+func TestService_GetWeatherByCoordinates(t *testing.T) {
+	weatherURL := "https://api.open-meteo.com/v1/forecast?current=temperature_2m%2Cweather_code%2Cis_day%2Cuv_index%2Capparent_temperature&forecast_days=1&latitude=48.7758&longitude=9.1829&timezone=auto"
+	mockClient := testutils.NewMockHTTPClient()
+	mockClient.AddResponse(weatherURL, 200, testutils.OpenMeteoWeatherResponse)
+	service := NewService(mockClient, WithCache(cache.NewMemoryCache(0), time.Minute))
+
+	for i := 0; i < 2; i++ {
+		weather, err := service.GetWeatherByCoordinates(48.7758, 9.1829)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if weather.City != "Stuttgart" || weather.Temperature != 22.5 {
+			t.Errorf("Expected Stuttgart weather at 22.5°C, got %+v", weather)
+		}
+	}
+	if count := mockClient.GetCallCount(weatherURL); count != 1 {
+		t.Errorf("Expected the second lookup to be cached, got %d upstream calls", count)
+	}
+
+	tests := []struct {
+		lat, lon  float64
+		wantField string
+	}{
+		{-90.1, 0, "Latitude"},
+		{90.1, 0, "Latitude"},
+		{0, -180.1, "Longitude"},
+		{0, 180.1, "Longitude"},
+	}
+	for _, tt := range tests {
+		_, err := service.GetWeatherByCoordinates(tt.lat, tt.lon)
+
+		var apiErr *models.APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != 400 || !strings.Contains(apiErr.Message, tt.wantField) {
+			t.Errorf("Expected a 400 naming %s for %v,%v, got %v", tt.wantField, tt.lat, tt.lon, err)
+		}
+	}
+}